@@ -83,6 +83,15 @@ class EmulatorController {
                 
             case 'error':
                 this.onError(data.error);
+                // Fail the request the error answers, if one is waiting
+                const replies = { start: 'start_complete', stop: 'stop_complete', loadKernel: 'kernel_loaded' };
+                const pending = this.pendingCallbacks.get(replies[data.request]);
+                if (pending) {
+                    const error = new Error(data.error);
+                    error.code = data.code;
+                    pending.reject(error);
+                    this.pendingCallbacks.delete(replies[data.request]);
+                }
                 break;
                 
             case 'init_complete':
@@ -91,6 +100,7 @@ class EmulatorController {
                 
             case 'start_complete':
             case 'stop_complete':
+            case 'kernel_loaded':
                 // These are handled by promises in start()/stop()
                 const callback = this.pendingCallbacks.get(data.type);
                 if (callback) {
@@ -132,6 +142,21 @@ class EmulatorController {
         this.llmHost = llmHost;
     }
     
+    /**
+     * Load the kernel for the next start, given as a URL the worker
+     * fetches or as a Uint8Array or ArrayBuffer
+     */
+    async loadKernel(kernel, options) {
+        return new Promise((resolve, reject) => {
+            this.pendingCallbacks.set('kernel_loaded', { resolve, reject });
+            if (typeof kernel === 'string') {
+                this.worker.postMessage({ type: 'loadKernel', url: kernel, options });
+            } else {
+                this.worker.postMessage({ type: 'loadKernel', kernel, options });
+            }
+        });
+    }
+    
     /**
      * Start the emulator
      */
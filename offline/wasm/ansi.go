@@ -0,0 +1,270 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// maxSequenceLen bounds how much of a single escape sequence the parser
+// buffers, so a guest that never terminates an OSC can't grow it forever.
+const maxSequenceLen = 4096
+
+// Parser states
+const (
+	vtGround = iota
+	vtEscape
+	vtCSI
+	vtOSC
+	vtOSCEscape // saw ESC inside an OSC, expecting '\' to end it
+)
+
+// vtEvent is one structured item of console output.
+type vtEvent struct {
+	Type   string // "text", "bell", "title", "csi", "osc" or "esc"
+	Data   string // text, OSC payload, or ESC final byte
+	Params string // CSI parameter bytes, e.g. "1;2" or "?2004"
+	Final  byte   // CSI final byte
+}
+
+func (e vtEvent) toJS() map[string]interface{} {
+	obj := map[string]interface{}{"type": e.Type}
+	switch e.Type {
+	case "text", "osc", "esc":
+		obj["data"] = e.Data
+	case "title":
+		obj["value"] = e.Data
+	case "csi":
+		obj["params"] = e.Params
+		obj["final"] = string(e.Final)
+	}
+	return obj
+}
+
+// vtParser is a minimal ANSI/VT output parser. It keeps state between Feed
+// calls, so escape sequences and UTF-8 characters split across writes are
+// reassembled. It also tracks terminal modes the guest toggles.
+type vtParser struct {
+	state int
+	text  []byte
+	seq   []byte
+
+	// bytewise decodes text one character per byte, as Latin-1, for
+	// consoles that aren't UTF-8.
+	bytewise bool
+
+	// bracketedPaste is set by DECSET 2004 and read from other goroutines.
+	bracketedPaste atomic.Bool
+
+	// cursor is where the next character would go, kept up to date as
+	// bytes are parsed; screen is what other goroutines read.
+	cursor     vtCursor
+	cols, rows int
+	screen     vtScreen
+}
+
+// Feed parses p and calls emit for each complete event. The cursor
+// published to Cursor includes everything parsed up to each event.
+func (v *vtParser) Feed(p []byte, emit func(vtEvent)) {
+	v.syncSize()
+	report := emit
+	emit = func(e vtEvent) {
+		v.publishCursor()
+		report(e)
+	}
+	defer v.publishCursor()
+
+	for _, b := range p {
+		v.step(b, emit)
+	}
+
+	// Hold back a trailing partial UTF-8 character until the next write
+	keep := 0
+	if !v.bytewise {
+		keep = incompleteTail(v.text)
+	}
+	tail := append([]byte(nil), v.text[len(v.text)-keep:]...)
+	v.text = v.text[:len(v.text)-keep]
+	v.flushText(emit)
+	v.text = append(v.text, tail...)
+}
+
+func (v *vtParser) step(b byte, emit func(vtEvent)) {
+	switch v.state {
+	case vtGround:
+		switch b {
+		case 0x1b:
+			v.flushText(emit)
+			v.state = vtEscape
+		case 0x07:
+			v.flushText(emit)
+			emit(vtEvent{Type: "bell"})
+		default:
+			v.text = append(v.text, b)
+			v.advance(b)
+		}
+
+	case vtEscape:
+		v.seq = v.seq[:0]
+		switch b {
+		case '[':
+			v.state = vtCSI
+		case ']':
+			v.state = vtOSC
+		default:
+			emit(vtEvent{Type: "esc", Data: string(b)})
+			v.state = vtGround
+		}
+
+	case vtCSI:
+		if b >= 0x40 && b <= 0x7e {
+			v.trackMode(b)
+			v.moveCursor(b)
+			emit(vtEvent{Type: "csi", Params: string(v.seq), Final: b})
+			v.state = vtGround
+		} else if len(v.seq) < maxSequenceLen {
+			v.seq = append(v.seq, b)
+		}
+
+	case vtOSC:
+		switch b {
+		case 0x07:
+			v.emitOSC(emit)
+		case 0x1b:
+			v.state = vtOSCEscape
+		default:
+			if len(v.seq) < maxSequenceLen {
+				v.seq = append(v.seq, b)
+			}
+		}
+
+	case vtOSCEscape:
+		if b == '\\' {
+			v.emitOSC(emit)
+		} else {
+			// Not a string terminator; treat the ESC as starting anew
+			v.emitOSC(emit)
+			v.state = vtEscape
+			v.step(b, emit)
+		}
+	}
+}
+
+// trackMode updates private modes set or reset by a CSI ? ... h/l sequence.
+func (v *vtParser) trackMode(final byte) {
+	if (final != 'h' && final != 'l') || len(v.seq) == 0 || v.seq[0] != '?' {
+		return
+	}
+	for _, mode := range strings.Split(string(v.seq[1:]), ";") {
+		switch mode {
+		case "25":
+			v.cursor.hidden = final == 'l'
+		case "2004":
+			v.bracketedPaste.Store(final == 'h')
+		}
+	}
+}
+
+func (v *vtParser) flushText(emit func(vtEvent)) {
+	if len(v.text) > 0 {
+		emit(vtEvent{Type: "text", Data: v.decode(v.text)})
+		v.text = v.text[:0]
+	}
+}
+
+func (v *vtParser) decode(b []byte) string {
+	if v.bytewise {
+		return latin1String(b)
+	}
+	return string(b)
+}
+
+// emitOSC reports a finished OSC. Codes 0 and 2 set the window title.
+func (v *vtParser) emitOSC(emit func(vtEvent)) {
+	v.state = vtGround
+	data := v.decode(v.seq)
+	for _, prefix := range []string{"0;", "2;"} {
+		if len(data) >= len(prefix) && data[:len(prefix)] == prefix {
+			emit(vtEvent{Type: "title", Data: data[len(prefix):]})
+			return
+		}
+	}
+	emit(vtEvent{Type: "osc", Data: data})
+}
+
+// incompleteTail returns how many trailing bytes of b form the start of a
+// UTF-8 character that hasn't been fully received.
+func incompleteTail(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i > len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:]) {
+				return 0
+			}
+			return len(b) - i
+		}
+	}
+	return 0
+}
+
+// ansiStripper removes escape sequences from console output, keeping text
+// and control characters such as newline and bell. Its state carries
+// across calls, so a sequence split between writes is still removed whole.
+type ansiStripper struct {
+	state int
+}
+
+// Strip returns p without escape sequences.
+func (s *ansiStripper) Strip(p []byte) []byte {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		out = s.step(b, out)
+	}
+	return out
+}
+
+func (s *ansiStripper) step(b byte, out []byte) []byte {
+	switch s.state {
+	case vtGround:
+		if b == 0x1b {
+			s.state = vtEscape
+		} else {
+			out = append(out, b)
+		}
+
+	case vtEscape:
+		switch {
+		case b == '[':
+			s.state = vtCSI
+		case b == ']':
+			s.state = vtOSC
+		case b >= 0x20 && b <= 0x2f:
+			// Intermediate byte, as in ESC ( B; the final byte follows
+		default:
+			s.state = vtGround
+		}
+
+	case vtCSI:
+		if b >= 0x40 && b <= 0x7e {
+			s.state = vtGround
+		}
+
+	case vtOSC:
+		switch b {
+		case 0x07:
+			s.state = vtGround
+		case 0x1b:
+			s.state = vtOSCEscape
+		}
+
+	case vtOSCEscape:
+		if b == '\\' {
+			s.state = vtGround
+		} else {
+			s.state = vtEscape
+			out = s.step(b, out)
+		}
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// feedBytewise feeds s to v one byte per Feed call, as a guest writing
+// unbuffered would, and returns every event emitted.
+func feedBytewise(v *vtParser, s string) []vtEvent {
+	var events []vtEvent
+	for i := 0; i < len(s); i++ {
+		v.Feed([]byte{s[i]}, func(e vtEvent) { events = append(events, e) })
+	}
+	return events
+}
+
+func TestTitleSplitAcrossWrites(t *testing.T) {
+	for _, seq := range []string{
+		"\x1b]0;build: ok\x07",   // BEL terminated
+		"\x1b]2;build: ok\x1b\\", // ST terminated
+	} {
+		v := &vtParser{}
+		got := feedBytewise(v, "$ "+seq+"done")
+		want := []vtEvent{
+			{Type: "text", Data: "$"},
+			{Type: "text", Data: " "},
+			{Type: "title", Data: "build: ok"},
+			{Type: "text", Data: "d"},
+			{Type: "text", Data: "o"},
+			{Type: "text", Data: "n"},
+			{Type: "text", Data: "e"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q fed a byte at a time gave\n%+v\nwant\n%+v", seq, got, want)
+		}
+	}
+}
+
+func TestSplitSequencesAndCharacters(t *testing.T) {
+	v := &vtParser{}
+	got := feedBytewise(v, "\x1b[1;31m\x07é😀\x1b]7;file:///tmp\x07\x1bc")
+	want := []vtEvent{
+		{Type: "csi", Params: "1;31", Final: 'm'},
+		{Type: "bell"},
+		{Type: "text", Data: "é"},
+		{Type: "text", Data: "😀"},
+		{Type: "osc", Data: "7;file:///tmp"},
+		{Type: "esc", Data: "c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestEventCallbackBesideText(t *testing.T) {
+	text := newOutputRecorder(t)
+	events := newOutputRecorder(t)
+	w := NewConsoleWriter(text.fn.Value, 0)
+	w.SetEventCallback(events.fn.Value)
+
+	const out = "\x1b]0;shell\x07hi\x07"
+	for i := 0; i < len(out); i++ {
+		w.Write([]byte{out[i]})
+	}
+	w.Flush()
+
+	if got := text.text(); got != out {
+		t.Errorf("text callback got %q, want the output unchanged", got)
+	}
+	var got []string
+	for _, ev := range events.chunks {
+		s := ev.Get("type").String()
+		if v := ev.Get("value"); !v.IsUndefined() {
+			s += "=" + v.String()
+		}
+		if v := ev.Get("data"); !v.IsUndefined() {
+			s += ":" + v.String()
+		}
+		got = append(got, s)
+	}
+	if want := []string{"title=shell", "text:h", "text:i", "bell"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("event callback got %v, want %v", got, want)
+	}
+}
+
+func TestStripperRemovesEscapeSequences(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"\x1b[1;31mred\x1b[0m plain\n", "red plain\n"}, // SGR
+		{"\x1b[2J\x1b[H\x1b[?25lscreen", "screen"},      // clear, home, private mode
+		{"\x1b]0;title\x07text", "text"},                // OSC ended by BEL
+		{"\x1b]2;title\x1b\\text", "text"},              // OSC ended by ST
+		{"\x1b(Bcharset", "charset"},                    // intermediate byte
+		{"\x1b7saved\x1b8", "saved"},                    // two-byte escapes
+		{"bell\a tab\t cr\r\n", "bell\a tab\t cr\r\n"},  // control characters stay
+		{"ünïcödé \x1b[4mé\x1b[24m", "ünïcödé é"},       // multi-byte text untouched
+	}
+	for _, tt := range tests {
+		// Split at every point, a sequence across two writes goes whole
+		for i := 0; i <= len(tt.in); i++ {
+			var s ansiStripper
+			got := string(s.Strip([]byte(tt.in[:i]))) + string(s.Strip([]byte(tt.in[i:])))
+			if got != tt.want {
+				t.Errorf("Strip(%q) split at %d = %q, want %q", tt.in, i, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestStripAnsiLeavesSinksRaw(t *testing.T) {
+	e, primary := newTestEmulator(t, map[string]interface{}{"stripAnsi": true})
+	raw := newOutputRecorder(t)
+	e.call(addOutputSink, raw.fn)
+
+	// A color sequence split across two delivered chunks
+	for _, chunk := range []string{"\x1b[3", "2mgreen\x1b[", "0m done\n"} {
+		e.writer.Write([]byte(chunk))
+		e.writer.Flush()
+	}
+	if got := primary.text(); got != "green done\n" {
+		t.Errorf("primary callback got %q, want plain text", got)
+	}
+	if got := raw.text(); got != "\x1b[32mgreen\x1b[0m done\n" {
+		t.Errorf("sink got %q, want the colors kept", got)
+	}
+
+	// Off by default
+	e, primary = newTestEmulator(t, nil)
+	e.writer.Write([]byte("\x1b[1mbold\x1b[0m"))
+	e.writer.Flush()
+	if got := primary.text(); got != "\x1b[1mbold\x1b[0m" {
+		t.Errorf("without stripAnsi the callback got %q", got)
+	}
+}
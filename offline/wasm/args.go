@@ -0,0 +1,134 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"syscall/js"
+)
+
+// The helpers below read positional arguments after lookup has taken the
+// handle off. Each checks the JavaScript type before converting, since
+// js.Value panics or quietly stringifies on a mismatch, and names the
+// argument in its error so callers see which one was wrong.
+
+// arg returns args[i], or undefined past the end like a JS function would.
+func arg(args []js.Value, i int) js.Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return js.Undefined()
+}
+
+// present reports whether args[i] was passed as something other than null
+// or undefined.
+func present(args []js.Value, i int) bool {
+	v := arg(args, i)
+	return !v.IsUndefined() && !v.IsNull()
+}
+
+// typedArg returns args[i] if it has type t. want describes t for the error.
+func typedArg(args []js.Value, i int, name string, t js.Type, want string) (js.Value, error) {
+	v := arg(args, i)
+	if v.IsUndefined() {
+		return v, fmt.Errorf("missing %s argument", name)
+	}
+	if v.Type() != t {
+		return v, fmt.Errorf("%s must be %s, got %s", name, want, v.Type())
+	}
+	return v, nil
+}
+
+func stringArg(args []js.Value, i int, name string) (string, error) {
+	v, err := typedArg(args, i, name, js.TypeString, "a string")
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// numberArg also rejects NaN and the infinities, which no parameter here
+// has a use for.
+func numberArg(args []js.Value, i int, name string) (float64, error) {
+	v, err := typedArg(args, i, name, js.TypeNumber, "a number")
+	if err != nil {
+		return 0, err
+	}
+	n := v.Float()
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("%s must be finite, got %v", name, n)
+	}
+	return n, nil
+}
+
+func intArg(args []js.Value, i int, name string) (int, error) {
+	n, err := numberArg(args, i, name)
+	if err != nil {
+		return 0, err
+	}
+	if n != math.Trunc(n) || math.Abs(n) > 1<<31 {
+		return 0, fmt.Errorf("%s must be an integer, got %v", name, n)
+	}
+	return int(n), nil
+}
+
+func boolArg(args []js.Value, i int, name string) (bool, error) {
+	v, err := typedArg(args, i, name, js.TypeBoolean, "a boolean")
+	if err != nil {
+		return false, err
+	}
+	return v.Bool(), nil
+}
+
+// funcArg reads a callback: a function, or {obj, method} for a method
+// that needs obj as this.
+func funcArg(args []js.Value, i int, name string) (js.Value, error) {
+	v := arg(args, i)
+	if v.IsUndefined() {
+		return v, fmt.Errorf("missing %s argument", name)
+	}
+	return asCallback(v, name)
+}
+
+// asCallback returns v if it is a function. For {obj, method} it returns
+// obj's method bound to obj, so a framework object's write method still
+// sees itself as this when called.
+func asCallback(v js.Value, name string) (js.Value, error) {
+	if v.Type() == js.TypeFunction {
+		return v, nil
+	}
+	if v.Type() == js.TypeObject {
+		obj, method := v.Get("obj"), v.Get("method")
+		if (obj.Type() == js.TypeObject || obj.Type() == js.TypeFunction) && method.Type() == js.TypeString {
+			fn := obj.Get(method.String())
+			if fn.Type() != js.TypeFunction {
+				return js.Undefined(), fmt.Errorf("%s: obj.%s must be a function, got %s", name, method.String(), fn.Type())
+			}
+			return fn.Call("bind", obj), nil
+		}
+	}
+	return js.Undefined(), fmt.Errorf("%s must be a function or {obj, method}, got %s", name, v.Type())
+}
+
+func objectArg(args []js.Value, i int, name string) (js.Value, error) {
+	return typedArg(args, i, name, js.TypeObject, "an object")
+}
+
+// optionalFuncArg is funcArg where null or undefined mean "none" and come
+// back as undefined.
+func optionalFuncArg(args []js.Value, i int, name string) (js.Value, error) {
+	if !present(args, i) {
+		return js.Undefined(), nil
+	}
+	return funcArg(args, i, name)
+}
+
+// optionalObjectArg is objectArg where null or undefined come back as
+// undefined, so fields read from it are undefined too.
+func optionalObjectArg(args []js.Value, i int, name string) (js.Value, error) {
+	if !present(args, i) {
+		return js.Undefined(), nil
+	}
+	return objectArg(args, i, name)
+}
@@ -0,0 +1,152 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+func TestArgHelpersCheckTypes(t *testing.T) {
+	args := []js.Value{js.ValueOf(1.5), js.ValueOf("s"), js.Null(), js.ValueOf(math.NaN())}
+	if _, err := stringArg(args, 0, "name"); err == nil || !strings.Contains(err.Error(), "name must be a string, got number") {
+		t.Errorf("stringArg(number) = %v", err)
+	}
+	if _, err := numberArg(args, 1, "count"); err == nil || !strings.Contains(err.Error(), "count must be a number, got string") {
+		t.Errorf("numberArg(string) = %v", err)
+	}
+	if _, err := numberArg(args, 3, "count"); err == nil || !strings.Contains(err.Error(), "finite") {
+		t.Errorf("numberArg(NaN) = %v", err)
+	}
+	if _, err := intArg(args, 0, "count"); err == nil || !strings.Contains(err.Error(), "integer") {
+		t.Errorf("intArg(1.5) = %v", err)
+	}
+	if _, err := boolArg(args, 9, "flag"); err == nil || err.Error() != "missing flag argument" {
+		t.Errorf("boolArg past the end = %v", err)
+	}
+	if _, err := objectArg(args, 2, "options"); err == nil {
+		t.Error("objectArg accepted null")
+	}
+	if v, err := optionalObjectArg(args, 2, "options"); err != nil || !v.IsUndefined() {
+		t.Errorf("optionalObjectArg(null) = %v, %v; want undefined", v, err)
+	}
+}
+
+func TestFuncArgBindsObjectMethods(t *testing.T) {
+	obj := js.Global().Get("Function").New(`return {prefix: ">", write(s) { return this.prefix + s; }};`).Invoke()
+	fn, err := funcArg([]js.Value{js.ValueOf(map[string]interface{}{"obj": obj, "method": "write"})}, 0, "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fn.Invoke("x").String(); got != ">x" {
+		t.Errorf("bound method returned %q, want it to see obj as this", got)
+	}
+
+	for _, v := range []interface{}{42, "fn", map[string]interface{}{"obj": obj, "method": "missing"}, map[string]interface{}{"method": "write"}} {
+		if _, err := funcArg([]js.Value{js.ValueOf(v)}, 0, "sink"); err == nil || !strings.Contains(err.Error(), "sink") {
+			t.Errorf("funcArg(%v) = %v, want an error naming the argument", v, err)
+		}
+	}
+}
+
+func TestInitRejectsANonFunctionCallback(t *testing.T) {
+	for _, cb := range []interface{}{nil, 42, "console.log", map[string]interface{}{}, []interface{}{}} {
+		r := initEmulator(js.Undefined(), []js.Value{js.ValueOf(cb)}).(map[string]interface{})
+		if statusOf(r) != string(codeInvalidArgument) {
+			t.Errorf("tinyemuInit(%v) = %v, want invalid_argument", cb, r)
+			continue
+		}
+		if msg := r["error"].(map[string]interface{})["message"].(string); !strings.Contains(msg, "output callback") {
+			t.Errorf("tinyemuInit(%v) error %q doesn't name the callback", cb, msg)
+		}
+	}
+	rec := newOutputRecorder(t)
+	if got := statusOf(initEmulator(js.Undefined(), []js.Value{rec.fn.Value, js.ValueOf("fast")})); got != string(codeInvalidArgument) {
+		t.Errorf("tinyemuInit with string options = %s, want invalid_argument", got)
+	}
+}
+
+// exported returns the function registered as name.
+func exported(t *testing.T, name string) func(js.Value, []js.Value) interface{} {
+	t.Helper()
+	for _, export := range exports {
+		if export.name == name {
+			return export.fn
+		}
+	}
+	t.Fatalf("no export named %s", name)
+	return nil
+}
+
+func TestWrongTypedArgumentsFailGracefully(t *testing.T) {
+	fn := js.Global().Get("Function").New("")
+	tests := []struct {
+		name string
+		args []interface{}
+	}{
+		{"tinyemuSendInput", []interface{}{true}},
+		{"tinyemuSendInput", []interface{}{"x", 7}},
+		{"tinyemuPaste", []interface{}{map[string]interface{}{}}},
+		{"tinyemuSetLineMode", []interface{}{true}},
+		{"tinyemuSendSignal", []interface{}{fn}},
+		{"tinyemuSetReadyPattern", []interface{}{5}},
+		{"tinyemuReplay", []interface{}{[]interface{}{}}},
+		{"tinyemuRunScript", []interface{}{5}},
+		{"tinyemuTypeString", []interface{}{5}},
+		{"tinyemuWaitFor", []interface{}{5, 100}},
+		{"tinyemuKeyDown", []interface{}{5}},
+		{"tinyemuResize", []interface{}{"80", "24"}},
+		{"tinyemuMouseButton", []interface{}{"left", true}},
+		{"tinyemuMouseWheel", []interface{}{"up"}},
+		{"tinyemuLoadKernel", []interface{}{"vmlinux"}},
+		{"tinyemuLoadKernelFromURL", []interface{}{5}},
+		{"tinyemuLoadInitrd", []interface{}{5}},
+		{"tinyemuLoadFirmware", []interface{}{true}},
+		{"tinyemuLoadDTB", []interface{}{"dtb"}},
+		{"tinyemuSetCmdline", []interface{}{5}},
+		{"tinyemuLoadDisk", []interface{}{"disk"}},
+		{"tinyemuAttachLazyDisk", []interface{}{"fetch", 4096, 4096}},
+		{"tinyemuEnablePersistence", []interface{}{5, fn}},
+		{"tinyemuSetDisplayCallback", []interface{}{5}},
+		{"tinyemuSetAudioCallback", []interface{}{"cb"}},
+		{"tinyemuSetMessagePortCallback", []interface{}{5}},
+		{"tinyemuSendToMessagePort", []interface{}{true}},
+		{"tinyemuAttachNetwork", []interface{}{5}},
+		{"tinyemuSetSpeed", []interface{}{"fast"}},
+		{"tinyemuSetWatchdog", []interface{}{"soon"}},
+		{"tinyemuSetBreakpoint", []interface{}{true}},
+		{"tinyemuSetLogLevel", []interface{}{5}},
+		{"tinyemuAddOutputSink", []interface{}{"sink"}},
+		{"tinyemuSetFeature", []interface{}{5, true}},
+		{"tinyemuRestore", []interface{}{5}},
+		{"tinyemuStart", []interface{}{"now"}},
+		{"tinyemuStartAsync", []interface{}{"now"}},
+	}
+	for _, tt := range tests {
+		// Small instances, as they are only disposed when the test ends
+		e, _ := newTestEmulator(t, map[string]interface{}{"ramSizeMB": 1})
+		var result interface{}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s%v panicked: %v", tt.name, tt.args, r)
+				}
+			}()
+			result = e.call(exported(t, tt.name), tt.args...)
+		}()
+		if result == nil {
+			continue
+		}
+		if promise, ok := result.(js.Value); ok {
+			if v, fulfilled := awaitSettled(t, promise); fulfilled || v.Get("code").String() != string(codeInvalidArgument) {
+				t.Errorf("%s%v settled with %v, want an invalid_argument rejection", tt.name, tt.args, v)
+			}
+			continue
+		}
+		if got := statusOf(result); got != string(codeInvalidArgument) {
+			t.Errorf("%s%v = %s, want invalid_argument", tt.name, tt.args, got)
+		}
+	}
+}
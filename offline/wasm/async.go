@@ -0,0 +1,160 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall/js"
+)
+
+// newPromise returns a JS Promise whose executor calls fn with the resolve
+// and reject functions. The executor runs synchronously inside the Promise
+// constructor, so its js.Func is released as soon as the Promise exists.
+func newPromise(fn func(resolve, reject js.Value)) js.Value {
+	executor := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		fn(args[0], args[1])
+		return nil
+	})
+	defer executor.Release()
+
+	return js.Global().Get("Promise").New(executor)
+}
+
+// rejectedPromise returns a Promise already rejected with err, for calls
+// that return a Promise to fail before they start.
+func rejectedPromise(err error) js.Value {
+	return newPromise(func(resolve, reject js.Value) {
+		reject.Invoke(errorValue(err))
+	})
+}
+
+// await blocks until promise settles. It must not be called from a JS
+// callback's own goroutine, since settling needs the event loop.
+func await(promise js.Value) (js.Value, error) {
+	return awaitContext(context.Background(), promise)
+}
+
+// awaitContext is await that gives up with ctx's error once ctx is done.
+// The handlers it registers release themselves when the Promise settles,
+// so one given up on can still settle later.
+func awaitContext(ctx context.Context, promise js.Value) (js.Value, error) {
+	type outcome struct {
+		value js.Value
+		err   error
+	}
+	ch := make(chan outcome, 1)
+
+	var onFulfilled, onRejected js.Func
+	release := func() {
+		onFulfilled.Release()
+		onRejected.Release()
+	}
+	onFulfilled = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		ch <- outcome{value: args[0]}
+		return nil
+	})
+	onRejected = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		msg := "promise rejected"
+		if len(args) > 0 && args[0].Type() == js.TypeObject && args[0].Get("message").Type() == js.TypeString {
+			msg = args[0].Get("message").String()
+		} else if len(args) > 0 {
+			msg = args[0].String()
+		}
+		ch <- outcome{err: errors.New(msg)}
+		return nil
+	})
+
+	promise.Call("then", onFulfilled, onRejected)
+	select {
+	case o := <-ch:
+		return o.value, o.err
+	case <-ctx.Done():
+		return js.Undefined(), ctx.Err()
+	}
+}
+
+// jsError wraps msg in a JS Error so rejections carry a stack and message.
+func jsError(msg string) js.Value {
+	return js.Global().Get("Error").New(msg)
+}
+
+// settle resolves with a result's data, or rejects with an Error carrying
+// its code if it failed.
+func settle(result map[string]interface{}, resolve, reject js.Value) {
+	if failed(result) {
+		reject.Invoke(resultError(result))
+		return
+	}
+	resolve.Invoke(result["data"])
+}
+
+func initEmulatorAsync(this js.Value, args []js.Value) interface{} {
+	return newPromise(func(resolve, reject js.Value) {
+		settle(initEmulator(this, args).(map[string]interface{}), resolve, reject)
+	})
+}
+
+// startEmulatorAsync takes tinyemuStart's {bootTimeoutMs} and resolves
+// once the boot sequence completes rather than when the run goroutine is
+// merely launched. A run that ends before then rejects it, with crashed if
+// the machine crashed, timeout if it wasn't ready within bootTimeoutMs and
+// not_running if it was stopped, reset or powered off.
+func startEmulatorAsync(this js.Value, args []js.Value) interface{} {
+	return newPromise(func(resolve, reject js.Value) {
+		e, args, err := lookup(args, 0)
+		if err != nil {
+			reject.Invoke(errorValue(err))
+			return
+		}
+		timeout, err := bootTimeoutOption(args)
+		if err != nil {
+			reject.Invoke(errorValue(err))
+			return
+		}
+
+		var once sync.Once
+		result := e.start(func() {
+			once.Do(func() {
+				resolve.Invoke(map[string]interface{}{"status": string(statusRunning)})
+			})
+		}, timeout)
+		if failed(result) {
+			reject.Invoke(resultError(result))
+			return
+		}
+		done := e.done
+		go func() {
+			<-done
+			once.Do(func() {
+				reject.Invoke(errorValue(e.bootAborted()))
+			})
+		}()
+	})
+}
+
+// bootAborted explains why a run ended before its boot sequence finished.
+func (e *Emulator) bootAborted() error {
+	switch e.getState() {
+	case stateCrashed:
+		return newError(codeCrashed, "crashed before boot finished")
+	case stateBootTimeout:
+		return newError(codeTimeout, "boot did not finish in time")
+	case stateHalted:
+		return newError(codeNotRunning, "guest powered off before boot finished")
+	default:
+		return newError(codeNotRunning, "stopped before boot finished")
+	}
+}
+
+func stopEmulatorAsync(this js.Value, args []js.Value) interface{} {
+	return newPromise(func(resolve, reject js.Value) {
+		// Wait for teardown off the event loop
+		go func() {
+			settle(stopEmulator(this, args).(map[string]interface{}), resolve, reject)
+		}()
+	})
+}
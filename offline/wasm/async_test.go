@@ -0,0 +1,121 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// awaitSettled waits for promise to settle and returns its value and
+// whether it was fulfilled.
+func awaitSettled(t *testing.T, promise js.Value) (js.Value, bool) {
+	t.Helper()
+	type outcome struct {
+		value     js.Value
+		fulfilled bool
+	}
+	ch := make(chan outcome, 2)
+	onFulfilled := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		ch <- outcome{args[0], true}
+		return nil
+	})
+	defer onFulfilled.Release()
+	onRejected := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		ch <- outcome{args[0], false}
+		return nil
+	})
+	defer onRejected.Release()
+
+	promise.Call("then", onFulfilled, onRejected)
+	select {
+	case o := <-ch:
+		return o.value, o.fulfilled
+	case <-time.After(2 * time.Second):
+		t.Fatal("promise didn't settle")
+		return js.Undefined(), false
+	}
+}
+
+// wantRejected checks that promise rejects with an Error carrying code.
+func wantRejected(t *testing.T, promise js.Value, code resultCode) {
+	t.Helper()
+	v, fulfilled := awaitSettled(t, promise)
+	if fulfilled {
+		t.Fatalf("promise resolved with %v, want a %s rejection", v, code)
+	}
+	if got := v.Get("code").String(); got != string(code) {
+		t.Fatalf("rejected with code %s (%s), want %s", got, v.Get("message").String(), code)
+	}
+}
+
+func TestStartAsyncResolvesOnBoot(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{bootSteps: 2} })
+	e, _ := newTestEmulator(t, nil)
+	v, fulfilled := awaitSettled(t, e.call(startEmulatorAsync).(js.Value))
+	if !fulfilled || v.Get("status").String() != string(statusRunning) {
+		t.Fatalf("tinyemuStartAsync settled with %v, fulfilled %v", v, fulfilled)
+	}
+	if e.getState() != stateRunning {
+		t.Errorf("state is %s, want running", e.getState())
+	}
+}
+
+func TestStartAsyncRejectsWithoutKernel(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	e.kernel = nil
+	wantRejected(t, e.call(startEmulatorAsync).(js.Value), codeNoKernel)
+}
+
+func TestStartAsyncRejectsOnCrash(t *testing.T) {
+	useMachine(t, func(machineConfig) machine {
+		return &testMachine{bootSteps: 1 << 30, step: func(int) { panic("bad opcode") }}
+	})
+	e, _ := newTestEmulator(t, nil)
+	wantRejected(t, e.call(startEmulatorAsync).(js.Value), codeCrashed)
+}
+
+// haltingMachine powers off on its first step, before it has booted.
+type haltingMachine struct{ testMachine }
+
+func (m *haltingMachine) Halted() (int, bool) { return 0, m.steps > 0 }
+
+func TestStartAsyncRejectsOnPowerOff(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &haltingMachine{testMachine{bootSteps: 1 << 30}} })
+	e, _ := newTestEmulator(t, nil)
+	wantRejected(t, e.call(startEmulatorAsync).(js.Value), codeNotRunning)
+	if e.getState() != stateHalted {
+		t.Errorf("state is %s, want halted", e.getState())
+	}
+}
+
+func TestStartAsyncRejectsOnStopAndReset(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{bootSteps: 1 << 30} })
+	for _, end := range []func(e *Emulator) interface{}{
+		func(e *Emulator) interface{} { return e.call(stopEmulator) },
+		func(e *Emulator) interface{} { return e.call(resetEmulator) },
+	} {
+		e, _ := newTestEmulator(t, nil)
+		promise := e.call(startEmulatorAsync).(js.Value)
+		if result := end(e).(map[string]interface{}); failed(result) {
+			t.Fatal(result["error"])
+		}
+		wantRejected(t, promise, codeNotRunning)
+	}
+}
+
+func TestStartAsyncRejectsOnBootTimeout(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{bootSteps: 1 << 30} })
+	e, _ := newTestEmulator(t, nil)
+	start := time.Now()
+	wantRejected(t, e.call(startEmulatorAsync, map[string]interface{}{"bootTimeoutMs": 150}).(js.Value), codeTimeout)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("rejected after %v, before the 150ms boot timeout", elapsed)
+	}
+	if e.getState() != stateBootTimeout {
+		t.Errorf("state is %s, want boot_timeout", e.getState())
+	}
+
+	wantRejected(t, e.call(startEmulatorAsync, map[string]interface{}{"bootTimeoutMs": "soon"}).(js.Value), codeInvalidArgument)
+}
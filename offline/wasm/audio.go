@@ -0,0 +1,165 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// audioPeriod is how much audio each callback carries. Short enough for
+// low latency, long enough not to cross into JS too often.
+const audioPeriod = 20 * time.Millisecond
+
+var errNoAudio = newError(codeUnsupported, "machine has no audio device")
+
+// audioFormat describes the PCM stream a guest audio device produces.
+type audioFormat struct {
+	sampleRate int
+	channels   int
+}
+
+// audioDevice is implemented by machines with a virtio-sound output.
+type audioDevice interface {
+	AudioFormat() audioFormat
+	// ReadSamples fills buf with interleaved 16-bit samples the guest has
+	// played and returns how many it wrote.
+	ReadSamples(buf []int16) int
+}
+
+// audioSink holds the JS audio callback and the sample type it wants.
+type audioSink struct {
+	mu       sync.Mutex
+	callback js.Value
+	float32  bool
+}
+
+func (a *audioSink) get() (js.Value, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.callback, a.float32
+}
+
+// samplesToJS converts samples to an Int16Array, or a Float32Array in
+// [-1, 1] for Web Audio.
+func samplesToJS(samples []int16, asFloat bool) js.Value {
+	if asFloat {
+		buf := make([]byte, 4*len(samples))
+		for i, s := range samples {
+			binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(s)/32768))
+		}
+		return js.Global().Get("Float32Array").New(bytesToJS(buf).Get("buffer"))
+	}
+	buf := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(s))
+	}
+	return js.Global().Get("Int16Array").New(bytesToJS(buf).Get("buffer"))
+}
+
+// pumpAudio delivers the guest's audio to the callback until ctx is
+// canceled. Periods are paced by wall time, and whatever the guest
+// hasn't produced is filled with silence so the output never starves.
+func (e *Emulator) pumpAudio(ctx context.Context, dev audioDevice) {
+	e.machineMu.Lock()
+	format := dev.AudioFormat()
+	e.machineMu.Unlock()
+	if format.sampleRate <= 0 || format.channels <= 0 {
+		e.log.Warnf("audio device reported an unusable format %+v", format)
+		return
+	}
+
+	ticker := time.NewTicker(audioPeriod)
+	defer ticker.Stop()
+
+	start := time.Now()
+	var delivered int64 // frames
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		due := int64(time.Since(start).Seconds()*float64(format.sampleRate)) - delivered
+		if due <= 0 {
+			continue
+		}
+		samples := make([]int16, int(due)*format.channels)
+
+		e.machineMu.Lock()
+		n := dev.ReadSamples(samples)
+		e.machineMu.Unlock()
+		delivered += due
+
+		callback, asFloat := e.audio.get()
+		if callback.Type() != js.TypeFunction {
+			continue
+		}
+		// samples past n are already zero
+		callback.Invoke(map[string]interface{}{
+			"samples":    samplesToJS(samples, asFloat),
+			"frames":     int(due),
+			"channels":   format.channels,
+			"sampleRate": format.sampleRate,
+			"underrun":   n < len(samples),
+		})
+	}
+}
+
+// setAudioCallback registers fn to receive {samples, frames, channels,
+// sampleRate, underrun} every audioPeriod. An optional {format: "float32"}
+// delivers a Float32Array instead of the default Int16Array. null
+// unregisters it.
+func setAudioCallback(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	fn, err := optionalFuncArg(args, 0, "audio callback")
+	if err != nil {
+		return errorResult(err)
+	}
+	opts, err := optionalObjectArg(args, 1, "options")
+	if err != nil {
+		return errorResult(err)
+	}
+	asFloat := false
+	if opts.Truthy() {
+		switch f := opts.Get("format"); {
+		case f.IsUndefined() || f.IsNull():
+		case f.Type() == js.TypeString && f.String() == "float32":
+			asFloat = true
+		case f.Type() == js.TypeString && f.String() == "int16":
+		default:
+			return errResult(codeInvalidArgument, "format must be \"int16\" or \"float32\"")
+		}
+	}
+
+	e.audio.mu.Lock()
+	e.audio.callback = fn
+	e.audio.float32 = asFloat
+	e.audio.mu.Unlock()
+	return statusResult(statusAudioCallbackSet, nil)
+}
+
+// getAudioFormat returns the guest audio device's sample rate and channels.
+func getAudioFormat(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+	dev, ok := e.machine.(audioDevice)
+	if !ok {
+		return errorResult(errNoAudio)
+	}
+	format := dev.AudioFormat()
+	return okResult(map[string]interface{}{"sampleRate": format.sampleRate, "channels": format.channels})
+}
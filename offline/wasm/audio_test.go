@@ -0,0 +1,109 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// audioMachine plays a stereo ramp of samples 1, 2, 3... at 8kHz until it
+// runs out, as a guest would fill the virtio-sound ring.
+type audioMachine struct {
+	testMachine
+	pending []int16
+}
+
+func newAudioMachine(samples int) *audioMachine {
+	m := &audioMachine{pending: make([]int16, samples)}
+	for i := range m.pending {
+		m.pending[i] = int16(i + 1)
+	}
+	return m
+}
+
+func (m *audioMachine) AudioFormat() audioFormat { return audioFormat{sampleRate: 8000, channels: 2} }
+
+func (m *audioMachine) ReadSamples(buf []int16) int {
+	n := copy(buf, m.pending)
+	m.pending = m.pending[n:]
+	return n
+}
+
+func TestAudioDeliversSamplesInOrder(t *testing.T) {
+	// 50ms of sound, then the guest goes quiet
+	useMachine(t, func(machineConfig) machine { return newAudioMachine(800) })
+	e, _ := newTestEmulator(t, nil)
+	periods := newOutputRecorder(t)
+	if got := statusOf(e.call(setAudioCallback, periods.fn)); got != string(statusAudioCallbackSet) {
+		t.Fatalf("tinyemuSetAudioCallback = %s", got)
+	}
+	e.call(startEmulator)
+	time.Sleep(10 * audioPeriod)
+	e.call(stopEmulator)
+
+	periods.mu.Lock()
+	defer periods.mu.Unlock()
+	var all []int16
+	for i, p := range periods.chunks {
+		if p.Get("sampleRate").Int() != 8000 || p.Get("channels").Int() != 2 {
+			t.Errorf("period %d reports %v Hz and %v channels", i, p.Get("sampleRate"), p.Get("channels"))
+		}
+		samples := p.Get("samples")
+		if samples.Get("constructor").Get("name").String() != "Int16Array" || samples.Length() != 2*p.Get("frames").Int() {
+			t.Fatalf("period %d has %d samples for %v frames", i, samples.Length(), p.Get("frames"))
+		}
+		start := len(all)
+		for j := 0; j < samples.Length(); j++ {
+			all = append(all, int16(samples.Index(j).Int()))
+		}
+		if underrun := len(all) > 800; p.Get("underrun").Bool() != underrun {
+			t.Errorf("period %d, samples %d to %d: underrun = %v", i, start, len(all), !underrun)
+		}
+	}
+	if len(all) <= 800 {
+		t.Fatalf("only %d samples delivered in %v", len(all), 10*audioPeriod)
+	}
+	for i, s := range all {
+		want := int16(0) // silence once the guest has stopped
+		if i < 800 {
+			want = int16(i + 1)
+		}
+		if s != want {
+			t.Fatalf("sample %d is %d, want %d", i, s, want)
+		}
+	}
+}
+
+func TestSamplesToJSFloat32(t *testing.T) {
+	v := samplesToJS([]int16{-32768, 0, 16384, 32767}, true)
+	if name := v.Get("constructor").Get("name").String(); name != "Float32Array" {
+		t.Fatalf("got a %s", name)
+	}
+	var got []float64
+	for i := 0; i < v.Length(); i++ {
+		got = append(got, v.Index(i).Float())
+	}
+	if want := []float64{-1, 0, 0.5, float64(float32(32767) / 32768)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("samples = %v, want %v", got, want)
+	}
+}
+
+func TestAudioFormatAndOptions(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(getAudioFormat)); got != string(codeUnsupported) {
+		t.Errorf("without an audio device: tinyemuGetAudioFormat = %s, want unsupported", got)
+	}
+	fn, _ := countingCallback(t)
+	if got := statusOf(e.call(setAudioCallback, fn, map[string]interface{}{"format": "float64"})); got != string(codeInvalidArgument) {
+		t.Errorf("format float64 = %s, want invalid_argument", got)
+	}
+
+	useMachine(t, func(machineConfig) machine { return newAudioMachine(0) })
+	e.call(startEmulator)
+	r := e.call(getAudioFormat).(map[string]interface{})
+	if want := map[string]interface{}{"sampleRate": 8000, "channels": 2}; !reflect.DeepEqual(r["data"], want) {
+		t.Errorf("tinyemuGetAudioFormat = %v, want %v", r, want)
+	}
+}
@@ -0,0 +1,74 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"syscall/js"
+)
+
+// Boot methods for the bootMethod option.
+const (
+	// bootDirectKernel jumps straight to the kernel entry point, with the
+	// machine setting up what firmware otherwise would
+	bootDirectKernel = "direct-kernel"
+	// bootFirmware runs the firmware staged with tinyemuLoadFirmware, such
+	// as OpenSBI or a BIOS, which then hands over to the kernel
+	bootFirmware = "firmware"
+)
+
+// bootMethods lists the boot methods the machine supports.
+var bootMethods = []string{bootDirectKernel, bootFirmware}
+
+// bootMethodOption reads the bootMethod option.
+func bootMethodOption(v js.Value) (string, error) {
+	method := v.Get("bootMethod")
+	if method.IsUndefined() || method.IsNull() {
+		return bootDirectKernel, nil
+	}
+	if method.Type() != js.TypeString {
+		return "", fmt.Errorf("bootMethod must be a string, got %s", method.Type())
+	}
+	if !slices.Contains(bootMethods, method.String()) {
+		return "", fmt.Errorf("bootMethod %q is not supported, want one of %s", method.String(), strings.Join(bootMethods, ", "))
+	}
+	return method.String(), nil
+}
+
+// checkBoot reports a boot method start can't carry out with what is
+// staged.
+func (e *Emulator) checkBoot(method string) error {
+	if method == bootFirmware && e.firmware == nil {
+		return newError(codeMissingImage, "bootMethod firmware needs firmware, call tinyemuLoadFirmware first")
+	}
+	return nil
+}
+
+// loadFirmware accepts firmware such as OpenSBI or a BIOS as a Uint8Array
+// or ArrayBuffer, plus an optional {compression, onProgress} options
+// object, and stages it for the next start. Only bootMethod firmware runs
+// it.
+func loadFirmware(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !present(args, 0) {
+		return errResult(codeInvalidArgument, "missing firmware image argument")
+	}
+
+	data, err := loadImageArg(args)
+	if err != nil {
+		return errorResult(err)
+	}
+	if len(data) == 0 {
+		return errResult(codeInvalidArgument, "firmware image is empty")
+	}
+	e.firmware = data
+	return statusResult(statusFirmwareLoaded, map[string]interface{}{
+		"size":       len(data),
+		"bootMethod": e.options.bootMethod,
+	})
+}
@@ -0,0 +1,92 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// loaderMachine is a mock boot loader. On its first step it loads what
+// its boot method calls for, in order, into loaded.
+type loaderMachine struct {
+	testMachine
+	config machineConfig
+	loaded []string
+}
+
+func (m *loaderMachine) Step(n int) int {
+	if m.steps == 0 {
+		if m.config.bootMethod == bootFirmware {
+			m.loaded = append(m.loaded, "firmware "+string(m.config.firmware))
+		}
+		m.loaded = append(m.loaded, "kernel")
+	}
+	return m.testMachine.Step(n)
+}
+
+// bootLoader makes runs boot loaderMachines and returns the latest one.
+func bootLoader(t *testing.T) func() *loaderMachine {
+	var m *loaderMachine
+	useMachine(t, func(config machineConfig) machine {
+		m = &loaderMachine{config: config}
+		return m
+	})
+	return func() *loaderMachine { return m }
+}
+
+func TestBootMethods(t *testing.T) {
+	for _, tt := range []struct {
+		opts   map[string]interface{}
+		loaded string
+	}{
+		{nil, "kernel"},
+		{map[string]interface{}{"bootMethod": bootDirectKernel}, "kernel"},
+		{map[string]interface{}{"bootMethod": bootFirmware}, "firmware opensbi,kernel"},
+	} {
+		latest := bootLoader(t)
+		e, _ := newTestEmulator(t, tt.opts)
+		// Staged either way; only the firmware method runs it
+		if got := statusOf(e.call(loadFirmware, bytesToJS([]byte("opensbi")))); got != string(statusFirmwareLoaded) {
+			t.Fatalf("options %v: tinyemuLoadFirmware = %s", tt.opts, got)
+		}
+		e.call(startEmulator)
+		waitState(t, e, stateRunning)
+
+		m := latest()
+		if got := strings.Join(m.loaded, ","); got != tt.loaded {
+			t.Errorf("options %v: loader loaded %q, want %q", tt.opts, got, tt.loaded)
+		}
+		if !bytes.Equal(m.config.kernel.data, testKernel) {
+			t.Errorf("options %v: machine got a %d byte kernel, not the staged one", tt.opts, len(m.config.kernel.data))
+		}
+	}
+}
+
+func TestFirmwareBootNeedsFirmware(t *testing.T) {
+	latest := bootLoader(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"bootMethod": bootFirmware})
+	if got := statusOf(e.call(startEmulator)); got != string(codeMissingImage) {
+		t.Fatalf("firmware boot without firmware = %s, want missing_image", got)
+	}
+	if latest() != nil || e.getState() != stateInitialized {
+		t.Errorf("a refused start built a machine or left state %s", e.getState())
+	}
+
+	if got := statusOf(e.call(loadFirmware, bytesToJS(nil))); got != string(codeInvalidArgument) {
+		t.Errorf("loading empty firmware = %s, want invalid_argument", got)
+	}
+	e.call(loadFirmware, bytesToJS([]byte("bios")))
+	if got := statusOf(e.call(startEmulator)); got != string(statusStarting) {
+		t.Errorf("start once firmware is loaded = %s, want starting", got)
+	}
+}
+
+func TestUnknownBootMethodIsRefused(t *testing.T) {
+	for _, method := range []interface{}{"pxe", "", 2} {
+		if msg := initError(t, map[string]interface{}{"bootMethod": method}); !strings.Contains(msg, "bootMethod") {
+			t.Errorf("bootMethod %v: error %q doesn't name the option", method, msg)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"sync"
+	"syscall/js"
+)
+
+// bridgeHandler handles one worker message type. It gets the message's
+// data object and returns the reply to post back.
+type bridgeHandler func(data js.Value) map[string]interface{}
+
+// bridgeHandlers is the worker message dispatch table. Messages follow the
+// worker.js protocol, {type, ...data}, with an optional handle addressing
+// an instance and an optional id echoed back in the reply.
+var bridgeHandlers = map[string]bridgeHandler{
+	"init":    bridgeInit,
+	"start":   bridgeCall(startEmulator, "start_complete"),
+	"stop":    bridgeCall(stopEmulator, "stop_complete"),
+	"input":   bridgeCall(sendInput, "input_result", "text"),
+	"dispose": bridgeCall(disposeEmulator, "dispose_complete"),
+}
+
+var (
+	bridgeMu       sync.Mutex
+	bridgeAttached bool
+	bridgeListener js.Func // the message listener, once attached
+)
+
+// attachWorkerBridge makes the module drive itself from postMessage
+// commands, for running inside a dedicated Worker. The global functions
+// keep working alongside it.
+func attachWorkerBridge(this js.Value, args []js.Value) interface{} {
+	global := js.Global()
+	if global.Get("postMessage").Type() != js.TypeFunction || global.Get("addEventListener").Type() != js.TypeFunction {
+		return errResult(codeUnavailable, "tinyemuAttachWorkerBridge must be called inside a Web Worker")
+	}
+
+	bridgeMu.Lock()
+	defer bridgeMu.Unlock()
+	if bridgeAttached {
+		return statusResult(statusAlreadyAttached, nil)
+	}
+	bridgeAttached = true
+
+	bridgeListener = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) > 0 {
+			dispatchMessage(args[0].Get("data"))
+		}
+		return nil
+	})
+	global.Call("addEventListener", "message", bridgeListener)
+	return statusResult(statusAttached, nil)
+}
+
+// dispatchMessage runs the handler for msg.type and posts its reply.
+func dispatchMessage(msg js.Value) {
+	if msg.Type() != js.TypeObject {
+		return
+	}
+	typ := msg.Get("type")
+	if typ.Type() != js.TypeString {
+		return
+	}
+
+	var reply map[string]interface{}
+	if handler, ok := bridgeHandlers[typ.String()]; ok {
+		reply = handler(msg)
+	} else {
+		reply = errResult(codeUnknownMessage, "Unknown message type: "+typ.String())
+	}
+
+	if failed(reply) {
+		reply["type"] = "error"
+		reply["request"] = typ.String()
+	}
+	if id := msg.Get("id"); !id.IsUndefined() {
+		reply["id"] = id
+	}
+	js.Global().Call("postMessage", reply)
+}
+
+// bridgeInit creates an instance whose console output is posted as
+// {type: "output", handle, data} messages instead of a direct callback.
+func bridgeInit(data js.Value) map[string]interface{} {
+	var handle int
+	output := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) > 0 {
+			js.Global().Call("postMessage", map[string]interface{}{
+				"type":   "output",
+				"handle": handle,
+				"data":   args[0],
+			})
+		}
+		return nil
+	})
+
+	result := initEmulator(js.Undefined(), []js.Value{output.Value, data.Get("options")}).(map[string]interface{})
+	if failed(result) {
+		output.Release()
+		return result
+	}
+	handle = result["data"].(map[string]interface{})["handle"].(int)
+	// The instance owns output from here on, so disposing it releases it
+	instanceByHandle(handle).funcs.track(output)
+	result["type"] = "init_complete"
+	result["version"] = version
+	return result
+}
+
+// bridgeCall adapts a global function to a bridge handler. The message's
+// handle, if any, and the named fields become its arguments.
+func bridgeCall(fn func(js.Value, []js.Value) interface{}, replyType string, fields ...string) bridgeHandler {
+	return func(data js.Value) map[string]interface{} {
+		var args []js.Value
+		if handle := data.Get("handle"); handle.Type() == js.TypeNumber {
+			args = append(args, handle)
+		}
+		for _, name := range fields {
+			args = append(args, data.Get(name))
+		}
+
+		reply := map[string]interface{}{"type": replyType}
+		switch result := fn(js.Undefined(), args).(type) {
+		case map[string]interface{}:
+			for k, v := range result {
+				reply[k] = v
+			}
+		default:
+			reply["result"] = result
+		}
+		return reply
+	}
+}
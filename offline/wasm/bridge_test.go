@@ -0,0 +1,202 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"sync"
+	"syscall/js"
+	"testing"
+)
+
+// mockWorker replaces the Worker globals the bridge uses, keeping every
+// message posted and the message listener added, until the test ends or
+// the listener is removed.
+type mockWorker struct {
+	mu       sync.Mutex
+	posted   []js.Value
+	listener js.Value
+}
+
+func newMockWorker(t *testing.T) *mockWorker {
+	w := &mockWorker{}
+	post := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		w.mu.Lock()
+		w.posted = append(w.posted, args[0])
+		w.mu.Unlock()
+		return nil
+	})
+	listen := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if args[0].String() == "message" {
+			w.listener = args[1]
+		}
+		return nil
+	})
+	unlisten := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if args[0].String() == "message" && args[1].Equal(w.listener) {
+			w.listener = js.Undefined()
+		}
+		return nil
+	})
+	global := js.Global()
+	prevPost, prevListen, prevUnlisten := global.Get("postMessage"), global.Get("addEventListener"), global.Get("removeEventListener")
+	global.Set("postMessage", post)
+	global.Set("addEventListener", listen)
+	global.Set("removeEventListener", unlisten)
+	t.Cleanup(func() {
+		global.Set("postMessage", prevPost)
+		global.Set("addEventListener", prevListen)
+		global.Set("removeEventListener", prevUnlisten)
+		post.Release()
+		listen.Release()
+		unlisten.Release()
+	})
+	return w
+}
+
+// send dispatches msg and returns the reply it posted, failing the test
+// unless exactly one message besides console output was posted.
+func (w *mockWorker) send(t *testing.T, msg map[string]interface{}) js.Value {
+	t.Helper()
+	w.mu.Lock()
+	w.posted = nil
+	w.mu.Unlock()
+	dispatchMessage(js.ValueOf(msg))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var replies []js.Value
+	for _, m := range w.posted {
+		if m.Get("type").String() != "output" {
+			replies = append(replies, m)
+		}
+	}
+	if len(replies) != 1 {
+		t.Fatalf("%v posted %d replies, want 1", msg, len(replies))
+	}
+	return replies[0]
+}
+
+// outputs returns the data of output messages posted for handle.
+func (w *mockWorker) outputs(handle int) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var out string
+	for _, m := range w.posted {
+		if m.Get("type").String() == "output" && m.Get("handle").Int() == handle {
+			out += m.Get("data").String()
+		}
+	}
+	return out
+}
+
+func TestBridgeDispatchTable(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	w := newMockWorker(t)
+
+	reply := w.send(t, map[string]interface{}{"type": "init", "id": 7, "options": map[string]interface{}{"ramSizeMB": 1}})
+	if reply.Get("type").String() != "init_complete" || reply.Get("id").Int() != 7 || reply.Get("version").String() != version {
+		t.Fatalf("init replied %v", js.Global().Get("JSON").Call("stringify", reply))
+	}
+	handle := reply.Get("data").Get("handle").Int()
+	e := instanceByHandle(handle)
+	t.Cleanup(func() { e.dispose() })
+	e.stageKernel(testKernel)
+
+	for _, tt := range []struct {
+		msg  map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"type": "start", "handle": handle}, "start_complete"},
+		{map[string]interface{}{"type": "input", "handle": handle, "text": "ls\n"}, "input_result"},
+		{map[string]interface{}{"type": "stop", "handle": handle}, "stop_complete"},
+	} {
+		if got := w.send(t, tt.msg).Get("type").String(); got != tt.want {
+			t.Errorf("%s replied %s, want %s", tt.msg["type"], got, tt.want)
+		}
+	}
+	if got := string(e.reader.Pending()); got != "ls\n" {
+		t.Errorf("input message queued %q", got)
+	}
+
+	// Console output arrives as messages, not through a callback
+	w.mu.Lock()
+	w.posted = nil
+	w.mu.Unlock()
+	e.writer.Write([]byte("hello"))
+	e.writer.Flush()
+	if got := w.outputs(handle); got != "hello" {
+		t.Errorf("output messages for handle %d carried %q", handle, got)
+	}
+
+	if got := w.send(t, map[string]interface{}{"type": "dispose", "handle": handle}).Get("type").String(); got != "dispose_complete" {
+		t.Errorf("dispose replied %s", got)
+	}
+	if instanceByHandle(handle) != nil {
+		t.Error("dispose message left the instance registered")
+	}
+}
+
+func TestBridgeReportsErrors(t *testing.T) {
+	w := newMockWorker(t)
+	for _, tt := range []struct {
+		msg     map[string]interface{}
+		code    resultCode
+		request string
+	}{
+		{map[string]interface{}{"type": "reboot", "id": "r1"}, codeUnknownMessage, "reboot"},
+		{map[string]interface{}{"type": "start", "handle": 1 << 30}, codeUnknownHandle, "start"},
+		{map[string]interface{}{"type": "init", "options": map[string]interface{}{"ramSizeMB": -1}}, codeInvalidArgument, "init"},
+	} {
+		reply := w.send(t, tt.msg)
+		if reply.Get("type").String() != "error" || reply.Get("error").Get("code").String() != string(tt.code) || reply.Get("request").String() != tt.request {
+			t.Errorf("%v replied %v", tt.msg, js.Global().Get("JSON").Call("stringify", reply))
+		}
+		if id, ok := tt.msg["id"]; ok && reply.Get("id").String() != id {
+			t.Errorf("%v reply dropped its id", tt.msg)
+		}
+	}
+
+	// Messages that aren't commands are ignored
+	w.posted = nil
+	for _, msg := range []js.Value{js.ValueOf("start"), js.ValueOf(map[string]interface{}{"kind": "start"}), js.Null()} {
+		dispatchMessage(msg)
+	}
+	if len(w.posted) != 0 {
+		t.Errorf("non-command messages got %d replies", len(w.posted))
+	}
+}
+
+func TestAttachWorkerBridge(t *testing.T) {
+	global := js.Global()
+	prev := global.Get("addEventListener")
+	global.Set("addEventListener", js.Undefined())
+	got := statusOf(attachWorkerBridge(js.Undefined(), nil))
+	global.Set("addEventListener", prev)
+	if got != string(codeUnavailable) {
+		t.Errorf("tinyemuAttachWorkerBridge outside a Worker = %s, want unavailable", got)
+	}
+
+	w := newMockWorker(t)
+	// Attaching is once per module, so undo it for the next run of the test
+	t.Cleanup(func() {
+		bridgeMu.Lock()
+		defer bridgeMu.Unlock()
+		if bridgeAttached {
+			global.Call("removeEventListener", "message", bridgeListener)
+			bridgeListener.Release()
+			bridgeListener = js.Func{}
+			bridgeAttached = false
+		}
+	})
+	if got := statusOf(attachWorkerBridge(js.Undefined(), nil)); got != string(statusAttached) {
+		t.Fatalf("tinyemuAttachWorkerBridge = %s", got)
+	}
+	if got := statusOf(attachWorkerBridge(js.Undefined(), nil)); got != string(statusAlreadyAttached) {
+		t.Errorf("second tinyemuAttachWorkerBridge = %s, want already_attached", got)
+	}
+	// The listener feeds message events into the dispatch table
+	w.listener.Invoke(map[string]interface{}{"data": map[string]interface{}{"type": "bogus"}})
+	if len(w.posted) != 1 || w.posted[0].Get("request").String() != "bogus" {
+		t.Errorf("a message event posted %d replies", len(w.posted))
+	}
+}
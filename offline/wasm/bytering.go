@@ -0,0 +1,66 @@
+//go:build js && wasm
+
+package main
+
+// minRingSize is the capacity a byteRing starts at once written to.
+const minRingSize = 256
+
+// byteRing is a growable circular byte queue. Writes copy into spare
+// capacity and reads copy out from the head, so once it has grown to the
+// working size neither allocates. It does no locking of its own.
+type byteRing struct {
+	buf  []byte
+	head int
+	n    int
+}
+
+// Len returns how many bytes are queued.
+func (r *byteRing) Len() int {
+	return r.n
+}
+
+// Write appends p, growing the ring if it doesn't fit.
+func (r *byteRing) Write(p []byte) {
+	if r.n+len(p) > len(r.buf) {
+		r.grow(r.n + len(p))
+	}
+	tail := (r.head + r.n) % len(r.buf)
+	k := copy(r.buf[tail:], p)
+	copy(r.buf, p[k:])
+	r.n += len(p)
+}
+
+// grow reallocates to hold at least size bytes, unwrapping the contents
+// to the start of the new buffer.
+func (r *byteRing) grow(size int) {
+	c := max(minRingSize, 2*len(r.buf))
+	for c < size {
+		c *= 2
+	}
+	buf := make([]byte, c)
+	r.Peek(buf)
+	r.buf, r.head = buf, 0
+}
+
+// Peek copies up to len(p) bytes from the head into p without consuming
+// them and returns how many it copied.
+func (r *byteRing) Peek(p []byte) int {
+	n := min(len(p), r.n)
+	if n == 0 {
+		return 0
+	}
+	k := copy(p[:n], r.buf[r.head:])
+	copy(p[k:n], r.buf)
+	return n
+}
+
+// Discard drops the first n queued bytes.
+func (r *byteRing) Discard(n int) {
+	n = min(n, r.n)
+	r.n -= n
+	if r.n == 0 {
+		r.head = 0
+		return
+	}
+	r.head = (r.head + n) % len(r.buf)
+}
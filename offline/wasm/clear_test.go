@@ -0,0 +1,150 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// clearedBytes calls tinyemuClearInput and returns what it discarded.
+func clearedBytes(t *testing.T, e *Emulator, args ...interface{}) int {
+	t.Helper()
+	r := e.call(clearInput, args...).(map[string]interface{})
+	if statusOf(r) != string(statusInputCleared) {
+		t.Fatalf("tinyemuClearInput(%v) = %s", args, statusOf(r))
+	}
+	return r["data"].(map[string]interface{})["discarded"].(int)
+}
+
+func TestClearInputDiscardsQueuedInput(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	clk := newVirtualClock()
+	e.clock = clk
+
+	// Queued by sendInput, by the ring and by typing, which has sent its
+	// first character and waits to send the rest
+	e.call(sendInput, "stale keys")
+	p := newRingProducer(64)
+	e.call(bindInputSAB, p.sab)
+	p.publish([]byte("ring"))
+	promise := e.call(typeStringInput, "typed", map[string]interface{}{"perCharDelayMs": 100}).(js.Value)
+	const queued = len("stale keys") + len("ring") + len("t")
+	deadline := time.Now().Add(time.Second)
+	for len(e.reader.Pending()) < queued {
+		if time.Now().After(deadline) {
+			t.Fatalf("input queue holds %q, want %d bytes", e.reader.Pending(), queued)
+		}
+		time.Sleep(ringPollInterval)
+	}
+
+	if n := clearedBytes(t, e); n != queued {
+		t.Errorf("discarded %d bytes, want the %d queued", n, queued)
+	}
+	if got := e.reader.Pending(); len(got) != 0 {
+		t.Errorf("input queue holds %q after the clear", got)
+	}
+	if v, fulfilled := awaitSettled(t, promise); !fulfilled || v.Get("status").String() != string(statusCanceled) {
+		t.Errorf("typing settled with %v, want canceled", v)
+	}
+	// What typing had left isn't sent later
+	advanceMs(clk, 500)
+	time.Sleep(10 * virtualYield)
+
+	// Only input sent afterwards is read
+	e.call(sendInput, "fresh")
+	p.publish([]byte("!"))
+	waitPending(t, e, "fresh!")
+	if got := drain(e.reader); got != "fresh!" {
+		t.Errorf("read %q after the clear, want only the new input", got)
+	}
+	if n := clearedBytes(t, e); n != 0 {
+		t.Errorf("clearing nothing discarded %d bytes", n)
+	}
+}
+
+func TestClearInputDiscardsTheCookedLine(t *testing.T) {
+	e, rec := newTestEmulator(t, nil)
+	e.call(setLineMode, "cooked")
+	typeKeys(t, e, rec, "rm -rf")
+	if n := clearedBytes(t, e); n != len("rm -rf") {
+		t.Errorf("discarded %d bytes of the line being edited, want %d", n, len("rm -rf"))
+	}
+	if _, guest := typeKeys(t, e, rec, "ls\r"); guest != "ls\n" {
+		t.Errorf("the line after the clear reached the guest as %q, want %q", guest, "ls\n")
+	}
+}
+
+func TestClearInputOnOneConsoleOnly(t *testing.T) {
+	debug := newOutputRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"consoles": map[string]interface{}{"debug": debug.fn}})
+	e.call(sendInput, "main")
+	e.call(sendInput, "dbg", "debug")
+
+	if n := clearedBytes(t, e, "debug"); n != len("dbg") {
+		t.Errorf("clearing debug discarded %d bytes, want %d", n, len("dbg"))
+	}
+	if got := e.consoles["debug"].reader.Pending(); len(got) != 0 {
+		t.Errorf("debug still holds %q", got)
+	}
+	if got := string(e.reader.Pending()); got != "main" {
+		t.Errorf("clearing debug left console0 with %q, want %q", got, "main")
+	}
+	if got := statusOf(e.call(clearInput, "nope")); got != string(codeInvalidArgument) {
+		t.Errorf("clearing an unknown console = %s, want invalid_argument", got)
+	}
+}
+
+func TestClearInputBesideAReader(t *testing.T) {
+	e, _ := newTestEmulator(t, map[string]interface{}{"inputReadMode": "block"})
+
+	// A read waiting on an empty queue isn't woken by a clear
+	pending := readAsync(e.reader, 64)
+	clearedBytes(t, e)
+	select {
+	case r := <-pending:
+		t.Fatalf("clear woke the read with %q, %v", r.data, r.err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	e.call(sendInput, "new")
+	if r := <-pending; r.data != "new" || r.err != nil {
+		t.Fatalf("read %q, %v; want the input sent after the clear", r.data, r.err)
+	}
+
+	// Sends and clears racing a reader lose no byte and deliver none twice:
+	// every byte is either read or counted as discarded
+	const rounds = 200
+	done := make(chan int)
+	go func() {
+		read := 0
+		p := make([]byte, 7)
+		for {
+			n, err := e.reader.Read(p)
+			read += n
+			if err != nil {
+				done <- read
+				return
+			}
+		}
+	}()
+	sent, discarded := 0, 0
+	for i := 0; i < rounds; i++ {
+		msg := fmt.Sprintf("key %d;", i)
+		e.call(sendInput, msg)
+		sent += len(msg)
+		if i%3 == 0 {
+			discarded += clearedBytes(t, e)
+		}
+	}
+	// Let the reader take what's left before ending input
+	deadline := time.Now().Add(time.Second)
+	for len(e.reader.Pending()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	e.reader.Close()
+	if read := <-done; read+discarded != sent {
+		t.Errorf("read %d and discarded %d of %d bytes sent", read, discarded, sent)
+	}
+}
@@ -0,0 +1,108 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// clock is the run loop's only time source, so a deterministic run can
+// swap wall time for time derived from the instruction count.
+type clock interface {
+	Now() time.Time
+	// After returns a channel that receives once d of clock time has passed.
+	After(d time.Duration) <-chan time.Time
+	// Advance accounts for n retired instructions.
+	Advance(n int)
+}
+
+// wallClock is real time.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time                         { return time.Now() }
+func (wallClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (wallClock) Advance(int)                            {}
+
+const (
+	// virtualIPS is the nominal CPU speed that converts instructions to
+	// virtual time.
+	virtualIPS = 100e6
+	// virtualYield is the real time a virtual wait still takes. A zero
+	// timer would be run by the Go scheduler without ever returning to the
+	// browser event loop.
+	virtualYield = time.Millisecond
+)
+
+// virtualEpoch is where virtual time starts, so every deterministic run
+// sees the same dates.
+var virtualEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// virtualClock only moves when instructions retire or the run loop waits.
+// Waiting jumps straight to the deadline after a virtualYield, so the run
+// loop runs about as fast as the browser lets it.
+type virtualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newVirtualClock() *virtualClock {
+	return &virtualClock{now: virtualEpoch}
+}
+
+func (c *virtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *virtualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+	now := c.now
+	c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(virtualYield, func() { ch <- now })
+	return ch
+}
+
+func (c *virtualClock) Advance(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(time.Duration(float64(n) / virtualIPS * float64(time.Second)))
+}
+
+// waitUntil blocks until c reaches deadline or stop is closed, reporting
+// whether the deadline was reached. Unlike After it never moves c, so a
+// background wait in a deterministic run follows guest time instead of
+// pushing it forward, and stalls while the guest is paused.
+func waitUntil(c clock, deadline time.Time, stop <-chan struct{}) bool {
+	for {
+		d := deadline.Sub(c.Now())
+		if d <= 0 {
+			return true
+		}
+		if _, virtual := c.(*virtualClock); virtual {
+			d = virtualYield
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-stop:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// newClock returns the clock and device RNG for the given options.
+func newClock(opts options) (clock, *rand.Rand) {
+	if opts.deterministic {
+		return newVirtualClock(), rand.New(rand.NewSource(opts.seed))
+	}
+	return wallClock{}, rand.New(rand.NewSource(time.Now().UnixNano()))
+}
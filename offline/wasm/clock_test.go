@@ -0,0 +1,92 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// entropyMachine prints, on every step, a number from its RNG and the
+// time on its clock and RTC, which is all a real device could vary by.
+func entropyMachine(config machineConfig) machine {
+	return &testMachine{bootSteps: 2, step: func(steps int) {
+		fmt.Fprintf(config.console, "step %d: rand %d, clock %s, rtc %s\n", steps,
+			config.rand.Int63(), config.clock.Now().Format(time.RFC3339Nano), config.rtc.Now().Format(time.RFC3339))
+	}}
+}
+
+// deterministicRun boots entropyMachine with opts and returns its console
+// output up to the end of step 20.
+func deterministicRun(t *testing.T, opts map[string]interface{}) string {
+	t.Helper()
+	e, rec := newTestEmulator(t, opts)
+	e.call(startEmulator)
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(rec.text(), "step 21:") {
+		if time.Now().After(deadline) {
+			t.Fatalf("run didn't reach step 21, output %q", rec.text())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	e.call(stopEmulator)
+	out := rec.text()
+	return out[:strings.Index(out, "step 21:")]
+}
+
+func TestDeterministicRunsReproduce(t *testing.T) {
+	useMachine(t, entropyMachine)
+	opts := map[string]interface{}{"deterministic": true, "seed": 42}
+	first := deterministicRun(t, opts)
+	if second := deterministicRun(t, opts); second != first {
+		t.Fatalf("two runs with seed 42 differ:\n%s\n%s", first, second)
+	}
+	if !strings.Contains(first, "clock 2000-01-01T00:00:00Z") {
+		t.Errorf("virtual time doesn't start at the epoch:\n%s", first)
+	}
+
+	opts["seed"] = 43
+	if other := deterministicRun(t, opts); other == first {
+		t.Error("runs with seeds 42 and 43 print the same numbers")
+	}
+}
+
+func TestVirtualClockFollowsInstructions(t *testing.T) {
+	c := newVirtualClock()
+	c.Advance(virtualIPS / 2)
+	if got := c.Now().Sub(virtualEpoch); got != 500*time.Millisecond {
+		t.Errorf("after half a second's instructions the clock moved %v", got)
+	}
+
+	// Waiting jumps to the deadline, a virtualYield of real time later
+	start := time.Now()
+	at := <-c.After(time.Hour)
+	if got := at.Sub(virtualEpoch); got != time.Hour+500*time.Millisecond {
+		t.Errorf("After(1h) fired at %v past the epoch", got)
+	}
+	if real := time.Since(start); real > 500*time.Millisecond {
+		t.Errorf("a virtual hour took %v of real time", real)
+	}
+
+	// A waitUntil only waits for the guest to get there
+	deadline := c.Now().Add(time.Second)
+	done := make(chan bool, 1)
+	go func() { done <- waitUntil(c, deadline, nil) }()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("waitUntil returned before the clock reached its deadline")
+	default:
+	}
+	c.Advance(virtualIPS)
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("waitUntil reported it was stopped")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitUntil didn't return once the clock passed its deadline")
+	}
+}
@@ -0,0 +1,61 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall/js"
+)
+
+// maxCmdlineLength is the kernel's COMMAND_LINE_SIZE on RISC-V, less the
+// terminating NUL.
+const maxCmdlineLength = 1023
+
+// validateCmdline checks that s fits the kernel's command line buffer.
+func validateCmdline(s string) error {
+	if len(s) > maxCmdlineLength {
+		return fmt.Errorf("cmdline is %d bytes, limit is %d", len(s), maxCmdlineLength)
+	}
+	if strings.ContainsAny(s, "\x00\n") {
+		return fmt.Errorf("cmdline must be a single line without NUL bytes")
+	}
+	return nil
+}
+
+// cmdlineOption reads the cmdline option, the kernel command line.
+func cmdlineOption(v js.Value) (string, error) {
+	c := v.Get("cmdline")
+	if c.IsUndefined() || c.IsNull() {
+		return "", nil
+	}
+	if c.Type() != js.TypeString {
+		return "", fmt.Errorf("cmdline must be a string, got %s", c.Type())
+	}
+	return c.String(), validateCmdline(c.String())
+}
+
+// setCmdline stages the kernel command line for the next start. The
+// command line is read once at boot, so while a run is in progress the
+// call is ignored with a warning.
+func setCmdline(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	cmdline, err := stringArg(args, 0, "cmdline")
+	if err != nil {
+		return errorResult(err)
+	}
+	if err := validateCmdline(cmdline); err != nil {
+		return errorResult(err)
+	}
+
+	if e.isStarted() {
+		// Console logging waits on the event loop, so it can't block this callback
+		go e.log.Warnf("cmdline ignored: the kernel has already booted, stop and start again to apply it")
+		return statusResult(statusIgnored, map[string]interface{}{"reason": "running"})
+	}
+	e.cmdline = cmdline
+	return statusResult(statusCmdlineSet, map[string]interface{}{"cmdline": cmdline})
+}
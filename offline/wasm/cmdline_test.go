@@ -0,0 +1,90 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// cmdlineEmulator returns an instance created with opts and a pointer to
+// the cmdline its machine was built with.
+func cmdlineEmulator(t *testing.T, opts map[string]interface{}) (*Emulator, *string) {
+	got := new(string)
+	useMachine(t, func(config machineConfig) machine {
+		*got = config.cmdline
+		return &testMachine{}
+	})
+	e, _ := newTestEmulator(t, opts)
+	return e, got
+}
+
+func TestCmdlineReachesTheMachine(t *testing.T) {
+	const cmdline = "console=ttyS0 root=/dev/vda rw"
+	e, got := cmdlineEmulator(t, map[string]interface{}{"cmdline": cmdline})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if *got != cmdline {
+		t.Errorf("machine built with cmdline %q, want %q", *got, cmdline)
+	}
+
+	// tinyemuSetCmdline before the next start replaces it
+	e.call(stopEmulator)
+	result := e.call(setCmdline, "init=/bin/sh").(map[string]interface{})
+	if statusOf(result) != string(statusCmdlineSet) || result["data"].(map[string]interface{})["cmdline"] != "init=/bin/sh" {
+		t.Fatalf("tinyemuSetCmdline = %v", result)
+	}
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if *got != "init=/bin/sh" {
+		t.Errorf("after tinyemuSetCmdline the machine got %q", *got)
+	}
+}
+
+func TestSetCmdlineWhileRunningIsIgnored(t *testing.T) {
+	rec := newLogRecorder(t)
+	e, got := cmdlineEmulator(t, map[string]interface{}{"cmdline": "quiet", "onLog": rec.fn})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+
+	result := e.call(setCmdline, "debug").(map[string]interface{})
+	if statusOf(result) != string(statusIgnored) || result["data"].(map[string]interface{})["reason"] != "running" {
+		t.Errorf("tinyemuSetCmdline while running = %v, want ignored", result)
+	}
+	// The warning is logged from another goroutine
+	warned := func() bool { return strings.Contains(strings.Join(rec.lines, "\n"), "warn|[warn] cmdline ignored") }
+	for deadline := time.Now().Add(time.Second); !warned() && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !warned() {
+		t.Errorf("no warning logged, got %q", rec.lines)
+	}
+
+	// It doesn't carry over to the next boot either
+	e.call(stopEmulator)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if *got != "quiet" {
+		t.Errorf("restart booted with cmdline %q, want the staged %q", *got, "quiet")
+	}
+}
+
+func TestCmdlineIsValidated(t *testing.T) {
+	bad := []interface{}{42, strings.Repeat("x", maxCmdlineLength+1), "two\nlines", "nul\x00byte"}
+	for _, cmdline := range bad {
+		if msg := initError(t, map[string]interface{}{"cmdline": cmdline}); !strings.Contains(msg, "cmdline") {
+			t.Errorf("cmdline option %.20q: error %q doesn't name it", cmdline, msg)
+		}
+	}
+
+	e, _ := newTestEmulator(t, nil)
+	for _, cmdline := range bad {
+		if got := statusOf(e.call(setCmdline, cmdline)); got != string(codeInvalidArgument) {
+			t.Errorf("tinyemuSetCmdline(%.20q) = %s, want invalid_argument", cmdline, got)
+		}
+	}
+	if got := statusOf(e.call(setCmdline, strings.Repeat("x", maxCmdlineLength))); got != string(statusCmdlineSet) {
+		t.Errorf("cmdline at the limit = %s, want cmdline_set", got)
+	}
+}
@@ -0,0 +1,93 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"syscall/js"
+)
+
+// Compression modes accepted by the image load functions.
+const (
+	compressionAuto = "auto"
+	compressionNone = "none"
+	compressionGzip = "gzip"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressionOption reads the "compression" field of an optional options
+// object, defaulting to auto-detection.
+func compressionOption(opts js.Value) (string, error) {
+	if opts.Type() != js.TypeObject {
+		return compressionAuto, nil
+	}
+	v := opts.Get("compression")
+	if v.IsUndefined() || v.IsNull() {
+		return compressionAuto, nil
+	}
+	if v.Type() != js.TypeString {
+		return "", fmt.Errorf("compression must be a string, got %s", v.Type())
+	}
+	switch mode := v.String(); mode {
+	case compressionAuto, compressionNone, compressionGzip:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown compression %q, want none, gzip or auto", mode)
+	}
+}
+
+// decompressImage returns data decompressed according to mode. In auto
+// mode gzip is detected by its magic bytes. An onProgress callback hears
+// how much of data has been consumed; decompression stops once ctx is done.
+func decompressImage(ctx context.Context, data []byte, mode string, onProgress js.Value) ([]byte, error) {
+	if mode == compressionNone || (mode == compressionAuto && !bytes.HasPrefix(data, gzipMagic)) {
+		return data, nil
+	}
+
+	p := newProgress(onProgress, "decompress", int64(len(data)))
+	in := &progressReader{r: &contextReader{ctx: ctx, r: bytes.NewReader(data)}, progress: p}
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing image: %w", err)
+	}
+	defer zr.Close()
+
+	// Read one byte past the limit to tell "exactly at" from "over"
+	out, err := io.ReadAll(io.LimitReader(zr, maxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing image: %w", err)
+	}
+	if len(out) > maxImageSize {
+		return nil, fmt.Errorf("decompressed image exceeds %d bytes", maxImageSize)
+	}
+	p.finish(in.n)
+	return out, nil
+}
+
+// loadImageArg copies an image argument out of JS and decompresses it per
+// the options object that follows it, if any.
+func loadImageArg(args []js.Value) ([]byte, error) {
+	opts, err := optionalObjectArg(args, 1, "options")
+	if err != nil {
+		return nil, err
+	}
+	mode, err := compressionOption(opts)
+	if err != nil {
+		return nil, err
+	}
+	onProgress, err := progressOption(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := imageFromJS(arg(args, 0))
+	if err != nil {
+		return nil, err
+	}
+	return decompressImage(context.Background(), data, mode, onProgress)
+}
@@ -0,0 +1,107 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math/rand/v2"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+// gzipBytes compresses data the way a server would before sending it.
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadKernelCompressionModes(t *testing.T) {
+	// Noise after the magic keeps the compressed form big enough to be
+	// staged as a raw kernel when it's left alone
+	elf := make([]byte, 8192)
+	rand.NewChaCha8([32]byte{}).Read(elf)
+	copy(elf, "\x7fELF")
+	gz := gzipBytes(t, elf)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		mode    string // "" leaves the option out
+		want    []byte
+	}{
+		{"raw, detected", elf, "", elf},
+		{"gzip, detected", gz, "", elf},
+		{"gzip, auto", gz, compressionAuto, elf},
+		{"gzip, forced", gz, compressionGzip, elf},
+		{"gzip, left alone", gz, compressionNone, gz},
+	}
+	for _, tt := range tests {
+		e, _ := newTestEmulator(t, nil)
+		args := []interface{}{bytesToJS(tt.payload)}
+		if tt.mode != "" {
+			args = append(args, map[string]interface{}{"compression": tt.mode})
+		}
+		if got := statusOf(e.call(loadKernel, args...)); got != string(statusKernelLoaded) {
+			t.Errorf("%s: tinyemuLoadKernel = %s", tt.name, got)
+			continue
+		}
+		if !bytes.Equal(e.kernel.data, tt.want) {
+			t.Errorf("%s: staged a %d-byte kernel, want %d bytes", tt.name, len(e.kernel.data), len(tt.want))
+		}
+	}
+}
+
+func TestLoadDiskDecompressesGzip(t *testing.T) {
+	img := diskImage(8)
+	e, _ := newTestEmulator(t, nil)
+	result := e.call(loadDisk, bytesToJS(gzipBytes(t, img)))
+	if got := statusOf(result); got != string(statusDiskLoaded) {
+		t.Fatalf("tinyemuLoadDisk = %s", got)
+	}
+	if got := e.disks[0].(*memDisk).data; !bytes.Equal(got, img) {
+		t.Errorf("vda holds %d bytes, want the %d-byte image", len(got), len(img))
+	}
+}
+
+func TestCorruptGzipIsReported(t *testing.T) {
+	gz := gzipBytes(t, diskImage(8))
+	flipped := append([]byte(nil), gz...)
+	flipped[len(flipped)-6] ^= 0xff // inside the CRC-32 trailer
+
+	tests := []struct {
+		name    string
+		payload []byte
+		mode    string
+	}{
+		{"truncated", gz[:len(gz)/2], compressionAuto},
+		{"bad checksum", flipped, compressionAuto},
+		{"bad header", []byte{0x1f, 0x8b, 0xff, 0xff}, compressionAuto},
+		{"raw but gzip forced", diskImage(1), compressionGzip},
+	}
+	for _, tt := range tests {
+		e, _ := newTestEmulator(t, nil)
+		for name, fn := range map[string]func(js.Value, []js.Value) interface{}{
+			"tinyemuLoadKernel": loadKernel,
+			"tinyemuLoadDisk":   loadDisk,
+		} {
+			result := e.call(fn, bytesToJS(tt.payload), map[string]interface{}{"compression": tt.mode}).(map[string]interface{})
+			if statusOf(result) != string(codeInvalidArgument) {
+				t.Errorf("%s: %s = %s, want invalid_argument", tt.name, name, statusOf(result))
+				continue
+			}
+			if msg := result["error"].(map[string]interface{})["message"].(string); !strings.HasPrefix(msg, "decompressing image") {
+				t.Errorf("%s: %s failed with %q, which doesn't name decompression", tt.name, name, msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,862 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"syscall/js"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultFlushInterval is how long a buffered ConsoleWriter holds output
+// before delivering it, roughly one animation frame.
+const DefaultFlushInterval = 16 * time.Millisecond
+
+// flushThreshold is the amount of buffered output that triggers an immediate
+// flush regardless of the timer.
+const flushThreshold = 4096
+
+// rateBurst is how much input a rate-limited ConsoleReader lets through
+// at once after a quiet spell, in time at the configured rate.
+const rateBurst = 250 * time.Millisecond
+
+// DefaultMaxBuffered caps how many input bytes a ConsoleReader holds for
+// the guest, so a huge paste into a guest that isn't reading can't grow
+// the WASM heap without bound.
+const DefaultMaxBuffered = 1 << 20
+
+// ConsoleWriter writes to the JavaScript console and/or a callback function.
+//
+// With a non-zero flush interval, writes are coalesced and delivered in a
+// single callback when the interval elapses or the buffer reaches
+// flushThreshold, which keeps chatty guests from crossing into JS per byte.
+type ConsoleWriter struct {
+	callback js.Value
+	interval time.Duration
+
+	// Encoding is how output bytes are converted for the callbacks. In
+	// raw mode they get a Uint8Array, so bytes that aren't valid UTF-8
+	// reach JS unchanged.
+	Encoding consoleEncoding
+
+	// stripANSI removes escape sequences such as colors from what the
+	// primary callback gets. Sinks still see the raw output.
+	stripANSI atomic.Bool
+	stripper  ansiStripper
+
+	// Name, if set, is passed to the callbacks after each chunk, so one
+	// function can serve several consoles.
+	Name string
+
+	// Tap, if set, sees every Write as it happens, before coalescing.
+	Tap func(p []byte)
+
+	// FlushOnNewline holds back a partial line until its newline arrives
+	// or Flush is called, so a UI that re-renders per chunk never shows
+	// half a line. A partial line that reaches flushThreshold goes out
+	// anyway, and a prompt waiting for input only appears on Flush.
+	FlushOnNewline bool
+
+	// DisableFailing stops calling a callback or sink once it throws, as
+	// one for an unmounted terminal will on every chunk. Either way the
+	// first throw of each is logged and Write carries on.
+	DisableFailing bool
+
+	// onEvent, if set, receives output parsed into structured VT events.
+	onEvent js.Value
+	parser  vtParser
+
+	// Clock timestamps what the meter reports; nil means the wall clock.
+	Clock clock
+	meter outputMeter
+
+	mu      sync.Mutex
+	pending []byte
+	timer   *time.Timer
+
+	// flushMu serializes deliveries so flushed chunks stay in order.
+	flushMu sync.Mutex
+
+	// Extra output callbacks that receive the same chunks as callback
+	sinksMu    sync.Mutex
+	sinks      []outputSink
+	nextSinkID int
+	failed     map[int]bool // ids of callbacks that have thrown
+}
+
+// Ids for the callbacks that aren't sinks, which count up from 1.
+const (
+	primaryCallback = 0
+	eventCallback   = -1
+	meterCallback   = -2
+)
+
+// outputSink is an additional output callback registered with AddSink, or
+// a Go function registered with AddSinkFunc.
+type outputSink struct {
+	id   int
+	fn   js.Value
+	goFn func(chunk js.Value, n int)
+}
+
+// NewConsoleWriter creates a ConsoleWriter that invokes callback with output.
+// A flushInterval of zero delivers every Write immediately.
+func NewConsoleWriter(callback js.Value, flushInterval time.Duration) *ConsoleWriter {
+	return &ConsoleWriter{callback: callback, interval: flushInterval}
+}
+
+func (c *ConsoleWriter) Write(p []byte) (n int, err error) {
+	if c.Tap != nil {
+		c.Tap(p)
+	}
+	if c.interval <= 0 && !c.FlushOnNewline {
+		c.flushMu.Lock()
+		c.deliver(p)
+		c.flushMu.Unlock()
+		return len(p), nil
+	}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, p...)
+	full := len(c.pending) >= flushThreshold || c.interval <= 0
+	if !full && c.timer == nil {
+		c.timer = time.AfterFunc(c.interval, c.flushLines)
+	}
+	c.mu.Unlock()
+
+	if full {
+		c.flushLines()
+	}
+	return len(p), nil
+}
+
+// Flush delivers any buffered output immediately, partial line included.
+func (c *ConsoleWriter) Flush() {
+	c.flush(true)
+}
+
+// flushLines is Flush for the timer and a full buffer, which leave a
+// partial line buffered under FlushOnNewline.
+func (c *ConsoleWriter) flushLines() {
+	c.flush(false)
+}
+
+func (c *ConsoleWriter) flush(all bool) {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	data := c.pending
+	c.pending = nil
+	if c.FlushOnNewline && !all {
+		data, c.pending = splitPartialLine(data)
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+
+	if len(data) > 0 {
+		c.deliver(data)
+	}
+}
+
+// splitPartialLine splits data after its last newline, returning the
+// complete lines and a copy of the partial line after them. A partial line
+// of flushThreshold bytes or more isn't held back.
+func splitPartialLine(data []byte) (lines, partial []byte) {
+	i := bytes.LastIndexByte(data, '\n')
+	if len(data)-(i+1) >= flushThreshold {
+		return data, nil
+	}
+	if i+1 < len(data) {
+		partial = append(partial, data[i+1:]...)
+	}
+	return data[:i+1], partial
+}
+
+// SetCallback replaces the callback given to NewConsoleWriter. One
+// disabled for throwing is enabled again.
+func (c *ConsoleWriter) SetCallback(fn js.Value) {
+	c.flushMu.Lock()
+	c.callback = fn
+	c.flushMu.Unlock()
+	c.sinksMu.Lock()
+	delete(c.failed, primaryCallback)
+	c.sinksMu.Unlock()
+}
+
+// SetEventCallback registers fn to receive output as structured events
+// such as {type:"text"}, {type:"bell"} and {type:"title"}.
+func (c *ConsoleWriter) SetEventCallback(fn js.Value) {
+	c.flushMu.Lock()
+	c.onEvent = fn
+	c.flushMu.Unlock()
+}
+
+// AddSink registers fn to receive every chunk delivered to the primary
+// callback, and returns an id for RemoveSink.
+func (c *ConsoleWriter) AddSink(fn js.Value) int {
+	c.sinksMu.Lock()
+	defer c.sinksMu.Unlock()
+
+	c.nextSinkID++
+	c.sinks = append(c.sinks, outputSink{id: c.nextSinkID, fn: fn})
+	return c.nextSinkID
+}
+
+// AddSinkFunc is AddSink for Go code: fn gets each chunk as the JS value
+// callbacks receive, along with its length in bytes. It runs on the
+// delivering goroutine rather than inside a JS callback, so it may block.
+func (c *ConsoleWriter) AddSinkFunc(fn func(chunk js.Value, n int)) int {
+	c.sinksMu.Lock()
+	defer c.sinksMu.Unlock()
+
+	c.nextSinkID++
+	c.sinks = append(c.sinks, outputSink{id: c.nextSinkID, goFn: fn})
+	return c.nextSinkID
+}
+
+// RemoveSink unregisters a sink, reporting whether id was registered.
+func (c *ConsoleWriter) RemoveSink(id int) bool {
+	c.sinksMu.Lock()
+	defer c.sinksMu.Unlock()
+
+	for i, s := range c.sinks {
+		if s.id == id {
+			c.sinks = append(c.sinks[:i:i], c.sinks[i+1:]...)
+			delete(c.failed, id)
+			return true
+		}
+	}
+	return false
+}
+
+// terminalState is what the guest's output has set up on the terminal
+// that outlasts the output itself.
+type terminalState struct {
+	cursor         vtCursor
+	bracketedPaste bool
+}
+
+// terminalState returns the terminal state as of the last delivery.
+func (c *ConsoleWriter) terminalState() terminalState {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+	return terminalState{cursor: c.parser.cursor, bracketedPaste: c.parser.bracketedPaste.Load()}
+}
+
+// setTerminalState puts the terminal back in state s, as if the guest's
+// output had left it there.
+func (c *ConsoleWriter) setTerminalState(s terminalState) {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+	c.parser.cursor = s.cursor
+	c.parser.cursor.clamp(c.parser.cols, c.parser.rows)
+	c.parser.bracketedPaste.Store(s.bracketedPaste)
+	c.parser.publishCursor()
+}
+
+// BracketedPaste reports whether the guest has enabled bracketed paste mode.
+func (c *ConsoleWriter) BracketedPaste() bool {
+	return c.parser.bracketedPaste.Load()
+}
+
+// Cursor returns the guest's cursor as parsed from delivered output.
+func (c *ConsoleWriter) Cursor() vtCursor {
+	return c.parser.Cursor()
+}
+
+// SetSize tells the parser the terminal dimensions to clamp the cursor to.
+func (c *ConsoleWriter) SetSize(ws winsize) {
+	c.parser.SetSize(ws)
+}
+
+// SetStripANSI turns escape sequence removal for the primary callback on
+// or off, from the next chunk delivered.
+func (c *ConsoleWriter) SetStripANSI(on bool) {
+	c.stripANSI.Store(on)
+}
+
+// StripANSI reports whether escape sequences are removed for the primary
+// callback.
+func (c *ConsoleWriter) StripANSI() bool {
+	return c.stripANSI.Load()
+}
+
+func (c *ConsoleWriter) deliver(p []byte) {
+	// The parser always runs so terminal modes are tracked even when
+	// nobody is listening for events
+	c.parser.bytewise = c.Encoding != encodingUTF8
+	c.parser.Feed(p, func(e vtEvent) {
+		if c.onEvent.Type() != js.TypeFunction {
+			return
+		}
+		if err := safeInvoke(c.onEvent, e.toJS()); err != nil {
+			c.callbackFailed(eventCallback, err)
+		}
+	})
+
+	c.measure(len(p))
+
+	c.sinksMu.Lock()
+	sinks := c.sinks
+	c.sinksMu.Unlock()
+	if c.callback.Type() != js.TypeFunction && len(sinks) == 0 {
+		// Nobody wants the text, so don't build it
+		return
+	}
+	out := c.Encoding.decode(p)
+
+	var err error
+	if !c.StripANSI() {
+		err = invokeOutput(c.callback, out, c.Name)
+	} else if plain := c.stripper.Strip(p); len(plain) > 0 {
+		err = invokeOutput(c.callback, c.Encoding.decode(plain), c.Name)
+	}
+	if err != nil {
+		c.callbackFailed(primaryCallback, err)
+	}
+	for _, s := range sinks {
+		if s.goFn != nil {
+			s.goFn(js.ValueOf(out), len(p))
+			continue
+		}
+		if err := invokeOutput(s.fn, out, c.Name); err != nil {
+			c.callbackFailed(s.id, err)
+		}
+	}
+}
+
+// callbackFailed handles a throw from the callback or sink with the given
+// id. It runs from deliver, under flushMu.
+func (c *ConsoleWriter) callbackFailed(id int, err error) {
+	c.sinksMu.Lock()
+	first := !c.failed[id]
+	if c.failed == nil {
+		c.failed = make(map[int]bool)
+	}
+	c.failed[id] = true
+	c.sinksMu.Unlock()
+
+	if first {
+		what := "output callback"
+		switch {
+		case id == eventCallback:
+			what = "event callback"
+		case id == meterCallback:
+			what = "output meter"
+		case id > 0:
+			what = fmt.Sprintf("output sink %d", id)
+		}
+		if c.Name != "" {
+			what += " of " + c.Name
+		}
+		action := "further throws are not logged"
+		if c.DisableFailing {
+			action = "it is disabled"
+		}
+		// Deliveries can run inside a JS callback, where console logging
+		// would wait on the event loop forever
+		go defaultLogger.Warnf("%s failed, %s: %v", what, action, err)
+	}
+	if !c.DisableFailing {
+		return
+	}
+	switch id {
+	case primaryCallback:
+		c.callback = js.Undefined()
+	case eventCallback:
+		c.onEvent = js.Undefined()
+	case meterCallback:
+		c.meter.fn = js.Undefined()
+	default:
+		c.RemoveSink(id)
+	}
+}
+
+// safeInvoke calls fn, returning a throw as an error instead of a panic.
+func safeInvoke(fn js.Value, args ...interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	fn.Invoke(args...)
+	return nil
+}
+
+// invokeOutput calls an output callback, skipping ones that aren't
+// functions and returning a throw so one bad sink can't stop the others.
+func invokeOutput(fn js.Value, out interface{}, name string) error {
+	if fn.Type() != js.TypeFunction {
+		return nil
+	}
+	if name != "" {
+		return safeInvoke(fn, out, name)
+	}
+	return safeInvoke(fn, out)
+}
+
+// OverflowPolicy controls what ConsoleReader.Write does when the input queue
+// is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for the reader to make room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the data being written.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued data to make room.
+	OverflowDropOldest
+	// OverflowError refuses the data and returns ErrInputFull.
+	OverflowError
+)
+
+var (
+	// ErrInputFull is returned by Write under OverflowError when the queue is full.
+	ErrInputFull = errors.New("input buffer full")
+	// ErrInputDropped is returned by Write under OverflowDropNewest when the
+	// data was discarded.
+	ErrInputDropped = errors.New("input dropped")
+	// ErrInputClosed is returned by Write once Close has been called, as
+	// the guest will never read the data.
+	ErrInputClosed = errors.New("input closed")
+)
+
+// ConsoleReader reads input from a JavaScript callback.
+//
+// Read distinguishes "nothing yet" from "no more":
+//
+//   - open with input queued: (n > 0, nil)
+//   - open and empty: (0, nil) in the default non-blocking mode, so the
+//     guest console keeps polling; blocking mode instead parks until input
+//     arrives, so consumers don't have to spin, and with ReadTimeout set
+//     Read parks at most that long before returning (0, nil)
+//   - closed with input still queued: (n > 0, nil) until it is drained
+//   - closed and drained: (0, io.EOF), on every call from then on
+//
+// In blocking mode a canceled context also ends a parked Read with
+// io.EOF. A Write racing Close may or may not be delivered.
+//
+// Input is queued in a ring buffer under a lock, which Read copies out of
+// directly, so a keystroke costs no channel send and, once the ring has
+// grown to the working size, no allocation.
+type ConsoleReader struct {
+	blocking  bool
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// avail is signalled, without blocking, each time Write queues input,
+	// to wake a parked Read. A stale signal only makes Read look again.
+	avail chan struct{}
+
+	// Policy decides what Write does when MaxBuffered would be exceeded.
+	Policy OverflowPolicy
+
+	// MaxBuffered is the most input bytes held at once; 0 means no limit.
+	// A single Write larger than this can never fit and fails with
+	// ErrInputFull whatever the policy.
+	MaxBuffered int
+
+	// ReadTimeout, if non-zero, makes a non-blocking Read wait that long
+	// for input before reporting none, like ReadWithTimeout.
+	ReadTimeout time.Duration
+
+	// Rate, if non-zero, is the most input bytes per second Read hands
+	// out, measured on Clock, so a burst reaches the guest as a steady
+	// stream instead of overflowing its TTY. Input over the rate stays
+	// queued and counted against MaxBuffered. A blocking Read waits on
+	// Clock for its share, so Clock must not depend on that Read
+	// returning.
+	Rate  int
+	Clock clock
+
+	rateMu   sync.Mutex
+	tokens   float64
+	refilled time.Time
+
+	mu  sync.Mutex
+	ctx context.Context
+
+	// queue holds bytes accepted by Write and not yet returned by Read.
+	// room is closed and replaced when Read frees space, if a blocked
+	// Write asked for it since the last time. clears counts Clear calls,
+	// so a Write blocked across one drops its data too.
+	sizeMu     sync.Mutex
+	queue      byteRing
+	room       chan struct{}
+	roomWanted bool
+	clears     int
+
+	// When the guest last found no input, and whether a blocking Read is
+	// parked right now, so a watchdog can tell waiting from wedged.
+	waitMu    sync.Mutex
+	lastEmpty time.Time
+	parked    bool
+}
+
+func NewConsoleReader() *ConsoleReader {
+	return NewConsoleReaderWithMode(false)
+}
+
+// NewConsoleReaderWithMode creates a ConsoleReader, optionally in blocking mode.
+func NewConsoleReaderWithMode(blocking bool) *ConsoleReader {
+	return NewConsoleReaderWithPolicy(blocking, OverflowBlock)
+}
+
+// NewConsoleReaderWithPolicy creates a ConsoleReader with the given read mode
+// and overflow policy.
+func NewConsoleReaderWithPolicy(blocking bool, policy OverflowPolicy) *ConsoleReader {
+	return &ConsoleReader{
+		blocking:    blocking,
+		closed:      make(chan struct{}),
+		avail:       make(chan struct{}, 1),
+		Policy:      policy,
+		MaxBuffered: DefaultMaxBuffered,
+		ctx:         context.Background(),
+		room:        make(chan struct{}),
+	}
+}
+
+// Buffered returns how many input bytes are waiting to be read.
+func (c *ConsoleReader) Buffered() int {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+	return c.queue.Len()
+}
+
+// Pending returns a copy of the input queued and not yet read.
+func (c *ConsoleReader) Pending() []byte {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+	p := make([]byte, c.queue.Len())
+	c.queue.Peek(p)
+	return p
+}
+
+// AwaitingInput reports whether the guest has been waiting for input since
+// the given time: a blocking Read is parked, or a Read found nothing.
+func (c *ConsoleReader) AwaitingInput(since time.Time) bool {
+	c.waitMu.Lock()
+	defer c.waitMu.Unlock()
+	return c.parked || !c.lastEmpty.Before(since)
+}
+
+func (c *ConsoleReader) setParked(parked bool) {
+	c.waitMu.Lock()
+	c.parked = parked
+	c.waitMu.Unlock()
+}
+
+func (c *ConsoleReader) markEmpty() {
+	c.waitMu.Lock()
+	c.lastEmpty = time.Now()
+	c.waitMu.Unlock()
+}
+
+// allow takes up to n bytes from the rate limiter and returns how many
+// may be read now, with n when there is no limit.
+func (c *ConsoleReader) allow(n int) int {
+	if c.Rate <= 0 {
+		return n
+	}
+	c.rateMu.Lock()
+	defer c.rateMu.Unlock()
+
+	now := c.rateClock().Now()
+	burst := math.Max(1, float64(c.Rate)*rateBurst.Seconds())
+	if c.refilled.IsZero() {
+		c.tokens = burst
+	} else {
+		c.tokens = math.Min(burst, c.tokens+now.Sub(c.refilled).Seconds()*float64(c.Rate))
+	}
+	c.refilled = now
+
+	if k := int(c.tokens); k < n {
+		n = k
+	}
+	c.tokens -= float64(n)
+	return n
+}
+
+func (c *ConsoleReader) rateClock() clock {
+	if c.Clock == nil {
+		return wallClock{}
+	}
+	return c.Clock
+}
+
+// nextAllowed returns when the rate limiter next has a byte to give.
+func (c *ConsoleReader) nextAllowed() time.Time {
+	c.rateMu.Lock()
+	defer c.rateMu.Unlock()
+
+	missing := 1 - c.tokens
+	return c.refilled.Add(time.Duration(missing / float64(c.Rate) * float64(time.Second)))
+}
+
+// enqueue adds data to the queue if it fits under MaxBuffered and Clear
+// hasn't been called since clears was read. If it doesn't fit, it returns
+// a channel closed the next time space is freed.
+func (c *ConsoleReader) enqueue(data []byte, clears int) (<-chan struct{}, bool, error) {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+
+	if c.clears != clears {
+		return nil, false, ErrInputDropped
+	}
+	if c.MaxBuffered > 0 && c.queue.Len()+len(data) > c.MaxBuffered {
+		c.roomWanted = true
+		return c.room, false, nil
+	}
+	c.queue.Write(data)
+	return nil, true, nil
+}
+
+// Clear discards all queued input without handing it to Read and returns
+// how many bytes it dropped. A Write waiting for room returns
+// ErrInputDropped rather than queue its data afterwards.
+func (c *ConsoleReader) Clear() int {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+
+	n := c.queue.Len()
+	c.clears++
+	c.roomWanted = true
+	c.discardLocked(n)
+	select {
+	case <-c.avail:
+	default:
+	}
+	return n
+}
+
+// discard drops the first n queued bytes and wakes writers waiting for
+// room.
+func (c *ConsoleReader) discard(n int) {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+	c.discardLocked(n)
+}
+
+// discardLocked is called with sizeMu held.
+func (c *ConsoleReader) discardLocked(n int) {
+	c.queue.Discard(n)
+	if c.roomWanted {
+		close(c.room)
+		c.room = make(chan struct{})
+		c.roomWanted = false
+	}
+}
+
+// SetContext sets the context a blocking Read waits on. Canceling it
+// unblocks any pending Read, which then returns io.EOF.
+func (c *ConsoleReader) SetContext(ctx context.Context) {
+	c.mu.Lock()
+	c.ctx = ctx
+	c.mu.Unlock()
+}
+
+func (c *ConsoleReader) context() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ctx
+}
+
+func (c *ConsoleReader) Read(p []byte) (n int, err error) {
+	switch {
+	case c.blocking:
+		return c.read(p, true, nil)
+	case c.ReadTimeout > 0:
+		return c.ReadWithTimeout(p, c.ReadTimeout)
+	default:
+		return c.read(p, false, nil)
+	}
+}
+
+// ReadWithTimeout is Read that waits up to d of real time for input when
+// none is queued, then returns (0, nil) as an empty poll would. A guest
+// polling its TTY this way neither spins nor blocks for good.
+func (c *ConsoleReader) ReadWithTimeout(p []byte, d time.Duration) (int, error) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	return c.read(p, true, timer.C)
+}
+
+// read implements Read. With wait set it parks for input until timeout
+// fires, if it isn't nil.
+func (c *ConsoleReader) read(p []byte, wait bool, timeout <-chan time.Time) (int, error) {
+	// Everything queued is read together, so one Read can return a burst
+	// of Writes
+	for c.Buffered() == 0 && wait && !c.isClosed() {
+		// Park until input arrives or the reader is closed or canceled
+		woken, err := c.park(timeout)
+		if err != nil {
+			return 0, err
+		}
+		if !woken {
+			break
+		}
+	}
+	if c.Buffered() > 0 {
+		return c.readLimited(p)
+	}
+
+	if c.isClosed() {
+		return 0, io.EOF
+	}
+	c.markEmpty()
+	return 0, nil
+}
+
+// park waits for a Write to signal input, reporting whether one did. It
+// returns io.EOF if the context is canceled first.
+func (c *ConsoleReader) park(timeout <-chan time.Time) (bool, error) {
+	c.setParked(true)
+	defer c.setParked(false)
+	select {
+	case <-c.avail:
+		return true, nil
+	case <-c.closed:
+		return false, nil
+	case <-c.context().Done():
+		return false, io.EOF
+	case <-timeout:
+		return false, nil
+	}
+}
+
+// readLimited is readBuffered within the rate limit. With nothing allowed
+// yet a non-blocking Read returns (0, nil) without counting as finding no
+// input, and a blocking one waits for the next byte's turn.
+func (c *ConsoleReader) readLimited(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		n := c.allow(len(p))
+		if n > 0 {
+			return c.readBuffered(p[:n])
+		}
+		if !c.blocking {
+			return 0, nil
+		}
+		if !waitUntil(c.rateClock(), c.nextAllowed(), c.context().Done()) {
+			return 0, io.EOF
+		}
+	}
+}
+
+// readBuffered copies from the queue into p without splitting a multi-byte
+// UTF-8 sequence whose remaining bytes are still queued.
+func (c *ConsoleReader) readBuffered(p []byte) (int, error) {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+
+	n := c.queue.Peek(p)
+	if n < c.queue.Len() {
+		n = runeBoundary(p[:n])
+	}
+	c.discardLocked(n)
+	return n, nil
+}
+
+// runeBoundary returns how many bytes of p, a prefix of input that goes
+// on past it, to hand out. It backs off to the start of a rune that would
+// be cut short, unless that rune is the very first one, in which case it
+// returns all of p so a tiny destination still makes progress.
+func runeBoundary(p []byte) int {
+	max := len(p)
+	for i := max - 1; i >= 0 && i > max-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(p[i]) {
+			continue
+		}
+		if utf8.FullRune(p[i:max]) || i == 0 {
+			return max
+		}
+		return i
+	}
+	return max
+}
+
+// Close signals end of input. Data already written is still returned by
+// Read; after that Read returns io.EOF. Close is safe to call repeatedly.
+func (c *ConsoleReader) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *ConsoleReader) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Write queues data for Read. When MaxBuffered would be exceeded, the
+// reader's Policy decides whether to wait, drop data, or return
+// ErrInputFull. After Close, including while waiting for room, it returns
+// ErrInputClosed. Write copies data, so the caller may reuse it.
+func (c *ConsoleReader) Write(data []byte) error {
+	if c.isClosed() {
+		return ErrInputClosed
+	}
+	// Empty writes would wake a blocking Read with nothing to return
+	if len(data) == 0 {
+		return nil
+	}
+	if c.MaxBuffered > 0 && len(data) > c.MaxBuffered {
+		return ErrInputFull
+	}
+
+	c.sizeMu.Lock()
+	clears := c.clears
+	c.sizeMu.Unlock()
+
+	for {
+		room, ok, err := c.enqueue(data, clears)
+		if err != nil {
+			return err
+		}
+		if ok {
+			select {
+			case c.avail <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+
+		switch c.Policy {
+		case OverflowDropNewest:
+			return ErrInputDropped
+		case OverflowError:
+			return ErrInputFull
+		case OverflowDropOldest:
+			// Make just enough room by dropping the oldest queued bytes
+			c.discard(c.Buffered() + len(data) - c.MaxBuffered)
+			continue
+		}
+
+		select {
+		case <-room:
+		case <-c.closed:
+			return ErrInputClosed
+		}
+	}
+}
+
+// Verify io.Writer and io.Reader interfaces are satisfied
+var _ io.Writer = (*ConsoleWriter)(nil)
+var _ io.ReadCloser = (*ConsoleReader)(nil)
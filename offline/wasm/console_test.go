@@ -0,0 +1,939 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"syscall/js"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// readResult is what a Read running in a goroutine returned.
+type readResult struct {
+	data string
+	err  error
+}
+
+// readAsync runs one Read in a goroutine and returns its result channel.
+func readAsync(r *ConsoleReader, size int) <-chan readResult {
+	ch := make(chan readResult, 1)
+	go func() {
+		p := make([]byte, size)
+		n, err := r.Read(p)
+		ch <- readResult{string(p[:n]), err}
+	}()
+	return ch
+}
+
+func TestBlockingReadWakesOncePerWrite(t *testing.T) {
+	r := NewConsoleReaderWithMode(true)
+	for _, want := range []string{"a", "bc", "def"} {
+		ch := readAsync(r, 16)
+		select {
+		case got := <-ch:
+			t.Fatalf("Read returned %+v before any Write", got)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		if err := r.Write([]byte(want)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-ch:
+			if got.data != want || got.err != nil {
+				t.Fatalf("Read = %q, %v; want %q, nil", got.data, got.err, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Read didn't wake for Write %q", want)
+		}
+	}
+
+	// The last Write has been consumed, so another Read parks again
+	ch := readAsync(r, 16)
+	select {
+	case got := <-ch:
+		t.Fatalf("Read returned %+v with nothing written", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	r.Close()
+	if got := <-ch; got.err != io.EOF {
+		t.Fatalf("parked Read after Close = %+v, want io.EOF", got)
+	}
+}
+
+func TestClosedReaderReturnsEOF(t *testing.T) {
+	for _, blocking := range []bool{false, true} {
+		r := NewConsoleReaderWithMode(blocking)
+		r.Close()
+		for i := 0; i < 2; i++ {
+			if n, err := r.Read(make([]byte, 4)); n != 0 || err != io.EOF {
+				t.Errorf("blocking=%v: Read %d after Close = %d, %v; want 0, io.EOF", blocking, i, n, err)
+			}
+		}
+	}
+}
+
+func TestWriteAfterCloseIsRefused(t *testing.T) {
+	r := NewConsoleReader()
+	r.Write([]byte("kept"))
+	r.Close()
+	for _, data := range []string{"x", ""} {
+		if err := r.Write([]byte(data)); err != ErrInputClosed {
+			t.Errorf("Write(%q) after Close = %v, want ErrInputClosed", data, err)
+		}
+	}
+	if got := drain(r); got != "kept" {
+		t.Errorf("closed reader holds %q, want only what came before Close", got)
+	}
+
+	// A Write waiting for room is refused by the Close too
+	r = fullReader(t, OverflowBlock)
+	done := make(chan error, 1)
+	go func() { done <- r.Write([]byte("ef")) }()
+	time.Sleep(20 * time.Millisecond)
+	r.Close()
+	select {
+	case err := <-done:
+		if err != ErrInputClosed {
+			t.Errorf("waiting Write ended by Close = %v, want ErrInputClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't end the waiting Write")
+	}
+}
+
+func TestSendInputAfterCloseInput(t *testing.T) {
+	debug := newOutputRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"consoles": map[string]interface{}{"debug": debug.fn}})
+	for _, id := range []interface{}{nil, "debug"} {
+		args := []interface{}{}
+		if id != nil {
+			args = append(args, id)
+		}
+		if got := statusOf(e.call(closeInput, args...)); got != string(statusInputClosed) {
+			t.Fatalf("tinyemuCloseInput(%v) = %s", id, got)
+		}
+		r := e.call(sendInput, append([]interface{}{"late"}, args...)...).(map[string]interface{})
+		data, _ := r["data"].(map[string]interface{})
+		if statusOf(r) != string(codeInputClosed) || data["accepted"] != false || data["reason"] != "closed" {
+			t.Errorf("console %v: tinyemuSendInput after tinyemuCloseInput = %v, want refused as closed", id, r)
+		}
+	}
+}
+
+func TestReadKeepsRunesWhole(t *testing.T) {
+	const input = "héllo 😀 世界 🇯🇵!"
+	for size := 1; size <= 8; size++ {
+		r := NewConsoleReader()
+		if err := r.Write([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+
+		var got []byte
+		p := make([]byte, size)
+		for {
+			n, err := r.Read(p)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A rune only comes out in pieces when it is wider than p
+			if chunk := p[:n]; n >= utf8.UTFMax && !utf8.Valid(chunk) {
+				t.Errorf("size %d: Read returned %q, which splits a rune", size, chunk)
+			}
+			got = append(got, p[:n]...)
+		}
+		if string(got) != input {
+			t.Errorf("size %d: read %q, want %q", size, got, input)
+		}
+	}
+}
+
+func TestReadWaitsForRestOfRune(t *testing.T) {
+	r := NewConsoleReader()
+	p := make([]byte, 8)
+
+	// The first two bytes of 世 arrive in one Write and sit behind "ab"
+	r.Write([]byte("ab\xe4\xb8"))
+	if n, _ := r.Read(p[:3]); string(p[:n]) != "ab" {
+		t.Fatalf("Read = %q, want %q", p[:n], "ab")
+	}
+	r.Write([]byte("\x96"))
+	if n, _ := r.Read(p); string(p[:n]) != "世" {
+		t.Fatalf("Read = %q, want %q", p[:n], "世")
+	}
+}
+
+// fullReader returns a reader under policy with "abcd" filling its
+// four-byte queue.
+func fullReader(t *testing.T, policy OverflowPolicy) *ConsoleReader {
+	t.Helper()
+	r := NewConsoleReaderWithPolicy(false, policy)
+	r.MaxBuffered = 4
+	if err := r.Write([]byte("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// drain reads everything queued in r.
+func TestReadContractTransitions(t *testing.T) {
+	r := NewConsoleReader()
+	p := make([]byte, 3)
+	read := func(state, want string, wantErr error) {
+		t.Helper()
+		if n, err := r.Read(p); string(p[:n]) != want || err != wantErr {
+			t.Errorf("%s: Read = %q, %v; want %q, %v", state, p[:n], err, want, wantErr)
+		}
+	}
+
+	read("open and empty", "", nil)
+	read("open and empty again", "", nil)
+	r.Write([]byte("hello"))
+	read("open with data", "hel", nil)
+	r.Close()
+	read("closed with data", "lo", nil)
+	read("closed and drained", "", io.EOF)
+	read("closed and drained again", "", io.EOF)
+
+	// Blocking mode parks where non-blocking returns (0, nil), and ends
+	// the same way
+	r = NewConsoleReaderWithMode(true)
+	r.Write([]byte("ab"))
+	r.Close()
+	read("blocking, closed with data", "ab", nil)
+	read("blocking, closed and drained", "", io.EOF)
+}
+
+func TestReadDrainsEveryQueuedWrite(t *testing.T) {
+	for _, blocking := range []bool{false, true} {
+		r := NewConsoleReaderWithMode(blocking)
+		for _, chunk := range []string{"one ", "two ", "three"} {
+			if err := r.Write([]byte(chunk)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// A buffer too small for all three gets the front, in order
+		p := make([]byte, 6)
+		if n, err := r.Read(p); string(p[:n]) != "one tw" || err != nil {
+			t.Errorf("blocking=%v: short Read = %q, %v; want %q, nil", blocking, p[:n], err, "one tw")
+		}
+		p = make([]byte, 64)
+		if n, err := r.Read(p); string(p[:n]) != "o three" || err != nil {
+			t.Errorf("blocking=%v: second Read = %q, %v; want %q, nil", blocking, p[:n], err, "o three")
+		}
+	}
+
+	r := NewConsoleReader()
+	for _, chunk := range []string{"a", "bc", "def"} {
+		r.Write([]byte(chunk))
+	}
+	p := make([]byte, 64)
+	if n, err := r.Read(p); string(p[:n]) != "abcdef" || err != nil {
+		t.Errorf("Read = %q, %v; want all three writes %q, nil", p[:n], err, "abcdef")
+	}
+	if r.Buffered() != 0 {
+		t.Errorf("%d bytes still queued after one Read", r.Buffered())
+	}
+}
+
+func drain(r *ConsoleReader) string {
+	p := make([]byte, 64)
+	n, _ := r.Read(p)
+	return string(p[:n])
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		wantErr error
+		want    string
+	}{
+		{OverflowDropNewest, ErrInputDropped, "abcd"},
+		{OverflowDropOldest, nil, "cdef"},
+		{OverflowError, ErrInputFull, "abcd"},
+	}
+	for _, tt := range tests {
+		r := fullReader(t, tt.policy)
+		if err := r.Write([]byte("ef")); err != tt.wantErr {
+			t.Errorf("policy %d: Write = %v, want %v", tt.policy, err, tt.wantErr)
+		}
+		if got := drain(r); got != tt.want {
+			t.Errorf("policy %d: queue holds %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestOverflowBlockWaitsForRoom(t *testing.T) {
+	r := fullReader(t, OverflowBlock)
+	done := make(chan error, 1)
+	go func() { done <- r.Write([]byte("ef")) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Write returned %v with the queue full", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	p := make([]byte, 2)
+	if n, _ := r.Read(p); string(p[:n]) != "ab" {
+		t.Fatalf("Read = %q, want %q", p[:n], "ab")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write didn't resume once Read made room")
+	}
+	if got := drain(r); got != "cdef" {
+		t.Errorf("queue holds %q, want %q", got, "cdef")
+	}
+}
+
+func TestWriteLargerThanQueue(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowError} {
+		r := NewConsoleReaderWithPolicy(false, policy)
+		r.MaxBuffered = 4
+		if err := r.Write([]byte("abcde")); err != ErrInputFull {
+			t.Errorf("policy %d: Write = %v, want ErrInputFull", policy, err)
+		}
+	}
+}
+
+// countingCallback returns an output callback that counts its calls.
+func countingCallback(tb testing.TB) (js.Value, *int) {
+	calls := new(int)
+	fn := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		*calls++
+		return nil
+	})
+	tb.Cleanup(fn.Release)
+	return fn.Value, calls
+}
+
+// benchmarkBurst writes a 64KB burst in 64-byte writes, as a chatty guest
+// would, and reports how many times the callback was invoked per burst.
+func benchmarkBurst(b *testing.B, interval time.Duration) {
+	callback, calls := countingCallback(b)
+	w := NewConsoleWriter(callback, interval)
+	chunk := bytes.Repeat([]byte("x"), 64)
+	b.SetBytes(64 << 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for n := 0; n < 64<<10; n += len(chunk) {
+			w.Write(chunk)
+		}
+		w.Flush()
+	}
+	b.ReportMetric(float64(*calls)/float64(b.N), "invokes/op")
+}
+
+func BenchmarkConsoleWriterUnbuffered(b *testing.B) { benchmarkBurst(b, 0) }
+
+func BenchmarkConsoleWriterCoalesced(b *testing.B) { benchmarkBurst(b, DefaultFlushInterval) }
+
+// outputRecorder is an output callback that keeps the chunks it gets.
+type outputRecorder struct {
+	fn     js.Func
+	mu     sync.Mutex
+	chunks []js.Value
+}
+
+func newOutputRecorder(tb testing.TB) *outputRecorder {
+	rec := &outputRecorder{}
+	rec.fn = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		rec.mu.Lock()
+		rec.chunks = append(rec.chunks, args[0])
+		rec.mu.Unlock()
+		return nil
+	})
+	tb.Cleanup(rec.fn.Release)
+	return rec
+}
+
+// text joins the string chunks received so far.
+func (rec *outputRecorder) text() string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var s strings.Builder
+	for _, c := range rec.chunks {
+		s.WriteString(c.String())
+	}
+	return s.String()
+}
+
+// bytes joins the Uint8Array chunks received so far.
+func (rec *outputRecorder) bytes(tb testing.TB) []byte {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var out []byte
+	for _, c := range rec.chunks {
+		b, err := bytesFromJS(c)
+		if err != nil {
+			tb.Fatalf("chunk of type %s: %v", c.Type(), err)
+		}
+		out = append(out, b...)
+	}
+	return out
+}
+
+func TestRawOutputRoundTripsEveryByte(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, interval := range []time.Duration{0, DefaultFlushInterval} {
+		rec := newOutputRecorder(t)
+		w := NewConsoleWriter(rec.fn.Value, interval)
+		w.Encoding = encodingRaw
+		w.Write(all[:100])
+		w.Write(all[100:])
+		w.Flush()
+		if got := rec.bytes(t); !bytes.Equal(got, all) {
+			t.Errorf("interval %v: callback got % x, want 00 through ff", interval, got)
+		}
+	}
+}
+
+func TestOutputSinksGetTheSameBytes(t *testing.T) {
+	e, primary := newTestEmulator(t, map[string]interface{}{"stripAnsi": true})
+	a, b := newOutputRecorder(t), newOutputRecorder(t)
+	throwing := js.Global().Get("Function").New("throw new Error('sink broke')")
+
+	var ids []interface{}
+	for _, fn := range []js.Value{a.fn.Value, throwing, b.fn.Value} {
+		r := e.call(addOutputSink, fn).(map[string]interface{})
+		if statusOf(r) != string(statusSinkAdded) {
+			t.Fatalf("tinyemuAddOutputSink = %v", r)
+		}
+		ids = append(ids, r["data"].(map[string]interface{})["id"])
+	}
+	if ids[0] == ids[1] || ids[1] == ids[2] {
+		t.Fatalf("sinks share ids: %v", ids)
+	}
+
+	const out = "\x1b[32mok\x1b[0m\n"
+	e.writer.Write([]byte(out))
+	e.writer.Flush()
+	// A sink that throws doesn't stop the one after it
+	if a.text() != out || b.text() != out {
+		t.Errorf("sinks got %q and %q, want both %q", a.text(), b.text(), out)
+	}
+	if got := primary.text(); got != "ok\n" {
+		t.Errorf("primary callback got %q, want the stripped text", got)
+	}
+
+	if got := statusOf(e.call(removeOutputSink, ids[0])); got != string(statusSinkRemoved) {
+		t.Fatalf("tinyemuRemoveOutputSink = %s", got)
+	}
+	e.writer.Write([]byte("more"))
+	e.writer.Flush()
+	if a.text() != out || b.text() != out+"more" {
+		t.Errorf("after removing the first sink they hold %q and %q", a.text(), b.text())
+	}
+	if got := statusOf(e.call(removeOutputSink, ids[0])); got != string(codeInvalidArgument) {
+		t.Errorf("removing a sink twice = %s, want invalid_argument", got)
+	}
+	if got := statusOf(e.call(addOutputSink, "not a function")); got != string(codeInvalidArgument) {
+		t.Errorf("adding a string as a sink = %s, want invalid_argument", got)
+	}
+}
+
+// useDefaultLog sends defaultLogger's lines to a recorder for the test.
+func useDefaultLog(t *testing.T) *logRecorder {
+	rec := newLogRecorder(t)
+	saved := defaultLogger.callback
+	defaultLogger.callback = rec.fn.Value
+	t.Cleanup(func() { defaultLogger.callback = saved })
+	return rec
+}
+
+func TestThrowingSinkDoesntStopTheEmulator(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		log := useDefaultLog(t)
+		useMachine(t, tickingMachine)
+		e, primary := newTestEmulator(t, map[string]interface{}{"disableFailingCallbacks": disable})
+		throwing := js.Global().Get("Function").New("throw new Error('terminal unmounted')")
+		id := e.call(addOutputSink, throwing).(map[string]interface{})["data"].(map[string]interface{})["id"]
+
+		if n, err := e.writer.Write([]byte("direct\n")); n != len("direct\n") || err != nil {
+			t.Errorf("disable %v: Write = %d, %v; want %d, nil", disable, n, err, len("direct\n"))
+		}
+		e.writer.Flush()
+		e.call(startEmulator)
+		waitState(t, e, stateRunning)
+
+		// Ticks keep coming long after the sink first threw
+		before := len(waitOutput(t, primary, len("direct\n")))
+		waitOutput(t, primary, before+3*len("tick 1\n"))
+		if got := e.getState(); got != stateRunning {
+			t.Errorf("disable %v: state is %s with a throwing sink, want running", disable, got)
+		}
+
+		// The throw is logged once however often the sink threw
+		time.Sleep(10 * time.Millisecond)
+		var warned int
+		for _, line := range log.lines {
+			if strings.Contains(line, "output sink") && strings.Contains(line, "terminal unmounted") {
+				warned++
+			}
+		}
+		if warned != 1 {
+			t.Errorf("disable %v: sink failure logged %d times, want once: %q", disable, warned, log.lines)
+		}
+
+		// Disabled, the sink is gone as if it had been removed
+		removed := statusOf(e.call(removeOutputSink, id)) == string(statusSinkRemoved)
+		if removed == disable {
+			t.Errorf("disable %v: sink still registered = %v", disable, removed)
+		}
+	}
+}
+func TestSendInputPastTheCapIsRefused(t *testing.T) {
+	e, _ := newTestEmulator(t, map[string]interface{}{"maxInputBytes": 16})
+	send := func(s string) map[string]interface{} {
+		t.Helper()
+		// The guest isn't reading, so a Write waiting for room would hang
+		ch := make(chan map[string]interface{}, 1)
+		go func() { ch <- e.call(sendInput, s).(map[string]interface{}) }()
+		select {
+		case r := <-ch:
+			return r
+		case <-time.After(time.Second):
+			t.Fatalf("tinyemuSendInput(%q) blocked with the queue full", s)
+			return nil
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if r := send("12345678"); failed(r) {
+			t.Fatalf("write %d within the cap: %v", i, r["error"])
+		}
+	}
+	for _, s := range []string{"9", strings.Repeat("x", 1<<20)} {
+		r := send(s)
+		if !failed(r) || r["data"].(map[string]interface{})["accepted"] != false {
+			t.Errorf("writing %d bytes to a full queue = %v, want it refused", len(s), r)
+		}
+	}
+	if got := string(e.reader.Pending()); got != "1234567812345678" {
+		t.Errorf("queue holds %q, want the first 16 bytes", got)
+	}
+	if n := len(e.reader.queue.buf); n > minRingSize {
+		t.Errorf("queue grew to %d bytes holding 16", n)
+	}
+}
+
+func TestSendInputTakesBytesExactly(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	every := make([]byte, 256)
+	for i := range every {
+		every[i] = byte(i)
+	}
+	array := bytesToJS(every)
+	if got := sent(t, e, array); !bytes.Equal(got, every) {
+		t.Errorf("a Uint8Array of 0x00 to 0xff queued % x", got)
+	}
+	if got := sent(t, e, array.Get("buffer")); !bytes.Equal(got, every) {
+		t.Errorf("its ArrayBuffer queued % x", got)
+	}
+	// A view of part of a buffer sends just that part
+	if got := sent(t, e, array.Call("subarray", 250, 253)); !bytes.Equal(got, every[250:253]) {
+		t.Errorf("a subarray queued % x, want % x", got, every[250:253])
+	}
+
+	// Strings still go in as text, including characters outside the BMP
+	if got := sent(t, e, "ls 😀\n"); string(got) != "ls 😀\n" {
+		t.Errorf("a string queued %q", got)
+	}
+	for _, bad := range []interface{}{42, []interface{}{1, 2}, js.Global().Get("Int16Array").New(2)} {
+		if got := statusOf(e.call(sendInput, bad)); got != string(codeInvalidArgument) {
+			t.Errorf("sendInput(%v) = %s, want invalid_argument", bad, got)
+		}
+	}
+}
+
+func TestRateLimitedReadPacesABurst(t *testing.T) {
+	c := &manualClock{now: virtualEpoch}
+	r := NewConsoleReaderWithPolicy(false, OverflowError)
+	r.Rate, r.Clock = 100, c
+	burst := strings.Repeat("0123456789", 20)
+	if err := r.Write([]byte(burst)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A quarter second's worth goes through at once, then nothing until
+	// the clock moves
+	var got strings.Builder
+	p := make([]byte, 256)
+	n, _ := r.Read(p)
+	got.Write(p[:n])
+	if n != 25 {
+		t.Fatalf("first Read got %d bytes, want the 25 byte burst allowance", n)
+	}
+	if n, err := r.Read(p); n != 0 || err != nil {
+		t.Fatalf("Read with no time passed = %d, %v; want 0, nil", n, err)
+	}
+
+	// Then 100 bytes a second of fake time, queued rather than dropped
+	for elapsed := 100 * time.Millisecond; got.Len() < len(burst); elapsed += 100 * time.Millisecond {
+		c.tick(100 * time.Millisecond)
+		n, _ := r.Read(p)
+		got.Write(p[:n])
+		if want := min(len(burst), 25+int(elapsed/(10*time.Millisecond))); got.Len() != want {
+			t.Fatalf("after %v delivered %d bytes, want %d", elapsed, got.Len(), want)
+		}
+		if r.Buffered() != len(burst)-got.Len() {
+			t.Fatalf("after %v %d bytes queued, want %d", elapsed, r.Buffered(), len(burst)-got.Len())
+		}
+	}
+	if got.String() != burst {
+		t.Errorf("delivered %q, want the burst in order", got.String())
+	}
+}
+
+func TestRateLimitedInputCountsAgainstTheCap(t *testing.T) {
+	c := &manualClock{now: virtualEpoch}
+	r := NewConsoleReaderWithPolicy(false, OverflowError)
+	r.Rate, r.Clock, r.MaxBuffered = 8, c, 8
+	r.Write([]byte("abcdefgh"))
+	if got := drain(r); got != "ab" {
+		t.Fatalf("first Read = %q, want the 2 byte burst allowance %q", got, "ab")
+	}
+	if err := r.Write([]byte("ijk")); err != ErrInputFull {
+		t.Fatalf("Write past the cap while paced = %v, want ErrInputFull", err)
+	}
+	c.tick(250 * time.Millisecond)
+	if got := drain(r); got != "cd" {
+		t.Fatalf("after 250ms at 8 bytes/s Read = %q, want %q", got, "cd")
+	}
+	if err := r.Write([]byte("ijk")); err != nil {
+		t.Errorf("Write after the reader made room = %v", err)
+	}
+}
+
+func TestRateLimitedBlockingReadWaitsForItsTurn(t *testing.T) {
+	c := &manualClock{now: virtualEpoch}
+	r := NewConsoleReaderWithMode(true)
+	r.Rate, r.Clock = 10, c
+	r.Write([]byte("abcd"))
+	if got := drain(r); got != "ab" {
+		t.Fatalf("first Read = %q, want the 2 byte burst allowance %q", got, "ab")
+	}
+
+	ch := readAsync(r, 16)
+	select {
+	case got := <-ch:
+		t.Fatalf("Read returned %+v before the clock moved", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.tick(100 * time.Millisecond)
+	select {
+	case got := <-ch:
+		if got.data != "c" || got.err != nil {
+			t.Errorf("Read after 100ms = %+v, want %q", got, "c")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocking Read didn't wake when its byte was due")
+	}
+}
+
+func TestInputRateLimitOption(t *testing.T) {
+	e, _ := newTestEmulator(t, map[string]interface{}{"inputRateLimit": 300})
+	if e.reader.Rate != 300 || e.reader.Clock != e.clock {
+		t.Errorf("reader rate %d on clock %T, want 300 on the instance clock", e.reader.Rate, e.reader.Clock)
+	}
+	for _, bad := range []interface{}{-1, 1.5, "fast"} {
+		if msg := initError(t, map[string]interface{}{"inputRateLimit": bad}); !strings.Contains(msg, "inputRateLimit") {
+			t.Errorf("inputRateLimit %v: error %q doesn't name the option", bad, msg)
+		}
+	}
+}
+
+func TestReadWithTimeoutReturnsEmptyInTime(t *testing.T) {
+	const d, tolerance = 50 * time.Millisecond, 100 * time.Millisecond
+	r := NewConsoleReader()
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		n, err := r.ReadWithTimeout(make([]byte, 8), d)
+		if elapsed := time.Since(start); elapsed < d || elapsed > d+tolerance {
+			t.Errorf("empty ReadWithTimeout took %v, want %v within %v", elapsed, d, tolerance)
+		}
+		if n != 0 || err != nil {
+			t.Errorf("empty ReadWithTimeout = %d, %v; want 0, nil", n, err)
+		}
+	}
+}
+
+func TestReadWithTimeoutReturnsInputEarly(t *testing.T) {
+	r := NewConsoleReader()
+	r.Write([]byte("queued"))
+	start := time.Now()
+	p := make([]byte, 8)
+	if n, _ := r.ReadWithTimeout(p, time.Second); string(p[:n]) != "queued" || time.Since(start) > 20*time.Millisecond {
+		t.Errorf("ReadWithTimeout of queued input = %q after %v, want it at once", p[:n], time.Since(start))
+	}
+
+	// Input arriving partway through the wait ends it then
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		r.Write([]byte("late"))
+	}()
+	start = time.Now()
+	n, err := r.ReadWithTimeout(p, time.Second)
+	if elapsed := time.Since(start); string(p[:n]) != "late" || err != nil || elapsed > 200*time.Millisecond {
+		t.Errorf("ReadWithTimeout = %q, %v after %v; want %q well before the timeout", p[:n], err, elapsed, "late")
+	}
+
+	r.Close()
+	if n, err := r.ReadWithTimeout(p, time.Second); n != 0 || err != io.EOF {
+		t.Errorf("ReadWithTimeout after Close = %d, %v; want 0, io.EOF", n, err)
+	}
+}
+
+func TestInputReadModeOption(t *testing.T) {
+	tests := []struct {
+		opts     map[string]interface{}
+		blocking bool
+		timeout  time.Duration
+	}{
+		{nil, false, 0},
+		{map[string]interface{}{"inputReadMode": "poll"}, false, 0},
+		{map[string]interface{}{"inputReadMode": "block"}, true, 0},
+		{map[string]interface{}{"inputReadMode": "timeout"}, false, defaultReadTimeout},
+		{map[string]interface{}{"inputReadMode": "timeout", "inputReadTimeoutMs": 5}, false, 5 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		e, _ := newTestEmulator(t, tt.opts)
+		if e.reader.blocking != tt.blocking || e.reader.ReadTimeout != tt.timeout {
+			t.Errorf("options %v: reader blocking %v, timeout %v; want %v, %v", tt.opts, e.reader.blocking, e.reader.ReadTimeout, tt.blocking, tt.timeout)
+		}
+	}
+
+	// A timeout-mode Read is bounded like ReadWithTimeout
+	e, _ := newTestEmulator(t, map[string]interface{}{"inputReadMode": "timeout", "inputReadTimeoutMs": 30})
+	start := time.Now()
+	if n, err := e.reader.Read(make([]byte, 8)); n != 0 || err != nil || time.Since(start) < 30*time.Millisecond {
+		t.Errorf("timeout-mode Read = %d, %v after %v, want 0, nil after 30ms", n, err, time.Since(start))
+	}
+
+	for _, bad := range []map[string]interface{}{
+		{"inputReadMode": "spin"},
+		{"inputReadMode": 1},
+		{"inputReadTimeoutMs": 0},
+		{"inputReadTimeoutMs": 5000},
+		{"inputReadTimeoutMs": math.NaN()},
+	} {
+		if msg := initError(t, bad); !strings.Contains(msg, "inputRead") {
+			t.Errorf("options %v: error %q isn't about the read mode", bad, msg)
+		}
+	}
+}
+
+// chanReader models the input queue ConsoleReader had before its ring: a
+// channel of chunks drained into a buffer, with writers waiting for room
+// on a channel replaced every time a read frees some.
+type chanReader struct {
+	chunks chan []byte
+	buffer bytes.Buffer
+	mu     sync.Mutex
+	queued int
+	room   chan struct{}
+}
+
+func newChanReader() *chanReader {
+	return &chanReader{chunks: make(chan []byte, 100), room: make(chan struct{})}
+}
+
+func (c *chanReader) Write(data []byte) error {
+	c.mu.Lock()
+	c.queued += len(data)
+	c.mu.Unlock()
+	select {
+	case c.chunks <- data:
+		return nil
+	default:
+		return ErrInputFull
+	}
+}
+
+func (c *chanReader) Read(p []byte) (int, error) {
+	for drained := false; !drained; {
+		select {
+		case data := <-c.chunks:
+			c.buffer.Write(data)
+		default:
+			drained = true
+		}
+	}
+	n, _ := c.buffer.Read(p)
+	c.mu.Lock()
+	c.queued -= n
+	close(c.room)
+	c.room = make(chan struct{})
+	c.mu.Unlock()
+	return n, nil
+}
+
+// inputQueue is the contract both input queues share.
+type inputQueue interface {
+	Write(data []byte) error
+	Read(p []byte) (int, error)
+}
+
+// benchmarkKeystrokes types a byte at a time, the guest polling for input
+// after every fourth one as a busy run loop would.
+func benchmarkKeystrokes(b *testing.B, q inputQueue) {
+	keys := []byte("ls -l\n")
+	p := make([]byte, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := q.Write(keys[i%len(keys) : i%len(keys)+1]); err != nil {
+			b.Fatal(err)
+		}
+		if i%4 == 3 {
+			q.Read(p)
+		}
+	}
+}
+
+func BenchmarkInputChannel(b *testing.B) { benchmarkKeystrokes(b, newChanReader()) }
+
+func BenchmarkInputRing(b *testing.B) { benchmarkKeystrokes(b, NewConsoleReader()) }
+
+// methodSink is a JS object whose write method keeps what it is passed in
+// its chunks array, and the this it was called with in self.
+func methodSink() js.Value {
+	return js.Global().Get("Function").New(
+		"return {chunks: [], write(s) { this.chunks.push(s); this.self = this; }};",
+	).Invoke()
+}
+
+func TestMethodSinksKeepTheirReceiver(t *testing.T) {
+	console0, debug, logs := methodSink(), methodSink(), methodSink()
+	bound := func(obj js.Value) map[string]interface{} {
+		return map[string]interface{}{"obj": obj, "method": "write"}
+	}
+	result := initEmulator(js.Undefined(), []js.Value{
+		js.ValueOf(bound(console0)),
+		js.ValueOf(map[string]interface{}{
+			"consoles": map[string]interface{}{"debug": bound(debug)},
+			"onLog":    bound(logs),
+		}),
+	}).(map[string]interface{})
+	if failed(result) {
+		t.Fatalf("tinyemuInit with method sinks: %v", result["error"])
+	}
+	e := instances[result["data"].(map[string]interface{})["handle"].(int)]
+	t.Cleanup(func() { e.dispose() })
+
+	e.writer.Write([]byte("to console0"))
+	e.writer.Flush()
+	e.consoles["debug"].writer.Write([]byte("to debug"))
+	e.consoles["debug"].writer.Flush()
+	e.log.Warnf("to the log")
+
+	for _, tt := range []struct {
+		name string
+		sink js.Value
+		want string
+	}{
+		{"console0", console0, "to console0"},
+		{"consoles.debug", debug, "to debug"},
+		{"onLog", logs, "to the log"},
+	} {
+		if !tt.sink.Get("self").Equal(tt.sink) {
+			t.Errorf("%s: write ran with this %v, not its object", tt.name, tt.sink.Get("self"))
+		}
+		chunks := tt.sink.Get("chunks")
+		if chunks.Length() == 0 || !strings.Contains(chunks.Index(chunks.Length()-1).String(), tt.want) {
+			t.Errorf("%s: sink got %v, want %q last", tt.name, chunks, tt.want)
+		}
+	}
+}
+
+func TestFlushOnNewlineHoldsPartialLines(t *testing.T) {
+	rec := newOutputRecorder(t)
+	w := NewConsoleWriter(rec.fn.Value, 0)
+	w.FlushOnNewline = true
+	w.Write([]byte("log"))
+	w.Write([]byte("in: "))
+	if len(rec.chunks) != 0 {
+		t.Fatalf("partial line delivered as %q before its newline", rec.text())
+	}
+	w.Write([]byte("ok\r\n$ "))
+	if len(rec.chunks) != 1 || rec.chunks[0].String() != "login: ok\r\n" {
+		t.Fatalf("at the newline callback got %v, want the whole line in one chunk", rec.chunks)
+	}
+	w.Flush()
+	if rec.text() != "login: ok\r\n$ " {
+		t.Errorf("Flush left %q delivered, want the prompt too", rec.text())
+	}
+
+	// A partial line can't be held past the buffer
+	long := strings.Repeat("x", flushThreshold)
+	w.Write([]byte(long))
+	if !strings.HasSuffix(rec.text(), long) {
+		t.Errorf("a %d byte partial line was held back", len(long))
+	}
+
+	// Coalescing timers deliver whole lines and keep the rest
+	rec = newOutputRecorder(t)
+	w = NewConsoleWriter(rec.fn.Value, 5*time.Millisecond)
+	w.FlushOnNewline = true
+	w.Write([]byte("one\ntw"))
+	time.Sleep(30 * time.Millisecond)
+	if got := rec.text(); got != "one\n" {
+		t.Errorf("after the flush interval callback got %q, want only the whole line", got)
+	}
+}
+
+func TestFlushAndStopDeliverDanglingLines(t *testing.T) {
+	useMachine(t, func(config machineConfig) machine { return &testMachine{} })
+	debug := newOutputRecorder(t)
+	e, console0 := newTestEmulator(t, map[string]interface{}{
+		"flushOnNewline": true,
+		"consoles":       map[string]interface{}{"debug": debug.fn},
+	})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	writers := map[*outputRecorder]*ConsoleWriter{console0: e.writer, debug: e.consoles["debug"].writer}
+
+	for _, w := range writers {
+		w.Write([]byte("$ "))
+	}
+	time.Sleep(2 * stepInterval)
+	if console0.text() != "" || debug.text() != "" {
+		t.Fatalf("prompts delivered before a flush: %q, %q", console0.text(), debug.text())
+	}
+	if got := statusOf(e.call(flushOutput)); got != string(statusFlushed) {
+		t.Fatalf("tinyemuFlush = %s", got)
+	}
+	for rec := range writers {
+		if got := rec.text(); got != "$ " {
+			t.Errorf("tinyemuFlush delivered %q, want the prompt", got)
+		}
+	}
+
+	for _, w := range writers {
+		w.Write([]byte("half a line"))
+	}
+	e.call(stopEmulator)
+	for rec := range writers {
+		if got := rec.text(); got != "$ half a line" {
+			t.Errorf("by the time tinyemuStop returned callback got %q, want the dangling line", got)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"syscall/js"
+	"unicode/utf8"
+)
+
+// tabWidth is the spacing of the default tab stops.
+const tabWidth = 8
+
+// vtCursor is a 0-based cursor position on the guest terminal.
+type vtCursor struct {
+	row, col int
+	hidden   bool
+	// wrapNext is set once a character has been written in the last
+	// column; the next one wraps to the following line first.
+	wrapNext bool
+}
+
+// vtScreen is the part of the parser's state other goroutines access: the
+// terminal size output is laid out in, and the cursor as of the last
+// event.
+type vtScreen struct {
+	mu     sync.Mutex
+	size   winsize
+	cursor vtCursor
+}
+
+// SetSize sets the terminal dimensions the cursor is clamped to. Until it
+// is called the parser assumes defaultWinsize.
+func (v *vtParser) SetSize(ws winsize) {
+	v.screen.mu.Lock()
+	defer v.screen.mu.Unlock()
+	v.screen.size = ws
+	v.screen.cursor.clamp(ws.cols, ws.rows)
+}
+
+// Cursor returns the cursor as of the last event parsed.
+func (v *vtParser) Cursor() vtCursor {
+	v.screen.mu.Lock()
+	defer v.screen.mu.Unlock()
+	return v.screen.cursor
+}
+
+// syncSize picks up a size set since the last Feed.
+func (v *vtParser) syncSize() {
+	v.screen.mu.Lock()
+	ws := v.screen.size
+	v.screen.mu.Unlock()
+	if ws == (winsize{}) {
+		ws = defaultWinsize
+	}
+	if ws.cols != v.cols || ws.rows != v.rows {
+		v.cols, v.rows = ws.cols, ws.rows
+		v.cursor.clamp(v.cols, v.rows)
+	}
+}
+
+func (v *vtParser) publishCursor() {
+	v.screen.mu.Lock()
+	v.screen.cursor = v.cursor
+	v.screen.mu.Unlock()
+}
+
+func (c *vtCursor) clamp(cols, rows int) {
+	if cols > 0 {
+		c.col = min(max(c.col, 0), cols-1)
+	}
+	if rows > 0 {
+		c.row = min(max(c.row, 0), rows-1)
+	}
+}
+
+// advance moves the cursor over a byte of text. Every character takes one
+// column, including wide ones.
+func (v *vtParser) advance(b byte) {
+	c := &v.cursor
+	switch {
+	case b == '\r':
+		c.col, c.wrapNext = 0, false
+	case b == '\n' || b == '\v' || b == '\f':
+		c.row = min(c.row+1, v.rows-1)
+		c.wrapNext = false
+	case b == '\b':
+		c.col, c.wrapNext = max(c.col-1, 0), false
+	case b == '\t':
+		c.col, c.wrapNext = min((c.col/tabWidth+1)*tabWidth, v.cols-1), false
+	case b < 0x20 || b == 0x7f:
+		// Other control characters don't move the cursor
+	case !v.bytewise && !utf8.RuneStart(b):
+		// A continuation byte belongs to the character already counted
+	default:
+		if c.wrapNext {
+			c.col, c.wrapNext = 0, false
+			c.row = min(c.row+1, v.rows-1)
+		}
+		if c.col < v.cols-1 {
+			c.col++
+		} else {
+			c.wrapNext = true
+		}
+	}
+}
+
+// moveCursor applies the cursor movement of a CSI sequence with the given
+// final byte: CUP and HVP, CUU, CUD, CUF, CUB, CNL, CPL, CHA and VPA.
+func (v *vtParser) moveCursor(final byte) {
+	if len(v.seq) > 0 && v.seq[0] >= '<' && v.seq[0] <= '?' {
+		// Private sequences don't move the cursor
+		return
+	}
+	params := csiParams(string(v.seq))
+	n := max(param(params, 0), 1)
+
+	c := &v.cursor
+	switch final {
+	case 'H', 'f':
+		c.row, c.col = max(param(params, 0), 1)-1, max(param(params, 1), 1)-1
+	case 'A':
+		c.row -= n
+	case 'B':
+		c.row += n
+	case 'C':
+		c.col += n
+	case 'D':
+		c.col -= n
+	case 'E':
+		c.row, c.col = c.row+n, 0
+	case 'F':
+		c.row, c.col = c.row-n, 0
+	case 'G':
+		c.col = n - 1
+	case 'd':
+		c.row = n - 1
+	default:
+		return
+	}
+	c.wrapNext = false
+	c.clamp(v.cols, v.rows)
+}
+
+// csiParams splits CSI parameter bytes such as "5;10" into numbers, with
+// an empty or malformed parameter read as 0.
+func csiParams(s string) []int {
+	if s == "" {
+		return nil
+	}
+	fields := strings.Split(s, ";")
+	params := make([]int, len(fields))
+	for i, f := range fields {
+		params[i], _ = strconv.Atoi(f)
+	}
+	return params
+}
+
+// param returns params[i], or 0 if it is missing.
+func param(params []int, i int) int {
+	if i < len(params) {
+		return params[i]
+	}
+	return 0
+}
+
+// getCursor returns {row, col, visible} for console0: where the guest's
+// next character would appear, 0-based and clamped to the size given to
+// tinyemuResize, and whether the guest has the cursor shown. It follows
+// text, CR, LF, backspace, tabs and the usual cursor movement sequences as
+// output is delivered; scrolling regions and wide characters aren't
+// modelled.
+func getCursor(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	c := e.writer.Cursor()
+	return okResult(map[string]interface{}{
+		"row":     c.row,
+		"col":     c.col,
+		"visible": !c.hidden,
+	})
+}
@@ -0,0 +1,83 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"testing"
+)
+
+func TestCursorFollowsMovement(t *testing.T) {
+	v := &vtParser{}
+	v.SetSize(winsize{cols: 20, rows: 10})
+	for _, tt := range []struct {
+		out      string
+		row, col int
+	}{
+		{"hello", 0, 5},
+		{"\r\nab", 1, 2},
+		{"\x1b[5;8H", 4, 7},   // CUP is 1-based
+		{"\x1b[2A", 2, 7},     // CUU
+		{"\x1b[B", 3, 7},      // CUD defaults to 1
+		{"\x1b[3C", 3, 10},    // CUF
+		{"\x1b[4D", 3, 6},     // CUB
+		{"\x1b[0D", 3, 5},     // a 0 count moves 1
+		{"\x1b[H", 0, 0},      // CUP without parameters is home
+		{"\x1b[9;99H", 8, 19}, // clamped to the terminal
+		{"\x1b[50B", 9, 19},
+		{"\x1b[99D", 9, 0},
+		{"\x1b[99A", 0, 0},
+		{"\tx\b", 0, 8},
+		{"\x1b[?1049h", 0, 8}, // private modes don't move it
+		{"\x1b[2;3f", 1, 2},   // HVP
+		{"\x1b[12G", 1, 11},   // CHA
+		{"\x1b[7d", 6, 11},    // VPA
+	} {
+		feedBytewise(v, tt.out)
+		if c := v.Cursor(); c.row != tt.row || c.col != tt.col {
+			t.Errorf("after %q cursor is at %d,%d, want %d,%d", tt.out, c.row, c.col, tt.row, tt.col)
+		}
+	}
+
+	// Text in the last column wraps with the next character
+	v.Feed([]byte("\x1b[1;20Hxy"), func(vtEvent) {})
+	if c := v.Cursor(); c.row != 1 || c.col != 1 {
+		t.Errorf("writing past the last column left the cursor at %d,%d, want 1,1", c.row, c.col)
+	}
+}
+
+func TestCursorVisibility(t *testing.T) {
+	v := &vtParser{}
+	for _, tt := range []struct {
+		out    string
+		hidden bool
+	}{
+		{"\x1b[?25l", true},
+		{"text", true},
+		{"\x1b[?25h", false},
+		{"\x1b[?1;25l", true}, // among other modes
+		{"\x1b[25h", true},    // not the private mode
+		{"\x1b[?25h", false},
+	} {
+		v.Feed([]byte(tt.out), func(vtEvent) {})
+		if got := v.Cursor().hidden; got != tt.hidden {
+			t.Errorf("after %q hidden = %v, want %v", tt.out, got, tt.hidden)
+		}
+	}
+}
+
+func TestGetCursor(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	e.writer.Write([]byte("\x1b[?25l\x1b[30;70H"))
+	e.writer.Flush()
+	data := e.call(getCursor).(map[string]interface{})["data"].(map[string]interface{})
+	if data["row"] != 23 || data["col"] != 69 || data["visible"] != false {
+		t.Errorf("tinyemuGetCursor = %v, want row 23 col 69 hidden in the default 80x24", data)
+	}
+
+	// A smaller terminal clamps it
+	e.call(resizeTerminal, 40, 10)
+	data = e.call(getCursor).(map[string]interface{})["data"].(map[string]interface{})
+	if data["row"] != 9 || data["col"] != 39 {
+		t.Errorf("after resizing to 40x10 tinyemuGetCursor = %v, want row 9 col 39", data)
+	}
+}
@@ -0,0 +1,306 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"syscall/js"
+)
+
+const (
+	// maxMemoryRead bounds a single tinyemuReadMemory so a typo in length
+	// can't allocate the whole guest.
+	maxMemoryRead = 1 << 20
+	// maxSingleStep bounds tinyemuStep, which runs on the calling thread.
+	maxSingleStep = 1 << 20
+)
+
+var errNoDebug = newError(codeUnsupported, "machine does not support inspection")
+
+// errParked is a call that needs the machine between instructions while
+// the run loop's step waits for a disk fetch, which the machine is in the
+// middle of.
+var errParked = newError(codeBusy, "a step is waiting for a disk fetch, try again once it settles")
+
+// cpuRegisters is the RISC-V integer register file. X[0] is always zero.
+type cpuRegisters struct {
+	PC uint64
+	X  [32]uint64
+}
+
+// inspectable is implemented by machines a debugger can look into. Both
+// methods are called with machineMu held, between steps, so they always
+// see a consistent state even while the machine is running.
+type inspectable interface {
+	Registers() cpuRegisters
+	// ReadMemory fills p from guest physical memory at addr, or returns
+	// an error if any of it lies outside guest memory.
+	ReadMemory(addr uint64, p []byte) error
+}
+
+// abiNames are the RISC-V calling convention names of x0 to x31.
+var abiNames = [32]string{
+	"zero", "ra", "sp", "gp", "tp", "t0", "t1", "t2",
+	"s0", "s1", "a0", "a1", "a2", "a3", "a4", "a5",
+	"a6", "a7", "s2", "s3", "s4", "s5", "s6", "s7",
+	"s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6",
+}
+
+// hex64 formats a register as a 0x-prefixed hex string. Registers are 64
+// bits wide, beyond what a JS number holds exactly.
+func hex64(v uint64) string {
+	return fmt.Sprintf("0x%016x", v)
+}
+
+// addressArg reads a guest address, given either as a number or, for
+// addresses beyond 2^53 such as kernel virtual addresses, as a string like
+// "0xffffffff80000000".
+func addressArg(args []js.Value, i int, name string) (uint64, error) {
+	if v := arg(args, i); v.Type() == js.TypeString {
+		addr, err := strconv.ParseUint(v.String(), 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be an address, got %q", name, v.String())
+		}
+		return addr, nil
+	}
+	n, err := numberArg(args, i, name)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > 1<<53 || n != float64(uint64(n)) {
+		return 0, fmt.Errorf("%s must be a non-negative safe integer, got %v", name, n)
+	}
+	return uint64(n), nil
+}
+
+// inspect runs fn against the current machine between steps, refusing
+// while a step is parked mid-instruction.
+func (e *Emulator) inspect(fn func(m inspectable) map[string]interface{}) map[string]interface{} {
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+
+	if e.machine == nil {
+		return errResult(codeNotRunning, "no machine to inspect, call tinyemuStart first")
+	}
+	if e.parked.Load() {
+		return errorResult(errParked)
+	}
+	m, ok := e.machine.(inspectable)
+	if !ok {
+		return errorResult(errNoDebug)
+	}
+	return fn(m)
+}
+
+// readRegisters returns {pc, x, names}: the program counter, x0 to x31 as
+// hex strings, and their ABI names.
+func readRegisters(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	return e.inspect(func(m inspectable) map[string]interface{} {
+		regs := m.Registers()
+		x := make([]interface{}, len(regs.X))
+		names := make([]interface{}, len(abiNames))
+		for i, v := range regs.X {
+			x[i] = hex64(v)
+			names[i] = abiNames[i]
+		}
+		return okResult(map[string]interface{}{"pc": hex64(regs.PC), "x": x, "names": names})
+	})
+}
+
+// readMemory takes (addr, length) and returns {addr, data} with data a
+// Uint8Array copy of guest physical memory.
+func readMemory(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 2)
+	if err != nil {
+		return errorResult(err)
+	}
+	addr, err := addressArg(args, 0, "addr")
+	if err != nil {
+		return errorResult(err)
+	}
+	length, err := intArg(args, 1, "length")
+	if err != nil {
+		return errorResult(err)
+	}
+	if length < 1 || length > maxMemoryRead {
+		return errResult(codeInvalidArgument, fmt.Sprintf("length must be between 1 and %d, got %d", maxMemoryRead, length))
+	}
+
+	return e.inspect(func(m inspectable) map[string]interface{} {
+		buf := make([]byte, length)
+		if err := m.ReadMemory(addr, buf); err != nil {
+			return errorResult(err)
+		}
+		return okResult(map[string]interface{}{"addr": hex64(addr), "data": bytesToJS(buf)})
+	})
+}
+
+// breakpoints are the PC breakpoints of an instance. They outlive runs,
+// so ones set before start or reset catch the next boot.
+type breakpoints struct {
+	mu    sync.Mutex
+	addrs map[uint64]struct{}
+	hit   *uint64 // breakpoint the last step stopped at, until taken
+}
+
+func (bp *breakpoints) set(addr uint64) bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if _, ok := bp.addrs[addr]; ok {
+		return false
+	}
+	if bp.addrs == nil {
+		bp.addrs = make(map[uint64]struct{})
+	}
+	bp.addrs[addr] = struct{}{}
+	return true
+}
+
+func (bp *breakpoints) clear(addr uint64) bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if _, ok := bp.addrs[addr]; !ok {
+		return false
+	}
+	delete(bp.addrs, addr)
+	return true
+}
+
+// run executes up to n instructions of m and returns how many retired.
+// With breakpoints set it goes one instruction at a time and stops before
+// one at a breakpoint, recording it for take; the instruction the machine
+// is already at never counts, so resuming from a breakpoint moves on.
+func (bp *breakpoints) run(m machine, dm inspectable, n int) int {
+	bp.mu.Lock()
+	if len(bp.addrs) == 0 {
+		bp.mu.Unlock()
+		return m.Step(n)
+	}
+	addrs := make(map[uint64]struct{}, len(bp.addrs))
+	for addr := range bp.addrs {
+		addrs[addr] = struct{}{}
+	}
+	bp.mu.Unlock()
+
+	retired := 0
+	for retired < n {
+		if m.Step(1) == 0 {
+			// Idle, waiting for an interrupt
+			break
+		}
+		retired++
+		pc := dm.Registers().PC
+		if _, ok := addrs[pc]; ok {
+			bp.mu.Lock()
+			bp.hit = &pc
+			bp.mu.Unlock()
+			break
+		}
+	}
+	return retired
+}
+
+// take returns the breakpoint the last step stopped at, once.
+func (bp *breakpoints) take() (uint64, bool) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if bp.hit == nil {
+		return 0, false
+	}
+	addr := *bp.hit
+	bp.hit = nil
+	return addr, true
+}
+
+// singleStep executes exactly n instructions of a paused machine,
+// ignoring breakpoints, and returns how many retired. Fewer retire only
+// if the guest goes idle waiting for an interrupt.
+func (e *Emulator) singleStep(m machine, n int) int {
+	retired := 0
+	for retired < n {
+		r := m.Step(n - retired)
+		if r == 0 {
+			break
+		}
+		retired += r
+	}
+	e.clock.Advance(retired)
+	e.stats.record(retired)
+	if retired > 0 {
+		e.watchdog.kick()
+	}
+	return retired
+}
+
+// stepEmulator takes n and executes that many instructions while paused,
+// returning {pc, retired}. n defaults to 1.
+func stepEmulator(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 1)
+	if err != nil {
+		return errorResult(err)
+	}
+	n := 1
+	if present(args, 0) {
+		if n, err = intArg(args, 0, "n"); err != nil {
+			return errorResult(err)
+		}
+	}
+	if n < 1 || n > maxSingleStep {
+		return errResult(codeInvalidArgument, fmt.Sprintf("n must be between 1 and %d, got %d", maxSingleStep, n))
+	}
+	if state := e.getState(); state != statePaused {
+		if !e.isRunning() {
+			return errResult(codeNotRunning, "not running")
+		}
+		return errResult(codeInvalidState, fmt.Sprintf("can only step while paused, machine is %s", state))
+	}
+	return e.inspect(func(m inspectable) map[string]interface{} {
+		retired := e.singleStep(e.machine, n)
+		return okResult(map[string]interface{}{"pc": hex64(m.Registers().PC), "retired": retired})
+	})
+}
+
+// setBreakpoint installs a PC breakpoint. When the guest reaches addr the
+// machine pauses before executing it and onBreakpoint fires with {addr}.
+func setBreakpoint(this js.Value, args []js.Value) interface{} {
+	return changeBreakpoint(args, statusBreakpointSet, statusAlreadySet, (*breakpoints).set)
+}
+
+// clearBreakpoint removes a PC breakpoint.
+func clearBreakpoint(this js.Value, args []js.Value) interface{} {
+	return changeBreakpoint(args, statusBreakpointCleared, statusNotSet, (*breakpoints).clear)
+}
+
+func changeBreakpoint(args []js.Value, changed, unchanged resultStatus, change func(*breakpoints, uint64) bool) interface{} {
+	e, args, err := lookup(args, 1)
+	if err != nil {
+		return errorResult(err)
+	}
+	addr, err := addressArg(args, 0, "addr")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.machineMu.Lock()
+	_, ok := e.machine.(inspectable)
+	supported := ok || e.machine == nil
+	e.machineMu.Unlock()
+	if !supported {
+		return errorResult(errNoDebug)
+	}
+
+	status := changed
+	if !change(&e.breakpoints, addr) {
+		status = unchanged
+	}
+	return statusResult(status, map[string]interface{}{"addr": hex64(addr)})
+}
@@ -0,0 +1,266 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// cpuBase is where cpuMachine's memory and program start.
+const cpuBase = 0x80000000
+
+// cpuMachine is an inspectable machine whose every instruction moves the
+// PC on by 4. Register xN holds N<<32|N, and memory byte i holds i.
+type cpuMachine struct {
+	pc  uint64
+	mem []byte
+}
+
+func newCPUMachine() *cpuMachine {
+	mem := make([]byte, 4096)
+	for i := range mem {
+		mem[i] = byte(i)
+	}
+	return &cpuMachine{pc: cpuBase, mem: mem}
+}
+
+func (m *cpuMachine) Step(n int) int {
+	m.pc += 4 * uint64(n)
+	return n
+}
+
+func (m *cpuMachine) Booted() bool { return true }
+
+func (m *cpuMachine) Registers() cpuRegisters {
+	regs := cpuRegisters{PC: m.pc}
+	for i := 1; i < len(regs.X); i++ {
+		regs.X[i] = uint64(i)<<32 | uint64(i)
+	}
+	return regs
+}
+
+func (m *cpuMachine) ReadMemory(addr uint64, p []byte) error {
+	if addr < cpuBase || addr-cpuBase+uint64(len(p)) > uint64(len(m.mem)) {
+		return fmt.Errorf("%d bytes at %s aren't in guest memory", len(p), hex64(addr))
+	}
+	copy(p, m.mem[addr-cpuBase:])
+	return nil
+}
+
+// pausedCPU starts an instance on a cpuMachine and pauses it.
+func pausedCPU(t *testing.T) *Emulator {
+	t.Helper()
+	useMachine(t, func(machineConfig) machine { return newCPUMachine() })
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if result := e.call(pauseEmulator).(map[string]interface{}); failed(result) {
+		t.Fatal(result["error"])
+	}
+	return e
+}
+
+func TestReadRegisters(t *testing.T) {
+	e := pausedCPU(t)
+	result := e.call(readRegisters).(map[string]interface{})
+	if failed(result) {
+		t.Fatal(result["error"])
+	}
+	data := result["data"].(map[string]interface{})
+	x := data["x"].([]interface{})
+	names := data["names"].([]interface{})
+	if len(x) != 32 || len(names) != 32 {
+		t.Fatalf("got %d registers and %d names, want 32 of each", len(x), len(names))
+	}
+	for i, want := range map[int]string{
+		0:  "0x0000000000000000",
+		1:  "0x0000000100000001",
+		10: "0x0000000a0000000a",
+		31: "0x0000001f0000001f",
+	} {
+		if x[i] != want {
+			t.Errorf("x%d = %v, want %s", i, x[i], want)
+		}
+	}
+	if names[0] != "zero" || names[2] != "sp" || names[10] != "a0" {
+		t.Errorf("names start %v, want zero, ra, sp, ... a0 at 10", names[:11])
+	}
+
+	// Paused, the PC is a valid address that holds still
+	pc := data["pc"]
+	if again := e.call(readRegisters).(map[string]interface{})["data"].(map[string]interface{})["pc"]; again != pc {
+		t.Errorf("pc moved from %v to %v while paused", pc, again)
+	}
+	if s, ok := pc.(string); !ok || len(s) != 18 || s <= hex64(cpuBase) {
+		t.Errorf("pc = %v, want a hex address past %s", pc, hex64(cpuBase))
+	}
+}
+
+func TestReadMemory(t *testing.T) {
+	e := pausedCPU(t)
+	result := e.call(readMemory, cpuBase+0x10, 4).(map[string]interface{})
+	if failed(result) {
+		t.Fatal(result["error"])
+	}
+	data := result["data"].(map[string]interface{})
+	got, err := bytesFromJS(data["data"].(js.Value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0x10, 0x11, 0x12, 0x13}) || data["addr"] != "0x0000000080000010" {
+		t.Errorf("read %v at %v, want [16 17 18 19] at 0x0000000080000010", got, data["addr"])
+	}
+
+	// Addresses also come as strings, beyond what a JS number holds
+	if result := e.call(readMemory, "0x80000ffc", 4).(map[string]interface{}); failed(result) {
+		t.Errorf("reading the last word by string address: %v", result["error"])
+	}
+
+	for _, tt := range []struct {
+		addr   interface{}
+		length int
+	}{
+		{cpuBase - 1, 4},             // starts before memory
+		{cpuBase + 4094, 4},          // runs off the end
+		{0, 1},                       // far below
+		{"0xffffffff80000000", 8},    // kernel virtual address
+		{cpuBase, 0},                 // empty read
+		{cpuBase, maxMemoryRead + 1}, // over the bound
+		{-8, 4},                      // negative address
+		{"not an address", 4},        // unparseable
+	} {
+		if got := statusOf(e.call(readMemory, tt.addr, tt.length)); got != string(codeInvalidArgument) {
+			t.Errorf("readMemory(%v, %d) = %s, want invalid_argument", tt.addr, tt.length, got)
+		}
+	}
+}
+
+func TestInspectionNeedsAnInspectableMachine(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(readRegisters)); got != string(codeNotRunning) {
+		t.Errorf("readRegisters before start = %s, want not_running", got)
+	}
+
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	e, _ = newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if got := statusOf(e.call(readRegisters)); got != string(codeUnsupported) {
+		t.Errorf("readRegisters on a machine without inspection = %s, want unsupported", got)
+	}
+	if got := statusOf(e.call(readMemory, cpuBase, 4)); got != string(codeUnsupported) {
+		t.Errorf("readMemory on a machine without inspection = %s, want unsupported", got)
+	}
+}
+
+// regsPC returns the PC tinyemuReadRegisters reports.
+func regsPC(t *testing.T, e *Emulator) string {
+	t.Helper()
+	result := e.call(readRegisters).(map[string]interface{})
+	if failed(result) {
+		t.Fatal(result["error"])
+	}
+	return result["data"].(map[string]interface{})["pc"].(string)
+}
+
+func TestBreakpointPausesBeforeTheAddress(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return newCPUMachine() })
+	hits := make(chan string, 4)
+	onBreakpoint := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		hits <- args[0].Get("addr").String()
+		return nil
+	})
+	t.Cleanup(onBreakpoint.Release)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onBreakpoint": onBreakpoint})
+
+	// Set before start, partway through the second step's slice
+	addr := cpuBase + 4*(stepInstructions+10)
+	if got := statusOf(e.call(setBreakpoint, addr)); got != string(statusBreakpointSet) {
+		t.Fatalf("setBreakpoint = %s, want breakpoint_set", got)
+	}
+	if got := statusOf(e.call(setBreakpoint, addr)); got != string(statusAlreadySet) {
+		t.Errorf("setting it again = %s, want already_set", got)
+	}
+	e.call(startEmulator)
+
+	select {
+	case hit := <-hits:
+		if hit != hex64(uint64(addr)) {
+			t.Errorf("onBreakpoint got addr %s, want %s", hit, hex64(uint64(addr)))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("onBreakpoint didn't fire")
+	}
+	if e.getState() != statePaused {
+		t.Errorf("state is %s at a breakpoint, want paused", e.getState())
+	}
+	if pc := regsPC(t, e); pc != hex64(uint64(addr)) {
+		t.Errorf("pc = %s at the breakpoint, want %s", pc, hex64(uint64(addr)))
+	}
+
+	// Resuming runs on past it rather than stopping again where it is
+	if got := statusOf(e.call(clearBreakpoint, addr)); got != string(statusBreakpointCleared) {
+		t.Errorf("clearBreakpoint = %s, want breakpoint_cleared", got)
+	}
+	if got := statusOf(e.call(clearBreakpoint, addr)); got != string(statusNotSet) {
+		t.Errorf("clearing it again = %s, want not_set", got)
+	}
+	e.call(resumeEmulator)
+	select {
+	case hit := <-hits:
+		t.Errorf("onBreakpoint fired again at %s after the breakpoint was cleared", hit)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if e.getState() != stateRunning {
+		t.Errorf("state is %s after resuming, want running", e.getState())
+	}
+}
+
+func TestStepRunsExactlyN(t *testing.T) {
+	e := pausedCPU(t)
+	var pc uint64
+	fmt.Sscan(regsPC(t, e), &pc)
+
+	for _, n := range []int{1, 3, 1000} {
+		result := e.call(stepEmulator, n).(map[string]interface{})
+		if failed(result) {
+			t.Fatal(result["error"])
+		}
+		pc += 4 * uint64(n)
+		data := result["data"].(map[string]interface{})
+		if data["retired"] != n || data["pc"] != hex64(pc) {
+			t.Errorf("step(%d) = retired %v, pc %v; want %d, %s", n, data["retired"], data["pc"], n, hex64(pc))
+		}
+		if got := regsPC(t, e); got != hex64(pc) {
+			t.Errorf("after step(%d) readRegisters has pc %s, want %s", n, got, hex64(pc))
+		}
+	}
+
+	// n defaults to 1. A lone number would be taken as n, not the handle
+	result := e.call(stepEmulator, js.Undefined()).(map[string]interface{})
+	if pc += 4; failed(result) || result["data"].(map[string]interface{})["pc"] != hex64(pc) {
+		t.Errorf("step() = %v, want pc %s", result, hex64(pc))
+	}
+	for _, n := range []int{0, -1, maxSingleStep + 1} {
+		if got := statusOf(e.call(stepEmulator, n)); got != string(codeInvalidArgument) {
+			t.Errorf("step(%d) = %s, want invalid_argument", n, got)
+		}
+	}
+}
+
+func TestStepNeedsAPausedMachine(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return newCPUMachine() })
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(stepEmulator, 1)); got != string(codeNotRunning) {
+		t.Errorf("step before start = %s, want not_running", got)
+	}
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if got := statusOf(e.call(stepEmulator, 1)); got != string(codeInvalidState) {
+		t.Errorf("step while running = %s, want invalid_state", got)
+	}
+}
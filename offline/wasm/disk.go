@@ -0,0 +1,234 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"syscall/js"
+)
+
+// sectorSize is the virtio block sector size; disk images must be a whole
+// number of sectors.
+const sectorSize = 512
+
+// maxDisks is how many virtio block devices a machine can have, named vda
+// onwards.
+const maxDisks = 8
+
+// maxImageSize caps images copied into WASM memory. Every image is held in
+// full in the Go heap alongside the JS copy it came from, so a 1 GiB disk
+// costs at least 2 GiB of browser memory while loading.
+const maxImageSize = 1 << 30
+
+var errReadOnly = newError(codeInvalidState, "disk is read-only")
+
+// blockBackend is the storage behind a virtio block device.
+type blockBackend interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() int64
+	ReadOnly() bool
+}
+
+// reverter is implemented by backends that can drop the guest's writes
+// and go back to the image as loaded, for a cold reset.
+type reverter interface {
+	// Revert discards every write and returns the offsets of the sectors
+	// it restored.
+	Revert() []int64
+}
+
+// overlayer is implemented by backends that keep the guest's writes apart
+// from the image, which is all of them a snapshot has to save.
+type overlayer interface {
+	// Overlay returns a copy of every extent written, by offset.
+	Overlay() map[int64][]byte
+	// SetOverlay replaces the guest's writes with overlay, as returned by
+	// Overlay on a backend with the same image.
+	SetOverlay(overlay map[int64][]byte) error
+}
+
+// memDisk is a blockBackend held entirely in memory. The loaded image is
+// never written: sectors the guest writes are copied out into an overlay,
+// so a cold reset can revert without keeping a second full copy.
+type memDisk struct {
+	data     []byte
+	readOnly bool
+	written  map[int64][]byte // overlay sectors by offset
+}
+
+// sector returns the current contents of the sector at off, a multiple
+// of sectorSize.
+func (d *memDisk) sector(off int64) []byte {
+	if s, ok := d.written[off]; ok {
+		return s
+	}
+	return d.data[off : off+sectorSize]
+}
+
+func (d *memDisk) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= int64(len(d.data)) {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && off < int64(len(d.data)) {
+		start := off - off%sectorSize
+		c := copy(p[n:], d.sector(start)[off-start:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (d *memDisk) WriteAt(p []byte, off int64) (int, error) {
+	if d.readOnly {
+		return 0, errReadOnly
+	}
+	if off < 0 || off+int64(len(p)) > int64(len(d.data)) {
+		return 0, io.ErrShortWrite
+	}
+	if d.written == nil {
+		d.written = make(map[int64][]byte)
+	}
+	n := 0
+	for n < len(p) {
+		start := off - off%sectorSize
+		s, ok := d.written[start]
+		if !ok {
+			s = append([]byte(nil), d.data[start:start+sectorSize]...)
+			d.written[start] = s
+		}
+		c := copy(s[off-start:], p[n:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+func (d *memDisk) Revert() []int64 {
+	offs := make([]int64, 0, len(d.written))
+	for off := range d.written {
+		offs = append(offs, off)
+	}
+	d.written = nil
+	return offs
+}
+
+func (d *memDisk) Overlay() map[int64][]byte {
+	overlay := make(map[int64][]byte, len(d.written))
+	for off, s := range d.written {
+		overlay[off] = append([]byte(nil), s...)
+	}
+	return overlay
+}
+
+func (d *memDisk) SetOverlay(overlay map[int64][]byte) error {
+	written := make(map[int64][]byte, len(overlay))
+	for off, s := range overlay {
+		if off < 0 || off%sectorSize != 0 || off >= int64(len(d.data)) || len(s) != sectorSize {
+			return fmt.Errorf("overlay extent of %d bytes at %d isn't a sector of the disk", len(s), off)
+		}
+		written[off] = append([]byte(nil), s...)
+	}
+	d.written = written
+	return nil
+}
+
+func (d *memDisk) Size() int64 { return int64(len(d.data)) }
+
+func (d *memDisk) ReadOnly() bool { return d.readOnly }
+
+// imageFromJS copies an image out of a JS Uint8Array or ArrayBuffer,
+// refusing sizes that would exhaust WASM memory instead of aborting.
+func imageFromJS(v js.Value) (data []byte, err error) {
+	if !v.InstanceOf(js.Global().Get("Uint8Array")) && !v.InstanceOf(js.Global().Get("ArrayBuffer")) {
+		return nil, errNotBytes
+	}
+	if size := v.Get("byteLength").Int(); size > maxImageSize {
+		return nil, fmt.Errorf("image is %d bytes, limit is %d", size, maxImageSize)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = nil, fmt.Errorf("allocating image: %v", r)
+		}
+	}()
+	return bytesFromJS(v)
+}
+
+// diskName returns the guest name of block device i: vda, vdb and so on.
+func diskName(i int) string {
+	return "vd" + string(rune('a'+i))
+}
+
+// diskIndex resolves a device given as an index or a name such as "vdb".
+func diskIndex(v js.Value) (int, error) {
+	switch v.Type() {
+	case js.TypeNumber:
+		n := v.Float()
+		if n != float64(int(n)) || n < 0 || n >= maxDisks {
+			return 0, fmt.Errorf("device must be a whole number between 0 and %d, got %v", maxDisks-1, n)
+		}
+		return int(n), nil
+	case js.TypeString:
+		for i := 0; i < maxDisks; i++ {
+			if v.String() == diskName(i) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown device %q, want %s to %s", v.String(), diskName(0), diskName(maxDisks-1))
+	default:
+		return 0, fmt.Errorf("device must be a number or a string, got %s", v.Type())
+	}
+}
+
+// deviceOption reads the device field of an optional options object,
+// defaulting to vda.
+func deviceOption(opts js.Value) (int, error) {
+	if opts.Type() != js.TypeObject {
+		return 0, nil
+	}
+	v := opts.Get("device")
+	if v.IsUndefined() || v.IsNull() {
+		return 0, nil
+	}
+	return diskIndex(v)
+}
+
+// loadDisk accepts (bytes, {readOnly, compression, onProgress, device}) and
+// stages the image as a virtio block device for the next start. device is
+// an index or a name, vda by default; loading a device again replaces it.
+func loadDisk(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !present(args, 0) {
+		return errResult(codeInvalidArgument, "missing disk image argument")
+	}
+
+	device, err := deviceOption(arg(args, 1))
+	if err != nil {
+		return errorResult(err)
+	}
+	data, err := loadImageArg(args)
+	if err != nil {
+		return errorResult(err)
+	}
+	if len(data) == 0 || len(data)%sectorSize != 0 {
+		return errResult(codeInvalidArgument, fmt.Sprintf("disk image size %d is not a non-zero multiple of %d", len(data), sectorSize))
+	}
+
+	readOnly := arg(args, 1).Type() == js.TypeObject && args[1].Get("readOnly").Truthy()
+	e.disks[device] = &memDisk{data: data, readOnly: readOnly}
+
+	return statusResult(statusDiskLoaded, map[string]interface{}{
+		"device":   diskName(device),
+		"size":     len(data),
+		"readOnly": readOnly,
+	})
+}
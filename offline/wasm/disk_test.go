@@ -0,0 +1,243 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+// diskImage returns an image of n sectors, each filled with its number.
+func diskImage(n int) []byte {
+	img := make([]byte, n*sectorSize)
+	for i := range img {
+		img[i] = byte(i / sectorSize)
+	}
+	return img
+}
+
+func TestLoadDiskIsReadableByTheMachine(t *testing.T) {
+	var disks [maxDisks]blockBackend
+	useMachine(t, func(config machineConfig) machine {
+		disks = config.disks
+		return &testMachine{}
+	})
+	e, _ := newTestEmulator(t, nil)
+	img := diskImage(4)
+	result := loadDisk(js.Undefined(), []js.Value{js.ValueOf(e.handle), bytesToJS(img), js.ValueOf(map[string]interface{}{"readOnly": true})})
+	if got := statusOf(result); got != string(statusDiskLoaded) {
+		t.Fatalf("tinyemuLoadDisk = %s", got)
+	}
+	data := result.(map[string]interface{})["data"].(map[string]interface{})
+	if data["device"] != "vda" || data["size"] != len(img) || data["readOnly"] != true {
+		t.Errorf("tinyemuLoadDisk data = %v", data)
+	}
+
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	vda := disks[0]
+	if vda == nil {
+		t.Fatal("machine has no vda")
+	}
+	if vda.Size() != int64(len(img)) || !vda.ReadOnly() {
+		t.Errorf("vda is %d bytes, read-only %v; want %d, true", vda.Size(), vda.ReadOnly(), len(img))
+	}
+	got := make([]byte, sectorSize+10)
+	if _, err := vda.ReadAt(got, sectorSize-5); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, img[sectorSize-5:2*sectorSize+5]) {
+		t.Error("vda doesn't read back the image")
+	}
+	if _, err := vda.WriteAt([]byte{1}, 0); err != errReadOnly {
+		t.Errorf("writing a read-only disk = %v, want errReadOnly", err)
+	}
+}
+
+func TestLoadDiskWritesStayInMemory(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	img := diskImage(2)
+	loadDisk(js.Undefined(), []js.Value{js.ValueOf(e.handle), bytesToJS(img), js.ValueOf(map[string]interface{}{"device": "vdb"})})
+	vdb := e.disks[1]
+	if vdb == nil || e.disks[0] != nil {
+		t.Fatal("image wasn't staged as vdb alone")
+	}
+	if _, err := vdb.WriteAt([]byte("hello"), 510); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 9)
+	vdb.ReadAt(got, 508)
+	if want := []byte{0, 0, 'h', 'e', 'l', 'l', 'o', 1, 1}; !bytes.Equal(got, want) {
+		t.Errorf("read % x after the write, want % x", got, want)
+	}
+	if base := vdb.(*memDisk).data; !bytes.Equal(base, img) {
+		t.Error("the write reached the loaded image")
+	}
+}
+
+func TestLoadDiskRejectsBadImages(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	for name, image := range map[string]js.Value{
+		"empty":          bytesToJS(nil),
+		"partial sector": bytesToJS(make([]byte, sectorSize+1)),
+		"string":         js.ValueOf("not bytes"),
+	} {
+		if got := statusOf(loadDisk(js.Undefined(), []js.Value{js.ValueOf(e.handle), image})); got != string(codeInvalidArgument) {
+			t.Errorf("%s image: tinyemuLoadDisk = %s, want invalid_argument", name, got)
+		}
+	}
+	if got := statusOf(loadDisk(js.Undefined(), []js.Value{js.ValueOf(e.handle), bytesToJS(diskImage(1)), js.ValueOf(map[string]interface{}{"device": "vdz"})})); got != string(codeInvalidArgument) {
+		t.Errorf("unknown device: tinyemuLoadDisk = %s, want invalid_argument", got)
+	}
+}
+
+func TestTwoDisksRegisterDistinctly(t *testing.T) {
+	var config machineConfig
+	useMachine(t, func(c machineConfig) machine {
+		config = c
+		return &testMachine{}
+	})
+	e, _ := newTestEmulator(t, nil)
+	vda, vdb := diskImage(2), bytes.Repeat([]byte{0xbb}, 3*sectorSize)
+	for _, load := range []struct {
+		img    []byte
+		device interface{}
+		want   string
+	}{
+		{vda, nil, "vda"},
+		{diskImage(1), 1, "vdb"}, // replaced by the next load
+		{vdb, "vdb", "vdb"},
+	} {
+		args := []interface{}{bytesToJS(load.img)}
+		if load.device != nil {
+			args = append(args, map[string]interface{}{"device": load.device})
+		}
+		result := e.call(loadDisk, args...).(map[string]interface{})
+		if failed(result) || result["data"].(map[string]interface{})["device"] != load.want {
+			t.Fatalf("tinyemuLoadDisk on device %v = %v, want %s", load.device, result, load.want)
+		}
+	}
+	if got := statusOf(e.call(loadInitrd, bytesToJS([]byte("initramfs")))); got != string(statusInitrdLoaded) {
+		t.Fatalf("tinyemuLoadInitrd = %s", got)
+	}
+
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	for i, want := range [][]byte{vda, vdb} {
+		disk := config.disks[i]
+		if disk == nil || disk.Size() != int64(len(want)) {
+			t.Fatalf("%s is %v, want %d bytes", diskName(i), disk, len(want))
+		}
+		got := make([]byte, len(want))
+		disk.ReadAt(got, 0)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s doesn't read back its own image", diskName(i))
+		}
+	}
+	for i := 2; i < maxDisks; i++ {
+		if config.disks[i] != nil {
+			t.Errorf("%s is set with nothing loaded there", diskName(i))
+		}
+	}
+	if string(config.initrd) != "initramfs" {
+		t.Errorf("machine got initrd %q", config.initrd)
+	}
+}
+
+func TestMissingRequiredImageFailsStart(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	e, _ := newTestEmulator(t, map[string]interface{}{"requiredImages": []interface{}{"initrd", "vdb"}})
+	for _, tt := range []struct {
+		load func()
+		want string // named by the error
+	}{
+		{func() {}, "initrd"},
+		{func() { e.call(loadInitrd, bytesToJS([]byte("initramfs"))) }, "vdb"},
+		{func() { e.call(loadDisk, bytesToJS(diskImage(1))) }, "vdb"}, // vda isn't vdb
+	} {
+		tt.load()
+		result := e.call(startEmulator).(map[string]interface{})
+		if statusOf(result) != string(codeMissingImage) {
+			t.Fatalf("start with %s missing = %v, want missing_image", tt.want, result)
+		}
+		if msg := result["error"].(map[string]interface{})["message"].(string); !strings.Contains(msg, tt.want) {
+			t.Errorf("missing_image message %q doesn't name %s", msg, tt.want)
+		}
+		if e.getState() != stateInitialized {
+			t.Errorf("failed start left the state %s", e.getState())
+		}
+	}
+
+	e.call(loadDisk, bytesToJS(diskImage(1)), map[string]interface{}{"device": "vdb"})
+	if got := statusOf(e.call(startEmulator)); got != string(statusStarting) {
+		t.Errorf("start with every image loaded = %s, want starting", got)
+	}
+
+	for _, bad := range []interface{}{"vdz", []interface{}{"kernel"}, []interface{}{3}} {
+		if msg := initError(t, map[string]interface{}{"requiredImages": bad}); !strings.Contains(msg, "requiredImages") {
+			t.Errorf("requiredImages %v: error %q doesn't name the option", bad, msg)
+		}
+	}
+}
+
+func TestWarmResetKeepsTheDiskAndColdResetRevertsIt(t *testing.T) {
+	for _, tt := range []struct {
+		mode    interface{} // nil for the default
+		reverts bool
+	}{
+		{resetWarm, false},
+		{resetCold, true},
+		{nil, true},
+	} {
+		var configs []machineConfig
+		useMachine(t, func(config machineConfig) machine {
+			configs = append(configs, config)
+			return &testMachine{}
+		})
+		e, _ := newTestEmulator(t, map[string]interface{}{"ramSizeMB": 1})
+		img := diskImage(4)
+		e.call(loadDisk, bytesToJS(img))
+		e.call(startEmulator)
+		waitState(t, e, stateRunning)
+
+		// The guest writes its disk and RAM
+		e.machineMu.Lock()
+		configs[0].disks[0].WriteAt([]byte("guest data"), sectorSize)
+		configs[0].ram[100] = 0xaa
+		e.machineMu.Unlock()
+
+		args := []interface{}{}
+		if tt.mode != nil {
+			args = append(args, tt.mode)
+		}
+		if got := statusOf(e.call(resetEmulator, args...)); got != string(statusReset) {
+			t.Fatalf("reset %v = %s", tt.mode, got)
+		}
+		waitState(t, e, stateRunning)
+		if len(configs) != 2 {
+			t.Fatalf("reset %v booted %d machines, want a second", tt.mode, len(configs))
+		}
+		after := configs[1]
+
+		got := make([]byte, len("guest data"))
+		after.disks[0].ReadAt(got, sectorSize)
+		if reverted := bytes.Equal(got, img[sectorSize:sectorSize+len(got)]); reverted != tt.reverts {
+			t.Errorf("reset %v: disk reads %q after the reset, reverted %v, want %v", tt.mode, got, reverted, tt.reverts)
+		}
+		if kept := after.ram[100] == 0xaa; kept == tt.reverts {
+			t.Errorf("reset %v: RAM byte kept %v, want %v", tt.mode, kept, !tt.reverts)
+		}
+
+		// Either way the images are the ones already loaded, not copies
+		if after.disks[0] != configs[0].disks[0] || after.kernel != configs[0].kernel || &after.ram[0] != &configs[0].ram[0] {
+			t.Errorf("reset %v: the machine got new images or RAM", tt.mode)
+		}
+	}
+
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(resetEmulator, "lukewarm")); got != string(codeInvalidArgument) {
+		t.Errorf("reset with an unknown mode = %s, want invalid_argument", got)
+	}
+}
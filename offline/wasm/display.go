@@ -0,0 +1,271 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// displayInterval caps display updates at about one per animation
+	// frame, unless displayIntervalMs says otherwise.
+	displayInterval = DefaultFlushInterval
+	// maxDisplayInterval bounds displayIntervalMs.
+	maxDisplayInterval = time.Second
+	// maxDirtyRects bounds the dirty list of one display update; past it
+	// the regions merge into their bounding box.
+	maxDirtyRects = 8
+)
+
+var errNoDisplay = newError(codeUnsupported, "machine has no display")
+
+// rect is a region of the framebuffer in pixels.
+type rect struct {
+	x, y, width, height int
+}
+
+func (r rect) empty() bool { return r.width <= 0 || r.height <= 0 }
+
+// touches reports whether r and o overlap or share an edge, so their union
+// covers nothing neither did.
+func (r rect) touches(o rect) bool {
+	return r.x <= o.x+o.width && o.x <= r.x+r.width &&
+		r.y <= o.y+o.height && o.y <= r.y+r.height
+}
+
+// union returns the smallest rect covering r and o.
+func (r rect) union(o rect) rect {
+	x, y := min(r.x, o.x), min(r.y, o.y)
+	return rect{
+		x:      x,
+		y:      y,
+		width:  max(r.x+r.width, o.x+o.width) - x,
+		height: max(r.y+r.height, o.y+o.height) - y,
+	}
+}
+
+// clip returns the part of r inside a width by height display.
+func (r rect) clip(width, height int) rect {
+	x, y := max(r.x, 0), max(r.y, 0)
+	return rect{
+		x:      x,
+		y:      y,
+		width:  max(min(r.x+r.width, width)-x, 0),
+		height: max(min(r.y+r.height, height)-y, 0),
+	}
+}
+
+func (r rect) toJS() map[string]interface{} {
+	return map[string]interface{}{
+		"x":      r.x,
+		"y":      r.y,
+		"width":  r.width,
+		"height": r.height,
+	}
+}
+
+// dirtyRegion accumulates damage between display updates as a short list
+// of rects, merging those that touch. The zero value is empty.
+type dirtyRegion struct {
+	rects []rect
+}
+
+// mark adds r to the region.
+func (d *dirtyRegion) mark(r rect) {
+	if r.empty() {
+		return
+	}
+	// Absorb every rect r touches, starting over as the union grows
+	for i := 0; i < len(d.rects); {
+		if !d.rects[i].touches(r) {
+			i++
+			continue
+		}
+		r = r.union(d.rects[i])
+		d.rects = append(d.rects[:i], d.rects[i+1:]...)
+		i = 0
+	}
+	d.rects = append(d.rects, r)
+	if len(d.rects) > maxDirtyRects {
+		d.rects = []rect{d.bounds()}
+	}
+}
+
+// bounds returns the bounding box of the region.
+func (d *dirtyRegion) bounds() rect {
+	var b rect
+	for i, r := range d.rects {
+		if i == 0 {
+			b = r
+			continue
+		}
+		b = b.union(r)
+	}
+	return b
+}
+
+// take returns the region's rects and empties it.
+func (d *dirtyRegion) take() []rect {
+	rects := d.rects
+	d.rects = nil
+	return rects
+}
+
+// displayInfo describes a framebuffer's geometry and pixel layout.
+type displayInfo struct {
+	width, height int
+	stride        int    // bytes per row
+	format        string // e.g. "rgba8888", matching ImageData when stride is width*4
+}
+
+// displayPixelBytes is the size of a pixel in every format a display
+// comes in.
+const displayPixelBytes = 4
+
+func (d displayInfo) toJS() map[string]interface{} {
+	return map[string]interface{}{
+		"width":  d.width,
+		"height": d.height,
+		"stride": d.stride,
+		"format": d.format,
+	}
+}
+
+// framebuffer is implemented by machines with a display device.
+type framebuffer interface {
+	DisplayInfo() displayInfo
+	// TakeDirty returns the regions changed since the last call and clears
+	// them. A dirtyRegion keeps the list short.
+	TakeDirty() []rect
+	// Pixels returns the framebuffer memory, valid until the next Step.
+	Pixels() []byte
+}
+
+// displaySink holds the JS display callback.
+type displaySink struct {
+	mu       sync.Mutex
+	callback js.Value
+}
+
+func (d *displaySink) get() js.Value {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.callback
+}
+
+// pumpDisplay delivers dirty frames from fb to the display callback until
+// ctx is canceled. Changes between ticks coalesce into one update, with
+// the damage merged into at most maxDirtyRects rects. Only the rows and
+// columns inside their bounds are copied, through buffers kept from one
+// update to the next.
+func (e *Emulator) pumpDisplay(ctx context.Context, fb framebuffer) {
+	ticker := time.NewTicker(e.options.displayInterval)
+	defer ticker.Stop()
+
+	var (
+		damage dirtyRegion
+		buf    []byte   // the dirty pixels, packed
+		out    js.Value // a Uint8Array of at least len(buf)
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		callback := e.display.get()
+		if callback.Type() != js.TypeFunction {
+			continue
+		}
+
+		e.machineMu.Lock()
+		for _, r := range fb.TakeDirty() {
+			damage.mark(r)
+		}
+		var frame map[string]interface{}
+		var dirty rect
+		if len(damage.rects) > 0 {
+			info := fb.DisplayInfo()
+			frame = info.toJS()
+			dirty = damage.bounds().clip(info.width, info.height)
+			buf = copyRect(buf[:0], fb.Pixels(), info.stride, dirty)
+		}
+		e.machineMu.Unlock()
+
+		if frame == nil {
+			continue
+		}
+		if out.IsUndefined() || out.Length() < len(buf) {
+			out = js.Global().Get("Uint8Array").New(len(buf))
+		}
+		data := out.Call("subarray", 0, len(buf))
+		js.CopyBytesToJS(data, buf)
+		frame["data"] = data
+		frame["dirty"] = dirty.toJS()
+		rects := damage.take()
+		list := make([]interface{}, len(rects))
+		for i, r := range rects {
+			list[i] = r.toJS()
+		}
+		frame["dirtyRects"] = list
+		callback.Invoke(frame)
+	}
+}
+
+// copyRect appends the pixels of r in a framebuffer with the given stride
+// to dst, row after row with nothing between them.
+func copyRect(dst, pixels []byte, stride int, r rect) []byte {
+	row := r.width * displayPixelBytes
+	for y := r.y; y < r.y+r.height; y++ {
+		start := y*stride + r.x*displayPixelBytes
+		if start+row > len(pixels) {
+			break
+		}
+		dst = append(dst, pixels[start:start+row]...)
+	}
+	return dst
+}
+
+// setDisplayCallback registers fn to receive {data, width, height, stride,
+// format, dirty, dirtyRects} whenever the display changes, at most once
+// per displayIntervalMs. dirty bounds everything that changed and
+// dirtyRects breaks it down, so a canvas can redraw only those parts.
+// data holds just the pixels inside dirty, dirty.width*4 bytes to a row,
+// ready for an ImageData of dirty's size put at dirty.x, dirty.y. The
+// array is reused by the next update, so copy it to keep it. null
+// unregisters the callback.
+func setDisplayCallback(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	fn, err := optionalFuncArg(args, 0, "display callback")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.display.mu.Lock()
+	e.display.callback = fn
+	e.display.mu.Unlock()
+	return statusResult(statusDisplayCallbackSet, nil)
+}
+
+// getDisplayInfo returns the current display geometry.
+func getDisplayInfo(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+	fb, ok := e.machine.(framebuffer)
+	if !ok {
+		return errorResult(errNoDisplay)
+	}
+	return okResult(fb.DisplayInfo().toJS())
+}
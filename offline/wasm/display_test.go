@@ -0,0 +1,183 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+func TestDirtyRegionMergesTouchingRects(t *testing.T) {
+	var d dirtyRegion
+	d.mark(rect{0, 0, 2, 2})
+	d.mark(rect{2, 0, 2, 2}) // shares an edge with the first
+	d.mark(rect{10, 10, 1, 1})
+	d.mark(rect{5, 5, 0, 3})
+	if want := []rect{{0, 0, 4, 2}, {10, 10, 1, 1}}; !reflect.DeepEqual(d.rects, want) {
+		t.Errorf("region is %v, want %v", d.rects, want)
+	}
+
+	// A rect bridging two others merges all three
+	d.mark(rect{3, 1, 8, 10})
+	if got, want := d.take(), []rect{{0, 0, 11, 11}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bridged region is %v, want %v", got, want)
+	}
+	if d.rects != nil {
+		t.Error("take left the region non-empty")
+	}
+
+	for i := 0; i <= maxDirtyRects; i++ {
+		d.mark(rect{i * 10, 0, 1, 1})
+	}
+	if want := []rect{{0, 0, maxDirtyRects*10 + 1, 1}}; !reflect.DeepEqual(d.rects, want) {
+		t.Errorf("past %d rects the region is %v, want its bounding box", maxDirtyRects, d.rects)
+	}
+}
+
+// fbMachine has an 8x4 RGBA framebuffer. Its dirty list is guarded by
+// the emulator's machineMu like any machine state.
+type fbMachine struct {
+	testMachine
+	pixels []byte
+	dirty  []rect
+}
+
+func newFBMachine() *fbMachine {
+	m := &fbMachine{pixels: make([]byte, 8*4*4)}
+	for i := range m.pixels {
+		m.pixels[i] = byte(i)
+	}
+	return m
+}
+
+func (m *fbMachine) DisplayInfo() displayInfo {
+	return displayInfo{width: 8, height: 4, stride: 8 * 4, format: "rgba8888"}
+}
+
+func (m *fbMachine) TakeDirty() []rect {
+	d := m.dirty
+	m.dirty = nil
+	return d
+}
+
+func (m *fbMachine) Pixels() []byte { return m.pixels }
+
+// damage marks rects dirty as the guest would between steps.
+func (m *fbMachine) damage(e *Emulator, rects ...rect) {
+	e.machineMu.Lock()
+	m.dirty = append(m.dirty, rects...)
+	e.machineMu.Unlock()
+}
+
+// waitFrames waits up to a second for rec to hold n frames.
+func waitFrames(t *testing.T, rec *outputRecorder, n int) []js.Value {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		rec.mu.Lock()
+		frames := append([]js.Value(nil), rec.chunks...)
+		rec.mu.Unlock()
+		if len(frames) >= n {
+			return frames
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d display frames, want %d", len(frames), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDisplayCallbackGetsDirtyFrames(t *testing.T) {
+	m := newFBMachine()
+	useMachine(t, func(machineConfig) machine { return m })
+	e, _ := newTestEmulator(t, map[string]interface{}{"displayIntervalMs": 20})
+	frames := newOutputRecorder(t)
+	if got := statusOf(e.call(setDisplayCallback, frames.fn)); got != string(statusDisplayCallbackSet) {
+		t.Fatalf("tinyemuSetDisplayCallback = %s", got)
+	}
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+
+	// Two changes inside one interval coalesce into one update
+	m.damage(e, rect{0, 0, 2, 1}, rect{5, 2, 3, 2})
+	f := waitFrames(t, frames, 1)[0]
+	if f.Get("width").Int() != 8 || f.Get("height").Int() != 4 || f.Get("stride").Int() != 32 || f.Get("format").String() != "rgba8888" {
+		t.Errorf("frame geometry %vx%v stride %v format %v, want 8x4 stride 32 rgba8888",
+			f.Get("width"), f.Get("height"), f.Get("stride"), f.Get("format"))
+	}
+	if got := jsRect(f.Get("dirty")); got != (rect{0, 0, 8, 4}) {
+		t.Errorf("dirty = %v, want the bounds of both changes", got)
+	}
+	if list := f.Get("dirtyRects"); list.Length() != 2 || jsRect(list.Index(0)) != (rect{0, 0, 2, 1}) || jsRect(list.Index(1)) != (rect{5, 2, 3, 2}) {
+		t.Errorf("dirtyRects has %d rects, want the two changes", list.Length())
+	}
+	// The bounds cover the whole display, so data is all of it
+	if data, err := bytesFromJS(f.Get("data")); err != nil || !bytes.Equal(data, m.pixels) {
+		t.Errorf("frame data is %d bytes (%v), want the framebuffer", len(data), err)
+	}
+
+	// Nothing new is drawn until something changes
+	time.Sleep(100 * time.Millisecond)
+	if n := len(waitFrames(t, frames, 1)); n != 1 {
+		t.Errorf("%d frames with no new damage", n)
+	}
+	m.damage(e, rect{1, 1, 1, 1})
+	if f := waitFrames(t, frames, 2)[1]; jsRect(f.Get("dirty")) != (rect{1, 1, 1, 1}) {
+		t.Errorf("second frame's dirty = %v", jsRect(f.Get("dirty")))
+	}
+}
+
+func TestDisplayFrameCarriesOnlyTheDirtyPixels(t *testing.T) {
+	m := newFBMachine()
+	useMachine(t, func(machineConfig) machine { return m })
+	e, _ := newTestEmulator(t, map[string]interface{}{"displayIntervalMs": 20})
+	frames := newOutputRecorder(t)
+	e.call(setDisplayCallback, frames.fn)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+
+	// Columns 2 to 4 of rows 1 and 2, packed 12 bytes to a row
+	m.damage(e, rect{2, 1, 3, 2})
+	f := waitFrames(t, frames, 1)[0]
+	want := append(append([]byte(nil), m.pixels[1*32+2*4:1*32+5*4]...), m.pixels[2*32+2*4:2*32+5*4]...)
+	if data, err := bytesFromJS(f.Get("data")); err != nil || !bytes.Equal(data, want) {
+		t.Errorf("frame data is % x (%v), want the dirty rect's % x", data, err, want)
+	}
+
+	// A rect running off the display is cut to it
+	m.damage(e, rect{6, 3, 5, 5})
+	f2 := waitFrames(t, frames, 2)[1]
+	if got := jsRect(f2.Get("dirty")); got != (rect{6, 3, 2, 1}) {
+		t.Errorf("dirty = %v, want it clipped to the display", got)
+	}
+	if data, _ := bytesFromJS(f2.Get("data")); !bytes.Equal(data, m.pixels[3*32+6*4:]) {
+		t.Errorf("clipped frame data is % x, want the last two pixels", data)
+	}
+
+	// The smaller update reuses the first one's memory
+	if !f.Get("data").Get("buffer").Equal(f2.Get("data").Get("buffer")) {
+		t.Error("each update allocated a new buffer")
+	}
+}
+
+// jsRect reads a rect back from its JS form.
+func jsRect(v js.Value) rect {
+	return rect{v.Get("x").Int(), v.Get("y").Int(), v.Get("width").Int(), v.Get("height").Int()}
+}
+
+func TestGetDisplayInfo(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(getDisplayInfo)); got != string(codeUnsupported) {
+		t.Errorf("before a graphical machine runs: tinyemuGetDisplayInfo = %s, want unsupported", got)
+	}
+
+	useMachine(t, func(machineConfig) machine { return newFBMachine() })
+	e.call(startEmulator)
+	r := e.call(getDisplayInfo).(map[string]interface{})
+	if want := (displayInfo{8, 4, 32, "rgba8888"}).toJS(); failed(r) || !reflect.DeepEqual(r["data"], want) {
+		t.Errorf("tinyemuGetDisplayInfo = %v, want %v", r, want)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+)
+
+// dispose tears e down for good: the run loop, any background work, and
+// every js.Func it owns. It reports whether the run loop stopped in time
+// and how many funcs were released.
+func (e *Emulator) dispose() (bool, int) {
+	owned := e.funcs.count()
+	exited := e.haltRunLoop()
+
+	e.recorder.mu.Lock()
+	if e.recorder.replayStop != nil {
+		close(e.recorder.replayStop)
+		e.recorder.replayStop = nil
+	}
+	e.recorder.mu.Unlock()
+	e.script.cancel()
+	e.typing.cancel()
+	e.loads.cancelAll()
+	e.waiters.cancelAll()
+
+	e.ringMu.Lock()
+	if e.ringStop != nil {
+		close(e.ringStop)
+		e.ringStop = nil
+	}
+	e.ringMu.Unlock()
+
+	e.netMu.Lock()
+	if e.net != nil {
+		e.net.close()
+		e.net = nil
+	}
+	e.netMu.Unlock()
+
+	e.display.mu.Lock()
+	e.display.callback = js.Undefined()
+	e.display.mu.Unlock()
+	e.audio.mu.Lock()
+	e.audio.callback = js.Undefined()
+	e.audio.mu.Unlock()
+	e.messages.writer.SetCallback(js.Undefined())
+	e.streams.shutdownAll()
+
+	e.reader.Close()
+	for _, sc := range e.consoles {
+		sc.reader.Close()
+	}
+	e.messages.reader.Close()
+	unregister(e)
+	e.setState(stateDisposed)
+	e.funcs.releaseAll()
+	return exited, owned
+}
+
+// disposeEmulator destroys an instance and frees what it holds on the JS
+// side. The handle is invalid afterwards; if it was the default, the most
+// recently created remaining instance takes over.
+func disposeEmulator(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	status := statusDisposed
+	exited, released := e.dispose()
+	if !exited {
+		status = statusDisposeTimeout
+	}
+	return statusResult(status, map[string]interface{}{"handle": e.handle, "releasedFuncs": released})
+}
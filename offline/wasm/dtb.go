@@ -0,0 +1,57 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall/js"
+)
+
+const (
+	// fdtMagic opens every flattened device tree, big-endian.
+	fdtMagic = 0xd00dfeed
+	// fdtHeaderSize is the size of a version 17 FDT header.
+	fdtHeaderSize = 40
+)
+
+// parseDTB checks that data holds a flattened device tree and returns it
+// cut to the size its header declares.
+func parseDTB(data []byte) ([]byte, error) {
+	if len(data) < fdtHeaderSize {
+		return nil, fmt.Errorf("device tree is %d bytes, too small for an FDT header", len(data))
+	}
+	if magic := binary.BigEndian.Uint32(data); magic != fdtMagic {
+		return nil, fmt.Errorf("device tree magic is 0x%08x, want 0x%08x", magic, fdtMagic)
+	}
+	size := binary.BigEndian.Uint32(data[4:])
+	if size < fdtHeaderSize || uint64(size) > uint64(len(data)) {
+		return nil, fmt.Errorf("device tree header gives size %d, image is %d bytes", size, len(data))
+	}
+	return data[:size], nil
+}
+
+// loadDTB accepts a flattened device tree as a Uint8Array or ArrayBuffer,
+// plus an optional {compression, onProgress} options object. The machine
+// boots with it instead of the device tree it would generate from the
+// init options.
+func loadDTB(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !present(args, 0) {
+		return errResult(codeInvalidArgument, "missing device tree argument")
+	}
+
+	data, err := loadImageArg(args)
+	if err != nil {
+		return errorResult(err)
+	}
+	dtb, err := parseDTB(data)
+	if err != nil {
+		return errorResult(err)
+	}
+	e.dtb = dtb
+	return statusResult(statusDTBLoaded, map[string]interface{}{"size": len(dtb)})
+}
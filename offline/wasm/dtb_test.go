@@ -0,0 +1,74 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// fdtImage is a size byte device tree, with trailing bytes of padding
+// after it that its header doesn't count.
+func fdtImage(size, trailing int) []byte {
+	data := bytes.Repeat([]byte{0xaa}, size+trailing)
+	binary.BigEndian.PutUint32(data, fdtMagic)
+	binary.BigEndian.PutUint32(data[4:], uint32(size))
+	return data
+}
+
+func TestBadDTBIsRejected(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	good := fdtImage(64, 0)
+	e.call(loadDTB, bytesToJS(good))
+
+	badMagic := fdtImage(64, 0)
+	binary.BigEndian.PutUint32(badMagic, 0xedfe0dd0) // the magic little-endian
+	oversized := fdtImage(64, 0)
+	binary.BigEndian.PutUint32(oversized[4:], 65)
+	for name, data := range map[string][]byte{
+		"bad magic":            badMagic,
+		"shorter than header":  fdtImage(64, 0)[:fdtHeaderSize-1],
+		"size past the end":    oversized,
+		"size inside a header": fdtImage(fdtHeaderSize-1, 1),
+	} {
+		if got := statusOf(e.call(loadDTB, bytesToJS(data))); got != string(codeInvalidArgument) {
+			t.Errorf("%s: tinyemuLoadDTB = %s, want invalid_argument", name, got)
+		}
+	}
+	if got := statusOf(e.call(loadDTB)); got != string(codeInvalidArgument) {
+		t.Errorf("no argument: tinyemuLoadDTB = %s, want invalid_argument", got)
+	}
+	// A refused tree doesn't replace the one staged
+	if !bytes.Equal(e.dtb, good) {
+		t.Errorf("staged device tree is %d bytes after refused loads, want the good %d", len(e.dtb), len(good))
+	}
+}
+
+func TestSuppliedDTBReachesTheMachine(t *testing.T) {
+	var got []byte
+	useMachine(t, func(config machineConfig) machine {
+		got = config.dtb
+		return &testMachine{}
+	})
+
+	// Without one the machine generates its own
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if got != nil {
+		t.Errorf("machine got a %d byte device tree nobody loaded", len(got))
+	}
+	e.call(stopEmulator)
+
+	result := e.call(loadDTB, bytesToJS(fdtImage(64, 16))).(map[string]interface{})
+	if statusOf(result) != string(statusDTBLoaded) || result["data"].(map[string]interface{})["size"] != 64 {
+		t.Fatalf("tinyemuLoadDTB = %v, want dtb_loaded with size 64", result)
+	}
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	// Cut to the size in its header
+	if want := fdtImage(64, 0); !bytes.Equal(got, want) {
+		t.Errorf("machine got a %d byte device tree, want the loaded %d", len(got), len(want))
+	}
+}
@@ -0,0 +1,427 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"syscall/js"
+	"time"
+)
+
+// stopTimeout bounds how long a stop waits for the run loop to exit.
+const stopTimeout = 2 * time.Second
+
+var (
+	errNotInitialized = newError(codeNotInitialized, "not initialized, call tinyemuInit first")
+	errStopTimeout    = newError(codeTimeout, "run loop did not stop in time")
+	errNoKernel       = newError(codeNoKernel, "no kernel loaded, call tinyemuLoadKernel first")
+)
+
+// Emulator is one emulated machine together with the console wiring and
+// boot inputs JavaScript has set up for it. Each tinyemuInit creates one.
+type Emulator struct {
+	handle int
+	writer *ConsoleWriter
+	reader *ConsoleReader
+
+	// Consoles besides console0, fixed at init
+	consoles map[string]*serialConsole
+	messages messagePort
+	line     lineDiscipline
+	options  options
+	log      *logger
+	funcs    *funcRegistry
+	clock    clock
+	rand     *rand.Rand // seeds device randomness
+
+	// Guest RAM, allocated up front by tinyemuInit so running out of
+	// memory is reported there
+	ram []byte
+
+	// Staged for the next boot
+	kernel   *kernelImage
+	firmware []byte
+	dtb      []byte
+	cmdline  string
+	initrd   []byte
+	disks    [maxDisks]blockBackend
+	winsize  winsize
+
+	// Run loop lifecycle
+	ctx  context.Context
+	stop context.CancelFunc
+	done chan struct{} // closed when the run loop exits
+
+	// Lifecycle state, changed only through setState and transition
+	stateMu     sync.Mutex
+	state       string
+	stateQueue  []string
+	dispatching bool
+
+	// Pause state. Pausing never touches ctx, so machine state survives
+	// until resume.
+	pauseMu     sync.Mutex
+	paused      bool
+	resumed     chan struct{} // closed when a pause ends
+	pausedState string        // state to return to on resume
+	untilOutput atomic.Bool   // a tinyemuRunUntilOutput is in progress
+
+	// machineMu guards machine, which the run loop holds while stepping.
+	// stepCtx is the run's context while the run loop is in a step, and
+	// parked is set while that step waits for a Promise with machineMu let
+	// go; see awaitStep.
+	machineMu sync.Mutex
+	machine   machine
+	stepCtx   context.Context
+	parked    atomic.Bool
+
+	stats    runStats
+	limiter  speedLimiter
+	yielder  yielder
+	ready    readyWatcher
+	watchdog watchdog
+	waiters  outputWaiters
+
+	breakpoints breakpoints
+	loads       loadSet
+
+	recorder   recorder
+	script     scriptRunner
+	typing     scriptRunner
+	scrollback *scrollback
+
+	display displaySink
+	audio   audioSink
+	streams streamSet
+
+	// Network tunnel, if attached
+	netMu sync.Mutex
+	net   *netLink
+
+	// SharedArrayBuffer input ring consumer, if one is bound
+	ringMu   sync.Mutex
+	ring     *inputRing
+	ringStop chan struct{}
+}
+
+func newEmulator(callback js.Value, opts options) *Emulator {
+	e := &Emulator{
+		writer:  NewConsoleWriter(callback, DefaultFlushInterval),
+		options: opts,
+		log:     newLogger(opts.logLevel, opts.onLog),
+		funcs:   newFuncRegistry(),
+		winsize: defaultWinsize,
+		cmdline: opts.cmdline,
+	}
+	e.clock, e.rand = newClock(opts)
+	e.log.format = opts.logFormat
+	e.log.clock = e.clock
+	e.stats.clock = e.clock
+	e.limiter.clock = e.clock
+	e.yielder.budget = opts.yield
+	e.scrollback = newScrollback(opts.scrollback)
+	e.writer.Tap = func(p []byte) {
+		e.recorder.output(p)
+		e.scrollback.Write(p)
+	}
+	e.reader = e.newInputReader()
+	e.writer.Encoding = opts.encoding
+	e.writer.SetStripANSI(opts.stripANSI)
+	e.writer.DisableFailing = opts.disableFailing
+	e.writer.FlushOnNewline = opts.flushOnNewline
+	e.writer.Clock = e.clock
+	e.writer.SetSize(e.winsize)
+	e.writer.SetEventCallback(opts.onEvent)
+	e.newSerialConsoles(opts.consoles)
+	e.newMessagePort()
+	return e
+}
+
+// newInputReader creates a console input queue configured by the options.
+// Input arrives from calls on the JS event loop, which can't wait for the
+// guest to make room, so a full queue refuses it with ErrInputFull.
+func (e *Emulator) newInputReader() *ConsoleReader {
+	r := NewConsoleReaderWithPolicy(e.options.readMode == readBlock, OverflowError)
+	if e.options.readMode == readTimeout {
+		r.ReadTimeout = e.options.readTimeout
+	}
+	r.MaxBuffered = e.options.maxInputBytes
+	r.Rate = e.options.inputRate
+	r.Clock = e.clock
+	return r
+}
+
+// Instance registry. Calls that don't pass a handle address the default
+// instance, which is the one most recently created by tinyemuInit.
+var (
+	instancesMu   sync.Mutex
+	instances     = make(map[int]*Emulator)
+	nextHandle    = 1
+	defaultHandle int
+)
+
+// register adds e to the registry, makes it the default and returns its handle.
+func register(e *Emulator) int {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+
+	e.handle = nextHandle
+	nextHandle++
+	instances[e.handle] = e
+	defaultHandle = e.handle
+	return e.handle
+}
+
+// unregister removes e from the registry. If e was the default, the most
+// recent remaining instance becomes the default.
+func unregister(e *Emulator) {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+
+	delete(instances, e.handle)
+	if defaultHandle == e.handle {
+		defaultHandle = 0
+		for h := range instances {
+			defaultHandle = max(defaultHandle, h)
+		}
+	}
+}
+
+// instanceByHandle returns the instance with the given handle, or nil.
+func instanceByHandle(handle int) *Emulator {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	return instances[handle]
+}
+
+// lookup resolves which instance a call addresses and returns the
+// remaining arguments. A leading number is taken as a handle when the call
+// has more arguments than the function's leading numeric parameters, so
+// tinyemuResize(80, 24) and tinyemuResize(h, 80, 24) both work.
+func lookup(args []js.Value, numericParams int) (*Emulator, []js.Value, error) {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+
+	handle := defaultHandle
+	if len(args) > numericParams && args[0].Type() == js.TypeNumber {
+		handle = args[0].Int()
+		args = args[1:]
+		if _, ok := instances[handle]; !ok {
+			return nil, args, withCode(codeUnknownHandle, fmt.Errorf("unknown emulator handle %d", handle))
+		}
+	}
+
+	e, ok := instances[handle]
+	if !ok {
+		return nil, args, errNotInitialized
+	}
+	return e, args, nil
+}
+
+// stagedConfig returns the machine configuration for the next start.
+func (e *Emulator) stagedConfig() machineConfig {
+	return machineConfig{
+		console:       watchedConsole{e},
+		consoleDevice: e.options.consoleDevice,
+		consoles:      e.consolePorts(),
+		messages:      e.messages.port(),
+		ramSizeMB:     e.options.ramSizeMB,
+		cores:         e.options.cores,
+		isa:           e.options.isa,
+		ram:           e.ram,
+		kernel:        e.kernel,
+		bootMethod:    e.options.bootMethod,
+		firmware:      e.firmware,
+		dtb:           e.dtb,
+		cmdline:       e.cmdline,
+		initrd:        e.initrd,
+		disks:         e.machineDisks(),
+		winsize:       e.winsize,
+		exitPort:      e.options.exitPort,
+		rtc:           e.newRTC(),
+		clock:         e.clock,
+		rand:          rand.New(rand.NewSource(e.rand.Int63())),
+	}
+}
+
+// start boots the staged configuration unless a run is already in
+// progress. The check and the move to starting happen together under
+// stateMu, so of two racing starts only one launches a run loop. A
+// non-zero bootTimeout stops the run if it isn't ready in time.
+func (e *Emulator) start(onBooted func(), bootTimeout time.Duration) map[string]interface{} {
+	if e.kernel == nil {
+		return errorResult(errNoKernel)
+	}
+	if err := e.missingImage(); err != nil {
+		return errorResult(err)
+	}
+	if err := e.checkBoot(e.options.bootMethod); err != nil {
+		return errorResult(err)
+	}
+	if e.loopAlive() || !e.transitionFrom(stateStarting, stateInitialized, stateStopped, stateCrashed, stateBootTimeout, stateHalted) {
+		if e.getState() == statePaused {
+			return errResult(codeAlreadyRunning, "already running and paused, call tinyemuResume")
+		}
+		return errResult(codeAlreadyRunning, "already running")
+	}
+
+	result := e.launch(nil, onBooted)
+	if !failed(result) && bootTimeout > 0 {
+		e.watchBoot(e.ctx, e.stop, bootTimeout)
+	}
+	return result
+}
+
+// loopAlive reports whether a run loop goroutine has not exited yet, which
+// can outlast a stop that timed out.
+func (e *Emulator) loopAlive() bool {
+	if e.done == nil {
+		return false
+	}
+	select {
+	case <-e.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// launch starts the run loop goroutine on m, or on a freshly booted machine
+// if m is nil. If onBooted is non-nil it is called from that goroutine once
+// the boot sequence has finished.
+func (e *Emulator) launch(m machine, onBooted func()) map[string]interface{} {
+	if m == nil && e.kernel == nil {
+		return errorResult(errNoKernel)
+	}
+
+	e.ctx, e.stop = context.WithCancel(context.Background())
+	e.reader.SetContext(e.ctx)
+	for _, sc := range e.consoles {
+		sc.reader.SetContext(e.ctx)
+	}
+	e.messages.reader.SetContext(e.ctx)
+	e.setState(stateStarting)
+
+	e.pauseMu.Lock()
+	e.paused = false
+	e.pauseMu.Unlock()
+
+	if m == nil {
+		m = newMachine(e.stagedConfig())
+	}
+	if n, ok := m.(netInterface); ok {
+		n.SetTransmit(e.transmitFrame)
+	}
+	e.machineMu.Lock()
+	e.machine = m
+	e.machineMu.Unlock()
+	e.stats.reset()
+	e.yielder.reset(e.clock.Now())
+	e.options.exitPort.reset()
+	e.ready.reset()
+
+	done := make(chan struct{})
+	e.done = done
+	ctx, stop := e.ctx, e.stop
+	go func() {
+		defer close(done)
+		defer e.recoverCrash(stop)
+		defer e.stats.halt()
+		e.runLoop(ctx, stop, m, onBooted)
+		e.drainOutput(m)
+	}()
+
+	go func() {
+		defer e.recoverCrash(stop)
+		e.watch(ctx)
+	}()
+	if e.options.statsInterval > 0 && e.options.onStats.Type() == js.TypeFunction {
+		go func() {
+			defer e.recoverCrash(stop)
+			e.reportStats(ctx)
+		}()
+	}
+	if fb, ok := m.(framebuffer); ok {
+		go func() {
+			defer e.recoverCrash(stop)
+			e.pumpDisplay(ctx, fb)
+		}()
+	}
+	if dev, ok := m.(audioDevice); ok {
+		go func() {
+			defer e.recoverCrash(stop)
+			e.pumpAudio(ctx, dev)
+		}()
+	}
+
+	return statusResult(statusStarting, nil)
+}
+
+// recoverCrash must be deferred by every goroutine that runs emulator code,
+// with the cancel func of the run it belongs to. It turns a panic into a
+// crashed instance and an onError callback with the panic message and
+// stack, instead of a dead WASM module.
+func (e *Emulator) recoverCrash(stop context.CancelFunc) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	e.setState(stateCrashed)
+	stop()
+	e.writer.Flush()
+	e.flushConsoles()
+
+	e.log.with(e.runFields()).Errorf("crashed: %v", r)
+	if e.options.onError.Type() == js.TypeFunction {
+		e.options.onError.Invoke(map[string]interface{}{
+			"message": fmt.Sprint(r),
+			"code":    stateCrashed,
+			"stack":   string(debug.Stack()),
+		})
+	}
+}
+
+// isRunning reports whether a run loop has been started and not stopped.
+func (e *Emulator) isRunning() bool {
+	return e.ctx != nil && e.ctx.Err() == nil
+}
+
+// isStarted reports whether the instance has left the initialized state for
+// a run that hasn't already ended.
+func (e *Emulator) isStarted() bool {
+	switch e.getState() {
+	case stateStarting, stateRunning, statePaused:
+		return true
+	}
+	return false
+}
+
+// haltRunLoop cancels the run loop, waits up to stopTimeout for it to exit
+// and flushes pending output. A loop that exits drains the machine first;
+// the flush here also covers one that didn't exit in time. It reports
+// whether the loop exited.
+func (e *Emulator) haltRunLoop() bool {
+	if e.stop == nil {
+		return true
+	}
+	e.stop()
+
+	exited := true
+	if e.done != nil {
+		select {
+		case <-e.done:
+		case <-time.After(stopTimeout):
+			exited = false
+			e.log.Warnf("run loop still running %v after stop", stopTimeout)
+		}
+	}
+	e.writer.Flush()
+	e.flushConsoles()
+	return exited
+}
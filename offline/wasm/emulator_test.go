@@ -0,0 +1,368 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// testKernel is a raw RISC-V image the kernel loader accepts.
+var testKernel = bytes.Repeat([]byte{0x13}, 4096)
+
+// newTestEmulator runs tinyemuInit with opts, output going to the returned
+// recorder, stages testKernel and disposes the instance when the test
+// ends.
+func newTestEmulator(t *testing.T, opts map[string]interface{}) (*Emulator, *outputRecorder) {
+	t.Helper()
+	rec := newOutputRecorder(t)
+	args := []js.Value{rec.fn.Value}
+	if opts != nil {
+		args = append(args, js.ValueOf(opts))
+	}
+	result := initEmulator(js.Undefined(), args).(map[string]interface{})
+	if failed(result) {
+		t.Fatalf("tinyemuInit: %v", result["error"])
+	}
+	handle := result["data"].(map[string]interface{})["handle"].(int)
+	e := instances[handle]
+	t.Cleanup(func() { e.dispose() })
+
+	if result := e.stageKernel(testKernel); failed(result) {
+		t.Fatalf("staging the kernel: %v", result["error"])
+	}
+	return e, rec
+}
+
+// initError returns the message of the invalid_argument error tinyemuInit
+// gives for opts, which it fails the test for accepting.
+func initError(t *testing.T, opts map[string]interface{}) string {
+	t.Helper()
+	// A real callback, so the options are what gets refused
+	result := initEmulator(js.Undefined(), []js.Value{newOutputRecorder(t).fn.Value, js.ValueOf(opts)}).(map[string]interface{})
+	if !failed(result) {
+		t.Errorf("tinyemuInit(%.40v) succeeded", opts)
+		instances[result["data"].(map[string]interface{})["handle"].(int)].dispose()
+		return ""
+	}
+	if code := statusOf(result); code != string(codeInvalidArgument) {
+		t.Errorf("tinyemuInit(%.40v) = %s, want invalid_argument", opts, code)
+	}
+	return result["error"].(map[string]interface{})["message"].(string)
+}
+
+// call invokes a tinyemu export on e's handle with args after it.
+func (e *Emulator) call(fn func(js.Value, []js.Value) interface{}, args ...interface{}) interface{} {
+	vals := []js.Value{js.ValueOf(e.handle)}
+	for _, a := range args {
+		vals = append(vals, js.ValueOf(a))
+	}
+	return fn(js.Undefined(), vals)
+}
+
+// useMachine makes runs boot the machine build returns until the test
+// ends.
+func useMachine(t *testing.T, build func(config machineConfig) machine) {
+	t.Helper()
+	prev := newMachine
+	newMachine = build
+	t.Cleanup(func() { newMachine = prev })
+}
+
+// testMachine boots after bootSteps steps and calls step, if set, with
+// the step count on every one.
+type testMachine struct {
+	bootSteps int
+	steps     int
+	step      func(steps int)
+}
+
+func (m *testMachine) Step(n int) int {
+	m.steps++
+	if m.step != nil {
+		m.step(m.steps)
+	}
+	return n
+}
+
+func (m *testMachine) Booted() bool {
+	return m.steps >= m.bootSteps
+}
+
+// waitState waits up to a second for e to reach state.
+func waitState(t *testing.T, e *Emulator, state string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for e.getState() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("state is %s, want %s", e.getState(), state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// statusOf returns a result's data.status, or its error code if it
+// failed.
+func statusOf(result interface{}) string {
+	r := result.(map[string]interface{})
+	if failed(r) {
+		return r["error"].(map[string]interface{})["code"].(string)
+	}
+	status, _ := r["data"].(map[string]interface{})["status"].(string)
+	return status
+}
+
+func TestInstancesHaveIndependentConsoles(t *testing.T) {
+	// Each machine prints the RAM size its instance was created with
+	useMachine(t, func(config machineConfig) machine {
+		return &testMachine{step: func(steps int) {
+			fmt.Fprintf(config.console, "[%dMB]", config.ramSizeMB)
+		}}
+	})
+	a, recA := newTestEmulator(t, map[string]interface{}{"ramSizeMB": 1})
+	b, recB := newTestEmulator(t, map[string]interface{}{"ramSizeMB": 2})
+	if a.handle == b.handle {
+		t.Fatalf("both instances got handle %d", a.handle)
+	}
+	a.call(startEmulator)
+	b.call(startEmulator)
+	outA, outB := waitOutput(t, recA, 10), waitOutput(t, recB, 10)
+	if strings.Contains(outA, "[2MB]") || !strings.Contains(outA, "[1MB]") {
+		t.Errorf("first instance's callback got %q", outA)
+	}
+	if strings.Contains(outB, "[1MB]") || !strings.Contains(outB, "[2MB]") {
+		t.Errorf("second instance's callback got %q", outB)
+	}
+
+	a.call(sendInput, "to a")
+	b.call(sendInput, "to b")
+	if got := string(a.reader.Pending()); got != "to a" {
+		t.Errorf("first instance's input queue holds %q", got)
+	}
+	if got := string(b.reader.Pending()); got != "to b" {
+		t.Errorf("second instance's input queue holds %q", got)
+	}
+
+	// Stopping one leaves the other running
+	a.call(stopEmulator)
+	waitState(t, a, stateStopped)
+	if got := b.getState(); got != stateRunning {
+		t.Errorf("second instance is %s after the first stopped", got)
+	}
+}
+
+func TestCallsWithoutHandleUseLatestInstance(t *testing.T) {
+	a, _ := newTestEmulator(t, nil)
+	b, _ := newTestEmulator(t, nil)
+	sendInput(js.Undefined(), []js.Value{js.ValueOf("default")})
+	if a.reader.Buffered() != 0 || string(b.reader.Pending()) != "default" {
+		t.Error("a call without a handle didn't go to the newest instance")
+	}
+
+	b.dispose()
+	sendInput(js.Undefined(), []js.Value{js.ValueOf("fallback")})
+	if got := string(a.reader.Pending()); got != "fallback" {
+		t.Errorf("after disposing the default, the remaining instance got %q", got)
+	}
+
+	if got := statusOf(sendInput(js.Undefined(), []js.Value{js.ValueOf(b.handle), js.ValueOf("x")})); got != string(codeUnknownHandle) {
+		t.Errorf("call on a disposed handle = %s, want unknown_handle", got)
+	}
+}
+
+func TestRacingStartsLaunchOneRunLoop(t *testing.T) {
+	var builds atomic.Int32
+	useMachine(t, func(machineConfig) machine {
+		builds.Add(1)
+		return &testMachine{}
+	})
+	e, _ := newTestEmulator(t, nil)
+
+	const starts = 8
+	results := make(chan string, starts)
+	var ready sync.WaitGroup
+	ready.Add(starts)
+	for i := 0; i < starts; i++ {
+		go func() {
+			ready.Done()
+			ready.Wait()
+			results <- statusOf(e.call(startEmulator))
+		}()
+	}
+	counts := map[string]int{}
+	for i := 0; i < starts; i++ {
+		counts[<-results]++
+	}
+	if counts[string(statusStarting)] != 1 || counts[string(codeAlreadyRunning)] != starts-1 {
+		t.Errorf("racing starts returned %v, want one starting and the rest already_running", counts)
+	}
+	if n := builds.Load(); n != 1 {
+		t.Errorf("%d run loops were launched, want 1", n)
+	}
+
+	// Once stopped it can be started again, still one loop at a time
+	e.call(stopEmulator)
+	e.call(startEmulator)
+	if got := statusOf(e.call(startEmulator)); got != string(codeAlreadyRunning) {
+		t.Errorf("start after restart = %s, want already_running", got)
+	}
+	if n := builds.Load(); n != 2 {
+		t.Errorf("%d run loops after a stop and restart, want 2", n)
+	}
+	e.call(pauseEmulator)
+	r := e.call(startEmulator).(map[string]interface{})
+	if msg := r["error"].(map[string]interface{})["message"].(string); !strings.Contains(msg, "tinyemuResume") {
+		t.Errorf("start while paused failed with %q, want a hint to resume", msg)
+	}
+}
+
+// reinit calls tinyemuInit with {reinit} and a callback, disposing any
+// instance it creates when the test ends.
+func reinit(t *testing.T, mode interface{}) map[string]interface{} {
+	t.Helper()
+	rec := newOutputRecorder(t)
+	result := initEmulator(js.Undefined(), []js.Value{rec.fn.Value, js.ValueOf(map[string]interface{}{"reinit": mode})}).(map[string]interface{})
+	if !failed(result) {
+		e := instances[result["data"].(map[string]interface{})["handle"].(int)]
+		t.Cleanup(func() { e.dispose() })
+	}
+	return result
+}
+
+func TestReinitFalseRefusesASecondInstance(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+
+	result := reinit(t, false)
+	if got := statusOf(result); got != string(codeAlreadyInit) {
+		t.Fatalf("tinyemuInit({reinit: false}) = %s, want already_initialized", got)
+	}
+	if h := result["data"].(map[string]interface{})["handle"]; h != e.handle {
+		t.Errorf("refusal names handle %v, want the existing %d", h, e.handle)
+	}
+
+	// The existing instance carries on as the default
+	if e.getState() != stateRunning || instanceByHandle(e.handle) != e {
+		t.Errorf("existing instance is %s, registered %v", e.getState(), instanceByHandle(e.handle) == e)
+	}
+	if current, _, _ := lookup(nil, 0); current != e {
+		t.Error("the refused init changed the default instance")
+	}
+}
+
+func TestReinitTrueTearsDownTheOldInstance(t *testing.T) {
+	m := &testMachine{}
+	useMachine(t, func(machineConfig) machine { return m })
+	old, _ := newTestEmulator(t, nil)
+	old.call(startEmulator)
+	waitState(t, old, stateRunning)
+	old.call(getOutputStream) // holds funcs until it is disposed
+	if old.funcs.count() == 0 {
+		t.Fatal("the old instance holds no funcs to release")
+	}
+
+	result := reinit(t, true)
+	if failed(result) {
+		t.Fatal(result["error"])
+	}
+	data := result["data"].(map[string]interface{})
+	if data["replaced"] != old.handle || data["handle"] == old.handle {
+		t.Errorf("tinyemuInit({reinit: true}) = %v, want a new handle replacing %d", data, old.handle)
+	}
+
+	if old.getState() != stateDisposed || instanceByHandle(old.handle) != nil {
+		t.Errorf("old instance is %s, still registered %v", old.getState(), instanceByHandle(old.handle) != nil)
+	}
+	if n := old.funcs.count(); n != 0 {
+		t.Errorf("old instance still holds %d funcs", n)
+	}
+	if n, err := old.reader.Read(make([]byte, 4)); n != 0 || err != io.EOF {
+		t.Errorf("old reader Read = %d, %v; want 0, io.EOF", n, err)
+	}
+	steps := m.steps
+	time.Sleep(3 * stepInterval)
+	if m.steps != steps {
+		t.Errorf("old run loop stepped %d more times after the reinit", m.steps-steps)
+	}
+	if current, _, _ := lookup(nil, 0); current == nil || current.handle != data["handle"] {
+		t.Error("the new instance isn't the default")
+	}
+}
+
+func TestReinitUnsetAddsAnInstance(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	result := reinit(t, js.Undefined())
+	if failed(result) {
+		t.Fatal(result["error"])
+	}
+	if _, ok := result["data"].(map[string]interface{})["replaced"]; ok || instanceByHandle(e.handle) != e {
+		t.Errorf("tinyemuInit without reinit = %v, want the existing instance kept", result["data"])
+	}
+	if got := statusOf(reinit(t, "yes")); got != string(codeInvalidArgument) {
+		t.Errorf("reinit of a string = %s, want invalid_argument", got)
+	}
+}
+
+func TestOutOfOrderCallsReturnTheirCodes(t *testing.T) {
+	lifecycle := []struct {
+		name string
+		fn   func(js.Value, []js.Value) interface{}
+	}{
+		{"tinyemuSendInput", sendInput},
+		{"tinyemuStart", startEmulator},
+		{"tinyemuStop", stopEmulator},
+		{"tinyemuPause", pauseEmulator},
+		{"tinyemuResume", resumeEmulator},
+	}
+	t.Run("before init", func(t *testing.T) {
+		withoutInstances(t)
+		for _, f := range lifecycle {
+			result := f.fn(js.Undefined(), []js.Value{js.ValueOf("ls\n")})
+			if got := statusOf(result); got != string(codeNotInitialized) {
+				t.Errorf("%s before tinyemuInit = %v, want not_initialized", f.name, result)
+			}
+		}
+	})
+
+	useMachine(t, func(config machineConfig) machine { return &testMachine{} })
+	e, _ := newTestEmulator(t, nil)
+	check := func(when string, fn func(js.Value, []js.Value) interface{}, want string) map[string]interface{} {
+		t.Helper()
+		result := e.call(fn).(map[string]interface{})
+		if got := statusOf(result); got != want {
+			t.Errorf("%s: got %s, want %s", when, got, want)
+		}
+		return result
+	}
+	check("stop before start", stopEmulator, string(codeNotRunning))
+	check("pause before start", pauseEmulator, string(codeNotRunning))
+	check("resume before start", resumeEmulator, string(codeNotRunning))
+
+	check("start", startEmulator, string(statusStarting))
+	waitState(t, e, stateRunning)
+	if r := check("start while running", startEmulator, string(codeAlreadyRunning)); !failed(r) {
+		t.Errorf("a second start succeeded: %v", r)
+	}
+	check("resume while running", resumeEmulator, string(statusAlreadyRunning))
+
+	check("pause", pauseEmulator, string(statusPaused))
+	check("pause while paused", pauseEmulator, string(statusAlreadyPaused))
+	r := check("start while paused", startEmulator, string(codeAlreadyRunning))
+	if msg := r["error"].(map[string]interface{})["message"].(string); !strings.Contains(msg, "tinyemuResume") {
+		t.Errorf("start while paused says %q, want it to point at tinyemuResume", msg)
+	}
+
+	check("stop", stopEmulator, string(statusStopped))
+	check("stop after stop", stopEmulator, string(codeNotRunning))
+	check("pause after stop", pauseEmulator, string(codeNotRunning))
+	check("resume after stop", resumeEmulator, string(codeNotRunning))
+}
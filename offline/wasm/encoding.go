@@ -0,0 +1,74 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+)
+
+// consoleEncoding is how console bytes map to the strings JavaScript
+// sends and receives.
+type consoleEncoding int
+
+const (
+	// encodingUTF8 treats console bytes as UTF-8 text.
+	encodingUTF8 consoleEncoding = iota
+	// encodingLatin1 maps each byte to the code point of the same value,
+	// for guests that emit Latin-1 or arbitrary high-bit bytes.
+	encodingLatin1
+	// encodingRaw delivers output as Uint8Array; strings sent as input
+	// are taken byte per character as with latin1.
+	encodingRaw
+)
+
+var encodingNames = map[string]consoleEncoding{
+	"utf8":   encodingUTF8,
+	"latin1": encodingLatin1,
+	"raw":    encodingRaw,
+}
+
+func parseEncoding(name string) (consoleEncoding, error) {
+	enc, ok := encodingNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown console encoding %q, want utf8, latin1 or raw", name)
+	}
+	return enc, nil
+}
+
+// decode converts console output for the output callbacks: a string, or
+// a Uint8Array in raw mode.
+func (enc consoleEncoding) decode(p []byte) interface{} {
+	switch enc {
+	case encodingLatin1:
+		return latin1String(p)
+	case encodingRaw:
+		return bytesToJS(p)
+	default:
+		return string(p)
+	}
+}
+
+// latin1String decodes p as Latin-1, one character per byte.
+func latin1String(p []byte) string {
+	runes := make([]rune, len(p))
+	for i, b := range p {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// encode converts a string from JavaScript to console bytes. Outside
+// utf8 mode a character above U+00FF has no byte and is refused.
+func (enc consoleEncoding) encode(s string) ([]byte, error) {
+	if enc == encodingUTF8 {
+		return []byte(s), nil
+	}
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, newError(codeInvalidArgument, fmt.Sprintf("character %U can't be sent as a single byte", r))
+		}
+		out = append(out, byte(r))
+	}
+	return out, nil
+}
@@ -0,0 +1,92 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// highBits is guest output that isn't valid UTF-8: ASCII, then bytes
+// that are é and ÿ in Latin-1.
+var highBits = []byte{'A', 0xe9, 0xff}
+
+// encodingEmulator returns an instance created with opts that has written
+// highBits, and what its callback got.
+func encodingEmulator(t *testing.T, opts map[string]interface{}) (*Emulator, *outputRecorder) {
+	t.Helper()
+	e, rec := newTestEmulator(t, opts)
+	e.writer.Write(highBits)
+	e.writer.Flush()
+	return e, rec
+}
+
+// sent returns what sendInput(input) queued for the guest.
+func sent(t *testing.T, e *Emulator, input interface{}) []byte {
+	t.Helper()
+	e.reader.Clear()
+	if result := e.call(sendInput, input).(map[string]interface{}); failed(result) {
+		t.Fatalf("sendInput(%v): %v", input, result["error"])
+	}
+	return e.reader.Pending()
+}
+
+func TestLatin1RoundTripsHighBitBytes(t *testing.T) {
+	e, rec := encodingEmulator(t, map[string]interface{}{"consoleEncoding": "latin1"})
+	out := rec.text()
+	if out != "Aéÿ" {
+		t.Fatalf("callback got %q, want %q", out, "Aéÿ")
+	}
+	if got := sent(t, e, out); !bytes.Equal(got, highBits) {
+		t.Errorf("sending the output back queued % x, want % x", got, highBits)
+	}
+	if got := statusOf(e.call(sendInput, "€")); got != string(codeInvalidArgument) {
+		t.Errorf("sendInput of a character above U+00FF = %s, want invalid_argument", got)
+	}
+}
+
+func TestRawRoundTripsHighBitBytes(t *testing.T) {
+	e, rec := encodingEmulator(t, map[string]interface{}{"consoleEncoding": "raw"})
+	out := rec.bytes(t)
+	if !bytes.Equal(out, highBits) {
+		t.Fatalf("callback got % x, want % x", out, highBits)
+	}
+	if got := sent(t, e, bytesToJS(out)); !bytes.Equal(got, highBits) {
+		t.Errorf("sending the output back as bytes queued % x, want % x", got, highBits)
+	}
+
+	// Strings are taken a byte per character, as with latin1
+	if got := sent(t, e, "Aéÿ"); !bytes.Equal(got, highBits) {
+		t.Errorf("sendInput(%q) queued % x, want % x", "Aéÿ", got, highBits)
+	}
+}
+
+func TestUTF8IsTheDefault(t *testing.T) {
+	for _, opts := range []map[string]interface{}{nil, {"consoleEncoding": "utf8"}} {
+		e, rec := encodingEmulator(t, opts)
+
+		// Invalid UTF-8 becomes replacement characters, as it always has
+		if out := rec.text(); out != "A��" {
+			t.Errorf("options %v: callback got %q, want %q", opts, out, "A��")
+		}
+		if got := sent(t, e, "Aéÿ"); string(got) != "Aéÿ" {
+			t.Errorf("options %v: sendInput(%q) queued % x, want its UTF-8", opts, "Aéÿ", got)
+		}
+		if got := sent(t, e, bytesToJS(highBits)); !bytes.Equal(got, highBits) {
+			t.Errorf("options %v: bytes queued as % x, want % x", opts, got, highBits)
+		}
+	}
+}
+
+func TestUnknownConsoleEncodingIsRefused(t *testing.T) {
+	for _, opts := range []map[string]interface{}{
+		{"consoleEncoding": "ebcdic"},
+		{"consoleEncoding": 8},
+		{"consoleEncoding": "utf8", "binaryOutput": true},
+	} {
+		if msg := initError(t, opts); !strings.Contains(strings.ToLower(msg), "encoding") {
+			t.Errorf("tinyemuInit(%v) error %q isn't about the encoding", opts, msg)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"sync"
+	"syscall/js"
+)
+
+// exitPort is an MMIO register a guest test suite writes its exit code to,
+// enabled by the exitPort init option. The machine's bus hands it every
+// write; the first one to the port ends the run.
+type exitPort struct {
+	addr uint64
+
+	mu      sync.Mutex
+	value   uint32
+	written bool
+}
+
+// Write records value if addr is the port's, reporting whether it was.
+// The bus calls it for each MMIO write; a nil port claims nothing.
+func (p *exitPort) Write(addr uint64, value uint32) bool {
+	if p == nil || addr != p.addr {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.written {
+		p.value, p.written = value, true
+	}
+	return true
+}
+
+// take returns the value written, if any.
+func (p *exitPort) take() (uint32, bool) {
+	if p == nil {
+		return 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.value, p.written
+}
+
+// reset forgets a write from an earlier run.
+func (p *exitPort) reset() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.written = false
+	p.mu.Unlock()
+}
+
+// exitOption reads the exitPort option, the address of the exit port, as
+// a number or a string such as "0x100000".
+func exitOption(v js.Value) (*exitPort, error) {
+	a := v.Get("exitPort")
+	if a.IsUndefined() || a.IsNull() {
+		return nil, nil
+	}
+	addr, err := addressArg([]js.Value{a}, 0, "exitPort")
+	if err != nil {
+		return nil, err
+	}
+	return &exitPort{addr: addr}, nil
+}
+
+// exitRun ends a run whose guest wrote code to the exit port: like a power
+// off, the instance moves to halted, and onExit gets the value written,
+// exactly as written, so a harness can tell 0 from failure. Output has
+// been drained by then.
+func (e *Emulator) exitRun(stop context.CancelFunc, code uint32) {
+	if !e.transitionFrom(stateHalted, stateStarting, stateRunning, statePaused) {
+		return
+	}
+	stop()
+
+	e.log.Infof("guest wrote %d to the exit port", code)
+	if e.options.onExit.Type() == js.TypeFunction {
+		e.options.onExit.Invoke(code)
+	}
+}
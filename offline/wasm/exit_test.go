@@ -0,0 +1,127 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// testExitPort is where the tests put the exit port.
+const testExitPort = 0x100000
+
+// exitingMachine writes to a register beside the exit port on its first
+// step, then writes code to the port on its third.
+type exitingMachine struct {
+	testMachine
+	port *exitPort
+	code uint32
+}
+
+func (m *exitingMachine) Step(n int) int {
+	m.testMachine.Step(n)
+	switch m.steps {
+	case 1:
+		if m.port.Write(testExitPort+4, 99) {
+			panic("the exit port claimed a write to another address")
+		}
+	case 3:
+		m.port.Write(testExitPort, m.code)
+	}
+	return n
+}
+
+// exitRecorder is an onExit callback that sends on what it is passed.
+func exitRecorder(t *testing.T) (js.Func, chan js.Value) {
+	codes := make(chan js.Value, 4)
+	fn := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		codes <- args[0]
+		return nil
+	})
+	t.Cleanup(fn.Release)
+	return fn, codes
+}
+
+func TestExitPortWriteEndsTheRun(t *testing.T) {
+	for _, code := range []uint32{0, 1, 0xffffffff} {
+		m := &exitingMachine{code: code}
+		useMachine(t, func(config machineConfig) machine {
+			m.port = config.exitPort
+			return m
+		})
+		onExit, codes := exitRecorder(t)
+		e, _ := newTestEmulator(t, map[string]interface{}{"exitPort": "0x100000", "onExit": onExit})
+		e.call(startEmulator)
+
+		select {
+		case got := <-codes:
+			if got.Type() != js.TypeNumber || uint32(got.Float()) != code || got.Float() != float64(code) {
+				t.Errorf("onExit got %v, want exactly %d", got, code)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("code %d: onExit didn't fire", code)
+		}
+		waitState(t, e, stateHalted)
+		if m.steps != 3 {
+			t.Errorf("code %d: machine ran %d steps, want none past the exit at 3", code, m.steps)
+		}
+	}
+}
+
+func TestExitPortIsReadyAgainAfterRestart(t *testing.T) {
+	m := &exitingMachine{code: 7}
+	useMachine(t, func(config machineConfig) machine {
+		m.testMachine, m.port = testMachine{}, config.exitPort
+		return m
+	})
+	onExit, codes := exitRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"exitPort": testExitPort, "onExit": onExit})
+	for run := 1; run <= 2; run++ {
+		if got := statusOf(e.call(startEmulator)); got != string(statusStarting) {
+			t.Fatalf("run %d: tinyemuStart = %s", run, got)
+		}
+		select {
+		case got := <-codes:
+			if got.Int() != 7 {
+				t.Errorf("run %d: onExit got %v, want 7", run, got)
+			}
+		case <-time.After(time.Second):
+			// A write left over from the first run would end the second
+			// before the guest wrote anything
+			t.Fatalf("run %d: onExit didn't fire", run)
+		}
+		waitState(t, e, stateHalted)
+		// The loop exits just after the state changes
+		select {
+		case <-e.done:
+		case <-time.After(time.Second):
+			t.Fatalf("run %d: the run loop didn't exit after halting", run)
+		}
+	}
+	if len(codes) != 0 {
+		t.Errorf("onExit fired %d more times", len(codes))
+	}
+}
+
+func TestWithoutAnExitPortWritesAreIgnored(t *testing.T) {
+	m := &exitingMachine{}
+	useMachine(t, func(config machineConfig) machine {
+		m.port = config.exitPort
+		return m
+	})
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	time.Sleep(5 * stepInterval)
+	if m.port != nil || e.getState() != stateRunning || m.steps <= 3 {
+		t.Errorf("without the option: port %v, state %s after %d steps; want none, running past 3", m.port, e.getState(), m.steps)
+	}
+
+	for _, bad := range []interface{}{"not an address", -1, true} {
+		if msg := initError(t, map[string]interface{}{"exitPort": bad}); !strings.Contains(msg, "exitPort") {
+			t.Errorf("exitPort %v: error %q doesn't name the option", bad, msg)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// waitWindow bounds how much output each waiter keeps to match against.
+// Output older than that can no longer be part of a match.
+const waitWindow = 4096
+
+// errDisposed fails waits still pending when their instance goes away.
+var errDisposed = newError(codeInvalidState, "instance was disposed")
+
+// outputWaiter is one pending tinyemuWaitFor. It only sees output that
+// arrives after it was added.
+type outputWaiter struct {
+	pattern *regexp.Regexp
+	window  []byte
+	done    chan []string // receives the match and its groups, or nil if canceled
+
+	// onMatch, if set, runs on the writing goroutine as soon as the
+	// pattern matches, before the machine writes anything more.
+	onMatch func()
+}
+
+// outputWaiters matches console output for every pending waiter
+// independently, so waiters on different patterns don't steal each
+// other's matches.
+type outputWaiters struct {
+	mu      sync.Mutex
+	waiters map[int]*outputWaiter
+	next    int
+}
+
+// add registers a waiter for re and returns its id. onMatch may be nil.
+func (ws *outputWaiters) add(re *regexp.Regexp, onMatch func()) (int, *outputWaiter) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.waiters == nil {
+		ws.waiters = make(map[int]*outputWaiter)
+	}
+	ws.next++
+	w := &outputWaiter{pattern: re, done: make(chan []string, 1), onMatch: onMatch}
+	ws.waiters[ws.next] = w
+	return ws.next, w
+}
+
+// remove drops a waiter that gave up, reporting whether it was still
+// pending. If it wasn't, a match is already waiting on its done channel.
+func (ws *outputWaiters) remove(id int) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, ok := ws.waiters[id]; !ok {
+		return false
+	}
+	delete(ws.waiters, id)
+	return true
+}
+
+// observe feeds console output to every waiter and completes the ones
+// whose pattern now matches.
+func (ws *outputWaiters) observe(p []byte) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for id, w := range ws.waiters {
+		w.window = append(w.window, p...)
+		if over := len(w.window) - waitWindow; over > 0 {
+			w.window = append(w.window[:0], w.window[over:]...)
+		}
+		m := w.pattern.FindSubmatch(w.window)
+		if m == nil {
+			continue
+		}
+		groups := make([]string, len(m))
+		for i, g := range m {
+			groups[i] = string(g)
+		}
+		if w.onMatch != nil {
+			w.onMatch()
+		}
+		w.done <- groups
+		delete(ws.waiters, id)
+	}
+}
+
+// cancelAll completes every pending waiter without a match.
+func (ws *outputWaiters) cancelAll() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for id, w := range ws.waiters {
+		w.done <- nil
+		delete(ws.waiters, id)
+	}
+}
+
+// timeoutArg reads an optional timeoutMs argument, zero if absent.
+func timeoutArg(args []js.Value, i int) (time.Duration, error) {
+	if !present(args, i) {
+		return 0, nil
+	}
+	ms, err := numberArg(args, i, "timeoutMs")
+	if err != nil {
+		return 0, err
+	}
+	if ms < 0 {
+		return 0, fmt.Errorf("timeoutMs must be >= 0, got %v", ms)
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// waitForOutput returns a Promise that resolves with {match, groups} once
+// console output matches pattern (Go RE2 syntax), or rejects with code
+// "timeout" after timeoutMs on the instance's clock, which in a
+// deterministic run only moves while the guest runs. Without a timeout it
+// waits indefinitely.
+func waitForOutput(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	pattern, err := stringArg(args, 0, "pattern")
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	timeout, err := timeoutArg(args, 1)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+
+	// Registered before returning, so output written right after the call
+	// still counts
+	id, w := e.waiters.add(re, nil)
+	return newPromise(func(resolve, reject js.Value) {
+		// Waiting needs the event loop, so it can't block this callback
+		go func() {
+			groups, timedOut := e.awaitMatch(id, w, timeout)
+			if timedOut {
+				settle(errResult(codeTimeout, fmt.Sprintf("no output matched %q within %v", pattern, timeout)), resolve, reject)
+				return
+			}
+			if groups == nil {
+				settle(errorResult(errDisposed), resolve, reject)
+				return
+			}
+			list := make([]interface{}, len(groups)-1)
+			for i, g := range groups[1:] {
+				list[i] = g
+			}
+			settle(okResult(map[string]interface{}{"match": groups[0], "groups": list}), resolve, reject)
+		}()
+	})
+}
+
+// awaitMatch waits for waiter id to match, for at most timeout on the
+// instance clock unless that is zero. It returns the match and its
+// groups, nil if the waiter was canceled, or timedOut once the waiter has
+// been removed because time ran out.
+func (e *Emulator) awaitMatch(id int, w *outputWaiter, timeout time.Duration) (groups []string, timedOut bool) {
+	expired := make(chan struct{})
+	finished := make(chan struct{})
+	defer close(finished)
+	if timeout > 0 {
+		deadline := e.clock.Now().Add(timeout)
+		go func() {
+			if waitUntil(e.clock, deadline, finished) {
+				close(expired)
+			}
+		}()
+	}
+
+	select {
+	case groups = <-w.done:
+		return groups, false
+	case <-expired:
+		if e.waiters.remove(id) {
+			return nil, true
+		}
+		// Matched just as the timeout fired
+		return <-w.done, false
+	}
+}
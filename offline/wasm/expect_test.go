@@ -0,0 +1,98 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// machineWrites writes s as the machine would, through the console the
+// run loop hands it, and flushes it out.
+func machineWrites(e *Emulator, s string) {
+	watchedConsole{e}.Write([]byte(s))
+	e.writer.Flush()
+}
+
+// wantMatch waits for promise to resolve with match and groups.
+func wantMatch(t *testing.T, promise js.Value, match string, groups ...string) {
+	t.Helper()
+	v, fulfilled := awaitSettled(t, promise)
+	if !fulfilled {
+		t.Fatalf("rejected with %v (%v), want a match of %q", v.Get("code"), v.Get("message"), match)
+	}
+	if got := v.Get("match").String(); got != match {
+		t.Errorf("match = %q, want %q", got, match)
+	}
+	var got []string
+	for i := 0; i < v.Get("groups").Length(); i++ {
+		got = append(got, v.Get("groups").Index(i).String())
+	}
+	if strings.Join(got, "|") != strings.Join(groups, "|") {
+		t.Errorf("groups = %q, want %q", got, groups)
+	}
+}
+
+func TestWaitForMatchesAcrossWrites(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	promise := e.call(waitForOutput, `(\w+)@(\w+):~\$ $`).(js.Value)
+	machineWrites(e, "Welcome\nroot@")
+	machineWrites(e, "tiny:~$ ")
+	wantMatch(t, promise, "root@tiny:~$ ", "root", "tiny")
+}
+
+func TestWaitForTimesOut(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	// Output from before the call doesn't count
+	machineWrites(e, "login: ")
+	start := time.Now()
+	wantRejected(t, e.call(waitForOutput, "login: ", 50).(js.Value), codeTimeout)
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("timed out after %v, before timeoutMs", waited)
+	}
+	if n := len(e.waiters.waiters); n != 0 {
+		t.Errorf("%d waiters left registered after the timeout", n)
+	}
+
+	wantRejected(t, e.call(waitForOutput, "login(").(js.Value), codeInvalidArgument)
+	wantRejected(t, e.call(waitForOutput, "login", -1).(js.Value), codeInvalidArgument)
+}
+
+func TestSimultaneousWaitersEachGetTheirMatch(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	password := e.call(waitForOutput, "Password: ").(js.Value)
+	login := e.call(waitForOutput, `login: `).(js.Value)
+	alsoLogin := e.call(waitForOutput, `(\w+) login: `).(js.Value)
+
+	machineWrites(e, "buildroot login: ")
+	wantMatch(t, login, "login: ")
+	wantMatch(t, alsoLogin, "buildroot login: ", "buildroot")
+	if n := len(e.waiters.waiters); n != 1 {
+		t.Fatalf("%d waiters pending, want only the password one", n)
+	}
+	machineWrites(e, "root\nPassword: ")
+	wantMatch(t, password, "Password: ")
+}
+
+func TestWaitWindowIsBounded(t *testing.T) {
+	var ws outputWaiters
+	ws.add(regexp.MustCompile("never"), nil)
+	for i := 0; i < 10; i++ {
+		ws.observe([]byte(strings.Repeat("x", 1000)))
+	}
+	for _, w := range ws.waiters {
+		if len(w.window) != waitWindow {
+			t.Errorf("waiter keeps %d bytes, want the last %d", len(w.window), waitWindow)
+		}
+	}
+}
+
+func TestDisposeRejectsPendingWaits(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	promise := e.call(waitForOutput, "never").(js.Value)
+	e.dispose()
+	wantRejected(t, promise, codeInvalidState)
+}
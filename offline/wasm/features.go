@@ -0,0 +1,136 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"syscall/js"
+)
+
+// feature is a behavior tinyemuGetFeatures reports. Those with set can be
+// toggled by tinyemuSetFeature; the rest are fixed at init or changed
+// through the call named in how.
+type feature struct {
+	get func(e *Emulator) bool
+	set func(e *Emulator, on bool)
+	how string
+}
+
+// features lists every feature by name.
+var features = map[string]feature{
+	"batchedOutput": {
+		get: func(e *Emulator) bool { return e.writer.interval > 0 },
+		how: "fixed at init",
+	},
+	"bracketedPaste": {
+		get: func(e *Emulator) bool { return e.writer.BracketedPaste() },
+		how: "set by the guest",
+	},
+	"cookedInput": {
+		get: func(e *Emulator) bool { return e.line.isCooked() },
+		set: func(e *Emulator, on bool) { e.setCooked(on) },
+	},
+	"deterministic": {
+		get: func(e *Emulator) bool { return e.options.deterministic },
+		how: "fixed at init",
+	},
+	"flushOnNewline": {
+		get: func(e *Emulator) bool { return e.writer.FlushOnNewline },
+		how: "fixed at init",
+	},
+	"lazyDisk": {
+		get: func(e *Emulator) bool {
+			for _, d := range e.disks {
+				if pd, ok := d.(*persistentDisk); ok {
+					d = pd.blockBackend
+				}
+				if _, ok := d.(*lazyDisk); ok {
+					return true
+				}
+			}
+			return false
+		},
+		how: "set with tinyemuAttachLazyDisk",
+	},
+	"persistence": {
+		get: func(e *Emulator) bool {
+			_, ok := e.disks[0].(*persistentDisk)
+			return ok
+		},
+		how: "set with tinyemuEnablePersistence",
+	},
+	"sharedInput": {
+		get: func(e *Emulator) bool {
+			e.ringMu.Lock()
+			defer e.ringMu.Unlock()
+			return e.ring != nil
+		},
+		how: "set with tinyemuBindInputSAB",
+	},
+	"speedLimit": {
+		get: func(e *Emulator) bool { return e.limiter.active() },
+		how: "set with tinyemuSetSpeed",
+	},
+	"stripAnsi": {
+		get: func(e *Emulator) bool { return e.writer.StripANSI() },
+		set: func(e *Emulator, on bool) {
+			e.writer.SetStripANSI(on)
+			for _, sc := range e.consoles {
+				sc.writer.SetStripANSI(on)
+			}
+		},
+	},
+	"yieldBudget": {
+		get: func(e *Emulator) bool { return e.yielder.budget.enabled() },
+		how: "fixed at init",
+	},
+}
+
+// getFeatures returns a map of every feature name to whether it is on.
+// cookedInput and stripAnsi can be changed with tinyemuSetFeature.
+func getFeatures(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	data := make(map[string]interface{}, len(features))
+	for name, f := range features {
+		data[name] = f.get(e)
+	}
+	return okResult(data)
+}
+
+// setFeature accepts (name, enabled) and turns a feature that can change
+// at runtime on or off. Unknown names fail with invalid_argument, and
+// features that can't be toggled with invalid_state.
+func setFeature(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	name, err := stringArg(args, 0, "feature name")
+	if err != nil {
+		return errorResult(err)
+	}
+	on, err := boolArg(args, 1, "enabled")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	f, ok := features[name]
+	if !ok {
+		names := make([]string, 0, len(features))
+		for n := range features {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return errResult(codeInvalidArgument, fmt.Sprintf("unknown feature %q, want one of %s", name, strings.Join(names, ", ")))
+	}
+	if f.set == nil {
+		return errResult(codeInvalidState, fmt.Sprintf("feature %s can't be changed with tinyemuSetFeature, it is %s", name, f.how))
+	}
+	f.set(e, on)
+	return statusResult(statusFeatureSet, map[string]interface{}{"name": name, "enabled": on})
+}
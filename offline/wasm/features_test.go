@@ -0,0 +1,125 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// featuresOf returns what tinyemuGetFeatures reports for e.
+func featuresOf(t *testing.T, e *Emulator) map[string]interface{} {
+	t.Helper()
+	r := e.call(getFeatures).(map[string]interface{})
+	if failed(r) {
+		t.Fatalf("tinyemuGetFeatures: %v", r["error"])
+	}
+	return r["data"].(map[string]interface{})
+}
+
+func TestGetFeaturesReportsWhatIsOn(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	got := featuresOf(t, e)
+	if len(got) != len(features) {
+		t.Errorf("reported %d features, want all %d", len(got), len(features))
+	}
+	// Output is batched unless DefaultFlushInterval turns it off
+	for name, on := range got {
+		if want := name == "batchedOutput" && DefaultFlushInterval > 0; on != want {
+			t.Errorf("%s is %v by default, want %v", name, on, want)
+		}
+	}
+
+	e, _ = newTestEmulator(t, map[string]interface{}{"stripAnsi": true, "flushOnNewline": true})
+	p := newRingProducer(64)
+	e.call(bindInputSAB, p.sab)
+	e.call(setLineMode, "cooked")
+	got = featuresOf(t, e)
+	for _, name := range []string{"stripAnsi", "flushOnNewline", "sharedInput", "cookedInput"} {
+		if got[name] != true {
+			t.Errorf("%s is %v, want true", name, got[name])
+		}
+	}
+	e.call(bindInputSAB, nil)
+	if got := featuresOf(t, e)["sharedInput"]; got != false {
+		t.Errorf("sharedInput is %v once unbound", got)
+	}
+}
+
+func TestSetFeatureStripAnsi(t *testing.T) {
+	debug := newOutputRecorder(t)
+	e, rec := newTestEmulator(t, map[string]interface{}{"consoles": map[string]interface{}{"debug": debug.fn}})
+	write := func() {
+		e.writer.Write([]byte("\x1b[31mred\x1b[0m"))
+		e.writer.Flush()
+		e.consoles["debug"].writer.Write([]byte("\x1b[1mbold\x1b[0m"))
+		e.consoles["debug"].writer.Flush()
+	}
+
+	if r := e.call(setFeature, "stripAnsi", true).(map[string]interface{}); statusOf(r) != string(statusFeatureSet) {
+		t.Fatalf("tinyemuSetFeature(stripAnsi, true) = %s", statusOf(r))
+	}
+	write()
+	if rec.text() != "red" || debug.text() != "bold" {
+		t.Errorf("with stripAnsi set, console0 got %q and debug %q; want plain text", rec.text(), debug.text())
+	}
+	if got := featuresOf(t, e)["stripAnsi"]; got != true {
+		t.Errorf("stripAnsi reads %v after turning it on", got)
+	}
+
+	e.call(setFeature, "stripAnsi", false)
+	write()
+	if got := rec.text(); got != "red\x1b[31mred\x1b[0m" {
+		t.Errorf("with stripAnsi unset, console0 got %q; want the colors kept", got)
+	}
+}
+
+func TestSetFeatureCookedInput(t *testing.T) {
+	e, rec := newTestEmulator(t, nil)
+	e.call(setFeature, "cookedInput", true)
+	if echo, guest := typeKeys(t, e, rec, "l", "s"); echo != "ls" || guest != "" {
+		t.Errorf("cooked: typing echoed %q and the guest got %q; want the line held", echo, guest)
+	}
+	if _, guest := typeKeys(t, e, rec, "\r"); guest != "ls\n" {
+		t.Errorf("cooked: enter sent %q, want the line", guest)
+	}
+
+	e.call(setFeature, "cookedInput", false)
+	if echo, guest := typeKeys(t, e, rec, "l"); echo != "" || guest != "l" {
+		t.Errorf("raw: typing echoed %q and the guest got %q; want the key as it is", echo, guest)
+	}
+	if got := featuresOf(t, e)["cookedInput"]; got != false {
+		t.Errorf("cookedInput reads %v after turning it off", got)
+	}
+}
+
+func TestFixedFeaturesRefuseChanges(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	before := featuresOf(t, e)
+	for name, f := range features {
+		if f.set != nil {
+			continue
+		}
+		r := e.call(setFeature, name, true).(map[string]interface{})
+		if statusOf(r) != string(codeInvalidState) {
+			t.Errorf("tinyemuSetFeature(%s, true) = %s, want invalid_state", name, statusOf(r))
+			continue
+		}
+		if msg := r["error"].(map[string]interface{})["message"].(string); !strings.Contains(msg, f.how) {
+			t.Errorf("refusing %s: %q doesn't say it is %s", name, msg, f.how)
+		}
+	}
+	for name, on := range featuresOf(t, e) {
+		if on != before[name] {
+			t.Errorf("%s went from %v to %v", name, before[name], on)
+		}
+	}
+
+	r := e.call(setFeature, "turbo", true).(map[string]interface{})
+	if statusOf(r) != string(codeInvalidArgument) || !strings.Contains(r["error"].(map[string]interface{})["message"].(string), "stripAnsi") {
+		t.Errorf("an unknown feature = %v, want invalid_argument listing the features", r)
+	}
+	if got := statusOf(e.call(setFeature, "stripAnsi", "yes")); got != string(codeInvalidArgument) {
+		t.Errorf("a string for enabled = %s, want invalid_argument", got)
+	}
+}
@@ -0,0 +1,83 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"syscall/js"
+)
+
+// liveFuncs counts js.Funcs created through a funcRegistry and not yet
+// released, across all instances, so leaks show up in tinyemuMemoryUsage.
+var liveFuncs atomic.Int64
+
+// funcRegistry owns the js.Funcs created on behalf of one instance, such
+// as WebSocket handlers, so disposing the instance can release them all.
+// The package-level functions registered in main live for the page and
+// are not tracked.
+type funcRegistry struct {
+	mu    sync.Mutex
+	funcs map[int]js.Func
+	next  int
+	alive bool
+}
+
+func newFuncRegistry() *funcRegistry {
+	return &funcRegistry{funcs: make(map[int]js.Func), alive: true}
+}
+
+// funcOf wraps fn like js.FuncOf and tracks the result. The returned id
+// releases it early with release. After releaseAll the func is released
+// straight away, since nothing would ever release it later.
+func (r *funcRegistry) funcOf(fn func(this js.Value, args []js.Value) interface{}) (js.Func, int) {
+	return r.track(js.FuncOf(fn))
+}
+
+// track takes ownership of an existing js.Func.
+func (r *funcRegistry) track(f js.Func) (js.Func, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.alive {
+		f.Release()
+		return f, 0
+	}
+	r.next++
+	r.funcs[r.next] = f
+	liveFuncs.Add(1)
+	return f, r.next
+}
+
+// release releases one func ahead of the rest.
+func (r *funcRegistry) release(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.funcs[id]; ok {
+		delete(r.funcs, id)
+		f.Release()
+		liveFuncs.Add(-1)
+	}
+}
+
+// releaseAll releases every tracked func. Anything tracked afterwards is
+// released on the spot.
+func (r *funcRegistry) releaseAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	liveFuncs.Add(-int64(len(r.funcs)))
+	for id, f := range r.funcs {
+		f.Release()
+		delete(r.funcs, id)
+	}
+	r.alive = false
+}
+
+// count returns how many funcs are currently tracked.
+func (r *funcRegistry) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.funcs)
+}
@@ -0,0 +1,57 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+	"testing"
+)
+
+func TestFuncRegistryCountsLiveFuncs(t *testing.T) {
+	base := liveFuncs.Load()
+	r := newFuncRegistry()
+	noop := func(js.Value, []js.Value) interface{} { return nil }
+
+	_, a := r.funcOf(noop)
+	r.funcOf(noop)
+	r.track(js.FuncOf(noop))
+	if r.count() != 3 || liveFuncs.Load() != base+3 {
+		t.Fatalf("after three funcs: registry holds %d, %d live", r.count(), liveFuncs.Load()-base)
+	}
+	r.release(a)
+	r.release(a)
+	if r.count() != 2 || liveFuncs.Load() != base+2 {
+		t.Errorf("after releasing one twice: registry holds %d, %d live", r.count(), liveFuncs.Load()-base)
+	}
+
+	r.releaseAll()
+	if r.count() != 0 || liveFuncs.Load() != base {
+		t.Errorf("after releaseAll: registry holds %d, %d live", r.count(), liveFuncs.Load()-base)
+	}
+	// A func made for a disposed instance is released on the spot
+	if _, id := r.funcOf(noop); id != 0 || r.count() != 0 || liveFuncs.Load() != base {
+		t.Errorf("funcOf after releaseAll returned id %d, %d live", id, liveFuncs.Load()-base)
+	}
+}
+
+func TestDisposeReleasesInstanceFuncs(t *testing.T) {
+	mockWebSocket(t)
+	base := liveFuncs.Load()
+	for i := 0; i < 3; i++ {
+		e, _ := newTestEmulator(t, nil)
+		e.call(attachNetwork, "ws://relay")
+		owned := e.funcs.count()
+		if owned == 0 || liveFuncs.Load() != base+int64(owned) {
+			t.Fatalf("instance %d owns %d funcs, %d live", i, owned, liveFuncs.Load()-base)
+		}
+
+		r := e.call(disposeEmulator).(map[string]interface{})
+		if statusOf(r) != string(statusDisposed) || r["data"].(map[string]interface{})["releasedFuncs"] != owned {
+			t.Errorf("tinyemuDispose = %v, want %d funcs released", r, owned)
+		}
+		// Creating and disposing instances over and over leaks nothing
+		if n := liveFuncs.Load() - base; n != 0 {
+			t.Errorf("instance %d: %d funcs still live after dispose", i, n)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// smpMachine has as many harts as it was configured with and counts the
+// instructions each is given. Every hart bumps the same shared word, as
+// harts sharing guest RAM would.
+type smpMachine struct {
+	testMachine
+	harts  int
+	counts []int
+	shared int
+}
+
+func (m *smpMachine) Harts() int { return m.harts }
+
+func (m *smpMachine) StepHart(hart, n int) int {
+	if hart == 0 {
+		m.testMachine.Step(n)
+	}
+	m.counts[hart] += n
+	m.shared++
+	return n
+}
+
+// smpMachines makes runs boot smpMachines and returns the latest one.
+func smpMachines(t *testing.T) func() *smpMachine {
+	var m *smpMachine
+	useMachine(t, func(config machineConfig) machine {
+		m = &smpMachine{harts: config.cores, counts: make([]int, config.cores)}
+		return m
+	})
+	return func() *smpMachine { return m }
+}
+
+func TestTwoCoresReachTheMachine(t *testing.T) {
+	latest := smpMachines(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"cores": 2})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	e.call(pauseEmulator)
+
+	e.machineMu.Lock()
+	m := latest()
+	harts, counts, shared, steps := m.harts, append([]int(nil), m.counts...), m.shared, m.steps
+	// Read under the lock too, so a slice finishing late can't come between
+	instructions := statsData(t, e)["instructions"]
+	e.machineMu.Unlock()
+	if harts != 2 {
+		t.Fatalf("machine built with %d harts, want 2", harts)
+	}
+	// Each slice splits stepInstructions between the harts in turn
+	quantum := stepInstructions / 2
+	if counts[0] != steps*quantum || counts[1] != counts[0] {
+		t.Errorf("over %d slices harts ran %v instructions, want %d each", steps, counts, steps*quantum)
+	}
+	if shared != 2*steps {
+		t.Errorf("shared word bumped %d times over %d slices of 2 harts", shared, steps)
+	}
+	if instructions != float64(counts[0]+counts[1]) {
+		t.Errorf("stats count %v instructions, want both harts' %d", instructions, counts[0]+counts[1])
+	}
+
+	info := e.call(getCPUInfo).(map[string]interface{})["data"].(map[string]interface{})
+	if info["harts"] != 2 {
+		t.Errorf("tinyemuGetCPUInfo harts = %v, want 2", info["harts"])
+	}
+}
+
+func TestSingleCoreIsTheDefault(t *testing.T) {
+	latest := smpMachines(t)
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	e.call(pauseEmulator)
+
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+	// With one hart the run loop steps the machine as a whole
+	if m := latest(); m.harts != 1 || m.counts[0] != 0 || m.steps == 0 {
+		t.Errorf("default machine has %d harts, hart 0 stepped for %d instructions over %d steps; want 1 hart stepped whole", m.harts, m.counts[0], m.steps)
+	}
+}
+
+func TestCoreCountIsBounded(t *testing.T) {
+	for _, cores := range []interface{}{0, -1, maxCores + 1, 1.5, "2"} {
+		if msg := initError(t, map[string]interface{}{"cores": cores}); !strings.Contains(msg, "cores") {
+			t.Errorf("cores %v: error %q doesn't name the option", cores, msg)
+		}
+	}
+	e, _ := newTestEmulator(t, map[string]interface{}{"cores": maxCores})
+	if e.options.cores != maxCores {
+		t.Errorf("cores at the cap gave %d", e.options.cores)
+	}
+}
@@ -0,0 +1,66 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// imageInitrd names the initial ramdisk in the requiredImages option; block
+// devices go by their guest names.
+const imageInitrd = "initrd"
+
+// requiredImagesOption reads the requiredImages option, an array naming
+// what the machine needs staged besides the kernel: "initrd" and block
+// devices such as "vda".
+func requiredImagesOption(v js.Value) ([]string, error) {
+	list := v.Get("requiredImages")
+	if list.IsUndefined() || list.IsNull() {
+		return nil, nil
+	}
+	if !js.Global().Get("Array").Call("isArray", list).Bool() {
+		return nil, fmt.Errorf("requiredImages must be an array, got %s", list.Type())
+	}
+
+	names := make([]string, list.Length())
+	for i := range names {
+		name := list.Index(i)
+		if name.Type() != js.TypeString {
+			return nil, fmt.Errorf("requiredImages[%d] must be a string, got %s", i, name.Type())
+		}
+		if name.String() != imageInitrd {
+			if _, err := diskIndex(name); err != nil {
+				return nil, fmt.Errorf("requiredImages[%d]: %w", i, err)
+			}
+		}
+		names[i] = name.String()
+	}
+	return names, nil
+}
+
+// missingImage reports the first required image that isn't staged.
+func (e *Emulator) missingImage() error {
+	if missing := e.missingImages(e.options.requiredImages); len(missing) > 0 {
+		return missing[0]
+	}
+	return nil
+}
+
+// missingImages reports each image in required that isn't staged.
+func (e *Emulator) missingImages(required []string) []error {
+	var missing []error
+	for _, name := range required {
+		if name == imageInitrd {
+			if e.initrd == nil {
+				missing = append(missing, newError(codeMissingImage, "initrd required by the machine config is not loaded, call tinyemuLoadInitrd first"))
+			}
+			continue
+		}
+		i, _ := diskIndex(js.ValueOf(name))
+		if e.disks[i] == nil {
+			missing = append(missing, withCode(codeMissingImage, fmt.Errorf("disk %s required by the machine config is not loaded, call tinyemuLoadDisk with device %q first", name, name)))
+		}
+	}
+	return missing
+}
@@ -0,0 +1,174 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// Input ring layout, shared with the JavaScript producer:
+//
+//	bytes 0-3   head, Int32, total bytes written (JS stores)
+//	bytes 4-7   tail, Int32, total bytes consumed (Go stores)
+//	bytes 8-    ring data, position = index % (byteLength - 8)
+//
+// Both indices only grow and wrap at 2^32, so head - tail as uint32 is the
+// fill level. The producer writes bytes before publishing them with
+// Atomics.store on head, and must not let head - tail exceed the capacity.
+const (
+	ringHeaderSize = 8
+	ringHeadIndex  = 0
+	ringTailIndex  = 1
+
+	// ringPollInterval bounds keystroke latency through the ring. The Go
+	// side can't Atomics.wait without freezing the event loop, so it polls.
+	ringPollInterval = 2 * time.Millisecond
+)
+
+var errNoSharedMemory = newError(codeUnavailable, "SharedArrayBuffer is not available, page is not cross-origin isolated")
+
+// inputRing is the consumer end of a SharedArrayBuffer keystroke ring.
+type inputRing struct {
+	atomics js.Value
+	indices js.Value // Int32Array over the header
+	data    js.Value // Uint8Array over the ring bytes
+	size    uint32
+
+	// mu guards tail and skips, but isn't held while delivering, which
+	// can wait for the guest. skips counts skip calls, so a drain that
+	// raced one doesn't consume past it.
+	mu    sync.Mutex
+	tail  uint32
+	skips int
+}
+
+func newInputRing(sab js.Value) (*inputRing, error) {
+	ctor := js.Global().Get("SharedArrayBuffer")
+	atomics := js.Global().Get("Atomics")
+	if ctor.Type() != js.TypeFunction || atomics.Type() != js.TypeObject {
+		return nil, errNoSharedMemory
+	}
+	if !sab.InstanceOf(ctor) {
+		return nil, errors.New("expected a SharedArrayBuffer")
+	}
+	size := sab.Get("byteLength").Int() - ringHeaderSize
+	if size <= 0 {
+		return nil, errors.New("SharedArrayBuffer too small for an input ring")
+	}
+
+	r := &inputRing{
+		atomics: atomics,
+		indices: js.Global().Get("Int32Array").New(sab, 0, 2),
+		data:    js.Global().Get("Uint8Array").New(sab, ringHeaderSize, size),
+		size:    uint32(size),
+	}
+	r.tail = r.load(ringTailIndex)
+	return r, nil
+}
+
+func (r *inputRing) load(index int) uint32 {
+	return uint32(r.atomics.Call("load", r.indices, index).Int())
+}
+
+// drain hands everything published since the last drain to deliver. Bytes
+// are only consumed if deliver accepts them, drops them by policy or has
+// closed its input, so a full reader leaves them in the ring as
+// backpressure on the producer.
+func (r *inputRing) drain(deliver func([]byte) error) {
+	r.mu.Lock()
+	avail := r.load(ringHeadIndex) - r.tail
+	if avail == 0 {
+		r.mu.Unlock()
+		return
+	}
+	if avail > r.size {
+		// A misbehaving producer overran us; resync rather than read garbage
+		r.tail = r.load(ringHeadIndex) - r.size
+		avail = r.size
+	}
+
+	buf := make([]byte, avail)
+	start := r.tail % r.size
+	first := min(avail, r.size-start)
+	js.CopyBytesToGo(buf[:first], r.data.Call("subarray", start, start+first))
+	if first < avail {
+		js.CopyBytesToGo(buf[first:], r.data.Call("subarray", 0, avail-first))
+	}
+	skips := r.skips
+	r.mu.Unlock()
+
+	if err := deliver(buf); err != nil && !errors.Is(err, ErrInputDropped) && !errors.Is(err, ErrInputClosed) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.skips == skips {
+		r.tail += avail
+		r.atomics.Call("store", r.indices, ringTailIndex, int32(r.tail))
+	}
+}
+
+// skip consumes everything published without delivering it and returns
+// how many bytes that was.
+func (r *inputRing) skip() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	head := r.load(ringHeadIndex)
+	n := min(head-r.tail, r.size)
+	r.tail = head
+	r.skips++
+	r.atomics.Call("store", r.indices, ringTailIndex, int32(r.tail))
+	return int(n)
+}
+
+// consumeRing polls r into the console reader until stop is closed.
+func (e *Emulator) consumeRing(r *inputRing, stop <-chan struct{}) {
+	ticker := time.NewTicker(ringPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.drain(e.feedInput)
+		}
+	}
+}
+
+// bindInputSAB adopts a SharedArrayBuffer as the keystroke ring, replacing
+// any earlier one. Passing null unbinds it. Without shared memory it
+// reports a fallback and tinyemuSendInput remains the input path.
+func bindInputSAB(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.ringMu.Lock()
+	defer e.ringMu.Unlock()
+
+	if e.ringStop != nil {
+		close(e.ringStop)
+		e.ringStop, e.ring = nil, nil
+	}
+	if !present(args, 0) {
+		return statusResult(statusUnbound, nil)
+	}
+
+	r, err := newInputRing(args[0])
+	if errors.Is(err, errNoSharedMemory) {
+		return statusResult(statusFallback, map[string]interface{}{"reason": err.Error()})
+	}
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.ring, e.ringStop = r, make(chan struct{})
+	go e.consumeRing(r, e.ringStop)
+	return statusResult(statusBound, map[string]interface{}{"capacity": int(r.size)})
+}
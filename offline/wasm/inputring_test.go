@@ -0,0 +1,175 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// ringProducer plays the JavaScript side of an input ring.
+type ringProducer struct {
+	sab     js.Value
+	indices js.Value
+	data    js.Value
+	size    int
+}
+
+func newRingProducer(capacity int) *ringProducer {
+	sab := js.Global().Get("SharedArrayBuffer").New(ringHeaderSize + capacity)
+	return &ringProducer{
+		sab:     sab,
+		indices: js.Global().Get("Int32Array").New(sab, 0, 2),
+		data:    js.Global().Get("Uint8Array").New(sab, ringHeaderSize, capacity),
+		size:    capacity,
+	}
+}
+
+// index returns the head or tail as the producer sees it.
+func (p *ringProducer) index(i int) uint32 {
+	return uint32(js.Global().Get("Atomics").Call("load", p.indices, i).Int())
+}
+
+// setIndices starts both indices at n, as a ring that has been in use.
+func (p *ringProducer) setIndices(n uint32) {
+	p.indices.SetIndex(ringHeadIndex, int32(n))
+	p.indices.SetIndex(ringTailIndex, int32(n))
+}
+
+// publish writes b at the head and then stores the new head, as the
+// producer protocol requires.
+func (p *ringProducer) publish(b []byte) {
+	head := p.index(ringHeadIndex)
+	for i, c := range b {
+		p.data.SetIndex(int((head+uint32(i))%uint32(p.size)), c)
+	}
+	js.Global().Get("Atomics").Call("store", p.indices, ringHeadIndex, int32(head+uint32(len(b))))
+}
+
+// drained drains r and returns what it delivered.
+func drained(r *inputRing) string {
+	var got []byte
+	r.drain(func(b []byte) error {
+		got = append(got, b...)
+		return nil
+	})
+	return string(got)
+}
+
+func TestInputRingWrapsAround(t *testing.T) {
+	p := newRingProducer(16)
+	r, err := newInputRing(p.sab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, chunk := range []string{"0123456789", "abcdefghij", "ABCDEFGHIJKLMNOP", "x"} {
+		p.publish([]byte(chunk))
+		if got := drained(r); got != chunk {
+			t.Errorf("chunk %d: drained %q, want %q", i, got, chunk)
+		}
+		if head, tail := p.index(ringHeadIndex), p.index(ringTailIndex); head != tail {
+			t.Errorf("chunk %d: head %d, tail %d after a full drain", i, head, tail)
+		}
+	}
+	if got := drained(r); got != "" {
+		t.Errorf("an empty ring drained %q", got)
+	}
+}
+
+func TestInputRingIndicesWrapAt32Bits(t *testing.T) {
+	p := newRingProducer(16)
+	p.setIndices(1<<32 - 6)
+	r, err := newInputRing(p.sab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.publish([]byte("across 2^32"))
+	if got := drained(r); got != "across 2^32" {
+		t.Errorf("drained %q across the index wrap", got)
+	}
+	if tail := p.index(ringTailIndex); tail != 5 {
+		t.Errorf("tail is %d, want 5 past the wrap", tail)
+	}
+}
+
+func TestInputRingBackpressure(t *testing.T) {
+	p := newRingProducer(16)
+	r, _ := newInputRing(p.sab)
+	p.publish([]byte("keys"))
+
+	// A full reader leaves the bytes for the next drain
+	r.drain(func([]byte) error { return ErrInputFull })
+	if tail := p.index(ringTailIndex); tail != 0 {
+		t.Errorf("refused bytes were consumed, tail %d", tail)
+	}
+	if got := drained(r); got != "keys" {
+		t.Errorf("after backpressure drained %q, want the same bytes again", got)
+	}
+
+	// Bytes dropped by the reader's policy are gone
+	p.publish([]byte("lost"))
+	r.drain(func([]byte) error { return ErrInputDropped })
+	if got := drained(r); got != "" {
+		t.Errorf("dropped bytes came back as %q", got)
+	}
+}
+
+func TestInputRingRecoversFromOverrun(t *testing.T) {
+	p := newRingProducer(8)
+	r, _ := newInputRing(p.sab)
+	// A producer that ignores the tail laps the consumer
+	p.publish([]byte("0123456789AB"))
+	if got := drained(r); got != "456789AB" {
+		t.Errorf("after an overrun drained %q, want the newest 8 bytes", got)
+	}
+
+	p.publish([]byte("skip"))
+	if n := r.skip(); n != 4 {
+		t.Errorf("skip consumed %d bytes, want 4", n)
+	}
+	if got := drained(r); got != "" {
+		t.Errorf("skipped bytes came back as %q", got)
+	}
+}
+
+func TestBindInputSAB(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	p := newRingProducer(64)
+	r := e.call(bindInputSAB, p.sab).(map[string]interface{})
+	if statusOf(r) != string(statusBound) || r["data"].(map[string]interface{})["capacity"] != 64 {
+		t.Fatalf("tinyemuBindInputSAB = %v", r)
+	}
+	p.publish([]byte("echo hi\n"))
+	deadline := time.Now().Add(time.Second)
+	for !bytes.Equal(e.reader.Pending(), []byte("echo hi\n")) {
+		if time.Now().After(deadline) {
+			t.Fatalf("input queue holds %q, want the ring's bytes", e.reader.Pending())
+		}
+		time.Sleep(ringPollInterval)
+	}
+
+	if got := statusOf(e.call(bindInputSAB, nil)); got != string(statusUnbound) {
+		t.Errorf("tinyemuBindInputSAB(null) = %s, want unbound", got)
+	}
+	if got := statusOf(e.call(bindInputSAB, js.Global().Get("ArrayBuffer").New(64))); got != string(codeInvalidArgument) {
+		t.Errorf("tinyemuBindInputSAB(ArrayBuffer) = %s, want invalid_argument", got)
+	}
+	if got := statusOf(e.call(bindInputSAB, js.Global().Get("SharedArrayBuffer").New(ringHeaderSize))); got != string(codeInvalidArgument) {
+		t.Errorf("tinyemuBindInputSAB with no room for data = %s, want invalid_argument", got)
+	}
+
+	// Without cross-origin isolation the global is missing
+	global := js.Global()
+	ctor := global.Get("SharedArrayBuffer")
+	global.Delete("SharedArrayBuffer")
+	got := statusOf(e.call(bindInputSAB, p.sab))
+	global.Set("SharedArrayBuffer", ctor)
+	if got != string(statusFallback) {
+		t.Errorf("tinyemuBindInputSAB without SharedArrayBuffer = %s, want fallback", got)
+	}
+	if result := e.call(sendInput, "typed"); failed(result.(map[string]interface{})) {
+		t.Errorf("the fallback path refused input: %v", result)
+	}
+}
@@ -0,0 +1,145 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall/js"
+)
+
+const (
+	// machineXLEN is the register width this build emulates.
+	machineXLEN = 64
+	// isaExtensions are the single-letter extensions this build
+	// implements, in canonical ISA string order.
+	isaExtensions = "imafdc"
+)
+
+// isaExtensionNames describes each extension in isaExtensions.
+var isaExtensionNames = map[byte]string{
+	'i': "base integer",
+	'm': "integer multiply and divide",
+	'a': "atomics",
+	'f': "single-precision floating point",
+	'd': "double-precision floating point",
+	'c': "compressed instructions",
+}
+
+// cpuISA is the instruction set the hart is configured with.
+type cpuISA struct {
+	xlen       int
+	extensions string // letters enabled, in isaExtensions order
+}
+
+// defaultISA enables everything the build implements.
+var defaultISA = cpuISA{xlen: machineXLEN, extensions: isaExtensions}
+
+// String returns the ISA string, such as rv64imafdc.
+func (isa cpuISA) String() string {
+	return "rv" + strconv.Itoa(isa.xlen) + isa.extensions
+}
+
+// has reports whether extension ext is enabled.
+func (isa cpuISA) has(ext byte) bool {
+	return strings.IndexByte(isa.extensions, ext) >= 0
+}
+
+// misa returns the misa CSR value: MXL in the top two bits and one bit
+// per extension, a for bit 0, with S and U for the privilege modes.
+func (isa cpuISA) misa() uint64 {
+	v := uint64(2)<<62 | 1<<('s'-'a') | 1<<('u'-'a') // MXL 2 is 64-bit
+	for i := 0; i < len(isa.extensions); i++ {
+		v |= 1 << (isa.extensions[i] - 'a')
+	}
+	return v
+}
+
+// parseISA reads an ISA string such as rv64imac or rv64gc. g stands for
+// imafd, and i is always required. Extensions may come in any order but
+// must all be ones the build implements.
+func parseISA(s string) (cpuISA, error) {
+	lower := strings.ToLower(s)
+	if !strings.HasPrefix(lower, "rv") {
+		return cpuISA{}, fmt.Errorf("isa %q must start with rv and the XLEN, as in rv%d%s", s, machineXLEN, isaExtensions)
+	}
+	digits := len(lower[2:]) - len(strings.TrimLeft(lower[2:], "0123456789"))
+	xlen, err := strconv.Atoi(lower[2 : 2+digits])
+	if err != nil {
+		return cpuISA{}, fmt.Errorf("isa %q must start with rv and the XLEN, as in rv%d%s", s, machineXLEN, isaExtensions)
+	}
+	if xlen != machineXLEN {
+		return cpuISA{}, fmt.Errorf("isa %q: this build only emulates rv%d", s, machineXLEN)
+	}
+
+	want := make(map[byte]bool)
+	for _, c := range []byte(lower[2+digits:]) {
+		switch {
+		case c == 'g':
+			for _, g := range []byte("imafd") {
+				want[g] = true
+			}
+		case c == '_' || c == 'z' || c == 'x' || c == 's':
+			return cpuISA{}, fmt.Errorf("isa %q: multi-letter extensions aren't supported by this build", s)
+		case strings.IndexByte(isaExtensions, c) < 0:
+			return cpuISA{}, fmt.Errorf("isa %q: extension %c isn't supported by this build, want some of %s", s, c, isaExtensions)
+		default:
+			want[c] = true
+		}
+	}
+	if !want['i'] {
+		return cpuISA{}, fmt.Errorf("isa %q must include the base integer extension i", s)
+	}
+	if want['d'] && !want['f'] {
+		return cpuISA{}, fmt.Errorf("isa %q: extension d requires f", s)
+	}
+
+	isa := cpuISA{xlen: xlen}
+	for _, c := range []byte(isaExtensions) {
+		if want[c] {
+			isa.extensions += string(c)
+		}
+	}
+	return isa, nil
+}
+
+// isaOption reads the isa option, defaulting to everything the build
+// implements.
+func isaOption(v js.Value) (cpuISA, error) {
+	isa := v.Get("isa")
+	if isa.IsUndefined() || isa.IsNull() {
+		return defaultISA, nil
+	}
+	if isa.Type() != js.TypeString {
+		return cpuISA{}, fmt.Errorf("isa must be a string, got %s", isa.Type())
+	}
+	return parseISA(isa.String())
+}
+
+// getCPUInfo returns {isa, xlen, endianness, misa, harts, extensions} for
+// the harts the instance boots: the ISA string, the register width, the
+// byte order, the misa CSR as hex, how many there are and, for each
+// extension the build implements, {enabled, name}.
+func getCPUInfo(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	isa := e.options.isa
+	exts := make(map[string]interface{}, len(isaExtensions))
+	for _, c := range []byte(isaExtensions) {
+		exts[string(c)] = map[string]interface{}{
+			"enabled": isa.has(c),
+			"name":    isaExtensionNames[c],
+		}
+	}
+	return okResult(map[string]interface{}{
+		"isa":        isa.String(),
+		"xlen":       isa.xlen,
+		"endianness": "little",
+		"misa":       hex64(isa.misa()),
+		"harts":      e.options.cores,
+		"extensions": exts,
+	})
+}
@@ -0,0 +1,70 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCPUInfoReflectsTheISA(t *testing.T) {
+	// misa also has S and U set, for the privilege modes
+	for _, tt := range []struct {
+		isa     interface{}
+		want    string
+		misa    string
+		enabled string
+	}{
+		{nil, "rv64imafdc", "0x800000000014112d", "imafdc"},
+		{"rv64gc", "rv64imafdc", "0x800000000014112d", "imafdc"},
+		{"RV64IMAC", "rv64imac", "0x8000000000141105", "imac"},
+		{"rv64cmi", "rv64imc", "0x8000000000141104", "imc"},
+		{"rv64i", "rv64i", "0x8000000000140100", "i"},
+	} {
+		var booted cpuISA
+		useMachine(t, func(config machineConfig) machine {
+			booted = config.isa
+			return &testMachine{}
+		})
+		var opts map[string]interface{}
+		if tt.isa != nil {
+			opts = map[string]interface{}{"isa": tt.isa}
+		}
+		e, _ := newTestEmulator(t, opts)
+		info := e.call(getCPUInfo).(map[string]interface{})["data"].(map[string]interface{})
+		if info["isa"] != tt.want || info["xlen"] != 64 || info["misa"] != tt.misa || info["endianness"] != "little" {
+			t.Errorf("isa %v: tinyemuGetCPUInfo = %v, want %s with misa %s", tt.isa, info, tt.want, tt.misa)
+		}
+		exts := info["extensions"].(map[string]interface{})
+		for _, c := range isaExtensions {
+			ext := exts[string(c)].(map[string]interface{})
+			if want := strings.ContainsRune(tt.enabled, c); ext["enabled"] != want || ext["name"] == "" {
+				t.Errorf("isa %v: extension %c is %v, want enabled %v and named", tt.isa, c, ext, want)
+			}
+		}
+
+		// The machine is built with the same ISA
+		e.call(startEmulator)
+		waitState(t, e, stateRunning)
+		if booted.String() != tt.want {
+			t.Errorf("isa %v: machine booted as %s, want %s", tt.isa, booted, tt.want)
+		}
+		e.call(stopEmulator)
+	}
+}
+
+func TestUnsupportedISAIsRefused(t *testing.T) {
+	for _, isa := range []interface{}{
+		"rv32imac",    // another XLEN
+		"rv64imafdcv", // an extension the build lacks
+		"rv64i_zicsr", // multi-letter extensions
+		"rv64mac",     // no base integer set
+		"rv64imad",    // d without f
+		"imac",        // no rv prefix
+		64,
+	} {
+		if msg := initError(t, map[string]interface{}{"isa": isa}); !strings.Contains(msg, "isa") {
+			t.Errorf("isa %v: error %q doesn't name the option", isa, msg)
+		}
+	}
+}
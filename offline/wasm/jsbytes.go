@@ -0,0 +1,35 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"syscall/js"
+)
+
+// errNotBytes is returned when a JS value is neither a Uint8Array nor an
+// ArrayBuffer.
+var errNotBytes = errors.New("expected a Uint8Array or ArrayBuffer")
+
+// bytesToJS copies b into a new JS Uint8Array.
+func bytesToJS(b []byte) js.Value {
+	buf := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(buf, b)
+	return buf
+}
+
+// bytesFromJS copies a JS Uint8Array or ArrayBuffer into a Go slice.
+func bytesFromJS(v js.Value) ([]byte, error) {
+	uint8Array := js.Global().Get("Uint8Array")
+	switch {
+	case v.InstanceOf(uint8Array):
+	case v.InstanceOf(js.Global().Get("ArrayBuffer")):
+		v = uint8Array.New(v)
+	default:
+		return nil, errNotBytes
+	}
+
+	b := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(b, v)
+	return b, nil
+}
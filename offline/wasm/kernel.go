@@ -0,0 +1,182 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"syscall/js"
+)
+
+// minKernelSize rejects payloads too small to hold even an image header.
+const minKernelSize = 64
+
+// riscvImageMagic sits at offset 0x38 of a Linux RISC-V Image header.
+var riscvImageMagic = []byte("RSC\x05")
+
+// kernelImage is a kernel staged for the next start.
+type kernelImage struct {
+	data   []byte
+	format string // "elf", "riscv-image" or "raw"
+}
+
+// parseKernel checks that data plausibly holds a kernel and identifies its
+// format. Flat binaries such as bbl have no header, so anything that isn't
+// obviously wrong is accepted as "raw".
+func parseKernel(data []byte) (*kernelImage, error) {
+	if len(data) < minKernelSize {
+		return nil, fmt.Errorf("kernel image is %d bytes, too small to be valid", len(data))
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("\x7fELF")):
+		return &kernelImage{data: data, format: "elf"}, nil
+	case bytes.Equal(data[0x38:0x3c], riscvImageMagic):
+		return &kernelImage{data: data, format: "riscv-image"}, nil
+	case bytes.HasPrefix(bytes.TrimSpace(data[:minKernelSize]), []byte("<")):
+		// Usually an HTML error page served in place of the image
+		return nil, errors.New("kernel image looks like HTML, check the URL")
+	case bytes.Count(data[:minKernelSize], []byte{0}) == minKernelSize:
+		return nil, errors.New("kernel image starts with zeros, not a kernel")
+	}
+	return &kernelImage{data: data, format: "raw"}, nil
+}
+
+// stageKernel validates data and makes it the kernel for the next start.
+func (e *Emulator) stageKernel(data []byte) map[string]interface{} {
+	k, err := parseKernel(data)
+	if err != nil {
+		return errorResult(err)
+	}
+	e.kernel = k
+	return statusResult(statusKernelLoaded, map[string]interface{}{
+		"size":   len(k.data),
+		"format": k.format,
+	})
+}
+
+// loadKernel accepts a Uint8Array or ArrayBuffer the caller has fetched,
+// plus an optional {compression, onProgress} options object. onProgress is
+// called with (bytesProcessed, totalBytes, phase) while a gzip image is
+// decompressed.
+func loadKernel(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !present(args, 0) {
+		return errResult(codeInvalidArgument, "missing kernel image argument")
+	}
+
+	data, err := loadImageArg(args)
+	if err != nil {
+		return errorResult(err)
+	}
+	return e.stageKernel(data)
+}
+
+// loadInitrd accepts an initial ramdisk as a Uint8Array or ArrayBuffer,
+// plus an optional {compression, onProgress} options object, and stages it
+// beside the kernel for the next start.
+func loadInitrd(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !present(args, 0) {
+		return errResult(codeInvalidArgument, "missing initrd image argument")
+	}
+
+	data, err := loadImageArg(args)
+	if err != nil {
+		return errorResult(err)
+	}
+	if len(data) == 0 {
+		return errResult(codeInvalidArgument, "initrd image is empty")
+	}
+	e.initrd = data
+	return statusResult(statusInitrdLoaded, map[string]interface{}{"size": len(data)})
+}
+
+// loadKernelFromURL fetches a kernel with the Fetch API and returns a
+// Promise that resolves once it is staged. An onProgress option hears the
+// "download" phase, streamed in chunks, and any "decompress" phase;
+// totalBytes is -1 when the server doesn't send a usable Content-Length.
+// The Promise's loadId can be passed to tinyemuCancelLoad to abort it.
+func loadKernelFromURL(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	url, err := stringArg(args, 0, "url")
+	if err != nil {
+		return rejectedPromise(err)
+	}
+
+	opts, err := optionalObjectArg(args, 1, "options")
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	mode, err := compressionOption(opts)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	onProgress, err := progressOption(opts)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+
+	ctx, id := e.loads.begin()
+	promise := newPromise(func(resolve, reject js.Value) {
+		// Fetching needs the event loop, so it can't block this callback
+		go func() {
+			data, err := fetchBytes(ctx, url, onProgress)
+			if err == nil {
+				data, err = decompressImage(ctx, data, mode, onProgress)
+			}
+			if !e.loads.finish(id) {
+				settle(canceledLoad(id), resolve, reject)
+				return
+			}
+			if err != nil {
+				reject.Invoke(errorValue(err))
+				return
+			}
+			settle(e.stageKernel(data), resolve, reject)
+		}()
+	})
+	promise.Set("loadId", id)
+	return promise
+}
+
+// fetchBytes downloads url and returns the response body. With an
+// onProgress callback the body is read as a stream so the download can be
+// reported as it goes.
+func fetchBytes(ctx context.Context, url string, onProgress js.Value) ([]byte, error) {
+	init := map[string]interface{}{"signal": abortSignal(ctx)}
+	resp, err := await(js.Global().Call("fetch", url, init))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, withCode(codeFetchFailed, fmt.Errorf("fetching %s: %w", url, err))
+	}
+	if !resp.Get("ok").Bool() {
+		return nil, withCode(codeFetchFailed, fmt.Errorf("fetching %s: HTTP %d", url, resp.Get("status").Int()))
+	}
+
+	if onProgress.Type() == js.TypeFunction && resp.Get("body").Truthy() {
+		data, err := readBody(ctx, resp, onProgress)
+		if err != nil {
+			return nil, withCode(codeFetchFailed, fmt.Errorf("reading %s: %w", url, err))
+		}
+		return data, nil
+	}
+	body, err := await(resp.Call("arrayBuffer"))
+	if err != nil {
+		return nil, withCode(codeFetchFailed, fmt.Errorf("reading %s: %w", url, err))
+	}
+	return imageFromJS(body)
+}
@@ -0,0 +1,213 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"syscall/js"
+	"unicode/utf8"
+)
+
+// keyEvent holds the fields of a browser KeyboardEvent used for translation.
+type keyEvent struct {
+	key                    string
+	code                   string
+	ctrl, alt, shift, meta bool
+}
+
+func keyEventFromJS(v js.Value) keyEvent {
+	str := func(name string) string {
+		if f := v.Get(name); f.Type() == js.TypeString {
+			return f.String()
+		}
+		return ""
+	}
+	return keyEvent{
+		key:   str("key"),
+		code:  str("code"),
+		ctrl:  v.Get("ctrlKey").Truthy(),
+		alt:   v.Get("altKey").Truthy(),
+		shift: v.Get("shiftKey").Truthy(),
+		meta:  v.Get("metaKey").Truthy(),
+	}
+}
+
+// cursorKeys end in a letter and take xterm modifiers as "ESC [ 1 ; m X".
+var cursorKeys = map[string]byte{
+	"ArrowUp":    'A',
+	"ArrowDown":  'B',
+	"ArrowRight": 'C',
+	"ArrowLeft":  'D',
+	"Home":       'H',
+	"End":        'F',
+}
+
+// tildeKeys are sent as "ESC [ n ~", or "ESC [ n ; m ~" with modifiers.
+var tildeKeys = map[string]int{
+	"Insert":   2,
+	"Delete":   3,
+	"PageUp":   5,
+	"PageDown": 6,
+	"F5":       15,
+	"F6":       17,
+	"F7":       18,
+	"F8":       19,
+	"F9":       20,
+	"F10":      21,
+	"F11":      23,
+	"F12":      24,
+}
+
+// ss3Keys are F1-F4, sent as "ESC O X" when unmodified.
+var ss3Keys = map[string]byte{
+	"F1": 'P',
+	"F2": 'Q',
+	"F3": 'R',
+	"F4": 'S',
+}
+
+// xtermModifier returns the xterm modifier parameter, or 1 for none.
+func (e keyEvent) xtermModifier() int {
+	m := 1
+	if e.shift {
+		m += 1
+	}
+	if e.alt {
+		m += 2
+	}
+	if e.ctrl {
+		m += 4
+	}
+	if e.meta {
+		m += 8
+	}
+	return m
+}
+
+// translateKey returns the bytes a VT-style terminal sends for e, or nil if
+// the key produces no input (e.g. a bare modifier).
+func translateKey(e keyEvent) []byte {
+	mod := e.xtermModifier()
+
+	if final, ok := cursorKeys[e.key]; ok {
+		if mod == 1 {
+			return []byte{0x1b, '[', final}
+		}
+		return []byte("\x1b[1;" + strconv.Itoa(mod) + string(final))
+	}
+	if n, ok := tildeKeys[e.key]; ok {
+		if mod == 1 {
+			return []byte("\x1b[" + strconv.Itoa(n) + "~")
+		}
+		return []byte("\x1b[" + strconv.Itoa(n) + ";" + strconv.Itoa(mod) + "~")
+	}
+	if final, ok := ss3Keys[e.key]; ok {
+		if mod == 1 {
+			return []byte{0x1b, 'O', final}
+		}
+		return []byte("\x1b[1;" + strconv.Itoa(mod) + string(final))
+	}
+
+	var out []byte
+	switch e.key {
+	case "Enter":
+		out = []byte{'\r'}
+	case "Backspace":
+		out = []byte{0x7f}
+		if e.ctrl {
+			out = []byte{0x08}
+		}
+	case "Tab":
+		if e.shift {
+			return []byte("\x1b[Z")
+		}
+		out = []byte{'\t'}
+	case "Escape":
+		out = []byte{0x1b}
+	default:
+		key := e.key
+		if (e.ctrl || e.alt) && len(e.code) == 4 && strings.HasPrefix(e.code, "Key") {
+			// Layouts such as macOS Option turn Alt+x into another
+			// character; use the physical key instead
+			key = strings.ToLower(e.code[3:])
+			if e.shift {
+				key = e.code[3:]
+			}
+		}
+		r, size := utf8.DecodeRuneInString(key)
+		if size == 0 || size != len(key) {
+			// Named keys we don't translate, and bare modifiers
+			return nil
+		}
+		if e.meta {
+			// Leave Cmd/Win shortcuts to the browser
+			return nil
+		}
+		if e.ctrl {
+			c, ok := controlByte(r)
+			if !ok {
+				return nil
+			}
+			out = []byte{c}
+		} else {
+			out = []byte(key)
+		}
+	}
+
+	if e.alt {
+		out = append([]byte{0x1b}, out...)
+	}
+	return out
+}
+
+// controlByte maps Ctrl+r to its C0 control code.
+func controlByte(r rune) (byte, bool) {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return byte(r-'a') + 1, true
+	case r >= '@' && r <= '_':
+		return byte(r - '@'), true
+	case r == ' ' || r == '2':
+		return 0x00, true
+	case r == '?' || r == '8':
+		return 0x7f, true
+	case r >= '3' && r <= '7':
+		// xterm maps Ctrl+3..7 to ESC, FS, GS, RS, US
+		return byte(r-'3') + 0x1b, true
+	}
+	return 0, false
+}
+
+// keyDown translates a KeyboardEvent-like object and feeds the result to
+// the guest. handled is false when the key produces no input, so the
+// front-end can let the browser process it.
+func keyDown(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	ev, err := objectArg(args, 0, "key event")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	seq := translateKey(keyEventFromJS(ev))
+	if seq == nil {
+		return okResult(map[string]interface{}{"handled": false})
+	}
+	// Printable keys come out as UTF-8
+	seq, err = e.options.encoding.encode(string(seq))
+	if err != nil {
+		return errorResult(err)
+	}
+	result := inputResult(e.feedInput(seq))
+	result["data"].(map[string]interface{})["handled"] = true
+	return result
+}
+
+// keyUp exists for symmetry with keyDown; serial consoles have no key
+// release events.
+func keyUp(this js.Value, args []js.Value) interface{} {
+	return okResult(map[string]interface{}{"handled": false})
+}
@@ -0,0 +1,100 @@
+//go:build js && wasm
+
+package main
+
+import "testing"
+
+func TestTranslateKey(t *testing.T) {
+	tests := []struct {
+		name string
+		ev   keyEvent
+		want string
+	}{
+		// Control characters
+		{"Ctrl+C", keyEvent{key: "c", code: "KeyC", ctrl: true}, "\x03"},
+		{"Ctrl+Shift+C", keyEvent{key: "C", code: "KeyC", ctrl: true, shift: true}, "\x03"},
+		{"Ctrl+D", keyEvent{key: "d", code: "KeyD", ctrl: true}, "\x04"},
+		{"Ctrl+[", keyEvent{key: "[", code: "BracketLeft", ctrl: true}, "\x1b"},
+		{"Ctrl+Space", keyEvent{key: " ", code: "Space", ctrl: true}, "\x00"},
+		{"Ctrl+?", keyEvent{key: "?", code: "Slash", ctrl: true, shift: true}, "\x7f"},
+		{"Ctrl+5", keyEvent{key: "5", code: "Digit5", ctrl: true}, "\x1d"},
+		{"Enter", keyEvent{key: "Enter", code: "Enter"}, "\r"},
+		{"Backspace", keyEvent{key: "Backspace", code: "Backspace"}, "\x7f"},
+		{"Ctrl+Backspace", keyEvent{key: "Backspace", code: "Backspace", ctrl: true}, "\x08"},
+		{"Tab", keyEvent{key: "Tab", code: "Tab"}, "\t"},
+		{"Shift+Tab", keyEvent{key: "Tab", code: "Tab", shift: true}, "\x1b[Z"},
+		{"Escape", keyEvent{key: "Escape", code: "Escape"}, "\x1b"},
+
+		// Cursor and editing keys
+		{"Up", keyEvent{key: "ArrowUp"}, "\x1b[A"},
+		{"Left", keyEvent{key: "ArrowLeft"}, "\x1b[D"},
+		{"Home", keyEvent{key: "Home"}, "\x1b[H"},
+		{"Shift+Up", keyEvent{key: "ArrowUp", shift: true}, "\x1b[1;2A"},
+		{"Ctrl+Right", keyEvent{key: "ArrowRight", ctrl: true}, "\x1b[1;5C"},
+		{"Ctrl+Alt+Shift+End", keyEvent{key: "End", ctrl: true, alt: true, shift: true}, "\x1b[1;8F"},
+		{"Delete", keyEvent{key: "Delete"}, "\x1b[3~"},
+		{"Ctrl+PageDown", keyEvent{key: "PageDown", ctrl: true}, "\x1b[6;5~"},
+
+		// Function keys
+		{"F1", keyEvent{key: "F1"}, "\x1bOP"},
+		{"F4", keyEvent{key: "F4"}, "\x1bOS"},
+		{"Shift+F1", keyEvent{key: "F1", shift: true}, "\x1b[1;2P"},
+		{"F5", keyEvent{key: "F5"}, "\x1b[15~"},
+		{"F12", keyEvent{key: "F12"}, "\x1b[24~"},
+		{"Alt+F10", keyEvent{key: "F10", alt: true}, "\x1b[21;3~"},
+
+		// Printable keys and Alt as meta
+		{"a", keyEvent{key: "a", code: "KeyA"}, "a"},
+		{"é", keyEvent{key: "é", code: "Digit2"}, "é"},
+		{"Alt+b", keyEvent{key: "b", code: "KeyB", alt: true}, "\x1bb"},
+		{"macOS Option+b", keyEvent{key: "∫", code: "KeyB", alt: true}, "\x1bb"},
+		{"Alt+Shift+B", keyEvent{key: "B", code: "KeyB", alt: true, shift: true}, "\x1bB"},
+		{"Ctrl+Alt+x", keyEvent{key: "x", code: "KeyX", ctrl: true, alt: true}, "\x1b\x18"},
+		{"Alt+Enter", keyEvent{key: "Enter", alt: true}, "\x1b\r"},
+
+		// Keys left to the browser
+		{"Shift", keyEvent{key: "Shift", code: "ShiftLeft", shift: true}, ""},
+		{"CapsLock", keyEvent{key: "CapsLock", code: "CapsLock"}, ""},
+		{"Cmd+C", keyEvent{key: "c", code: "KeyC", meta: true}, ""},
+		{"Ctrl+é", keyEvent{key: "é", code: "Digit2", ctrl: true}, ""},
+	}
+	for _, tt := range tests {
+		got := translateKey(tt.ev)
+		if string(got) != tt.want || (got == nil) != (tt.want == "") {
+			t.Errorf("%s: translateKey = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeyDownFeedsTheGuest(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	for _, ev := range []map[string]interface{}{
+		{"key": "l", "code": "KeyL"},
+		{"key": "ArrowUp", "code": "ArrowUp"},
+		{"key": "c", "code": "KeyC", "ctrlKey": true},
+	} {
+		r := e.call(keyDown, ev).(map[string]interface{})
+		if failed(r) || r["data"].(map[string]interface{})["handled"] != true {
+			t.Errorf("tinyemuKeyDown(%v) = %v, want handled", ev, r)
+		}
+	}
+	const want = "l\x1b[A\x03"
+	if got := string(e.reader.Pending()); got != want {
+		t.Errorf("guest was sent %q, want %q", got, want)
+	}
+
+	for _, fn := range []func() interface{}{
+		func() interface{} { return e.call(keyDown, map[string]interface{}{"key": "Meta", "metaKey": true}) },
+		func() interface{} { return e.call(keyUp, map[string]interface{}{"key": "l", "code": "KeyL"}) },
+	} {
+		if r := fn().(map[string]interface{}); failed(r) || r["data"].(map[string]interface{})["handled"] != false {
+			t.Errorf("got %v, want unhandled", r)
+		}
+	}
+	if got := e.reader.Buffered(); got != len(want) {
+		t.Errorf("unhandled keys changed the queued input to %d bytes", got)
+	}
+	if got := statusOf(e.call(keyDown, "a")); got != string(codeInvalidArgument) {
+		t.Errorf("tinyemuKeyDown with a string = %s, want invalid_argument", got)
+	}
+}
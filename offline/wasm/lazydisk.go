@@ -0,0 +1,364 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"syscall/js"
+)
+
+const (
+	// maxLazyBlockSize bounds the blockSize of a lazy disk, so one cache
+	// miss can't ask for an unreasonable slice of the image.
+	maxLazyBlockSize = 16 << 20
+	// defaultLazyCacheBytes is how much fetched data a lazy disk keeps by
+	// default, divided into blocks.
+	defaultLazyCacheBytes = 32 << 20
+	// maxLazyDiskSize is the largest image size a JS number holds exactly.
+	maxLazyDiskSize = 1 << 53
+)
+
+// blockCache is a bounded LRU of fetched blocks by index.
+type blockCache struct {
+	max   int
+	order *list.List // most recently used first
+	items map[int64]*list.Element
+}
+
+type cachedBlock struct {
+	index int64
+	data  []byte
+}
+
+func newBlockCache(max int) *blockCache {
+	return &blockCache{max: max, order: list.New(), items: make(map[int64]*list.Element)}
+}
+
+// get returns block i and marks it most recently used.
+func (c *blockCache) get(i int64) ([]byte, bool) {
+	el, ok := c.items[i]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cachedBlock).data, true
+}
+
+// put adds block i, evicting the least recently used blocks over max.
+func (c *blockCache) put(i int64, data []byte) {
+	if el, ok := c.items[i]; ok {
+		el.Value.(*cachedBlock).data = data
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[i] = c.order.PushFront(&cachedBlock{index: i, data: data})
+	for c.order.Len() > c.max {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.items, el.Value.(*cachedBlock).index)
+	}
+}
+
+// remove drops block i if it is cached.
+func (c *blockCache) remove(i int64) {
+	if el, ok := c.items[i]; ok {
+		c.order.Remove(el)
+		delete(c.items, i)
+	}
+}
+
+// lazyDisk is a blockBackend whose image stays in JavaScript. A read of a
+// block that isn't cached calls fetch with (offset, length), which returns
+// those bytes or a Promise of them, for instance from an HTTP Range request
+// or File.slice. Blocks the guest writes are copied into an overlay in
+// memory, so the image itself is never written and a cold reset reverts to
+// it. tinyemuEnablePersistence can save the overlay to IndexedDB.
+type lazyDisk struct {
+	fetch     js.Value
+	size      int64
+	blockSize int64
+	readOnly  bool
+
+	// mu guards the cache, overlay and fetches in flight. It is let go
+	// while a fetch's Promise is awaited, so the overlay can be read
+	// meanwhile, and a read of a block already being fetched awaits the
+	// same Promise rather than asking again.
+	mu       sync.Mutex
+	cache    *blockCache
+	written  map[int64][]byte   // overlay blocks by index
+	fetching map[int64]js.Value // Promises of blocks being fetched, by index
+}
+
+// awaiter waits for a Promise to settle, as await does.
+type awaiter func(promise js.Value) (js.Value, error)
+
+// awaitingBackend is implemented by backends whose reads and writes may
+// wait on a Promise, so a caller can say how to wait.
+type awaitingBackend interface {
+	readAtAwaiting(p []byte, off int64, wait awaiter) (int, error)
+	writeAtAwaiting(p []byte, off int64, wait awaiter) (int, error)
+}
+
+func newLazyDisk(fetch js.Value, size, blockSize int64, cacheBlocks int, readOnly bool) *lazyDisk {
+	return &lazyDisk{
+		fetch:     fetch,
+		size:      size,
+		blockSize: blockSize,
+		readOnly:  readOnly,
+		cache:     newBlockCache(cacheBlocks),
+		fetching:  make(map[int64]js.Value),
+	}
+}
+
+// block returns the current contents of block i, fetching it on a miss
+// and waiting for the fetch with wait. It runs under mu.
+func (d *lazyDisk) block(i int64, wait awaiter) ([]byte, error) {
+	if b, ok := d.written[i]; ok {
+		return b, nil
+	}
+	if b, ok := d.cache.get(i); ok {
+		return b, nil
+	}
+	b, err := d.fetchBlock(i, wait)
+	if err != nil {
+		return nil, err
+	}
+	// mu may have been let go for the fetch
+	if w, ok := d.written[i]; ok {
+		return w, nil
+	}
+	d.cache.put(i, b)
+	return b, nil
+}
+
+// fetchBlock asks the fetch callback for block i, or joins the fetch of
+// it already in flight. It runs under mu, which it lets go while awaiting
+// a Promise, so it must not run on a JS callback's own goroutine then.
+func (d *lazyDisk) fetchBlock(i int64, wait awaiter) (data []byte, err error) {
+	off := i * d.blockSize
+	n := min(d.blockSize, d.size-off)
+
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = nil, fmt.Errorf("fetching block %d: %v", i, r)
+		}
+	}()
+	v, joined := d.fetching[i]
+	if !joined {
+		v = d.fetch.Invoke(float64(off), float64(n))
+	}
+	if v.Type() == js.TypeObject && v.Get("then").Type() == js.TypeFunction {
+		if !joined {
+			d.fetching[i] = v
+		}
+		d.mu.Unlock()
+		v, err = wait(v)
+		d.mu.Lock()
+		if !joined {
+			delete(d.fetching, i)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetching block %d: %w", i, err)
+		}
+	}
+	data, err = bytesFromJS(v)
+	if err != nil {
+		return nil, fmt.Errorf("fetching block %d: %w", i, err)
+	}
+	if int64(len(data)) != n {
+		return nil, fmt.Errorf("fetching block %d: got %d bytes, want %d", i, len(data), n)
+	}
+	return data, nil
+}
+
+func (d *lazyDisk) ReadAt(p []byte, off int64) (int, error) {
+	return d.readAtAwaiting(p, off, await)
+}
+
+func (d *lazyDisk) WriteAt(p []byte, off int64) (int, error) {
+	return d.writeAtAwaiting(p, off, await)
+}
+
+func (d *lazyDisk) readAtAwaiting(p []byte, off int64, wait awaiter) (int, error) {
+	if off < 0 || off >= d.size {
+		return 0, io.EOF
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off < d.size {
+		i := off / d.blockSize
+		b, err := d.block(i, wait)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], b[off-i*d.blockSize:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (d *lazyDisk) writeAtAwaiting(p []byte, off int64, wait awaiter) (int, error) {
+	if d.readOnly {
+		return 0, errReadOnly
+	}
+	if off < 0 || off+int64(len(p)) > d.size {
+		return 0, io.ErrShortWrite
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.written == nil {
+		d.written = make(map[int64][]byte)
+	}
+	n := 0
+	for n < len(p) {
+		i := off / d.blockSize
+		b, ok := d.written[i]
+		if !ok {
+			base, err := d.block(i, wait)
+			if err != nil {
+				return n, err
+			}
+			b = append([]byte(nil), base...)
+			d.written[i] = b
+			d.cache.remove(i)
+		}
+		c := copy(b[off-i*d.blockSize:], p[n:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+func (d *lazyDisk) Overlay() map[int64][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	overlay := make(map[int64][]byte, len(d.written))
+	for i, b := range d.written {
+		overlay[i*d.blockSize] = append([]byte(nil), b...)
+	}
+	return overlay
+}
+
+func (d *lazyDisk) SetOverlay(overlay map[int64][]byte) error {
+	written := make(map[int64][]byte, len(overlay))
+	for off, b := range overlay {
+		if off < 0 || off%d.blockSize != 0 || off >= d.size || int64(len(b)) != min(d.blockSize, d.size-off) {
+			return fmt.Errorf("overlay extent of %d bytes at %d isn't a block of the disk", len(b), off)
+		}
+		written[off/d.blockSize] = append([]byte(nil), b...)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range written {
+		d.cache.remove(i)
+	}
+	d.written = written
+	return nil
+}
+
+func (d *lazyDisk) Revert() []int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var offs []int64
+	for i, b := range d.written {
+		for s := int64(0); s < int64(len(b)); s += sectorSize {
+			offs = append(offs, i*d.blockSize+s)
+		}
+	}
+	d.written = nil
+	return offs
+}
+
+func (d *lazyDisk) Size() int64 { return d.size }
+
+func (d *lazyDisk) ReadOnly() bool { return d.readOnly }
+
+// sizeArg reads args[i] as a positive multiple of unit no larger than
+// limit.
+func sizeArg(args []js.Value, i int, name string, unit, limit int64) (int64, error) {
+	n, err := numberArg(args, i, name)
+	if err != nil {
+		return 0, err
+	}
+	if n != math.Trunc(n) || n < float64(unit) || n > float64(limit) || int64(n)%unit != 0 {
+		return 0, fmt.Errorf("%s must be a non-zero multiple of %d up to %d, got %v", name, unit, limit, n)
+	}
+	return int64(n), nil
+}
+
+// attachLazyDisk accepts (fetch, totalSize, blockSize, {device, readOnly,
+// cacheBlocks}) and stages an image that stays in JavaScript as a virtio
+// block device for the next start. fetch is called with (offset, length)
+// for each block the guest reads that isn't cached, and returns a
+// Uint8Array or ArrayBuffer of exactly length bytes, or a Promise of one.
+// blockSize is a multiple of 4096, so each block tinyemuEnablePersistence
+// saves lies in one overlay block. cacheBlocks bounds the fetched blocks
+// kept, 32 MiB's worth by default.
+//
+// While a Promise is pending the guest's step is parked and the machine is
+// let go, so other calls go on and tinyemuStop gives up on the fetch. The
+// machine is mid-instruction meanwhile, so tinyemuSnapshot, tinyemuRestore
+// and the calls that inspect it fail with busy until the Promise settles.
+func attachLazyDisk(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	fetch, err := funcArg(args, 0, "fetch callback")
+	if err != nil {
+		return errorResult(err)
+	}
+	size, err := sizeArg(args, 1, "totalSize", sectorSize, maxLazyDiskSize)
+	if err != nil {
+		return errorResult(err)
+	}
+	blockSize, err := sizeArg(args, 2, "blockSize", persistBlockSize, maxLazyBlockSize)
+	if err != nil {
+		return errorResult(err)
+	}
+	opts, err := optionalObjectArg(args, 3, "options")
+	if err != nil {
+		return errorResult(err)
+	}
+	device, err := deviceOption(opts)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	cacheBlocks := int(max(1, defaultLazyCacheBytes/blockSize))
+	if opts.Type() == js.TypeObject {
+		if v := opts.Get("cacheBlocks"); !v.IsUndefined() && !v.IsNull() {
+			if v.Type() != js.TypeNumber {
+				return errResult(codeInvalidArgument, fmt.Sprintf("cacheBlocks must be a number, got %s", v.Type()))
+			}
+			n := v.Float()
+			if n != math.Trunc(n) || n < 1 || n*float64(blockSize) > maxImageSize {
+				return errResult(codeInvalidArgument, fmt.Sprintf("cacheBlocks must be a whole number from 1 to %d MiB's worth, got %v", maxImageSize>>20, n))
+			}
+			cacheBlocks = int(n)
+		}
+	}
+	readOnly := opts.Type() == js.TypeObject && opts.Get("readOnly").Truthy()
+
+	e.disks[device] = newLazyDisk(fetch, size, blockSize, cacheBlocks, readOnly)
+	return statusResult(statusAttached, map[string]interface{}{
+		"device":      diskName(device),
+		"size":        size,
+		"blockSize":   blockSize,
+		"cacheBlocks": cacheBlocks,
+		"readOnly":    readOnly,
+	})
+}
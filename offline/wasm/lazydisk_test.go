@@ -0,0 +1,335 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// testLazyBlock is the block size the lazy disk tests attach with.
+const testLazyBlock = persistBlockSize
+
+// rangeFetch is a mock range-request callback serving image. An async one
+// returns a Promise for each fetch and leaves it pending until settle.
+type rangeFetch struct {
+	fn      js.Func
+	image   []byte
+	mu      sync.Mutex
+	calls   []string // "offset+length"
+	pending []pendingFetch
+	fetched chan struct{}
+}
+
+// pendingFetch is an async fetch yet to settle.
+type pendingFetch struct {
+	resolve js.Value
+	data    []byte
+}
+
+func newRangeFetch(t *testing.T, image []byte, async bool) *rangeFetch {
+	f := &rangeFetch{image: image, fetched: make(chan struct{}, 16)}
+	f.fn = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		off, n := args[0].Int(), args[1].Int()
+		f.mu.Lock()
+		f.calls = append(f.calls, fmt.Sprintf("%d+%d", off, n))
+		f.mu.Unlock()
+		if !async {
+			return bytesToJS(image[off : off+n])
+		}
+		return newPromise(func(resolve, reject js.Value) {
+			f.mu.Lock()
+			f.pending = append(f.pending, pendingFetch{resolve, image[off : off+n]})
+			f.mu.Unlock()
+			f.fetched <- struct{}{}
+		})
+	})
+	t.Cleanup(f.fn.Release)
+	return f
+}
+
+// requested returns the fetches made and forgets them.
+func (f *rangeFetch) requested() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+// settle resolves the pending fetches with their bytes.
+func (f *rangeFetch) settle() {
+	f.mu.Lock()
+	pending := f.pending
+	f.pending = nil
+	f.mu.Unlock()
+	for _, p := range pending {
+		p.resolve.Invoke(bytesToJS(p.data))
+	}
+}
+
+// attachTestLazyDisk attaches f as vda of e with cacheBlocks blocks of
+// testLazyBlock bytes cached.
+func attachTestLazyDisk(t *testing.T, e *Emulator, f *rangeFetch, cacheBlocks int) *lazyDisk {
+	t.Helper()
+	opts := map[string]interface{}{"cacheBlocks": cacheBlocks}
+	if got := statusOf(e.call(attachLazyDisk, f.fn, len(f.image), testLazyBlock, opts)); got != string(statusAttached) {
+		t.Fatalf("tinyemuAttachLazyDisk = %s", got)
+	}
+	return e.disks[0].(*lazyDisk)
+}
+
+func TestLazyDiskFetchesOnlyTheBlocksRead(t *testing.T) {
+	// Four whole blocks and a last one of a single sector
+	image := diskImage(4*testLazyBlock/sectorSize + 1)
+	f := newRangeFetch(t, image, false)
+	e, _ := newTestEmulator(t, nil)
+	d := attachTestLazyDisk(t, e, f, 8)
+
+	buf := make([]byte, 2*sectorSize)
+	d.ReadAt(buf, testLazyBlock-sectorSize) // the end of block 0 and start of block 1
+	if !bytes.Equal(buf, image[testLazyBlock-sectorSize:testLazyBlock+sectorSize]) {
+		t.Errorf("read across blocks 0 and 1 returned the wrong bytes")
+	}
+	if got, want := f.requested(), []string{"0+4096", "4096+4096"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fetched %v, want only blocks 0 and 1 %v", got, want)
+	}
+
+	// Cached blocks aren't fetched again, and the short last block is
+	// asked for at its own length
+	d.ReadAt(buf[:sectorSize], 100)
+	d.ReadAt(buf[:sectorSize], int64(len(image)-sectorSize))
+	if got, want := f.requested(), []string{"16384+512"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fetched %v, want only the last block %v", got, want)
+	}
+
+	// Writes go to the overlay, and block 2 is fetched once to fill it
+	d.WriteAt([]byte("overlay"), 2*testLazyBlock+8)
+	d.ReadAt(buf[:7], 2*testLazyBlock+8)
+	if string(buf[:7]) != "overlay" {
+		t.Errorf("read back %q over the write", buf[:7])
+	}
+	if got, want := f.requested(), []string{"8192+4096"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("writing block 2 fetched %v, want %v", got, want)
+	}
+	if image[2*testLazyBlock+8] != 2*testLazyBlock/sectorSize {
+		t.Errorf("the image itself was written")
+	}
+}
+
+func TestLazyDiskCacheEvictsTheLeastRecentlyUsed(t *testing.T) {
+	image := diskImage(4 * testLazyBlock / sectorSize)
+	f := newRangeFetch(t, image, false)
+	e, _ := newTestEmulator(t, nil)
+	d := attachTestLazyDisk(t, e, f, 2)
+
+	buf := make([]byte, 1)
+	read := func(block int64) { d.ReadAt(buf, block*testLazyBlock) }
+	read(0)
+	read(1)
+	read(0) // 1 is now the least recently used
+	read(2)
+	f.requested()
+
+	read(0)
+	if got := f.requested(); len(got) != 0 {
+		t.Errorf("block 0, used since block 1, was fetched again: %v", got)
+	}
+	read(1)
+	if got, want := f.requested(), []string{"4096+4096"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reading the evicted block 1 fetched %v, want %v", got, want)
+	}
+	// Reading 1 evicted 2, the least recent of 0 and 2
+	read(0)
+	read(2)
+	if got, want := f.requested(), []string{"8192+4096"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after evicting 2, fetched %v, want only block 2 %v", got, want)
+	}
+}
+
+// lazyReadingMachine reads the first sector of vda's block 1 on its
+// second step.
+type lazyReadingMachine struct {
+	testMachine
+	vda  blockBackend
+	read []byte
+	err  error
+}
+
+func (m *lazyReadingMachine) Step(n int) int {
+	m.testMachine.Step(n)
+	if m.steps == 2 {
+		m.read = make([]byte, sectorSize)
+		_, m.err = m.vda.ReadAt(m.read, testLazyBlock)
+	}
+	return n
+}
+
+func (m *lazyReadingMachine) MarshalState() ([]byte, error) {
+	return []byte{byte(m.steps)}, nil
+}
+
+func (m *lazyReadingMachine) UnmarshalState(data []byte) error { return nil }
+
+// parkedOnFetch starts an instance whose machine reads a lazy vda served
+// by an async fetch, and returns once that fetch is pending.
+func parkedOnFetch(t *testing.T) (*Emulator, *lazyReadingMachine, *rangeFetch) {
+	t.Helper()
+	m := &lazyReadingMachine{}
+	useMachine(t, func(config machineConfig) machine {
+		m.vda = config.disks[0]
+		return m
+	})
+	f := newRangeFetch(t, diskImage(2*testLazyBlock/sectorSize), true)
+	e, _ := newTestEmulator(t, nil)
+	attachTestLazyDisk(t, e, f, 2)
+	e.call(startEmulator)
+	select {
+	case <-f.fetched:
+	case <-time.After(time.Second):
+		t.Fatal("the machine's read didn't fetch")
+	}
+	deadline := time.Now().Add(time.Second)
+	for !e.parked.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("the step isn't parked on the fetch")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return e, m, f
+}
+
+func TestPendingFetchDoesntHoldTheMachine(t *testing.T) {
+	e, m, f := parkedOnFetch(t)
+
+	// Waiting on machineMu here would never end: the fetch can't settle
+	// until this returns. The machine is mid-read, so what needs it
+	// between instructions is refused
+	if got := statusOf(e.call(snapshotEmulator)); got != string(codeBusy) {
+		t.Errorf("tinyemuSnapshot during a fetch = %s, want busy", got)
+	}
+	if got := statusOf(e.call(restoreEmulator, bytesToJS([]byte("snapshot")))); got != string(codeBusy) {
+		t.Errorf("tinyemuRestore during a fetch = %s, want busy", got)
+	}
+	if got := statusOf(e.call(readRegisters)); got != string(codeBusy) {
+		t.Errorf("tinyemuReadRegisters during a fetch = %s, want busy", got)
+	}
+	e.call(pauseEmulator)
+	if got := statusOf(e.call(stepEmulator)); got != string(codeBusy) {
+		t.Errorf("tinyemuStep during a fetch = %s, want busy", got)
+	}
+
+	// Once settled the read completes and the step finishes
+	f.settle()
+	deadline := time.Now().Add(time.Second)
+	for e.parked.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("the step stayed parked after its fetch settled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+	if m.err != nil || !bytes.Equal(m.read, bytes.Repeat([]byte{testLazyBlock / sectorSize}, sectorSize)) {
+		t.Errorf("machine read %v, err %v; want sector 8 of the image", m.read[:4], m.err)
+	}
+}
+
+func TestStopGivesUpOnAPendingFetch(t *testing.T) {
+	e, m, _ := parkedOnFetch(t)
+	if got := statusOf(e.call(stopEmulator)); got != string(statusStopped) {
+		t.Fatalf("tinyemuStop during a fetch = %s, want stopped", got)
+	}
+	if m.err == nil {
+		t.Errorf("the given up read succeeded")
+	}
+	if e.parked.Load() {
+		t.Errorf("still parked after stop")
+	}
+}
+
+func TestSyncDuringAStepDoesntTakeTheMachine(t *testing.T) {
+	f := newRangeFetch(t, diskImage(2*testLazyBlock/sectorSize), true)
+	e, _ := newTestEmulator(t, nil)
+	attachTestLazyDisk(t, e, f, 2)
+	store := newBlockStore(t)
+	if got := statusOf(e.call(enablePersistence, "test-db", store.fn)); got != string(statusPersistenceEnabled) {
+		t.Fatalf("tinyemuEnablePersistence = %s", got)
+	}
+	pd := e.disks[0].(*persistentDisk)
+
+	// A step is in progress when the flush has to fetch a dirty block
+	e.machineMu.Lock()
+	e.stepCtx = context.Background()
+	pd.mu.Lock()
+	pd.dirty[1] = struct{}{}
+	pd.mu.Unlock()
+	synced := make(chan int)
+	go func() { synced <- pd.Sync() }()
+	<-f.fetched
+
+	time.Sleep(10 * time.Millisecond)
+	if e.parked.Load() {
+		t.Errorf("the flush's fetch parked the step")
+	}
+	if e.machineMu.TryLock() {
+		e.machineMu.Unlock()
+		t.Errorf("the flush's fetch let go of the step's machineMu")
+	}
+	f.settle()
+	if n := <-synced; n != 1 {
+		t.Errorf("Sync reported %d blocks, want 1", n)
+	}
+	e.stepCtx = nil
+	e.machineMu.Unlock()
+}
+
+func TestConcurrentReadsShareAFetch(t *testing.T) {
+	image := diskImage(2 * testLazyBlock / sectorSize)
+	f := newRangeFetch(t, image, true)
+	e, _ := newTestEmulator(t, nil)
+	d := attachTestLazyDisk(t, e, f, 2)
+
+	const readers = 3
+	reads := make(chan []byte, readers)
+	for i := 0; i < readers; i++ {
+		go func() {
+			buf := make([]byte, sectorSize)
+			if _, err := d.ReadAt(buf, testLazyBlock); err != nil {
+				t.Errorf("read: %v", err)
+			}
+			reads <- buf
+		}()
+	}
+	<-f.fetched
+	time.Sleep(10 * time.Millisecond)
+
+	// Settle whatever was fetched until every reader is done
+	want := image[testLazyBlock : testLazyBlock+sectorSize]
+	deadline := time.After(time.Second)
+	for i := 0; i < readers; {
+		f.settle()
+		select {
+		case got := <-reads:
+			if !bytes.Equal(got, want) {
+				t.Errorf("a reader got %v, want sector 8 of the image", got[:4])
+			}
+			i++
+		case <-time.After(time.Millisecond):
+		case <-deadline:
+			t.Fatalf("%d of %d reads didn't return", readers-i, readers)
+		}
+	}
+	if got, want := f.requested(), []string{"4096+4096"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fetched %v, want block 1 once %v", got, want)
+	}
+	if len(d.fetching) != 0 {
+		t.Errorf("%d fetches still in flight", len(d.fetching))
+	}
+}
@@ -0,0 +1,130 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"sync"
+	"syscall/js"
+	"unicode/utf8"
+)
+
+// lineDiscipline implements cooked input: typed characters are echoed and
+// collected locally, backspace edits the pending line, and the guest only
+// sees the line once Enter is pressed. In raw mode input passes through.
+type lineDiscipline struct {
+	mu     sync.Mutex
+	cooked bool
+	line   []byte
+}
+
+// setCooked switches modes. Leaving cooked mode returns the unsent line so
+// the caller can hand it to the guest rather than lose it.
+func (l *lineDiscipline) setCooked(cooked bool) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cooked = cooked
+	if cooked {
+		return nil
+	}
+	pending := l.line
+	l.line = nil
+	return pending
+}
+
+// clear drops the line being edited and returns its length.
+func (l *lineDiscipline) clear() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := len(l.line)
+	l.line = l.line[:0]
+	return n
+}
+
+func (l *lineDiscipline) isCooked() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cooked
+}
+
+// process runs data through the discipline and returns what the guest
+// should receive now and what to echo to the console.
+func (l *lineDiscipline) process(data []byte) (out, echo []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.cooked {
+		return data, nil
+	}
+	// Escape sequences come from special keys and mean nothing to a line
+	// editor, so send them on untouched
+	if len(data) > 0 && data[0] == 0x1b {
+		return data, nil
+	}
+
+	for _, b := range data {
+		switch {
+		case b == '\r' || b == '\n':
+			echo = append(echo, '\r', '\n')
+			out = append(out, l.line...)
+			out = append(out, '\n')
+			l.line = l.line[:0]
+		case b == 0x7f || b == '\b':
+			// Stop at the start of the line so the prompt survives
+			if len(l.line) == 0 {
+				continue
+			}
+			_, size := utf8.DecodeLastRune(l.line)
+			l.line = l.line[:len(l.line)-size]
+			echo = append(echo, '\b', ' ', '\b')
+		case b < 0x20 && b != '\t':
+			// Other control characters such as ^C act immediately
+			out = append(out, b)
+		default:
+			l.line = append(l.line, b)
+			echo = append(echo, b)
+		}
+	}
+	return out, echo
+}
+
+// feedInput is the entry point for all console input from JavaScript.
+func (e *Emulator) feedInput(data []byte) error {
+	e.recorder.input(data)
+	out, echo := e.line.process(data)
+	if len(echo) > 0 {
+		e.writer.Write(echo)
+	}
+	return e.reader.Write(out)
+}
+
+// setCooked switches console0 input between cooked and raw, handing the
+// guest a line left unsent by cooked mode.
+func (e *Emulator) setCooked(cooked bool) {
+	if pending := e.line.setCooked(cooked); len(pending) > 0 {
+		e.reader.Write(pending)
+	}
+}
+
+// setLineMode switches between "cooked" line editing and "raw" pass-through.
+func setLineMode(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	mode, err := stringArg(args, 0, "mode")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	switch mode {
+	case "cooked":
+		e.setCooked(true)
+	case "raw":
+		e.setCooked(false)
+	default:
+		return errResult(codeInvalidArgument, "unknown line mode "+mode+", want \"cooked\" or \"raw\"")
+	}
+	return statusResult(statusLineModeSet, map[string]interface{}{"mode": mode})
+}
@@ -0,0 +1,69 @@
+//go:build js && wasm
+
+package main
+
+import "testing"
+
+// typeKeys sends each chunk as its own tinyemuSendInput, as keystrokes
+// arrive, and returns what was echoed and what the guest got.
+func typeKeys(t *testing.T, e *Emulator, rec *outputRecorder, chunks ...string) (echo, guest string) {
+	t.Helper()
+	before := len(rec.text())
+	for _, c := range chunks {
+		if r := e.call(sendInput, c).(map[string]interface{}); failed(r) {
+			t.Fatalf("tinyemuSendInput(%q): %v", c, r["error"])
+		}
+	}
+	e.writer.Flush()
+	defer e.reader.Clear()
+	return rec.text()[before:], string(e.reader.Pending())
+}
+
+func TestCookedModeEditsTheLine(t *testing.T) {
+	e, rec := newTestEmulator(t, nil)
+	if got := statusOf(e.call(setLineMode, "cooked")); got != string(statusLineModeSet) {
+		t.Fatalf("tinyemuSetLineMode = %s", got)
+	}
+
+	tests := []struct {
+		name      string
+		keys      []string
+		echo, out string
+	}{
+		{"typing", []string{"l", "s"}, "ls", ""},
+		{"enter", []string{"\r"}, "\r\n", "ls\n"},
+		{"backspace", []string{"c", "d", "x", "\x7f", "\r"}, "cdx\b \b\r\n", "cd\n"},
+		{"backspace at column zero", []string{"\x7f", "\x7f", "p", "\r"}, "p\r\n", "p\n"},
+		{"backspace over a wide rune", []string{"café", "\b", "e\n"}, "café\b \be\r\n", "cafe\n"},
+		{"control keys act at once", []string{"sl", "\x03"}, "sl", "\x03"},
+		{"escape sequences pass through", []string{"\x1b[A"}, "", "\x1b[A"},
+		{"the line left by ^C", []string{"echo hi\rls\r"}, "echo hi\r\nls\r\n", "slecho hi\nls\n"},
+	}
+	for _, tt := range tests {
+		echo, out := typeKeys(t, e, rec, tt.keys...)
+		if echo != tt.echo || out != tt.out {
+			t.Errorf("%s: echoed %q and sent %q, want %q and %q", tt.name, echo, out, tt.echo, tt.out)
+		}
+	}
+}
+
+func TestRawModePassesThrough(t *testing.T) {
+	e, rec := newTestEmulator(t, nil)
+	keys := []string{"l", "s", "\x7f", "\r", "\x03"}
+	if echo, out := typeKeys(t, e, rec, keys...); echo != "" || out != "ls\x7f\r\x03" {
+		t.Errorf("raw mode echoed %q and sent %q", echo, out)
+	}
+
+	// Leaving cooked mode hands over the unfinished line
+	e.call(setLineMode, "cooked")
+	typeKeys(t, e, rec, "unfinished")
+	if got := statusOf(e.call(setLineMode, "raw")); got != string(statusLineModeSet) {
+		t.Fatalf("tinyemuSetLineMode(raw) = %s", got)
+	}
+	if got := string(e.reader.Pending()); got != "unfinished" {
+		t.Errorf("switching to raw sent %q, want the pending line", got)
+	}
+	if got := statusOf(e.call(setLineMode, "canonical")); got != string(codeInvalidArgument) {
+		t.Errorf("tinyemuSetLineMode(canonical) = %s, want invalid_argument", got)
+	}
+}
@@ -0,0 +1,120 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"syscall/js"
+)
+
+// loadSet tracks an instance's in-flight URL loads so they can be
+// canceled by id.
+type loadSet struct {
+	mu     sync.Mutex
+	next   int
+	active map[int]context.CancelFunc
+}
+
+// begin registers a new load and returns its context and id.
+func (s *loadSet) begin() (context.Context, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		s.active = make(map[int]context.CancelFunc)
+	}
+	s.next++
+	ctx, cancel := context.WithCancel(context.Background())
+	s.active[s.next] = cancel
+	return ctx, s.next
+}
+
+// finish forgets load id, reporting false if it was canceled first. What
+// a canceled load produced must then be thrown away.
+func (s *loadSet) finish(id int) bool {
+	return s.cancel(id)
+}
+
+// cancel aborts load id, reporting whether it was still in flight.
+func (s *loadSet) cancel(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cancel, ok := s.active[id]
+	if ok {
+		delete(s.active, id)
+		cancel()
+	}
+	return ok
+}
+
+// cancelAll aborts every load in flight and returns how many there were.
+func (s *loadSet) cancelAll() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.active)
+	for id, cancel := range s.active {
+		delete(s.active, id)
+		cancel()
+	}
+	return n
+}
+
+// canceledLoad is the result a canceled load's Promise resolves with.
+func canceledLoad(id int) map[string]interface{} {
+	return statusResult(statusCanceled, map[string]interface{}{"loadId": id})
+}
+
+// abortSignal returns an AbortSignal that fires once ctx is done, or
+// undefined where AbortController is missing. fetch then rejects at once
+// instead of finishing the download.
+func abortSignal(ctx context.Context) js.Value {
+	ctor := js.Global().Get("AbortController")
+	if ctor.Type() != js.TypeFunction {
+		return js.Undefined()
+	}
+	controller := ctor.New()
+	go func() {
+		<-ctx.Done()
+		controller.Call("abort")
+	}()
+	return controller.Get("signal")
+}
+
+// contextReader stops reading r with ctx's error once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// cancelLoad aborts the URL load whose Promise carries the given loadId,
+// or every load of the instance without one. The load's Promise resolves
+// with status "canceled" and nothing is staged.
+func cancelLoad(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 1)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !present(args, 0) {
+		n := e.loads.cancelAll()
+		return statusResult(statusCanceled, map[string]interface{}{"canceled": n})
+	}
+	id, err := intArg(args, 0, "load id")
+	if err != nil {
+		return errorResult(err)
+	}
+	if !e.loads.cancel(id) {
+		return statusResult(statusNotLoading, map[string]interface{}{"loadId": id})
+	}
+	return statusResult(statusCanceled, map[string]interface{}{"loadId": id})
+}
@@ -0,0 +1,96 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// useFetch replaces the global fetch with one resolving to resp until the
+// test ends.
+func useFetch(t *testing.T, resp js.Value) {
+	saved := js.Global().Get("fetch")
+	fetch := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return js.Global().Get("Promise").Call("resolve", resp)
+	})
+	js.Global().Set("fetch", fetch)
+	t.Cleanup(func() {
+		js.Global().Set("fetch", saved)
+		fetch.Release()
+	})
+}
+
+// slowChunks returns n chunks of size bytes for mockResponse.
+func slowChunks(n, size int) []interface{} {
+	chunks := make([]interface{}, n)
+	for i := range chunks {
+		chunks[i] = bytesToJS(make([]byte, size))
+	}
+	return chunks
+}
+
+func TestCancelLoadStopsTheDownload(t *testing.T) {
+	useFetch(t, mockResponse.Invoke(slowChunks(40, 1000), "40000", 25))
+	e, _ := newTestEmulator(t, nil)
+	staged := e.kernel
+	onProgress, reports := progressRecorder(t)
+	promise := e.call(loadKernelFromURL, "https://example.com/kernel", map[string]interface{}{"onProgress": onProgress}).(js.Value)
+	id := promise.Get("loadId").Int()
+
+	time.Sleep(150 * time.Millisecond)
+	if got := statusOf(e.call(cancelLoad, id)); got != string(statusCanceled) {
+		t.Fatalf("tinyemuCancelLoad = %s, want canceled", got)
+	}
+	v, fulfilled := awaitSettled(t, promise)
+	if !fulfilled || v.Get("status").String() != string(statusCanceled) || v.Get("loadId").Int() != id {
+		t.Fatalf("canceled load settled with %v, fulfilled %v; want {status: canceled, loadId: %d}", js.Global().Get("JSON").Call("stringify", v), fulfilled, id)
+	}
+
+	// Nothing more is read, and nothing is staged
+	n := len(*reports)
+	time.Sleep(150 * time.Millisecond)
+	if len(*reports) != n {
+		t.Errorf("%d more progress reports after the cancel", len(*reports)-n)
+	}
+	if n > 0 && (*reports)[n-1].done >= 40000 {
+		t.Errorf("download got to %v bytes, want it stopped short", (*reports)[n-1].done)
+	}
+	if e.kernel != staged {
+		t.Error("a canceled load staged its kernel")
+	}
+	if got := statusOf(e.call(cancelLoad, id)); got != string(statusNotLoading) {
+		t.Errorf("canceling it again = %s, want not_loading", got)
+	}
+}
+
+func TestCancelLoadWithoutIdCancelsAll(t *testing.T) {
+	useFetch(t, mockResponse.Invoke(slowChunks(40, 1000), "40000", 25))
+	e, _ := newTestEmulator(t, nil)
+	var promises []js.Value
+	for i := 0; i < 2; i++ {
+		promises = append(promises, e.call(loadKernelFromURL, "https://example.com/kernel", map[string]interface{}{"onProgress": js.Global().Get("Function").New("")}).(js.Value))
+	}
+
+	result := e.call(cancelLoad, js.Undefined()).(map[string]interface{})
+	if statusOf(result) != string(statusCanceled) || result["data"].(map[string]interface{})["canceled"] != 2 {
+		t.Errorf("tinyemuCancelLoad() = %v, want 2 canceled", result)
+	}
+	for i, promise := range promises {
+		if v, _ := awaitSettled(t, promise); v.Get("status").String() != string(statusCanceled) {
+			t.Errorf("load %d settled with status %v, want canceled", i, v.Get("status"))
+		}
+	}
+}
+
+func TestCanceledContextStopsDecompression(t *testing.T) {
+	gz := gzipBytes(t, bytes.Repeat([]byte("kernel"), 1<<16))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := decompressImage(ctx, gz, "gzip", js.Undefined()); err == nil {
+		t.Error("decompression ran to the end on a canceled context")
+	}
+}
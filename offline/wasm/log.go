@@ -0,0 +1,220 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall/js"
+	"time"
+)
+
+// logLevel orders log messages by severity; a logger passes messages at or
+// below its level.
+type logLevel int32
+
+const (
+	logError logLevel = iota
+	logWarn
+	logInfo
+	logDebug
+)
+
+var logLevelNames = [...]string{"error", "warn", "info", "debug"}
+
+func (l logLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// parseLogLevel maps a level name to its logLevel.
+func parseLogLevel(name string) (logLevel, error) {
+	for i, n := range logLevelNames {
+		if n == name {
+			return logLevel(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, want error, warn, info or debug", name)
+}
+
+// Log formats for the logFormat option.
+const (
+	// logText writes "[level] message key=value ..." lines
+	logText = "text"
+	// logJSON writes one {level, msg, time, fields} object per line, for
+	// CI to parse
+	logJSON = "json"
+)
+
+// logFields is context attached to a log record, such as an instruction
+// count or a device id.
+type logFields map[string]interface{}
+
+// logRecord is a log message as the JSON format writes it.
+type logRecord struct {
+	Level  string    `json:"level"`
+	Msg    string    `json:"msg"`
+	Time   string    `json:"time"`
+	Fields logFields `json:"fields,omitempty"`
+}
+
+// logger writes level-tagged lines to a JS callback, or to the console if
+// there is none. Disabled levels return before formatting.
+type logger struct {
+	level    atomic.Int32
+	callback js.Value
+
+	// format is logText or logJSON. clock stamps JSON records; nil means
+	// the wall clock.
+	format string
+	clock  clock
+}
+
+func newLogger(level logLevel, callback js.Value) *logger {
+	l := &logger{callback: callback, format: logText}
+	l.level.Store(int32(level))
+	return l
+}
+
+// logFormatOption reads the logFormat option.
+func logFormatOption(v js.Value) (string, error) {
+	format := v.Get("logFormat")
+	if format.IsUndefined() || format.IsNull() {
+		return logText, nil
+	}
+	if format.Type() != js.TypeString {
+		return "", fmt.Errorf("logFormat must be a string, got %s", format.Type())
+	}
+	switch format.String() {
+	case logText, logJSON:
+		return format.String(), nil
+	}
+	return "", fmt.Errorf("unknown log format %q, want %q or %q", format.String(), logText, logJSON)
+}
+
+// defaultLogger covers messages that don't belong to an instance.
+var defaultLogger = newLogger(logInfo, js.Undefined())
+
+func (l *logger) setLevel(level logLevel) {
+	l.level.Store(int32(level))
+}
+
+func (l *logger) enabled(level logLevel) bool {
+	return level <= logLevel(l.level.Load())
+}
+
+func (l *logger) logf(level logLevel, fields logFields, format string, args ...interface{}) {
+	if !l.enabled(level) {
+		return
+	}
+	line := l.formatLine(level, fields, fmt.Sprintf(format, args...))
+	if l.callback.Type() == js.TypeFunction {
+		l.callback.Invoke(line, level.String())
+		return
+	}
+	if l.format == logJSON {
+		fmt.Println(line)
+		return
+	}
+	fmt.Println("TinyEMU", line)
+}
+
+// formatLine renders one record in the logger's format.
+func (l *logger) formatLine(level logLevel, fields logFields, msg string) string {
+	if l.format == logJSON {
+		var now time.Time
+		if l.clock != nil {
+			now = l.clock.Now()
+		} else {
+			now = time.Now()
+		}
+		b, err := json.Marshal(logRecord{
+			Level:  level.String(),
+			Msg:    msg,
+			Time:   now.UTC().Format(time.RFC3339Nano),
+			Fields: fields,
+		})
+		if err == nil {
+			return string(b)
+		}
+		// A field that can't be encoded must not lose the message
+		b, _ = json.Marshal(logRecord{Level: level.String(), Msg: msg, Time: now.UTC().Format(time.RFC3339Nano)})
+		return string(b)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[" + level.String() + "] " + msg)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, " %s=%v", k, fields[k])
+	}
+	return sb.String()
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) { l.logf(logError, nil, format, args...) }
+func (l *logger) Warnf(format string, args ...interface{})  { l.logf(logWarn, nil, format, args...) }
+func (l *logger) Infof(format string, args ...interface{})  { l.logf(logInfo, nil, format, args...) }
+func (l *logger) Debugf(format string, args ...interface{}) { l.logf(logDebug, nil, format, args...) }
+
+// with returns l with fields attached to every record written through it.
+func (l *logger) with(fields logFields) logEntry {
+	return logEntry{l: l, fields: fields}
+}
+
+// logEntry is a logger with fields, from logger.with.
+type logEntry struct {
+	l      *logger
+	fields logFields
+}
+
+func (e logEntry) Errorf(format string, args ...interface{}) {
+	e.l.logf(logError, e.fields, format, args...)
+}
+func (e logEntry) Warnf(format string, args ...interface{}) {
+	e.l.logf(logWarn, e.fields, format, args...)
+}
+func (e logEntry) Infof(format string, args ...interface{}) {
+	e.l.logf(logInfo, e.fields, format, args...)
+}
+func (e logEntry) Debugf(format string, args ...interface{}) {
+	e.l.logf(logDebug, e.fields, format, args...)
+}
+
+// runFields is the context of the current run that records about the
+// guest carry.
+func (e *Emulator) runFields() logFields {
+	instret, uptime, _ := e.stats.counters()
+	return logFields{
+		"instructions": instret,
+		"uptimeMs":     uptime.Milliseconds(),
+		"state":        e.getState(),
+	}
+}
+
+// setLogLevel changes an instance's log verbosity at runtime.
+func setLogLevel(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	name, err := stringArg(args, 0, "level")
+	if err != nil {
+		return errorResult(err)
+	}
+	level, err := parseLogLevel(name)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.log.setLevel(level)
+	return statusResult(statusLogLevelSet, map[string]interface{}{"level": level.String()})
+}
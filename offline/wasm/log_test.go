@@ -0,0 +1,179 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// logRecorder is an onLog callback that keeps its (line, level) calls.
+type logRecorder struct {
+	fn    js.Func
+	lines []string
+}
+
+func newLogRecorder(t *testing.T) *logRecorder {
+	rec := &logRecorder{}
+	rec.fn = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		rec.lines = append(rec.lines, args[1].String()+"|"+args[0].String())
+		return nil
+	})
+	t.Cleanup(rec.fn.Release)
+	return rec
+}
+
+// logAll writes one message at every level.
+func logAll(l *logger) {
+	l.Errorf("disk %s", "gone")
+	l.Warnf("slow tick")
+	l.Infof("booted in %dms", 12)
+	l.Debugf("step %d", 7)
+}
+
+func TestLogLevelsSuppressAndTag(t *testing.T) {
+	rec := newLogRecorder(t)
+	l := newLogger(logWarn, rec.fn.Value)
+	logAll(l)
+	want := []string{"error|[error] disk gone", "warn|[warn] slow tick"}
+	if !reflect.DeepEqual(rec.lines, want) {
+		t.Errorf("at warn, callback got %q, want %q", rec.lines, want)
+	}
+
+	rec.lines = nil
+	l.setLevel(logDebug)
+	logAll(l)
+	want = []string{"error|[error] disk gone", "warn|[warn] slow tick", "info|[info] booted in 12ms", "debug|[debug] step 7"}
+	if !reflect.DeepEqual(rec.lines, want) {
+		t.Errorf("at debug, callback got %q, want %q", rec.lines, want)
+	}
+
+	rec.lines = nil
+	l.setLevel(logError)
+	l.with(logFields{"state": "running", "instructions": 3}).Errorf("crashed")
+	if want := []string{"error|[error] crashed instructions=3 state=running"}; !reflect.DeepEqual(rec.lines, want) {
+		t.Errorf("fields came out as %q, want %q", rec.lines, want)
+	}
+}
+
+// formatCounter counts how often it is formatted.
+type formatCounter int
+
+func (c *formatCounter) String() string {
+	*c++
+	return "counted"
+}
+
+func TestDisabledLevelSkipsFormatting(t *testing.T) {
+	l := newLogger(logInfo, newLogRecorder(t).fn.Value)
+	var c formatCounter
+	l.Debugf("value %v", &c)
+	l.with(logFields{"k": 1}).Debugf("value %v", &c)
+	if c != 0 {
+		t.Errorf("a disabled level formatted its arguments %d times", c)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { l.Debugf("step %d", 7) }); allocs != 0 {
+		t.Errorf("a disabled Debugf made %v allocations", allocs)
+	}
+	l.Infof("value %v", &c)
+	if c != 1 {
+		t.Errorf("an enabled level formatted its arguments %d times, want once", c)
+	}
+}
+
+func TestSetLogLevelAtRuntime(t *testing.T) {
+	rec := newLogRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onLog": rec.fn})
+	rec.lines = nil
+	e.log.Debugf("hidden")
+	if len(rec.lines) != 0 {
+		t.Errorf("debug logged at the default level: %q", rec.lines)
+	}
+
+	if got := statusOf(e.call(setLogLevel, "debug")); got != string(statusLogLevelSet) {
+		t.Fatalf("tinyemuSetLogLevel = %s", got)
+	}
+	e.log.Debugf("shown")
+	if want := []string{"debug|[debug] shown"}; !reflect.DeepEqual(rec.lines, want) {
+		t.Errorf("after tinyemuSetLogLevel(debug) got %q, want %q", rec.lines, want)
+	}
+	for _, bad := range []interface{}{"verbose", 3} {
+		if got := statusOf(e.call(setLogLevel, bad)); got != string(codeInvalidArgument) {
+			t.Errorf("tinyemuSetLogLevel(%v) = %s, want invalid_argument", bad, got)
+		}
+	}
+}
+
+func TestJSONLogRecords(t *testing.T) {
+	rec := newLogRecorder(t)
+	l := newLogger(logInfo, rec.fn.Value)
+	l.format = logJSON
+	l.clock = &manualClock{now: virtualEpoch}
+	l.with(logFields{"device": "vda"}).Warnf("read %d failed", 9)
+
+	var got logRecord
+	if len(rec.lines) != 1 || json.Unmarshal([]byte(rec.lines[0][len("warn|"):]), &got) != nil {
+		t.Fatalf("callback got %q, want one JSON record", rec.lines)
+	}
+	want := logRecord{Level: "warn", Msg: "read 9 failed", Time: "2000-01-01T00:00:00Z", Fields: logFields{"device": "vda"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("record = %+v, want %+v", got, want)
+	}
+}
+
+func TestLogFormatOption(t *testing.T) {
+	rec := newLogRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onLog": rec.fn, "logFormat": "json", "logLevel": "debug"})
+	rec.lines = nil
+	logAll(e.log)
+	e.log.with(e.runFields()).Warnf("guest stalled")
+	// A field JSON can't hold still leaves the message
+	e.log.with(logFields{"ch": make(chan int)}).Errorf("odd field")
+
+	wantMsgs := []string{"error|disk gone", "warn|slow tick", "info|booted in 12ms", "debug|step 7", "warn|guest stalled", "error|odd field"}
+	if len(rec.lines) != len(wantMsgs) {
+		t.Fatalf("callback got %d lines, want %d: %q", len(rec.lines), len(wantMsgs), rec.lines)
+	}
+	for i, line := range rec.lines {
+		level, text, _ := strings.Cut(line, "|")
+		var got logRecord
+		if strings.Contains(text, "\n") || json.Unmarshal([]byte(text), &got) != nil {
+			t.Errorf("line %d isn't a single line JSON record: %q", i, text)
+			continue
+		}
+		if got.Level+"|"+got.Msg != wantMsgs[i] || got.Level != level {
+			t.Errorf("record %d is %s %q at callback level %s, want %s", i, got.Level, got.Msg, level, wantMsgs[i])
+		}
+		if _, err := time.Parse(time.RFC3339Nano, got.Time); err != nil {
+			t.Errorf("record %d time %q: %v", i, got.Time, err)
+		}
+	}
+	var stalled logRecord
+	json.Unmarshal([]byte(rec.lines[4][len("warn|"):]), &stalled)
+	for _, k := range []string{"instructions", "uptimeMs", "state"} {
+		if _, ok := stalled.Fields[k]; !ok {
+			t.Errorf("run fields %v lack %s", stalled.Fields, k)
+		}
+	}
+
+	// Plain text comes out as it did before the option
+	rec = newLogRecorder(t)
+	e, _ = newTestEmulator(t, map[string]interface{}{"onLog": rec.fn, "logFormat": "text", "logLevel": "debug"})
+	rec.lines = nil
+	logAll(e.log)
+	e.log.with(logFields{"device": "vda"}).Infof("read")
+	want := []string{"error|[error] disk gone", "warn|[warn] slow tick", "info|[info] booted in 12ms", "debug|[debug] step 7", "info|[info] read device=vda"}
+	if !reflect.DeepEqual(rec.lines, want) {
+		t.Errorf("text format got %q, want %q", rec.lines, want)
+	}
+
+	for _, bad := range []interface{}{"xml", 1} {
+		if msg := initError(t, map[string]interface{}{"logFormat": bad}); !strings.Contains(msg, "log") {
+			t.Errorf("logFormat %v: error %q isn't about the log format", bad, msg)
+		}
+	}
+}
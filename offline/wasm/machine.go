@@ -0,0 +1,184 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// machine is the emulated system driven by the run loop. The TinyEMU core
+// will implement it; until that lands, placeholderMachine stands in.
+type machine interface {
+	// Step executes up to n instructions and returns how many retired.
+	Step(n int) int
+	// Booted reports whether the boot sequence has finished.
+	Booted() bool
+}
+
+// Console devices the tinyemuInit consoleDevice option can bind console0
+// to: the 16550 UART guests see as ttyS0, or the virtio console, hvc0.
+const (
+	consoleUART   = "uart"
+	consoleVirtio = "virtio"
+)
+
+// machineConsoleDevices lists the console devices the machine provides.
+var machineConsoleDevices = []string{consoleUART, consoleVirtio}
+
+// consoleTTY returns the guest device name of a console device.
+func consoleTTY(device string) string {
+	if device == consoleVirtio {
+		return "hvc0"
+	}
+	return "ttyS0"
+}
+
+// machineConfig collects everything staged from JavaScript for the next boot.
+type machineConfig struct {
+	console io.Writer
+	// Device console and the input queue are wired to, consoleUART or
+	// consoleVirtio
+	consoleDevice string
+	consoles      map[string]consolePort // extra consoles by id
+	messages      consolePort            // the virtio-serial message port
+	ramSizeMB     int
+	cores         int // harts, sharing ram
+	isa           cpuISA
+	ram           []byte
+	kernel        *kernelImage
+	bootMethod    string // bootDirectKernel or bootFirmware
+	firmware      []byte // run first under bootFirmware
+	dtb           []byte // nil to generate one from the config
+	cmdline       string
+	initrd        []byte
+	disks         [maxDisks]blockBackend // by index, nil where unset
+	winsize       winsize
+	exitPort      *exitPort // nil unless enabled
+	rtc           rtcSource
+
+	// Devices must take time and randomness from these, never from the
+	// time or math/rand packages, so deterministic runs reproduce.
+	clock clock
+	rand  *rand.Rand
+}
+
+// newMachine builds the machine a run boots. It is a variable so tests can
+// boot machines of their own.
+var newMachine = func(config machineConfig) machine {
+	return newPlaceholderMachine(config)
+}
+
+// placeholderMachine prints a short boot banner, one line per step, and
+// then idles. It exists to exercise the lifecycle plumbing from JavaScript.
+type placeholderMachine struct {
+	config machineConfig
+	banner []string
+	next   int
+}
+
+func newPlaceholderMachine(config machineConfig) *placeholderMachine {
+	m := &placeholderMachine{
+		config: config,
+		banner: []string{
+			"TinyEMU starting...\n",
+			fmt.Sprintf("Memory: %d MB\n", config.ramSizeMB),
+			fmt.Sprintf("Harts: %d\n", config.cores),
+			fmt.Sprintf("ISA: %s\n", config.isa),
+			fmt.Sprintf("Console: %s (%s)\n", consoleTTY(config.consoleDevice), config.consoleDevice),
+			fmt.Sprintf("virtio-serial port: %s\n", messagePortName),
+		},
+	}
+	if config.rtc != nil {
+		m.banner = append(m.banner, fmt.Sprintf("RTC: %s\n", config.rtc.Now().UTC().Format(time.RFC3339)))
+	}
+	if config.bootMethod == bootFirmware {
+		m.banner = append(m.banner, fmt.Sprintf("Firmware: %d bytes\n", len(config.firmware)))
+	}
+	if k := config.kernel; k != nil {
+		m.banner = append(m.banner, fmt.Sprintf("Kernel: %d bytes (%s)\n", len(k.data), k.format))
+	}
+	if config.dtb != nil {
+		m.banner = append(m.banner, fmt.Sprintf("Device tree: %d bytes (supplied)\n", len(config.dtb)))
+	} else {
+		m.banner = append(m.banner, "Device tree: generated\n")
+	}
+	if config.cmdline != "" {
+		m.banner = append(m.banner, fmt.Sprintf("Kernel command line: %s\n", config.cmdline))
+	}
+	if config.initrd != nil {
+		m.banner = append(m.banner, fmt.Sprintf("Initrd: %d bytes\n", len(config.initrd)))
+	}
+	for i, disk := range config.disks {
+		if disk == nil {
+			continue
+		}
+		mode := "rw"
+		if disk.ReadOnly() {
+			mode = "ro"
+		}
+		m.banner = append(m.banner, fmt.Sprintf("virtio-blk %s: %d sectors (%s)\n", diskName(i), disk.Size()/sectorSize, mode))
+	}
+	if config.bootMethod == bootFirmware {
+		m.banner = append(m.banner, "Boot: firmware, kernel handed over by firmware\n")
+	} else {
+		m.banner = append(m.banner, "Boot: direct kernel jump\n")
+	}
+	m.banner = append(m.banner, "Boot sequence would start here\n")
+	return m
+}
+
+func (m *placeholderMachine) Step(n int) int {
+	if m.next == 0 {
+		for id, port := range m.config.consoles {
+			fmt.Fprintf(port.out, "TinyEMU %s ready\n", id)
+		}
+	}
+	if m.next < len(m.banner) {
+		m.config.console.Write([]byte(m.banner[m.next]))
+		m.next++
+	}
+	return n
+}
+
+// Harts returns the configured core count. Only hart 0 does anything: it
+// owns the console and prints the banner, and the others idle.
+func (m *placeholderMachine) Harts() int {
+	return max(1, m.config.cores)
+}
+
+func (m *placeholderMachine) StepHart(hart, n int) int {
+	if hart == 0 {
+		return m.Step(n)
+	}
+	return n
+}
+
+func (m *placeholderMachine) Booted() bool {
+	return m.next >= len(m.banner)
+}
+
+// Resize records the size a TTY ioctl would report.
+func (m *placeholderMachine) Resize(ws winsize) {
+	m.config.winsize = ws
+}
+
+func (m *placeholderMachine) MarshalState() ([]byte, error) {
+	return binary.BigEndian.AppendUint32(nil, uint32(m.next)), nil
+}
+
+func (m *placeholderMachine) UnmarshalState(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("corrupt placeholder machine state")
+	}
+	next := int(binary.BigEndian.Uint32(data))
+	if next > len(m.banner) {
+		return errors.New("corrupt placeholder machine state")
+	}
+	m.next = next
+	return nil
+}
@@ -0,0 +1,91 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+// deviceMachine has both console devices, and echoes input read on each
+// tagged with the device's name. Only the one config.consoleDevice names
+// is wired to console0; the other reads nothing and writes nowhere.
+type deviceMachine struct {
+	devices map[string]consolePort
+}
+
+func (m *deviceMachine) Step(n int) int {
+	p := make([]byte, 64)
+	for name, port := range m.devices {
+		if k, _ := port.in.Read(p); k > 0 {
+			fmt.Fprintf(port.out, "%s:%s\n", name, p[:k])
+		}
+	}
+	return n
+}
+
+func (m *deviceMachine) Booted() bool { return true }
+
+func TestConsoleDeviceIsTheOneWired(t *testing.T) {
+	for _, device := range machineConsoleDevices {
+		var e *Emulator
+		var config machineConfig
+		useMachine(t, func(c machineConfig) machine {
+			config = c
+			m := &deviceMachine{devices: map[string]consolePort{}}
+			for _, name := range machineConsoleDevices {
+				m.devices[name] = consolePort{out: io.Discard, in: NewConsoleReader()}
+			}
+			m.devices[c.consoleDevice] = consolePort{out: c.console, in: e.reader}
+			return m
+		})
+		e, rec := newTestEmulator(t, map[string]interface{}{"consoleDevice": device})
+		e.call(startEmulator)
+		waitState(t, e, stateRunning)
+		if config.consoleDevice != device {
+			t.Errorf("option %q: machine built with console device %q", device, config.consoleDevice)
+		}
+
+		e.call(sendInput, "hi")
+		if got, want := waitOutput(t, rec, 0), device+":hi\n"; got != want {
+			t.Errorf("option %q: console0 got %q, want %q", device, got, want)
+		}
+	}
+}
+
+func TestConsoleDeviceDefaultsToTheUART(t *testing.T) {
+	for _, tt := range []struct {
+		opts   map[string]interface{}
+		banner string
+	}{
+		{nil, "Console: ttyS0 (uart)\n"},
+		{map[string]interface{}{"consoleDevice": "virtio"}, "Console: hvc0 (virtio)\n"},
+	} {
+		e, _ := newTestEmulator(t, tt.opts)
+		m := newPlaceholderMachine(e.stagedConfig())
+		if !strings.Contains(strings.Join(m.banner, ""), tt.banner) {
+			t.Errorf("options %v: banner %q doesn't name %q", tt.opts, m.banner, tt.banner)
+		}
+	}
+}
+
+func TestUnknownConsoleDeviceIsRefused(t *testing.T) {
+	for _, device := range []interface{}{"hvc0", "UART", "", 1} {
+		result := initEmulator(js.Undefined(), []js.Value{newOutputRecorder(t).fn.Value, js.ValueOf(map[string]interface{}{"consoleDevice": device})}).(map[string]interface{})
+		if !failed(result) {
+			t.Errorf("consoleDevice %v accepted", device)
+			instances[result["data"].(map[string]interface{})["handle"].(int)].dispose()
+			continue
+		}
+		if code := statusOf(result); code != string(codeInvalidArgument) {
+			t.Errorf("consoleDevice %v = %s, want invalid_argument", device, code)
+		}
+		// The message says which devices there are
+		if msg := result["error"].(map[string]interface{})["message"].(string); device != 1 && !strings.Contains(msg, "uart, virtio") {
+			t.Errorf("consoleDevice %v: error %q doesn't list the machine's devices", device, msg)
+		}
+	}
+}
@@ -1,133 +1,354 @@
 //go:build js && wasm
 
-// Package main provides a WASM entry point for TinyEMU.
-// This is a minimal test harness to verify WASM compilation works.
+// Package main is the WASM entry point for TinyEMU. It registers the
+// tinyemu* functions listed in exports on the global object, through
+// which a page creates emulator instances with tinyemuInit, loads images
+// into them, runs, pauses, snapshots and inspects them, and exchanges
+// console input and output. Several instances can run side by side: each
+// function takes an instance's handle as an optional first argument and
+// otherwise acts on the default instance. Calls return the result objects
+// described in result.go, or Promises for those that wait.
 package main
 
 import (
-	"bytes"
-	"context"
 	"fmt"
-	"io"
 	"syscall/js"
-	"time"
 )
 
-// ConsoleWriter writes to the JavaScript console and/or a callback function.
-type ConsoleWriter struct {
-	callback js.Value
+// exports are the functions main registers on the global object. Each
+// returns a result object or a Promise, as described in result.go.
+var exports = []struct {
+	name string
+	fn   func(this js.Value, args []js.Value) interface{}
+}{
+	{"tinyemuInit", initEmulator},
+	{"tinyemuStart", startEmulator},
+	{"tinyemuValidate", validateConfig},
+	{"tinyemuStop", stopEmulator},
+	{"tinyemuPause", pauseEmulator},
+	{"tinyemuResume", resumeEmulator},
+	{"tinyemuReset", resetEmulator},
+	{"tinyemuDispose", disposeEmulator},
+	{"tinyemuSnapshot", snapshotEmulator},
+	{"tinyemuRestore", restoreEmulator},
+	{"tinyemuSendInput", sendInput},
+	{"tinyemuFlush", flushOutput},
+	{"tinyemuGetCursor", getCursor},
+	{"tinyemuGetCPUInfo", getCPUInfo},
+	{"tinyemuGetFeatures", getFeatures},
+	{"tinyemuSetFeature", setFeature},
+	{"tinyemuCloseInput", closeInput},
+	{"tinyemuClearInput", clearInput},
+	{"tinyemuBindInputSAB", bindInputSAB},
+	{"tinyemuAddOutputSink", addOutputSink},
+	{"tinyemuRemoveOutputSink", removeOutputSink},
+	{"tinyemuListConsoles", listConsoles},
+	{"tinyemuGetScrollback", getScrollback},
+	{"tinyemuGetOutputStream", getOutputStream},
+	{"tinyemuGetInputStream", getInputStream},
+	{"tinyemuPaste", pasteInput},
+	{"tinyemuSetLineMode", setLineMode},
+	{"tinyemuSendSignal", sendSignal},
+	{"tinyemuSetReadyPattern", setReadyPattern},
+	{"tinyemuStartRecording", startRecording},
+	{"tinyemuStopRecording", stopRecording},
+	{"tinyemuReplay", replayTranscript},
+	{"tinyemuRunScript", runInputScript},
+	{"tinyemuCancelScript", cancelInputScript},
+	{"tinyemuTypeString", typeStringInput},
+	{"tinyemuCancelTyping", cancelTyping},
+	{"tinyemuWaitFor", waitForOutput},
+	{"tinyemuRunUntilOutput", runUntilOutput},
+	{"tinyemuKeyDown", keyDown},
+	{"tinyemuKeyUp", keyUp},
+	{"tinyemuResize", resizeTerminal},
+	{"tinyemuMouseMove", mouseMove},
+	{"tinyemuMouseButton", mouseButton},
+	{"tinyemuMouseWheel", mouseWheel},
+	{"tinyemuLoadKernel", loadKernel},
+	{"tinyemuLoadKernelFromURL", loadKernelFromURL},
+	{"tinyemuCancelLoad", cancelLoad},
+	{"tinyemuLoadInitrd", loadInitrd},
+	{"tinyemuLoadFirmware", loadFirmware},
+	{"tinyemuLoadDTB", loadDTB},
+	{"tinyemuSetCmdline", setCmdline},
+	{"tinyemuLoadDisk", loadDisk},
+	{"tinyemuAttachLazyDisk", attachLazyDisk},
+	{"tinyemuEnablePersistence", enablePersistence},
+	{"tinyemuSync", syncDisk},
+	{"tinyemuPrepareUnload", prepareUnload},
+	{"tinyemuSetOutputMeterCallback", setOutputMeterCallback},
+	{"tinyemuSetDisplayCallback", setDisplayCallback},
+	{"tinyemuGetDisplayInfo", getDisplayInfo},
+	{"tinyemuScreenshot", screenshot},
+	{"tinyemuSetAudioCallback", setAudioCallback},
+	{"tinyemuSetMessagePortCallback", setMessagePortCallback},
+	{"tinyemuSendToMessagePort", sendToMessagePort},
+	{"tinyemuGetAudioFormat", getAudioFormat},
+	{"tinyemuAttachNetwork", attachNetwork},
+	{"tinyemuDetachNetwork", detachNetwork},
+	{"tinyemuNetworkStats", networkStats},
+	{"tinyemuSetSpeed", setSpeed},
+	{"tinyemuSetWatchdog", setWatchdog},
+	{"tinyemuReadRegisters", readRegisters},
+	{"tinyemuReadMemory", readMemory},
+	{"tinyemuStep", stepEmulator},
+	{"tinyemuSetBreakpoint", setBreakpoint},
+	{"tinyemuClearBreakpoint", clearBreakpoint},
+	{"tinyemuGetStats", getStats},
+	{"tinyemuGetUptime", getUptime},
+	{"tinyemuGetState", getEmulatorState},
+	{"tinyemuIsRunning", emulatorIsRunning},
+	{"tinyemuMemoryUsage", memoryUsage},
+	{"tinyemuSetLogLevel", setLogLevel},
+	{"tinyemuAttachWorkerBridge", attachWorkerBridge},
+	{"tinyemuVersion", getVersion},
+	{"tinyemuGetSchema", getSchema},
+	{"tinyemuVersionString", getVersionString},
+
+	// Promise-returning variants
+	{"tinyemuInitAsync", initEmulatorAsync},
+	{"tinyemuStartAsync", startEmulatorAsync},
+	{"tinyemuStopAsync", stopEmulatorAsync},
 }
 
-func (c *ConsoleWriter) Write(p []byte) (n int, err error) {
-	if !c.callback.IsUndefined() && !c.callback.IsNull() {
-		c.callback.Invoke(string(p))
+func main() {
+	defaultLogger.Infof("WASM module loaded")
+
+	// Register JavaScript functions
+	for _, export := range exports {
+		js.Global().Set(export.name, js.FuncOf(export.fn))
 	}
-	return len(p), nil
-}
 
-// ConsoleReader reads input from a JavaScript callback.
-type ConsoleReader struct {
-	buffer    *bytes.Buffer
-	inputChan chan []byte
+	// Keep the Go program running
+	select {}
 }
 
-func NewConsoleReader() *ConsoleReader {
-	return &ConsoleReader{
-		buffer:    bytes.NewBuffer(nil),
-		inputChan: make(chan []byte, 100),
+// initEmulator creates a new emulator instance and makes it the default.
+// The returned handle can be passed as the first argument of the other
+// functions to address this instance specifically. If an instance
+// already exists, {reinit: true} disposes the default one first and
+// {reinit: false} refuses with already_initialized; without reinit the new
+// instance is added beside it.
+func initEmulator(this js.Value, args []js.Value) interface{} {
+	callback, err := funcArg(args, 0, "output callback")
+	if err != nil {
+		return errorResult(err)
+	}
+	opts, err := parseOptions(arg(args, 1))
+	if err != nil {
+		return errorResult(err)
 	}
-}
 
-func (c *ConsoleReader) Read(p []byte) (n int, err error) {
-	// Non-blocking read from buffer first
-	if c.buffer.Len() > 0 {
-		return c.buffer.Read(p)
+	// Disposing first also frees the old instance's RAM for the new one
+	replaced := 0
+	if current, _, err := lookup(nil, 0); err == nil {
+		switch opts.reinit {
+		case reinitReject:
+			r := errResult(codeAlreadyInit, fmt.Sprintf("instance %d is already initialized, dispose it or pass reinit: true", current.handle))
+			r["data"] = map[string]interface{}{"handle": current.handle}
+			return r
+		case reinitReplace:
+			if exited, _ := current.dispose(); !exited {
+				current.log.Warnf("instance %d run loop did not stop in time", current.handle)
+			}
+			replaced = current.handle
+		}
 	}
 
-	// Try to get more input from channel (non-blocking)
-	select {
-	case data := <-c.inputChan:
-		c.buffer.Write(data)
-		return c.buffer.Read(p)
-	default:
-		return 0, nil
+	ram, err := allocGuestRAM(opts.ramSizeMB, opts.memoryCapMB)
+	if err != nil {
+		r := errorResult(err)
+		r["data"] = map[string]interface{}{"requestedMB": opts.ramSizeMB}
+		return r
 	}
+
+	e := newEmulator(callback, opts)
+	e.ram = ram
+	handle := register(e)
+	e.setState(stateInitialized)
+	data := map[string]interface{}{"handle": handle}
+	if replaced != 0 {
+		data["replaced"] = replaced
+	}
+	return statusResult(statusInitialized, data)
 }
 
-func (c *ConsoleReader) Write(data []byte) {
-	c.inputChan <- data
+func startEmulator(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	timeout, err := bootTimeoutOption(args)
+	if err != nil {
+		return errorResult(err)
+	}
+	return e.start(nil, timeout)
 }
 
-// Global state for the emulator
-var (
-	consoleWriter *ConsoleWriter
-	consoleReader *ConsoleReader
-	emulatorCtx   context.Context
-	emulatorStop  context.CancelFunc
-)
+// stopEmulator ends the run. Before tinyemuInit it fails with
+// not_initialized, and with not_running when there is no run to stop; a
+// run loop left over from a stop that timed out can be stopped again.
+func stopEmulator(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !e.isStarted() && !e.loopAlive() {
+		return errResult(codeNotRunning, fmt.Sprintf("not running, machine is %s", e.getState()))
+	}
 
-func main() {
-	fmt.Println("TinyEMU WASM module loaded")
+	// Wait for teardown so an immediate re-init can't race the old loop
+	status := statusStopped
+	if !e.haltRunLoop() {
+		status = statusStopTimeout
+	}
+	if e.isStarted() {
+		e.setState(stateStopped)
+	}
+	return statusResult(status, nil)
+}
 
-	// Register JavaScript functions
-	js.Global().Set("tinyemuInit", js.FuncOf(initEmulator))
-	js.Global().Set("tinyemuStart", js.FuncOf(startEmulator))
-	js.Global().Set("tinyemuStop", js.FuncOf(stopEmulator))
-	js.Global().Set("tinyemuSendInput", js.FuncOf(sendInput))
-	js.Global().Set("tinyemuVersion", js.FuncOf(getVersion))
+// sendInput feeds input to console0, or to the console id given as the
+// second argument. Input is a string, encoded per the encoding option, or
+// a Uint8Array or ArrayBuffer whose bytes are sent as they are.
+func sendInput(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	data, err := e.inputArg(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	id, err := e.consoleArg(args, 1)
+	if err != nil {
+		return errorResult(err)
+	}
+	return inputResult(e.sendTo(id, data))
+}
 
-	// Keep the Go program running
-	select {}
+// inputArg reads console input given as a string or as bytes.
+func (e *Emulator) inputArg(args []js.Value, i int) ([]byte, error) {
+	v := arg(args, i)
+	if v.Type() == js.TypeString {
+		return e.options.encoding.encode(v.String())
+	}
+	data, err := bytesFromJS(v)
+	if err != nil {
+		return nil, fmt.Errorf("input must be a string, Uint8Array or ArrayBuffer, got %s", v.Type())
+	}
+	return data, nil
 }
 
-func getVersion(this js.Value, args []js.Value) interface{} {
-	return "0.1.0"
+// inputResult reports the outcome of a ConsoleReader.Write to JS.
+func inputResult(err error) map[string]interface{} {
+	var result map[string]interface{}
+	switch err {
+	case nil:
+		return okResult(map[string]interface{}{"accepted": true})
+	case ErrInputDropped:
+		result = errResult(codeInputDropped, err.Error())
+		result["data"] = map[string]interface{}{"accepted": false, "reason": "dropped"}
+	case ErrInputClosed:
+		result = errResult(codeInputClosed, err.Error())
+		result["data"] = map[string]interface{}{"accepted": false, "reason": "closed"}
+	default:
+		result = errResult(codeBufferFull, err.Error())
+		result["data"] = map[string]interface{}{"accepted": false, "reason": "buffer_full"}
+	}
+	return result
 }
 
-func initEmulator(this js.Value, args []js.Value) interface{} {
-	if len(args) < 1 {
-		return map[string]interface{}{"error": "missing callback argument"}
+// flushOutput delivers buffered output of every console now, including a
+// partial line that flushOnNewline is holding back, such as a prompt.
+func flushOutput(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
 	}
+	e.writer.Flush()
+	e.flushConsoles()
+	return statusResult(statusFlushed, nil)
+}
 
-	consoleWriter = &ConsoleWriter{callback: args[0]}
-	consoleReader = NewConsoleReader()
+// clearInput discards input queued for console0, or the console id given,
+// that the guest hasn't read yet, and returns {discarded} in bytes. For
+// console0 that also covers the SharedArrayBuffer ring, the line being
+// edited in cooked mode and whatever tinyemuTypeString has left to type,
+// which it cancels. Input sent afterwards is read as normal.
+func clearInput(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	id, err := e.consoleArg(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if id != defaultConsole {
+		n := e.consoles[id].reader.Clear()
+		return statusResult(statusInputCleared, map[string]interface{}{"discarded": n})
+	}
 
-	return map[string]interface{}{"status": "initialized"}
+	e.typing.cancel()
+	n := 0
+	e.ringMu.Lock()
+	if e.ring != nil {
+		n += e.ring.skip()
+	}
+	e.ringMu.Unlock()
+	n += e.line.clear()
+	n += e.reader.Clear()
+	return statusResult(statusInputCleared, map[string]interface{}{"discarded": n})
 }
 
-func startEmulator(this js.Value, args []js.Value) interface{} {
-	if consoleWriter == nil {
-		return map[string]interface{}{"error": "not initialized, call tinyemuInit first"}
+// closeInput ends input to console0, or to the console id given, so the
+// guest reads EOF. Input sent afterwards is refused with closed.
+func closeInput(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	id, err := e.consoleArg(args, 0)
+	if err != nil {
+		return errorResult(err)
 	}
 
-	// This is a placeholder - actual emulator start would go here
-	// For now, just demonstrate the callback works
-	go func() {
-		consoleWriter.Write([]byte("TinyEMU starting...\n"))
-		time.Sleep(100 * time.Millisecond)
-		consoleWriter.Write([]byte("Boot sequence would start here\n"))
-	}()
-
-	return map[string]interface{}{"status": "starting"}
+	if id == defaultConsole {
+		e.reader.Close()
+	} else {
+		e.consoles[id].reader.Close()
+	}
+	return statusResult(statusInputClosed, nil)
 }
 
-func stopEmulator(this js.Value, args []js.Value) interface{} {
-	if emulatorStop != nil {
-		emulatorStop()
+// addOutputSink registers an extra console output callback alongside the
+// one passed to tinyemuInit. Sinks get the raw output even with stripAnsi,
+// so a terminal can still show colors.
+func addOutputSink(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
 	}
-	return map[string]interface{}{"status": "stopped"}
+	fn, err := funcArg(args, 0, "sink")
+	if err != nil {
+		return errorResult(err)
+	}
+	return statusResult(statusSinkAdded, map[string]interface{}{"id": e.writer.AddSink(fn)})
 }
 
-func sendInput(this js.Value, args []js.Value) interface{} {
-	if len(args) < 1 || consoleReader == nil {
-		return false
+func removeOutputSink(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 1)
+	if err != nil {
+		return errorResult(err)
 	}
-
-	input := args[0].String()
-	consoleReader.Write([]byte(input))
-	return true
+	id, err := intArg(args, 0, "sink id")
+	if err != nil {
+		return errorResult(err)
+	}
+	if !e.writer.RemoveSink(id) {
+		return errResult(codeInvalidArgument, fmt.Sprintf("unknown output sink %d", id))
+	}
+	return statusResult(statusSinkRemoved, map[string]interface{}{"id": id})
 }
-
-// Verify io.Writer and io.Reader interfaces are satisfied
-var _ io.Writer = (*ConsoleWriter)(nil)
-var _ io.Reader = (*ConsoleReader)(nil)
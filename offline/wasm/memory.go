@@ -0,0 +1,65 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"runtime"
+	"syscall/js"
+)
+
+// defaultMemoryCapMB is the default budget for the whole WASM heap. wasm32
+// tops out at 4 GiB and some browsers refuse to grow much past 2 GiB.
+const defaultMemoryCapMB = 2048
+
+var errOutOfMemory = newError(codeOutOfMemory, "not enough memory for the requested guest RAM")
+
+// allocGuestRAM allocates guest RAM if it fits in the memory cap alongside
+// what the runtime already holds. A failed heap grow is fatal to a WASM
+// module rather than a recoverable error, so the budget is checked first;
+// the recover only catches sizes the runtime rejects outright.
+func allocGuestRAM(mb, capMB int) (ram []byte, err error) {
+	if err := checkRAMBudget(mb, capMB); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if recover() != nil {
+			ram, err = nil, errOutOfMemory
+		}
+	}()
+	return make([]byte, mb<<20), nil
+}
+
+// checkRAMBudget reports whether mb of guest RAM would exceed the memory
+// cap alongside what the runtime already holds.
+func checkRAMBudget(mb, capMB int) error {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if uint64(mb)<<20+ms.Sys > uint64(capMB)<<20 {
+		return errOutOfMemory
+	}
+	return nil
+}
+
+// memoryUsage returns Go heap statistics so the UI can warn before a RAM
+// size is picked that won't fit.
+func memoryUsage(this js.Value, args []js.Value) interface{} {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	capMB := defaultMemoryCapMB
+	if e, _, err := lookup(args, 0); err == nil {
+		capMB = e.options.memoryCapMB
+	}
+
+	return okResult(map[string]interface{}{
+		"heapAlloc":   float64(ms.HeapAlloc),
+		"heapSys":     float64(ms.HeapSys),
+		"heapObjects": float64(ms.HeapObjects),
+		"sys":         float64(ms.Sys),
+		"numGC":       int(ms.NumGC),
+		"jsFuncs":     float64(liveFuncs.Load()),
+		"capBytes":    float64(uint64(capMB) << 20),
+		"availableMB": max(0, capMB-int(ms.Sys>>20)),
+	})
+}
@@ -0,0 +1,72 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"runtime"
+	"syscall/js"
+	"testing"
+)
+
+func TestAllocGuestRAMChecksTheCap(t *testing.T) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	used := int(ms.Sys >> 20)
+
+	if _, err := allocGuestRAM(64, used+32); errorCode(err) != codeOutOfMemory {
+		t.Errorf("64MB with 32MB to spare = %v, want out_of_memory", err)
+	}
+	ram, err := allocGuestRAM(16, used+64)
+	if err != nil {
+		t.Fatalf("16MB with 64MB to spare: %v", err)
+	}
+	if len(ram) != 16<<20 {
+		t.Errorf("allocated %d bytes, want 16MB", len(ram))
+	}
+}
+
+func TestInitReportsRequestedMBWhenOutOfMemory(t *testing.T) {
+	rec := newOutputRecorder(t)
+	result := initEmulator(js.Undefined(), []js.Value{rec.fn.Value, js.ValueOf(map[string]interface{}{"ramSizeMB": 1024, "memoryCapMB": 64})}).(map[string]interface{})
+	if statusOf(result) != string(codeOutOfMemory) {
+		t.Fatalf("tinyemuInit = %v, want out_of_memory", result)
+	}
+	if got := result["data"].(map[string]interface{})["requestedMB"]; got != 1024 {
+		t.Errorf("requestedMB = %v, want 1024", got)
+	}
+
+	for _, limit := range []interface{}{0, 4097, 1.5, "512"} {
+		result := initEmulator(js.Undefined(), []js.Value{rec.fn.Value, js.ValueOf(map[string]interface{}{"memoryCapMB": limit})})
+		if got := statusOf(result); got != string(codeInvalidArgument) {
+			t.Errorf("memoryCapMB %v: tinyemuInit = %s, want invalid_argument", limit, got)
+		}
+	}
+}
+
+func TestMemoryUsageShape(t *testing.T) {
+	// Other tests have grown the heap, so the cap leaves room above it
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	capMB := int(ms.Sys>>20) + 512
+	e, _ := newTestEmulator(t, map[string]interface{}{"memoryCapMB": capMB})
+	r := e.call(memoryUsage).(map[string]interface{})
+	if failed(r) {
+		t.Fatal(r["error"])
+	}
+	// Each field must go through js.ValueOf as a number
+	data := js.ValueOf(r["data"])
+	for _, key := range []string{"heapAlloc", "heapSys", "heapObjects", "sys", "numGC", "jsFuncs", "capBytes", "availableMB"} {
+		if v := data.Get(key); v.Type() != js.TypeNumber || v.Float() < 0 {
+			t.Errorf("%s = %v, want a number >= 0", key, v)
+		}
+	}
+	if got := data.Get("capBytes").Float(); got != float64(capMB<<20) {
+		t.Errorf("capBytes = %v, want the instance's %dMB cap", got, capMB)
+	}
+	if avail, sys := data.Get("availableMB").Int(), data.Get("sys").Float(); avail != max(0, capMB-int(sys)>>20) {
+		t.Errorf("availableMB = %d with sys %v under a %dMB cap", avail, sys, capMB)
+	}
+	if data.Get("heapAlloc").Float() > data.Get("heapSys").Float() {
+		t.Error("heapAlloc is larger than heapSys")
+	}
+}
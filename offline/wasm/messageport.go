@@ -0,0 +1,72 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+)
+
+// messagePortName is the name of the message port in the guest, which
+// finds it as /dev/virtio-ports/org.tinyemu.message.
+const messagePortName = "org.tinyemu.message"
+
+// messagePort is a virtio-serial port guest software uses to exchange
+// messages with the page, such as progress or results, apart from the
+// consoles. Like a console it carries a byte stream, so how messages are
+// framed, for instance one JSON document per line, is up to the guest and
+// the page. Output is delivered as Uint8Array whatever the encoding
+// option says.
+type messagePort struct {
+	writer *ConsoleWriter // guest to host
+	reader *ConsoleReader // host to guest
+}
+
+// newMessagePort creates the message port, with no callback until
+// tinyemuSetMessagePortCallback registers one.
+func (e *Emulator) newMessagePort() {
+	w := NewConsoleWriter(js.Undefined(), DefaultFlushInterval)
+	w.Name = messagePortName
+	w.Encoding = encodingRaw
+	w.DisableFailing = e.options.disableFailing
+	e.messages = messagePort{writer: w, reader: e.newInputReader()}
+}
+
+// port returns the message port as the machine sees it.
+func (p messagePort) port() consolePort {
+	return consolePort{out: p.writer, in: p.reader}
+}
+
+// setMessagePortCallback registers fn to receive, as Uint8Array chunks,
+// whatever the guest writes to the message port. Nothing written there
+// reaches console0 or the other consoles. Output written while no
+// callback is registered is dropped. null unregisters it.
+func setMessagePortCallback(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	fn, err := optionalFuncArg(args, 0, "message port callback")
+	if err != nil {
+		return errorResult(err)
+	}
+	e.messages.writer.SetCallback(fn)
+	return statusResult(statusMessageCallbackSet, nil)
+}
+
+// sendToMessagePort queues data for the guest to read from the message
+// port, a string sent as UTF-8 or a Uint8Array or ArrayBuffer sent as it
+// is. It never goes to console0, and the result is as for
+// tinyemuSendInput.
+func sendToMessagePort(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	var data []byte
+	if v := arg(args, 0); v.Type() == js.TypeString {
+		data = []byte(v.String())
+	} else if data, err = bytesFromJS(v); err != nil {
+		return errResult(codeInvalidArgument, "message must be a string, Uint8Array or ArrayBuffer, got "+v.Type().String())
+	}
+	return inputResult(e.messages.reader.Write(data))
+}
@@ -0,0 +1,92 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// messageEmulator returns a started instance whose machine echoes what
+// it reads on console0 and on the message port back where it came from,
+// with the recorders of console0 and of the message port callback.
+func messageEmulator(t *testing.T) (e *Emulator, console0, messages *outputRecorder) {
+	t.Helper()
+	useMachine(t, func(config machineConfig) machine {
+		return &echoMachine{ports: map[string]consolePort{
+			defaultConsole: {out: config.console, in: e.reader},
+			"message":      config.messages,
+		}}
+	})
+	e, console0 = newTestEmulator(t, nil)
+	messages = newOutputRecorder(t)
+	if got := statusOf(e.call(setMessagePortCallback, messages.fn)); got != string(statusMessageCallbackSet) {
+		t.Fatalf("tinyemuSetMessagePortCallback = %s", got)
+	}
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	return e, console0, messages
+}
+
+// waitBytes waits up to a second for rec to hold more than n bytes of
+// Uint8Array output.
+func waitBytes(t *testing.T, rec *outputRecorder, n int) []byte {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if out := rec.bytes(t); len(out) > n {
+			return out
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no message port output past %d bytes", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMessagePortIsApartFromConsole0(t *testing.T) {
+	e, console0, messages := messageEmulator(t)
+	if got := statusOf(e.call(sendToMessagePort, `{"progress":50}`)); got != "" {
+		t.Fatalf("tinyemuSendToMessagePort = %s", got)
+	}
+	if got := statusOf(e.call(sendInput, "ls")); got != "" {
+		t.Fatalf("tinyemuSendInput = %s", got)
+	}
+
+	if got := waitBytes(t, messages, 0); string(got) != "message:{\"progress\":50}\n" {
+		t.Errorf("message port callback got %q, want only the message's echo", got)
+	}
+	if got := waitOutput(t, console0, 0); got != "console0:ls\n" {
+		t.Errorf("console0 callback got %q, want only its own echo", got)
+	}
+	// Nor does either turn up later
+	time.Sleep(20 * time.Millisecond)
+	if got := messages.bytes(t); string(got) != "message:{\"progress\":50}\n" {
+		t.Errorf("message port callback went on to get %q", got)
+	}
+	if got := console0.text(); got != "console0:ls\n" {
+		t.Errorf("console0 callback went on to get %q", got)
+	}
+}
+
+func TestMessagePortCarriesBytes(t *testing.T) {
+	e, console0, messages := messageEmulator(t)
+	// Not UTF-8, so a text console would have mangled it
+	msg := []byte{0xff, 0x00, 0xfe}
+	e.call(sendToMessagePort, bytesToJS(msg))
+	want := append(append([]byte("message:"), msg...), '\n')
+	if got := waitBytes(t, messages, 0); !bytes.Equal(got, want) {
+		t.Errorf("message port callback got %q, want %q", got, want)
+	}
+	if got := console0.text(); got != "" {
+		t.Errorf("console0 callback got %q from the message port", got)
+	}
+
+	if got := statusOf(e.call(sendToMessagePort, 42)); got != string(codeInvalidArgument) {
+		t.Errorf("sending a number = %s, want invalid_argument", got)
+	}
+	if got := statusOf(e.call(setMessagePortCallback, "log")); got != string(codeInvalidArgument) {
+		t.Errorf("a string callback = %s, want invalid_argument", got)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+)
+
+// outputMeter counts console output for a callback that only wants sizes,
+// not the text.
+type outputMeter struct {
+	fn    js.Value
+	total int64
+}
+
+// SetMeter registers fn to be called with (bytes, totalBytes, timestampMs)
+// for every chunk delivered, or removes the meter if fn is undefined. The
+// total counts from the first chunk after the meter is set, and the
+// timestamp is Unix milliseconds on Clock.
+func (c *ConsoleWriter) SetMeter(fn js.Value) {
+	c.flushMu.Lock()
+	c.meter = outputMeter{fn: fn}
+	c.flushMu.Unlock()
+}
+
+// measure reports a chunk of n bytes to the meter. It runs from deliver,
+// under flushMu.
+func (c *ConsoleWriter) measure(n int) {
+	if c.meter.fn.Type() != js.TypeFunction {
+		return
+	}
+	c.meter.total += int64(n)
+	now := c.clock().Now().UnixMilli()
+	if err := safeInvoke(c.meter.fn, n, float64(c.meter.total), float64(now)); err != nil {
+		c.callbackFailed(meterCallback, err)
+	}
+}
+
+func (c *ConsoleWriter) clock() clock {
+	if c.Clock == nil {
+		return wallClock{}
+	}
+	return c.Clock
+}
+
+// setOutputMeterCallback registers fn to hear the size of each chunk of
+// console0 output, with a running total and a timestamp, so a UI can show
+// throughput without the data. Pass nothing to remove it.
+func setOutputMeterCallback(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	fn, err := optionalFuncArg(args, 0, "meter callback")
+	if err != nil {
+		return errorResult(err)
+	}
+	e.writer.SetMeter(fn)
+	return statusResult(statusMeterCallbackSet, nil)
+}
@@ -0,0 +1,95 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// meterReading is one call of an output meter.
+type meterReading struct {
+	n              int
+	total, stampMs float64
+}
+
+// meterRecorder is a meter callback that keeps its readings.
+func meterRecorder(t *testing.T) (js.Value, *[]meterReading) {
+	readings := new([]meterReading)
+	fn := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		*readings = append(*readings, meterReading{args[0].Int(), args[1].Float(), args[2].Float()})
+		return nil
+	})
+	t.Cleanup(fn.Release)
+	return fn.Value, readings
+}
+
+func TestMeterTotalsEveryByteWritten(t *testing.T) {
+	// No text callback, so the meter is the only one listening
+	c := &manualClock{now: virtualEpoch}
+	w := NewConsoleWriter(js.Undefined(), 0)
+	w.Clock = c
+	meter, readings := meterRecorder(t)
+	w.SetMeter(meter)
+
+	r := rand.New(rand.NewSource(1))
+	written := 0
+	var lastWrite time.Time
+	for i := 0; i < 200; i++ {
+		chunk := bytes.Repeat([]byte("é"), 1+r.Intn(300))
+		w.Write(chunk)
+		written += len(chunk)
+		lastWrite = c.Now()
+		c.tick(time.Millisecond)
+	}
+	w.Flush()
+
+	sum := 0
+	for i, m := range *readings {
+		sum += m.n
+		if m.total != float64(sum) {
+			t.Fatalf("reading %d: total %v, want the %d bytes so far", i, m.total, sum)
+		}
+		if i > 0 && m.stampMs < (*readings)[i-1].stampMs {
+			t.Errorf("reading %d went back in time from %v to %v", i, (*readings)[i-1].stampMs, m.stampMs)
+		}
+	}
+	if sum != written {
+		t.Errorf("meter heard %d bytes, want the %d written", sum, written)
+	}
+	// Stamped by the writer's clock, no earlier than the last write
+	if last := (*readings)[len(*readings)-1].stampMs; last < float64(lastWrite.UnixMilli()) || last > float64(c.Now().UnixMilli()) {
+		t.Errorf("last timestamp %v, want between the last write at %v and now at %v", last, lastWrite.UnixMilli(), c.Now().UnixMilli())
+	}
+}
+
+func TestSetOutputMeterCallback(t *testing.T) {
+	e, rec := newTestEmulator(t, nil)
+	meter, readings := meterRecorder(t)
+	if got := statusOf(e.call(setOutputMeterCallback, meter)); got != string(statusMeterCallbackSet) {
+		t.Fatalf("tinyemuSetOutputMeterCallback = %s", got)
+	}
+	e.writer.Write([]byte("hello\n"))
+	e.writer.Flush()
+	if len(*readings) != 1 || (*readings)[0].n != 6 || (*readings)[0].total != 6 {
+		t.Errorf("meter heard %+v, want one 6 byte chunk", *readings)
+	}
+	// The text callback still gets the text
+	if got := rec.text(); got != "hello\n" {
+		t.Errorf("callback got %q beside the meter", got)
+	}
+
+	// Passing nothing removes the meter
+	e.call(setOutputMeterCallback)
+	e.writer.Write([]byte("more"))
+	e.writer.Flush()
+	if len(*readings) != 1 {
+		t.Errorf("removed meter heard %d chunks", len(*readings))
+	}
+	if got := statusOf(e.call(setOutputMeterCallback, "meter")); got != string(codeInvalidArgument) {
+		t.Errorf("a string meter = %s, want invalid_argument", got)
+	}
+}
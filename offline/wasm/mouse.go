@@ -0,0 +1,171 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+	"syscall/js"
+)
+
+// Linux evdev codes used by virtio-input pointer events.
+const (
+	evSyn = 0x00
+	evKey = 0x01
+	evRel = 0x02
+	evAbs = 0x03
+
+	synReport = 0x00
+
+	relX     = 0x00
+	relY     = 0x01
+	relWheel = 0x08
+
+	absX = 0x00
+	absY = 0x01
+
+	btnLeft   = 0x110
+	btnRight  = 0x111
+	btnMiddle = 0x112
+)
+
+var errNoPointer = newError(codeUnsupported, "machine has no pointer device")
+
+// inputEvent is a virtio_input_event: one evdev type/code/value triple. A
+// packet is a run of them closed by a SYN_REPORT.
+type inputEvent struct {
+	typ   uint16
+	code  uint16
+	value int32
+}
+
+// pointerDevice is implemented by machines with a virtio-input mouse or
+// tablet.
+type pointerDevice interface {
+	QueueInputEvents(evs []inputEvent)
+}
+
+// domButtons maps MouseEvent.button to evdev button codes.
+var domButtons = map[int]uint16{0: btnLeft, 1: btnMiddle, 2: btnRight}
+
+func report(evs ...inputEvent) []inputEvent {
+	return append(evs, inputEvent{typ: evSyn, code: synReport})
+}
+
+// moveEvents encodes a pointer move. Absolute positions are clamped to the
+// display, when there is one; relative moves are deltas.
+func moveEvents(x, y int, absolute bool, display *displayInfo) []inputEvent {
+	if !absolute {
+		return report(
+			inputEvent{typ: evRel, code: relX, value: int32(x)},
+			inputEvent{typ: evRel, code: relY, value: int32(y)},
+		)
+	}
+	x, y = max(x, 0), max(y, 0)
+	if display != nil {
+		x = min(x, display.width-1)
+		y = min(y, display.height-1)
+	}
+	return report(
+		inputEvent{typ: evAbs, code: absX, value: int32(x)},
+		inputEvent{typ: evAbs, code: absY, value: int32(y)},
+	)
+}
+
+func buttonEvents(code uint16, pressed bool) []inputEvent {
+	var value int32
+	if pressed {
+		value = 1
+	}
+	return report(inputEvent{typ: evKey, code: code, value: value})
+}
+
+// wheelEvents encodes a wheel turn in notches, positive meaning down as
+// with WheelEvent.deltaY. REL_WHEEL counts up, hence the flip.
+func wheelEvents(notches int) []inputEvent {
+	if notches == 0 {
+		return nil
+	}
+	return report(inputEvent{typ: evRel, code: relWheel, value: int32(-notches)})
+}
+
+// queuePointer hands evs to the machine's pointer device. build gets the
+// current display, if any, so it can clamp absolute positions.
+func (e *Emulator) queuePointer(build func(display *displayInfo) []inputEvent) interface{} {
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+
+	p, ok := e.machine.(pointerDevice)
+	if !ok {
+		return errorResult(errNoPointer)
+	}
+	var display *displayInfo
+	if fb, ok := e.machine.(framebuffer); ok {
+		info := fb.DisplayInfo()
+		display = &info
+	}
+	if evs := build(display); len(evs) > 0 {
+		p.QueueInputEvents(evs)
+	}
+	return okResult(map[string]interface{}{"accepted": true})
+}
+
+// mouseMove takes (x, y): a position in display pixels in absolute mode,
+// or movementX/movementY in relative mode.
+func mouseMove(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 2)
+	if err != nil {
+		return errorResult(err)
+	}
+	fx, err := numberArg(args, 0, "x")
+	if err != nil {
+		return errorResult(err)
+	}
+	fy, err := numberArg(args, 1, "y")
+	if err != nil {
+		return errorResult(err)
+	}
+	x, y := int(math.Round(fx)), int(math.Round(fy))
+	absolute := e.options.mouseMode == mouseAbsolute
+	return e.queuePointer(func(display *displayInfo) []inputEvent {
+		return moveEvents(x, y, absolute, display)
+	})
+}
+
+// mouseButton takes (button, pressed) with button as in MouseEvent.button.
+func mouseButton(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 2)
+	if err != nil {
+		return errorResult(err)
+	}
+	button, err := intArg(args, 0, "button")
+	if err != nil {
+		return errorResult(err)
+	}
+	pressed, err := boolArg(args, 1, "pressed")
+	if err != nil {
+		return errorResult(err)
+	}
+	code, ok := domButtons[button]
+	if !ok {
+		return errResult(codeInvalidArgument, "button must be 0 (left), 1 (middle) or 2 (right)")
+	}
+	return e.queuePointer(func(*displayInfo) []inputEvent {
+		return buttonEvents(code, pressed)
+	})
+}
+
+// mouseWheel takes a delta in notches, positive scrolling down.
+func mouseWheel(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 1)
+	if err != nil {
+		return errorResult(err)
+	}
+	delta, err := numberArg(args, 0, "delta")
+	if err != nil {
+		return errorResult(err)
+	}
+	notches := int(math.Round(delta))
+	return e.queuePointer(func(*displayInfo) []inputEvent {
+		return wheelEvents(notches)
+	})
+}
@@ -0,0 +1,107 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// pointerMachine is a graphical machine with a virtio-input pointer,
+// keeping the events queued to it.
+type pointerMachine struct {
+	*fbMachine
+	events []inputEvent
+}
+
+func (m *pointerMachine) QueueInputEvents(evs []inputEvent) {
+	m.events = append(m.events, evs...)
+}
+
+// pointerEmulator runs a pointerMachine under opts.
+func pointerEmulator(t *testing.T, opts map[string]interface{}) (*Emulator, *pointerMachine) {
+	t.Helper()
+	m := &pointerMachine{fbMachine: newFBMachine()}
+	useMachine(t, func(machineConfig) machine { return m })
+	e, _ := newTestEmulator(t, opts)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	return e, m
+}
+
+// takeEvents returns and clears what m has been queued.
+func (m *pointerMachine) takeEvents(e *Emulator) []inputEvent {
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+	evs := m.events
+	m.events = nil
+	return evs
+}
+
+var synEvent = inputEvent{typ: evSyn, code: synReport}
+
+func TestAbsoluteMovesClampToTheDisplay(t *testing.T) {
+	e, m := pointerEmulator(t, nil)
+	tests := []struct {
+		x, y float64
+		want []inputEvent
+	}{
+		{3, 2, []inputEvent{{evAbs, absX, 3}, {evAbs, absY, 2}, synEvent}},
+		{2.6, 0.4, []inputEvent{{evAbs, absX, 3}, {evAbs, absY, 0}, synEvent}},
+		// The display is 8x4
+		{100, 100, []inputEvent{{evAbs, absX, 7}, {evAbs, absY, 3}, synEvent}},
+		{-5, -1, []inputEvent{{evAbs, absX, 0}, {evAbs, absY, 0}, synEvent}},
+	}
+	for _, tt := range tests {
+		if r := e.call(mouseMove, tt.x, tt.y).(map[string]interface{}); failed(r) {
+			t.Fatalf("tinyemuMouseMove(%v, %v): %v", tt.x, tt.y, r["error"])
+		}
+		if got := m.takeEvents(e); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("move to (%v, %v) queued %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestRelativeMovesAreDeltas(t *testing.T) {
+	e, m := pointerEmulator(t, map[string]interface{}{"mouseMode": mouseRelative})
+	e.call(mouseMove, -20, 300)
+	if got, want := m.takeEvents(e), []inputEvent{{evRel, relX, -20}, {evRel, relY, 300}, synEvent}; !reflect.DeepEqual(got, want) {
+		t.Errorf("relative move queued %v, want %v", got, want)
+	}
+}
+
+func TestButtonsAndWheel(t *testing.T) {
+	e, m := pointerEmulator(t, nil)
+	e.call(mouseButton, 0, true)
+	e.call(mouseButton, 0, false)
+	e.call(mouseButton, 2, true)
+	e.call(mouseWheel, 2)
+	e.call(mouseWheel, 0)
+	e.call(mouseWheel, -1)
+	want := []inputEvent{
+		{evKey, btnLeft, 1}, synEvent,
+		{evKey, btnLeft, 0}, synEvent,
+		{evKey, btnRight, 1}, synEvent,
+		// Positive is down, which REL_WHEEL counts as negative
+		{evRel, relWheel, -2}, synEvent,
+		{evRel, relWheel, 1}, synEvent,
+	}
+	if got := m.takeEvents(e); !reflect.DeepEqual(got, want) {
+		t.Errorf("queued %v, want %v", got, want)
+	}
+
+	if got := statusOf(e.call(mouseButton, 3, true)); got != string(codeInvalidArgument) {
+		t.Errorf("button 3 = %s, want invalid_argument", got)
+	}
+	if got := statusOf(e.call(mouseButton, 0, "yes")); got != string(codeInvalidArgument) {
+		t.Errorf("pressed as a string = %s, want invalid_argument", got)
+	}
+}
+
+func TestMouseWithoutPointerDevice(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	if got := statusOf(e.call(mouseMove, 1, 1)); got != string(codeUnsupported) {
+		t.Errorf("tinyemuMouseMove without a pointer = %s, want unsupported", got)
+	}
+}
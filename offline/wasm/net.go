@@ -0,0 +1,237 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"syscall/js"
+)
+
+// Ethernet frames travel over the tunnel as discrete binary WebSocket
+// messages, one frame per message with no extra framing, so a relay can
+// hand them straight to a TAP device or switch.
+const (
+	minFrameSize = 14 // destination, source and EtherType
+	maxFrameSize = 65535
+)
+
+// netInterface is implemented by machines with a virtio-net device.
+type netInterface interface {
+	// SetTransmit gives the device the function that carries guest TX
+	// frames off the machine.
+	SetTransmit(tx func(frame []byte))
+	// ReceiveFrame queues a frame for the guest's RX ring.
+	ReceiveFrame(frame []byte)
+}
+
+// netLink is one WebSocket tunnel. Links are never reused: reattaching
+// closes the old one and opens a new one.
+type netLink struct {
+	url   string
+	ws    js.Value
+	owner *funcRegistry
+	funcs []int // ids in owner
+	open  bool
+
+	txFrames, rxFrames, dropped int
+}
+
+// transmitFrame is the TX function handed to the machine's net device.
+// Frames are dropped while no link is up, as a NIC with no carrier would.
+func (e *Emulator) transmitFrame(frame []byte) {
+	e.netMu.Lock()
+	defer e.netMu.Unlock()
+
+	l := e.net
+	if l == nil || !l.open {
+		if l != nil {
+			l.dropped++
+		}
+		return
+	}
+	l.txFrames++
+	l.ws.Call("send", bytesToJS(frame))
+}
+
+// receiveFrame hands a frame from the relay to the machine, if it has a
+// net device to take it.
+func (e *Emulator) receiveFrame(l *netLink, data js.Value) {
+	frame, err := bytesFromJS(data)
+	delivered := false
+	if err == nil && len(frame) >= minFrameSize && len(frame) <= maxFrameSize {
+		e.machineMu.Lock()
+		if n, ok := e.machine.(netInterface); ok {
+			n.ReceiveFrame(frame)
+			delivered = true
+		}
+		e.machineMu.Unlock()
+	}
+
+	e.netMu.Lock()
+	if delivered {
+		l.rxFrames++
+	} else {
+		l.dropped++
+	}
+	e.netMu.Unlock()
+}
+
+// networkStatus tells onNetwork that the link went up or down.
+func (e *Emulator) networkStatus(status resultStatus, reason string) {
+	if e.options.onNetwork.Type() != js.TypeFunction {
+		return
+	}
+	event := map[string]interface{}{"status": string(status)}
+	if reason != "" {
+		event["reason"] = reason
+	}
+	e.options.onNetwork.Invoke(event)
+}
+
+// closeLink shuts l down and releases its handlers. Called with netMu held.
+func (l *netLink) close() {
+	l.open = false
+	if !l.ws.IsUndefined() {
+		for _, ev := range []string{"onopen", "onmessage", "onclose", "onerror"} {
+			l.ws.Set(ev, js.Null())
+		}
+		l.ws.Call("close")
+	}
+	for _, id := range l.funcs {
+		l.owner.release(id)
+	}
+	l.funcs = nil
+}
+
+// dialNetwork opens a WebSocket to url and makes it the instance's link.
+func (e *Emulator) dialNetwork(url string) (err error) {
+	ctor := js.Global().Get("WebSocket")
+	if ctor.Type() != js.TypeFunction {
+		return newError(codeUnavailable, "WebSocket is not available")
+	}
+
+	// The constructor throws a SyntaxError for a malformed URL
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("invalid WebSocket URL " + url)
+		}
+	}()
+	ws := ctor.New(url)
+	ws.Set("binaryType", "arraybuffer")
+
+	l := &netLink{url: url, ws: ws, owner: e.funcs}
+	handler := func(fn func(ev js.Value)) js.Func {
+		f, id := e.funcs.funcOf(func(this js.Value, args []js.Value) interface{} {
+			ev := js.Undefined()
+			if len(args) > 0 {
+				ev = args[0]
+			}
+			fn(ev)
+			return nil
+		})
+		l.funcs = append(l.funcs, id)
+		return f
+	}
+
+	ws.Set("onopen", handler(func(js.Value) {
+		e.netMu.Lock()
+		l.open = true
+		e.netMu.Unlock()
+		e.networkStatus(statusUp, "")
+	}))
+	ws.Set("onmessage", handler(func(ev js.Value) {
+		e.receiveFrame(l, ev.Get("data"))
+	}))
+	down := func(reason string) {
+		e.netMu.Lock()
+		current := e.net == l
+		if current {
+			l.close()
+			e.net = nil
+		}
+		e.netMu.Unlock()
+		if current {
+			e.networkStatus(statusDown, reason)
+		}
+	}
+	ws.Set("onerror", handler(func(js.Value) { down("error") }))
+	ws.Set("onclose", handler(func(ev js.Value) {
+		reason := "closed"
+		if r := ev.Get("reason"); r.Type() == js.TypeString && r.String() != "" {
+			reason = r.String()
+		}
+		down(reason)
+	}))
+
+	e.netMu.Lock()
+	if e.net != nil {
+		e.net.close()
+	}
+	e.net = l
+	e.netMu.Unlock()
+	return nil
+}
+
+// attachNetwork tunnels the guest's virtio-net device over a WebSocket to
+// a relay, replacing any existing link. Link changes are reported to the
+// onNetwork callback; after a "down" this can simply be called again.
+func attachNetwork(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	url, err := stringArg(args, 0, "url")
+	if err != nil {
+		return errorResult(err)
+	}
+	if err := e.dialNetwork(url); err != nil {
+		return errorResult(err)
+	}
+	return statusResult(statusConnecting, map[string]interface{}{"url": url})
+}
+
+func detachNetwork(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.netMu.Lock()
+	l := e.net
+	if l != nil {
+		l.close()
+		e.net = nil
+	}
+	e.netMu.Unlock()
+
+	if l == nil {
+		return statusResult(statusNotAttached, nil)
+	}
+	e.networkStatus(statusDown, "detached")
+	return statusResult(statusDetached, nil)
+}
+
+// networkStats reports frame counters for the current link.
+func networkStats(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.netMu.Lock()
+	defer e.netMu.Unlock()
+	l := e.net
+	if l == nil {
+		return statusResult(statusNotAttached, nil)
+	}
+	status := statusConnecting
+	if l.open {
+		status = statusUp
+	}
+	return statusResult(status, map[string]interface{}{
+		"url":      l.url,
+		"txFrames": l.txFrames,
+		"rxFrames": l.rxFrames,
+		"dropped":  l.dropped,
+	})
+}
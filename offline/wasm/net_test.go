@@ -0,0 +1,155 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"sync"
+	"syscall/js"
+	"testing"
+)
+
+// mockWebSocket replaces the WebSocket global until the test ends with a
+// constructor that keeps every socket it makes in its sockets array. Each
+// socket keeps what it is sent, and a URL of "bad" throws as a malformed
+// one would.
+func mockWebSocket(t *testing.T) js.Value {
+	ctor := js.Global().Get("Function").New(`
+		function MockWebSocket(url) {
+			if (url === "bad") throw new SyntaxError("invalid URL");
+			this.url = url;
+			this.sent = [];
+			MockWebSocket.sockets.push(this);
+		}
+		MockWebSocket.sockets = [];
+		MockWebSocket.prototype.send = function (data) { this.sent.push(data); };
+		MockWebSocket.prototype.close = function () { this.closed = true; };
+		return MockWebSocket;
+	`).Invoke()
+	global := js.Global()
+	prev := global.Get("WebSocket")
+	global.Set("WebSocket", ctor)
+	t.Cleanup(func() { global.Set("WebSocket", prev) })
+	return ctor
+}
+
+// netMachine is a machine with a virtio-net device.
+type netMachine struct {
+	testMachine
+	mu       sync.Mutex
+	tx       func(frame []byte)
+	received [][]byte
+}
+
+func (m *netMachine) SetTransmit(tx func(frame []byte)) { m.tx = tx }
+
+func (m *netMachine) ReceiveFrame(frame []byte) {
+	m.mu.Lock()
+	m.received = append(m.received, frame)
+	m.mu.Unlock()
+}
+
+// testFrame returns an Ethernet frame of n bytes filled with b.
+func testFrame(b byte, n int) []byte {
+	return bytes.Repeat([]byte{b}, n)
+}
+
+func TestNetworkTunnelsFrames(t *testing.T) {
+	sockets := mockWebSocket(t).Get("sockets")
+	m := &netMachine{}
+	useMachine(t, func(machineConfig) machine { return m })
+	events := newOutputRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onNetwork": events.fn})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+
+	if got := statusOf(e.call(attachNetwork, "wss://relay.example/net")); got != string(statusConnecting) {
+		t.Fatalf("tinyemuAttachNetwork = %s", got)
+	}
+	ws := sockets.Index(0)
+	if got := ws.Get("binaryType").String(); got != "arraybuffer" {
+		t.Errorf("binaryType = %q, want arraybuffer", got)
+	}
+
+	// Without carrier a TX frame is dropped
+	m.tx(testFrame(1, 60))
+	ws.Call("onopen", js.Undefined())
+	m.tx(testFrame(2, 60))
+	m.tx(testFrame(3, 1514))
+	if n := ws.Get("sent").Length(); n != 2 {
+		t.Fatalf("%d messages sent, want one per frame after open", n)
+	}
+	for i, want := range [][]byte{testFrame(2, 60), testFrame(3, 1514)} {
+		got, err := bytesFromJS(ws.Get("sent").Index(i))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("message %d is %d bytes (%v), want frame %d bytes of %d", i, len(got), err, len(want), want[0])
+		}
+	}
+
+	message := func(data []byte) {
+		ws.Call("onmessage", map[string]interface{}{"data": bytesToJS(data).Get("buffer")})
+	}
+	message(testFrame(4, 64))
+	message(testFrame(5, minFrameSize-1))
+	m.mu.Lock()
+	if len(m.received) != 1 || !bytes.Equal(m.received[0], testFrame(4, 64)) {
+		t.Errorf("guest received %d frames, want just the 64-byte one", len(m.received))
+	}
+	m.mu.Unlock()
+
+	stats := e.call(networkStats).(map[string]interface{})
+	data := stats["data"].(map[string]interface{})
+	if statusOf(stats) != string(statusUp) || data["txFrames"] != 2 || data["rxFrames"] != 1 || data["dropped"] != 2 {
+		t.Errorf("tinyemuNetworkStats = %v", stats)
+	}
+	if n := len(events.chunks); n != 1 || events.chunks[0].Get("status").String() != string(statusUp) {
+		t.Errorf("onNetwork heard %d events, want one up", n)
+	}
+}
+
+func TestNetworkDownAllowsReattach(t *testing.T) {
+	sockets := mockWebSocket(t).Get("sockets")
+	events := newOutputRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onNetwork": events.fn})
+
+	e.call(attachNetwork, "ws://relay")
+	first := sockets.Index(0)
+	first.Call("onopen", js.Undefined())
+	first.Call("onclose", map[string]interface{}{"reason": "relay restarting"})
+	if n := len(events.chunks); n != 2 {
+		t.Fatalf("onNetwork heard %d events, want up and down", n)
+	}
+	down := events.chunks[1]
+	if down.Get("status").String() != string(statusDown) || down.Get("reason").String() != "relay restarting" {
+		t.Errorf("down event = status %v, reason %v", down.Get("status"), down.Get("reason"))
+	}
+	if got := statusOf(e.call(networkStats)); got != string(statusNotAttached) {
+		t.Errorf("stats after close = %s, want not_attached", got)
+	}
+
+	// Reattaching opens a new socket, and replacing it closes the old one
+	e.call(attachNetwork, "ws://relay")
+	second := sockets.Index(1)
+	e.call(attachNetwork, "ws://other")
+	if !second.Get("closed").Truthy() || !second.Get("onmessage").IsNull() {
+		t.Error("a replaced link was left open with its handlers")
+	}
+	if got := statusOf(e.call(detachNetwork)); got != string(statusDetached) {
+		t.Errorf("tinyemuDetachNetwork = %s", got)
+	}
+	if got := statusOf(e.call(detachNetwork)); got != string(statusNotAttached) {
+		t.Errorf("second tinyemuDetachNetwork = %s, want not_attached", got)
+	}
+}
+
+func TestAttachNetworkErrors(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	mockWebSocket(t)
+	if got := statusOf(e.call(attachNetwork, "bad")); got != string(codeInvalidArgument) {
+		t.Errorf("a malformed URL = %s, want invalid_argument", got)
+	}
+	js.Global().Set("WebSocket", js.Undefined())
+	if got := statusOf(e.call(attachNetwork, "ws://relay")); got != string(codeUnavailable) {
+		t.Errorf("without WebSocket = %s, want unavailable", got)
+	}
+}
@@ -0,0 +1,405 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// defaultRAMSizeMB matches the TinyEMU default machine.
+	defaultRAMSizeMB = 128
+	// maxRAMSizeMB keeps guest RAM well inside what a 32-bit WASM heap can
+	// grow to alongside the Go runtime and loaded images.
+	maxRAMSizeMB = 1024
+	// maxCores bounds the cores option. Harts share one WASM thread, so
+	// each one added slows every other.
+	maxCores = 8
+)
+
+// Pointer modes for the mouseMode option. Tablet-style absolute suits
+// desktops that follow the host cursor; relative suits games and guests
+// that only drive a plain mouse.
+const (
+	mouseAbsolute = "absolute"
+	mouseRelative = "relative"
+)
+
+// How the guest's console reads wait for input, chosen by inputReadMode.
+const (
+	readPoll    = "poll"    // return at once when empty
+	readBlock   = "block"   // wait for input
+	readTimeout = "timeout" // wait up to inputReadTimeoutMs
+)
+
+// defaultReadTimeout is the wait of the "timeout" read mode when
+// inputReadTimeoutMs isn't given.
+const defaultReadTimeout = 10 * time.Millisecond
+
+// options holds the settings passed to tinyemuInit.
+type options struct {
+	ramSizeMB       int
+	cores           int
+	isa             cpuISA
+	memoryCapMB     int
+	maxInputBytes   int
+	scrollback      int
+	inputRate       int
+	readMode        string
+	readTimeout     time.Duration
+	mouseMode       string
+	displayInterval time.Duration
+	consoleDevice   string
+	encoding        consoleEncoding
+	stripANSI       bool
+	disableFailing  bool
+	flushOnNewline  bool
+	onEvent         js.Value
+	onError         js.Value
+	onState         js.Value
+	onReady         js.Value
+	onNetwork       js.Value
+	onStall         js.Value
+	onBreakpoint    js.Value
+	onHalt          js.Value
+	onExit          js.Value
+	logLevel        logLevel
+	logFormat       string
+	onLog           js.Value
+
+	// Periodic stats reporting, off unless both are set. statsRegisters
+	// adds the register file to each report.
+	statsInterval  time.Duration
+	onStats        js.Value
+	statsRegisters bool
+
+	// When the run loop hands control back to the browser
+	yield yieldBudget
+
+	// Deterministic runs use a virtual clock and a seeded RNG
+	deterministic bool
+	seed          int64
+
+	// What the guest RTC reads, and where a fixed one starts
+	rtc      string
+	rtcEpoch time.Time
+
+	reinit reinitMode
+
+	// Exit port for CI runs, nil unless enabled
+	exitPort *exitPort
+
+	// Kernel command line, also settable with tinyemuSetCmdline
+	cmdline string
+
+	// How the machine boots, bootDirectKernel or bootFirmware
+	bootMethod string
+
+	// Images besides the kernel that start refuses to boot without
+	requiredImages []string
+
+	// Output callbacks of the consoles besides console0, by id
+	consoles map[string]js.Value
+}
+
+// reinitMode is what tinyemuInit does about an instance that already exists.
+type reinitMode int
+
+const (
+	// reinitAdd creates another instance beside it, which becomes the default.
+	reinitAdd reinitMode = iota
+	// reinitReplace disposes the default instance first.
+	reinitReplace
+	// reinitReject fails with already_initialized.
+	reinitReject
+)
+
+func defaultOptions() options {
+	return options{
+		ramSizeMB:       defaultRAMSizeMB,
+		cores:           1,
+		isa:             defaultISA,
+		memoryCapMB:     defaultMemoryCapMB,
+		maxInputBytes:   DefaultMaxBuffered,
+		scrollback:      defaultScrollbackBytes,
+		readMode:        readPoll,
+		readTimeout:     defaultReadTimeout,
+		mouseMode:       mouseAbsolute,
+		displayInterval: displayInterval,
+		consoleDevice:   consoleUART,
+		bootMethod:      bootDirectKernel,
+		rtc:             rtcHost,
+		rtcEpoch:        virtualEpoch,
+		logLevel:        logInfo,
+		logFormat:       logText,
+	}
+}
+
+// parseOptions reads an optional options object, filling in defaults for
+// missing fields.
+func parseOptions(v js.Value) (options, error) {
+	opts := defaultOptions()
+	if v.IsUndefined() || v.IsNull() {
+		return opts, nil
+	}
+	if v.Type() != js.TypeObject {
+		return opts, fmt.Errorf("options must be an object, got %s", v.Type())
+	}
+
+	if ram := v.Get("ramSizeMB"); !ram.IsUndefined() && !ram.IsNull() {
+		if ram.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("ramSizeMB must be a number, got %s", ram.Type())
+		}
+		mb := ram.Float()
+		if mb != float64(int(mb)) || mb < 1 || mb > maxRAMSizeMB {
+			return opts, fmt.Errorf("ramSizeMB must be a whole number between 1 and %d, got %v", maxRAMSizeMB, mb)
+		}
+		opts.ramSizeMB = int(mb)
+	}
+
+	if cores := v.Get("cores"); !cores.IsUndefined() && !cores.IsNull() {
+		if cores.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("cores must be a number, got %s", cores.Type())
+		}
+		n := cores.Float()
+		if n != float64(int(n)) || n < 1 || n > maxCores {
+			return opts, fmt.Errorf("cores must be a whole number between 1 and %d, got %v", maxCores, n)
+		}
+		opts.cores = int(n)
+	}
+
+	if limit := v.Get("memoryCapMB"); !limit.IsUndefined() && !limit.IsNull() {
+		if limit.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("memoryCapMB must be a number, got %s", limit.Type())
+		}
+		mb := limit.Float()
+		if mb != math.Trunc(mb) || mb < 1 || mb > 4096 {
+			return opts, fmt.Errorf("memoryCapMB must be a whole number between 1 and 4096, got %v", mb)
+		}
+		opts.memoryCapMB = int(mb)
+	}
+
+	if limit := v.Get("maxInputBytes"); !limit.IsUndefined() && !limit.IsNull() {
+		if limit.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("maxInputBytes must be a number, got %s", limit.Type())
+		}
+		n := limit.Float()
+		if n != math.Trunc(n) || n < 1 || n > 1<<30 {
+			return opts, fmt.Errorf("maxInputBytes must be a whole number between 1 and %d, got %v", 1<<30, n)
+		}
+		opts.maxInputBytes = int(n)
+	}
+
+	if size := v.Get("scrollbackBytes"); !size.IsUndefined() && !size.IsNull() {
+		if size.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("scrollbackBytes must be a number, got %s", size.Type())
+		}
+		n := size.Float()
+		if n != math.Trunc(n) || n < 0 || n > maxScrollbackBytes {
+			return opts, fmt.Errorf("scrollbackBytes must be a whole number between 0 and %d, got %v", maxScrollbackBytes, n)
+		}
+		opts.scrollback = int(n)
+	}
+
+	if rate := v.Get("inputRateLimit"); !rate.IsUndefined() && !rate.IsNull() {
+		if rate.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("inputRateLimit must be a number, got %s", rate.Type())
+		}
+		n := rate.Float()
+		if n != math.Trunc(n) || n < 0 || n > 1<<30 {
+			return opts, fmt.Errorf("inputRateLimit must be a whole number of characters per second between 0 and %d, got %v", 1<<30, n)
+		}
+		opts.inputRate = int(n)
+	}
+
+	if mode := v.Get("inputReadMode"); !mode.IsUndefined() && !mode.IsNull() {
+		switch {
+		case mode.Type() != js.TypeString:
+			return opts, fmt.Errorf("inputReadMode must be a string, got %s", mode.Type())
+		case mode.String() == readPoll, mode.String() == readBlock, mode.String() == readTimeout:
+			opts.readMode = mode.String()
+		default:
+			return opts, fmt.Errorf("inputReadMode must be %q, %q or %q", readPoll, readBlock, readTimeout)
+		}
+	}
+
+	if ms := v.Get("inputReadTimeoutMs"); !ms.IsUndefined() && !ms.IsNull() {
+		if ms.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("inputReadTimeoutMs must be a number, got %s", ms.Type())
+		}
+		if n := ms.Float(); !(n > 0 && n <= 1000) {
+			return opts, fmt.Errorf("inputReadTimeoutMs must be above 0 and at most 1000, got %v", n)
+		}
+		opts.readTimeout = time.Duration(ms.Float() * float64(time.Millisecond))
+	}
+
+	if mode := v.Get("mouseMode"); !mode.IsUndefined() && !mode.IsNull() {
+		if mode.Type() != js.TypeString || (mode.String() != mouseAbsolute && mode.String() != mouseRelative) {
+			return opts, fmt.Errorf("mouseMode must be %q or %q", mouseAbsolute, mouseRelative)
+		}
+		opts.mouseMode = mode.String()
+	}
+
+	if ms := v.Get("displayIntervalMs"); !ms.IsUndefined() && !ms.IsNull() {
+		if ms.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("displayIntervalMs must be a number, got %s", ms.Type())
+		}
+		n := ms.Float()
+		if !(n >= 1 && n <= float64(maxDisplayInterval.Milliseconds())) {
+			return opts, fmt.Errorf("displayIntervalMs must be between 1 and %d, got %v", maxDisplayInterval.Milliseconds(), n)
+		}
+		opts.displayInterval = time.Duration(n * float64(time.Millisecond))
+	}
+
+	if dev := v.Get("consoleDevice"); !dev.IsUndefined() && !dev.IsNull() {
+		if dev.Type() != js.TypeString {
+			return opts, fmt.Errorf("consoleDevice must be a string, got %s", dev.Type())
+		}
+		if !slices.Contains(machineConsoleDevices, dev.String()) {
+			return opts, fmt.Errorf("consoleDevice %q is not a console device of this machine, want one of %s", dev.String(), strings.Join(machineConsoleDevices, ", "))
+		}
+		opts.consoleDevice = dev.String()
+	}
+
+	if ms := v.Get("statsIntervalMs"); !ms.IsUndefined() && !ms.IsNull() {
+		if ms.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("statsIntervalMs must be a number, got %s", ms.Type())
+		}
+		if n := ms.Float(); !(n >= 0 && n <= float64(maxStatsInterval.Milliseconds())) {
+			return opts, fmt.Errorf("statsIntervalMs must be between 0 and %d, got %v", maxStatsInterval.Milliseconds(), n)
+		}
+		opts.statsInterval = time.Duration(ms.Float() * float64(time.Millisecond))
+	}
+	opts.statsRegisters = v.Get("statsRegisters").Truthy()
+
+	if level := v.Get("logLevel"); !level.IsUndefined() && !level.IsNull() {
+		if level.Type() != js.TypeString {
+			return opts, fmt.Errorf("logLevel must be a string, got %s", level.Type())
+		}
+		l, err := parseLogLevel(level.String())
+		if err != nil {
+			return opts, err
+		}
+		opts.logLevel = l
+	}
+
+	var err error
+	if opts.logFormat, err = logFormatOption(v); err != nil {
+		return opts, err
+	}
+	if opts.onEvent, err = callbackOption(v, "onEvent"); err != nil {
+		return opts, err
+	}
+	if opts.onError, err = callbackOption(v, "onError"); err != nil {
+		return opts, err
+	}
+	if opts.onState, err = callbackOption(v, "onState"); err != nil {
+		return opts, err
+	}
+	if opts.onStats, err = callbackOption(v, "onStats"); err != nil {
+		return opts, err
+	}
+	if opts.onLog, err = callbackOption(v, "onLog"); err != nil {
+		return opts, err
+	}
+	if opts.onReady, err = callbackOption(v, "onReady"); err != nil {
+		return opts, err
+	}
+	if opts.onNetwork, err = callbackOption(v, "onNetwork"); err != nil {
+		return opts, err
+	}
+	if opts.onStall, err = callbackOption(v, "onStall"); err != nil {
+		return opts, err
+	}
+	if opts.onBreakpoint, err = callbackOption(v, "onBreakpoint"); err != nil {
+		return opts, err
+	}
+	if opts.onHalt, err = callbackOption(v, "onHalt"); err != nil {
+		return opts, err
+	}
+	if opts.onExit, err = callbackOption(v, "onExit"); err != nil {
+		return opts, err
+	}
+	if opts.exitPort, err = exitOption(v); err != nil {
+		return opts, err
+	}
+	if opts.cmdline, err = cmdlineOption(v); err != nil {
+		return opts, err
+	}
+	if opts.requiredImages, err = requiredImagesOption(v); err != nil {
+		return opts, err
+	}
+	if opts.bootMethod, err = bootMethodOption(v); err != nil {
+		return opts, err
+	}
+	if opts.isa, err = isaOption(v); err != nil {
+		return opts, err
+	}
+	if opts.consoles, err = consolesOption(v); err != nil {
+		return opts, err
+	}
+
+	if seed := v.Get("seed"); !seed.IsUndefined() && !seed.IsNull() {
+		if seed.Type() != js.TypeNumber {
+			return opts, fmt.Errorf("seed must be a number, got %s", seed.Type())
+		}
+		n := seed.Float()
+		if n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return opts, fmt.Errorf("seed must be a safe integer, got %v", n)
+		}
+		opts.seed = int64(n)
+	}
+
+	// binaryOutput predates consoleEncoding and means raw
+	binary := v.Get("binaryOutput").Truthy()
+	if binary {
+		opts.encoding = encodingRaw
+	}
+	if enc := v.Get("consoleEncoding"); !enc.IsUndefined() && !enc.IsNull() {
+		if enc.Type() != js.TypeString {
+			return opts, fmt.Errorf("consoleEncoding must be a string, got %s", enc.Type())
+		}
+		if opts.encoding, err = parseEncoding(enc.String()); err != nil {
+			return opts, err
+		}
+		if binary && opts.encoding != encodingRaw {
+			return opts, fmt.Errorf("binaryOutput conflicts with consoleEncoding %q", enc.String())
+		}
+	}
+	opts.deterministic = v.Get("deterministic").Truthy()
+	if err := rtcOption(v, &opts); err != nil {
+		return opts, err
+	}
+	if err := yieldOption(v, &opts); err != nil {
+		return opts, err
+	}
+	opts.stripANSI = v.Get("stripAnsi").Truthy()
+	opts.disableFailing = v.Get("disableFailingCallbacks").Truthy()
+	opts.flushOnNewline = v.Get("flushOnNewline").Truthy()
+
+	switch r := v.Get("reinit"); {
+	case r.IsUndefined() || r.IsNull():
+	case r.Type() != js.TypeBoolean:
+		return opts, fmt.Errorf("reinit must be a boolean, got %s", r.Type())
+	case r.Bool():
+		opts.reinit = reinitReplace
+	default:
+		opts.reinit = reinitReject
+	}
+	return opts, nil
+}
+
+// callbackOption reads an optional callback field, a function or {obj,
+// method}.
+func callbackOption(v js.Value, name string) (js.Value, error) {
+	fn := v.Get(name)
+	if fn.IsUndefined() || fn.IsNull() {
+		return js.Undefined(), nil
+	}
+	return asCallback(fn, name)
+}
@@ -0,0 +1,62 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+func TestRAMSizeReachesTheMachine(t *testing.T) {
+	var booted int
+	useMachine(t, func(config machineConfig) machine {
+		booted = config.ramSizeMB
+		return &testMachine{}
+	})
+	tests := []struct {
+		name string
+		opts map[string]interface{} // nil is the single-argument form
+		want int
+	}{
+		{"no options", nil, defaultRAMSizeMB},
+		{"field missing", map[string]interface{}{"cores": 1}, defaultRAMSizeMB},
+		{"null", map[string]interface{}{"ramSizeMB": nil}, defaultRAMSizeMB},
+		{"smallest", map[string]interface{}{"ramSizeMB": 1}, 1},
+		{"256", map[string]interface{}{"ramSizeMB": 256}, 256},
+	}
+	for _, tt := range tests {
+		e, _ := newTestEmulator(t, tt.opts)
+		e.call(startEmulator)
+		waitState(t, e, stateRunning)
+		if booted != tt.want {
+			t.Errorf("%s: machine booted with %d MB, want %d", tt.name, booted, tt.want)
+		}
+		e.call(stopEmulator)
+	}
+}
+
+func TestRAMSizeRejectsBadValues(t *testing.T) {
+	rec := newOutputRecorder(t)
+	for _, ram := range []interface{}{0, -128, 1.5, maxRAMSizeMB + 1, 1e12, math.NaN(), math.Inf(1), "128", true} {
+		result := initEmulator(js.Undefined(), []js.Value{rec.fn.Value, js.ValueOf(map[string]interface{}{"ramSizeMB": ram})}).(map[string]interface{})
+		if statusOf(result) != string(codeInvalidArgument) {
+			t.Errorf("ramSizeMB %v: tinyemuInit = %s, want invalid_argument", ram, statusOf(result))
+			if !failed(result) {
+				disposeEmulator(js.Undefined(), []js.Value{js.ValueOf(result["data"].(map[string]interface{})["handle"])})
+			}
+			continue
+		}
+		if msg := result["error"].(map[string]interface{})["message"].(string); !strings.Contains(msg, "ramSizeMB") {
+			t.Errorf("ramSizeMB %v: error %q doesn't name the option", ram, msg)
+		}
+	}
+
+	// A size the parser allows is still refused up front when the heap
+	// couldn't grow to hold it
+	result := initEmulator(js.Undefined(), []js.Value{rec.fn.Value, js.ValueOf(map[string]interface{}{"ramSizeMB": maxRAMSizeMB, "memoryCapMB": 512})})
+	if got := statusOf(result); got != string(codeOutOfMemory) {
+		t.Errorf("ramSizeMB over the memory cap: tinyemuInit = %s, want out_of_memory", got)
+	}
+}
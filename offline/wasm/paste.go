@@ -0,0 +1,48 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+)
+
+// Bracketed paste markers (xterm DECSET 2004).
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// bracketPaste wraps text in paste markers, first removing any markers
+// inside it so pasted content can't end the paste early. Removing one
+// marker can join the text around it into another, so it repeats until
+// none are left.
+func bracketPaste(text string) string {
+	for strings.Contains(text, pasteStart) || strings.Contains(text, pasteEnd) {
+		text = strings.ReplaceAll(text, pasteStart, "")
+		text = strings.ReplaceAll(text, pasteEnd, "")
+	}
+	return pasteStart + text + pasteEnd
+}
+
+// pasteInput feeds clipboard text to the guest, bracketed when the guest
+// has asked for it so a shell can tell a paste from typing.
+func pasteInput(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	text, err := stringArg(args, 0, "text")
+	if err != nil {
+		return errorResult(err)
+	}
+	// Cooked mode edits the paste like typing, so markers would only get in the way
+	if e.writer.BracketedPaste() && !e.line.isCooked() {
+		text = bracketPaste(text)
+	}
+	data, err := e.options.encoding.encode(text)
+	if err != nil {
+		return errorResult(err)
+	}
+	return inputResult(e.feedInput(data))
+}
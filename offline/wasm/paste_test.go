@@ -0,0 +1,65 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// guestOutput has the guest print s, as if from the running program.
+func guestOutput(e *Emulator, s string) {
+	e.writer.Write([]byte(s))
+	e.writer.Flush()
+}
+
+// pasted runs tinyemuPaste and returns what it queued for the guest.
+func pasted(t *testing.T, e *Emulator, text string) string {
+	t.Helper()
+	if result := e.call(pasteInput, text).(map[string]interface{}); failed(result) {
+		t.Fatalf("tinyemuPaste(%q): %v", text, result["error"])
+	}
+	defer e.reader.Clear()
+	return string(e.reader.Pending())
+}
+
+func TestPasteFollowsBracketedPasteMode(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	if got := pasted(t, e, "ls -l\n"); got != "ls -l\n" {
+		t.Errorf("paste before the guest asked for brackets queued %q", got)
+	}
+
+	guestOutput(e, "\x1b[?2004h$ ")
+	if got, want := pasted(t, e, "ls -l\n"), pasteStart+"ls -l\n"+pasteEnd; got != want {
+		t.Errorf("bracketed paste queued %q, want %q", got, want)
+	}
+
+	// Set and reset in one sequence together with other modes
+	guestOutput(e, "\x1b[?25;2004l")
+	if got := pasted(t, e, "ls -l\n"); got != "ls -l\n" {
+		t.Errorf("paste once the guest turned brackets off queued %q", got)
+	}
+}
+
+func TestPasteCantEndTheBracketEarly(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	guestOutput(e, "\x1b[?2004h")
+	for _, text := range []string{
+		"echo " + pasteEnd + "; rm -rf ~",
+		pasteStart + "nested" + pasteEnd,
+		// Each marker completes another once the inner one is removed
+		"\x1b[20" + pasteEnd + "1~rm -rf ~",
+		"\x1b[20" + pasteStart + "1~rm -rf ~",
+	} {
+		got := pasted(t, e, text)
+		inner := got[len(pasteStart) : len(got)-len(pasteEnd)]
+		if got[:len(pasteStart)] != pasteStart || got[len(got)-len(pasteEnd):] != pasteEnd {
+			t.Errorf("paste of %q queued %q, which isn't bracketed", text, got)
+		}
+		for _, marker := range []string{pasteStart, pasteEnd} {
+			if strings.Contains(inner, marker) {
+				t.Errorf("paste of %q queued %q, with %q inside the brackets", text, got, marker)
+			}
+		}
+	}
+}
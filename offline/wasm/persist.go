@@ -0,0 +1,250 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// persistBlockSize is the granularity at which dirty disk data is
+	// reported to the persistence bridge.
+	persistBlockSize = 4096
+	// persistFlushInterval batches dirty blocks so a burst of guest writes
+	// becomes one round of IndexedDB puts.
+	persistFlushInterval = time.Second
+)
+
+var errNoPersistence = newError(codeInvalidState, "persistence not enabled, call tinyemuEnablePersistence first")
+
+// persistentDisk wraps a blockBackend and reports blocks the guest has
+// written to a JS callback, which stores them in IndexedDB. Reads pass
+// straight through to the wrapped backend.
+type persistentDisk struct {
+	blockBackend
+	dbName    string
+	writeBack js.Value
+
+	mu    sync.Mutex
+	dirty map[int64]struct{}
+	timer *time.Timer
+
+	// restored holds the blocks restoreBlocks applied, by index: the disk
+	// as it was persisted, which a cold reset goes back to rather than the
+	// bare image.
+	restored map[int64][]byte
+
+	// flushMu serializes flushes so blocks are reported in write order.
+	flushMu sync.Mutex
+}
+
+func newPersistentDisk(base blockBackend, dbName string, writeBack js.Value) *persistentDisk {
+	return &persistentDisk{
+		blockBackend: base,
+		dbName:       dbName,
+		writeBack:    writeBack,
+		dirty:        make(map[int64]struct{}),
+		restored:     make(map[int64][]byte),
+	}
+}
+
+func (d *persistentDisk) WriteAt(p []byte, off int64) (int, error) {
+	n, err := d.blockBackend.WriteAt(p, off)
+	d.markWritten(off, n)
+	return n, err
+}
+
+func (d *persistentDisk) readAtAwaiting(p []byte, off int64, wait awaiter) (int, error) {
+	if a, ok := d.blockBackend.(awaitingBackend); ok {
+		return a.readAtAwaiting(p, off, wait)
+	}
+	return d.blockBackend.ReadAt(p, off)
+}
+
+func (d *persistentDisk) writeAtAwaiting(p []byte, off int64, wait awaiter) (int, error) {
+	a, ok := d.blockBackend.(awaitingBackend)
+	if !ok {
+		return d.WriteAt(p, off)
+	}
+	n, err := a.writeAtAwaiting(p, off, wait)
+	d.markWritten(off, n)
+	return n, err
+}
+
+// markWritten marks the blocks of n bytes written at off dirty and arms
+// the flush timer.
+func (d *persistentDisk) markWritten(off int64, n int) {
+	if n == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for b := off / persistBlockSize; b <= (off+int64(n)-1)/persistBlockSize; b++ {
+		d.dirty[b] = struct{}{}
+	}
+	if d.timer == nil {
+		d.timer = time.AfterFunc(persistFlushInterval, func() { d.Sync() })
+	}
+}
+
+// Revert reverts the wrapped backend, applies the blocks restored from
+// IndexedDB on top again, and writes the reverted blocks back too, so
+// IndexedDB doesn't bring the discarded writes back on reload.
+func (d *persistentDisk) Revert() []int64 {
+	r, ok := d.blockBackend.(reverter)
+	if !ok {
+		return nil
+	}
+	offs := r.Revert()
+	for i, b := range d.restored {
+		if _, err := d.blockBackend.WriteAt(b, i*persistBlockSize); err != nil {
+			defaultLogger.Warnf("reapplying saved block %d of %s: %v", i, d.dbName, err)
+		}
+	}
+	d.mu.Lock()
+	for _, off := range offs {
+		d.dirty[off/persistBlockSize] = struct{}{}
+	}
+	d.mu.Unlock()
+	d.Sync()
+	return offs
+}
+
+func (d *persistentDisk) Overlay() map[int64][]byte {
+	o, ok := d.blockBackend.(overlayer)
+	if !ok {
+		return nil
+	}
+	return o.Overlay()
+}
+
+// SetOverlay sets the wrapped backend's overlay and writes back every
+// block it changes, in the background since a lazy disk may have to fetch
+// them.
+func (d *persistentDisk) SetOverlay(overlay map[int64][]byte) error {
+	o, ok := d.blockBackend.(overlayer)
+	if !ok {
+		return newError(codeUnsupported, "disk doesn't keep an overlay")
+	}
+	prev := o.Overlay()
+	if err := o.SetOverlay(overlay); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	for _, extents := range []map[int64][]byte{prev, overlay} {
+		for off, b := range extents {
+			for blk := off / persistBlockSize; blk <= (off+int64(len(b))-1)/persistBlockSize; blk++ {
+				d.dirty[blk] = struct{}{}
+			}
+		}
+	}
+	d.mu.Unlock()
+	go d.Sync()
+	return nil
+}
+
+// Sync reports every dirty block to the JS callback as
+// (blockIndex, Uint8Array), marks it clean and returns how many it reported.
+func (d *persistentDisk) Sync() int {
+	d.flushMu.Lock()
+	defer d.flushMu.Unlock()
+
+	d.mu.Lock()
+	dirty := d.dirty
+	d.dirty = make(map[int64]struct{})
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.mu.Unlock()
+
+	buf := make([]byte, persistBlockSize)
+	for b := range dirty {
+		n, _ := d.blockBackend.ReadAt(buf, b*persistBlockSize)
+		d.writeBack.Invoke(int(b), bytesToJS(buf[:n]))
+	}
+	return len(dirty)
+}
+
+// restoreBlocks applies saved [blockIndex, Uint8Array] pairs on top of the
+// base image without marking them dirty, and keeps them for Revert.
+func (d *persistentDisk) restoreBlocks(saved js.Value) error {
+	if !js.Global().Get("Array").Call("isArray", saved).Bool() {
+		return fmt.Errorf("savedBlocks must be an array, got %s", saved.Type())
+	}
+	for i := 0; i < saved.Length(); i++ {
+		pair := saved.Index(i)
+		if !js.Global().Get("Array").Call("isArray", pair).Bool() || pair.Length() != 2 || pair.Index(0).Type() != js.TypeNumber {
+			return fmt.Errorf("saved block %d is not a [blockIndex, data] pair", i)
+		}
+		data, err := bytesFromJS(pair.Index(1))
+		if err != nil {
+			return fmt.Errorf("saved block %d: %w", i, err)
+		}
+		index := int64(pair.Index(0).Int())
+		if _, err := d.blockBackend.WriteAt(data, index*persistBlockSize); err != nil {
+			return fmt.Errorf("saved block %d: %w", i, err)
+		}
+		d.restored[index] = data
+	}
+	return nil
+}
+
+// enablePersistence accepts (dbName, writeBlock, savedBlocks). writeBlock is
+// called with (blockIndex, Uint8Array) for each dirty block; savedBlocks is
+// an optional array of [blockIndex, Uint8Array] pairs previously read from
+// IndexedDB, applied to vda so earlier writes survive a reload.
+func enablePersistence(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	dbName, err := stringArg(args, 0, "dbName")
+	if err != nil {
+		return errorResult(err)
+	}
+	writeBlock, err := funcArg(args, 1, "writeBlock")
+	if err != nil {
+		return errorResult(err)
+	}
+	if e.disks[0] == nil {
+		return errResult(codeInvalidState, "no disk loaded as vda, call tinyemuLoadDisk first")
+	}
+	if e.disks[0].ReadOnly() {
+		return errorResult(errReadOnly)
+	}
+
+	base := e.disks[0]
+	if pd, ok := base.(*persistentDisk); ok {
+		pd.Sync()
+		base = pd.blockBackend
+	}
+	disk := newPersistentDisk(base, dbName, writeBlock)
+
+	if present(args, 2) {
+		if err := disk.restoreBlocks(args[2]); err != nil {
+			return errorResult(err)
+		}
+	}
+	e.disks[0] = disk
+
+	return statusResult(statusPersistenceEnabled, map[string]interface{}{"dbName": disk.dbName})
+}
+
+// syncDisk forces dirty blocks out to the persistence bridge, e.g. from a
+// beforeunload handler.
+func syncDisk(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	pd, ok := e.disks[0].(*persistentDisk)
+	if !ok {
+		return errorResult(errNoPersistence)
+	}
+	pd.Sync()
+	return statusResult(statusSynced, nil)
+}
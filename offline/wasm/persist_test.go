@@ -0,0 +1,172 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"sync"
+	"syscall/js"
+	"testing"
+)
+
+// blockStore stands in for the IndexedDB side of the persistence bridge,
+// keeping the blocks writeBlock is called with.
+type blockStore struct {
+	fn     js.Func
+	mu     sync.Mutex
+	blocks map[int][]byte
+	calls  int
+}
+
+func newBlockStore(t *testing.T) *blockStore {
+	s := &blockStore{blocks: make(map[int][]byte)}
+	s.fn = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		data, err := bytesFromJS(args[1])
+		if err != nil {
+			panic(err)
+		}
+		s.mu.Lock()
+		s.blocks[args[0].Int()] = data
+		s.calls++
+		s.mu.Unlock()
+		return nil
+	})
+	t.Cleanup(s.fn.Release)
+	return s
+}
+
+// saved returns the stored blocks as the [blockIndex, data] pairs
+// tinyemuEnablePersistence takes back.
+func (s *blockStore) saved() js.Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pairs := js.Global().Get("Array").New()
+	for i, b := range s.blocks {
+		pairs.Call("push", js.ValueOf([]interface{}{i, bytesToJS(b)}))
+	}
+	return pairs
+}
+
+// persistentTestEmulator returns an emulator with a blank 64 KiB vda saved
+// to store.
+func persistentTestEmulator(t *testing.T, store *blockStore, saved js.Value) *Emulator {
+	t.Helper()
+	e, _ := newTestEmulator(t, nil)
+	e.call(loadDisk, bytesToJS(make([]byte, 16*persistBlockSize)))
+	args := []interface{}{"test-db", store.fn}
+	if saved.Truthy() {
+		args = append(args, saved)
+	}
+	if got := statusOf(e.call(enablePersistence, args...)); got != string(statusPersistenceEnabled) {
+		t.Fatalf("tinyemuEnablePersistence = %s", got)
+	}
+	return e
+}
+
+func TestSyncReportsDirtyBlocks(t *testing.T) {
+	store := newBlockStore(t)
+	e := persistentTestEmulator(t, store, js.Undefined())
+	vda := e.disks[0]
+
+	// Two writes in block 1 and one across the end of block 4 into block 5
+	vda.WriteAt([]byte("one"), persistBlockSize+10)
+	vda.WriteAt(bytes.Repeat([]byte{7}, 8), 5*persistBlockSize-4)
+	vda.WriteAt([]byte("uno"), persistBlockSize+10)
+
+	if got := statusOf(e.call(syncDisk)); got != string(statusSynced) {
+		t.Fatalf("tinyemuSync = %s", got)
+	}
+	if store.calls != 3 {
+		t.Errorf("writeBlock called %d times, want once each for blocks 1, 4 and 5", store.calls)
+	}
+	for _, i := range []int{1, 4, 5} {
+		want := make([]byte, persistBlockSize)
+		vda.ReadAt(want, int64(i)*persistBlockSize)
+		if got, ok := store.blocks[i]; !ok || !bytes.Equal(got, want) {
+			t.Errorf("block %d wasn't reported with its contents", i)
+		}
+	}
+	if got := string(store.blocks[1][10:13]); got != "uno" {
+		t.Errorf("block 1 was saved holding %q, want the last write", got)
+	}
+
+	// Clean blocks aren't reported again
+	e.call(syncDisk)
+	if store.calls != 3 {
+		t.Errorf("a sync with nothing dirty called writeBlock %d more times", store.calls-3)
+	}
+}
+
+func TestSavedBlocksSurviveReload(t *testing.T) {
+	store := newBlockStore(t)
+	e := persistentTestEmulator(t, store, js.Undefined())
+	e.disks[0].WriteAt([]byte("kept"), 2*persistBlockSize)
+	e.call(syncDisk)
+
+	reloaded := persistentTestEmulator(t, newBlockStore(t), store.saved())
+	got := make([]byte, 4)
+	reloaded.disks[0].ReadAt(got, 2*persistBlockSize)
+	if string(got) != "kept" {
+		t.Errorf("after a reload the disk holds %q, want %q", got, "kept")
+	}
+	if pd := reloaded.disks[0].(*persistentDisk); len(pd.dirty) != 0 {
+		t.Errorf("restored blocks %v are marked dirty", pd.dirty)
+	}
+}
+
+func TestColdResetKeepsRestoredBlocks(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	store := newBlockStore(t)
+	e := persistentTestEmulator(t, store, js.Undefined())
+	e.disks[0].WriteAt([]byte("kept"), 2*persistBlockSize)
+	e.call(syncDisk)
+
+	// A reload writes over the restored block and a fresh one, then resets
+	reloaded := newBlockStore(t)
+	e = persistentTestEmulator(t, reloaded, store.saved())
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	e.machineMu.Lock()
+	e.disks[0].WriteAt([]byte("gone"), 2*persistBlockSize)
+	e.disks[0].WriteAt([]byte("temp"), 3*persistBlockSize)
+	e.machineMu.Unlock()
+	if got := statusOf(e.call(resetEmulator, resetCold)); got != string(statusReset) {
+		t.Fatalf("cold reset = %s", got)
+	}
+	e.call(syncDisk)
+
+	got := make([]byte, 4)
+	e.disks[0].ReadAt(got, 2*persistBlockSize)
+	if string(got) != "kept" {
+		t.Errorf("after a cold reset the restored block holds %q, want %q", got, "kept")
+	}
+	e.disks[0].ReadAt(got, 3*persistBlockSize)
+	if !bytes.Equal(got, make([]byte, 4)) {
+		t.Errorf("after a cold reset the block written since holds %q, want the image's zeros", got)
+	}
+
+	// What is persisted is the restored state, not the bare image
+	reloaded.mu.Lock()
+	defer reloaded.mu.Unlock()
+	if b, ok := reloaded.blocks[2]; !ok || string(b[:4]) != "kept" {
+		t.Errorf("block 2 was persisted holding %q, want %q", b[:min(len(b), 4)], "kept")
+	}
+	if b, ok := reloaded.blocks[3]; !ok || !bytes.Equal(b[:4], make([]byte, 4)) {
+		t.Errorf("block 3 was persisted holding %q, want it reverted", b[:min(len(b), 4)])
+	}
+}
+
+func TestPersistenceNeedsAWritableDisk(t *testing.T) {
+	store := newBlockStore(t)
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(enablePersistence, "test-db", store.fn)); got != string(codeInvalidState) {
+		t.Errorf("tinyemuEnablePersistence with no disk = %s, want invalid_state", got)
+	}
+	if got := statusOf(e.call(syncDisk)); got != string(codeInvalidState) {
+		t.Errorf("tinyemuSync without persistence = %s, want invalid_state", got)
+	}
+	e.call(loadDisk, bytesToJS(make([]byte, persistBlockSize)), map[string]interface{}{"readOnly": true})
+	if got := statusOf(e.call(enablePersistence, "test-db", store.fn)); got != string(codeInvalidState) {
+		t.Errorf("tinyemuEnablePersistence on a read-only disk = %s, want invalid_state", got)
+	}
+}
@@ -0,0 +1,131 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"syscall/js"
+	"time"
+)
+
+// progressInterval is the least time between two progress reports of one
+// phase, so a fast load doesn't cross into JS per chunk.
+const progressInterval = 100 * time.Millisecond
+
+// progress reports how far a load has got to an onProgress callback as
+// (bytesProcessed, totalBytes, phase), with totalBytes -1 when unknown.
+// The zero value reports nothing.
+type progress struct {
+	fn    js.Value
+	phase string
+	total int64
+	last  time.Time
+}
+
+// progressOption reads the onProgress field of an optional options object.
+func progressOption(opts js.Value) (js.Value, error) {
+	if opts.Type() != js.TypeObject {
+		return js.Undefined(), nil
+	}
+	return callbackOption(opts, "onProgress")
+}
+
+// newProgress starts reporting a phase such as "download" or
+// "decompress" of total bytes, or -1 if unknown.
+func newProgress(fn js.Value, phase string, total int64) *progress {
+	return &progress{fn: fn, phase: phase, total: total}
+}
+
+// report tells the callback done bytes are processed, at most once per
+// progressInterval.
+func (p *progress) report(done int64) {
+	if p == nil || p.fn.Type() != js.TypeFunction {
+		return
+	}
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.fn.Invoke(float64(done), float64(p.total), p.phase)
+	}
+}
+
+// finish reports the final count, however soon after the last report.
+func (p *progress) finish(done int64) {
+	if p == nil || p.fn.Type() != js.TypeFunction {
+		return
+	}
+	p.fn.Invoke(float64(done), float64(p.total), p.phase)
+}
+
+// progressReader reports how much of r has been read.
+type progressReader struct {
+	r        io.Reader
+	progress *progress
+	n        int64
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.n += int64(n)
+	pr.progress.report(pr.n)
+	return n, err
+}
+
+// contentLength returns a response's Content-Length, or -1 if it is
+// missing or describes an encoded body rather than what reading yields.
+func contentLength(resp js.Value) int64 {
+	headers := resp.Get("headers")
+	if enc := headers.Call("get", "Content-Encoding"); !enc.IsNull() && enc.String() != "identity" {
+		return -1
+	}
+	v := headers.Call("get", "Content-Length")
+	if v.IsNull() {
+		return -1
+	}
+	n, err := strconv.ParseInt(v.String(), 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// readBody reads a response body chunk by chunk through its stream
+// reader, reporting progress as it goes, and stops past maxImageSize or
+// once ctx is done.
+func readBody(ctx context.Context, resp js.Value, onProgress js.Value) ([]byte, error) {
+	total := contentLength(resp)
+	p := newProgress(onProgress, "download", total)
+	reader := resp.Get("body").Call("getReader")
+
+	var data []byte
+	if total > 0 && total <= maxImageSize {
+		data = make([]byte, 0, total)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			reader.Call("cancel")
+			return nil, err
+		}
+		chunk, err := await(reader.Call("read"))
+		if err != nil {
+			return nil, err
+		}
+		if chunk.Get("done").Bool() {
+			break
+		}
+		value := chunk.Get("value")
+		n := value.Get("length").Int()
+		if len(data)+n > maxImageSize {
+			reader.Call("cancel")
+			return nil, fmt.Errorf("image exceeds %d bytes", maxImageSize)
+		}
+		start := len(data)
+		data = append(data, make([]byte, n)...)
+		js.CopyBytesToGo(data[start:], value)
+		p.report(int64(len(data)))
+	}
+	p.finish(int64(len(data)))
+	return data, nil
+}
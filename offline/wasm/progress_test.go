@@ -0,0 +1,111 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"syscall/js"
+	"testing"
+)
+
+// mockResponse builds a fetch Response whose body yields chunks, each
+// after delayMs, with the given Content-Length header or none if null.
+var mockResponse = js.Global().Get("Function").New("chunks", "length", "delayMs", `
+	let i = 0;
+	return {
+		ok: true,
+		status: 200,
+		headers: {get: name => name === "Content-Length" ? length : null},
+		body: {getReader: () => ({
+			read: () => new Promise(resolve => setTimeout(() => resolve(
+				i < chunks.length ? {done: false, value: chunks[i++]} : {done: true}), delayMs)),
+			cancel: () => {},
+		})},
+	};`)
+
+// progressReport is one onProgress call.
+type progressReport struct {
+	done, total float64
+	phase       string
+}
+
+// progressRecorder is an onProgress callback that keeps its reports.
+func progressRecorder(t *testing.T) (js.Value, *[]progressReport) {
+	reports := new([]progressReport)
+	fn := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		*reports = append(*reports, progressReport{args[0].Float(), args[1].Float(), args[2].String()})
+		return nil
+	})
+	t.Cleanup(fn.Release)
+	return fn.Value, reports
+}
+
+// checkReports checks reports are of phase and total, count up and end
+// at final.
+func checkReports(t *testing.T, reports []progressReport, phase string, total, final float64, min int) {
+	t.Helper()
+	if len(reports) < min {
+		t.Fatalf("%d progress reports, want at least %d: %v", len(reports), min, reports)
+	}
+	for i, r := range reports {
+		if r.phase != phase || r.total != total {
+			t.Errorf("report %d = %+v, want phase %q of total %v", i, r, phase, total)
+		}
+		// The final count may repeat the last throttled one
+		if i > 0 && i < len(reports)-1 && r.done <= reports[i-1].done {
+			t.Errorf("report %d went from %v to %v bytes", i, reports[i-1].done, r.done)
+		}
+	}
+	if last := reports[len(reports)-1].done; last != final {
+		t.Errorf("last report is %v bytes, want %v", last, final)
+	}
+}
+
+func TestDownloadProgressCountsUp(t *testing.T) {
+	var want []byte
+	chunks := make([]interface{}, 6)
+	for i := range chunks {
+		chunk := bytes.Repeat([]byte{byte(i)}, 1000)
+		want = append(want, chunk...)
+		chunks[i] = bytesToJS(chunk)
+	}
+
+	for _, length := range []interface{}{"6000", nil} {
+		onProgress, reports := progressRecorder(t)
+		resp := mockResponse.Invoke(chunks, length, 50)
+		data, err := readBody(context.Background(), resp, onProgress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("read %d bytes, not the %d the chunks hold", len(data), len(want))
+		}
+
+		// Chunks 50ms apart against a 100ms throttle report every other
+		// one, then the total
+		total := float64(-1)
+		if length != nil {
+			total = 6000
+		}
+		checkReports(t, *reports, "download", total, 6000, 3)
+	}
+}
+
+func TestDecompressProgressCountsUp(t *testing.T) {
+	// Random bytes don't compress, so there is plenty of input to consume
+	raw := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(raw)
+	gz := gzipBytes(t, raw)
+
+	onProgress, reports := progressRecorder(t)
+	out, err := decompressImage(context.Background(), gz, "gzip", onProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, raw) {
+		t.Fatal("decompressed image differs")
+	}
+	checkReports(t, *reports, "decompress", float64(len(gz)), float64(len(gz)), 2)
+}
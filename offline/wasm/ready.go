@@ -0,0 +1,180 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// readyWindow is how much recent output the ready pattern is matched
+// against, so a prompt split across writes still matches.
+const readyWindow = 4096
+
+// readyWatcher decides when a run counts as ready: when console output
+// matches the pattern, or once the machine has booted if none is set.
+type readyWatcher struct {
+	mu      sync.Mutex
+	pattern *regexp.Regexp
+	window  []byte
+	matched bool
+	fired   bool
+	readyCh chan struct{} // closed when take first reports ready
+}
+
+func (w *readyWatcher) setPattern(re *regexp.Regexp) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pattern = re
+	w.matched = false
+	w.window = w.window[:0]
+}
+
+// reset rearms the watcher for a new run.
+func (w *readyWatcher) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.matched = false
+	w.fired = false
+	w.window = w.window[:0]
+	w.readyCh = make(chan struct{})
+}
+
+// readied returns a channel closed once the current run becomes ready.
+func (w *readyWatcher) readied() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.readyCh
+}
+
+// observe matches console output against the pattern.
+func (w *readyWatcher) observe(p []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pattern == nil || w.matched || w.fired {
+		return
+	}
+	w.window = append(w.window, p...)
+	if over := len(w.window) - readyWindow; over > 0 {
+		w.window = append(w.window[:0], w.window[over:]...)
+	}
+	w.matched = w.pattern.Match(w.window)
+}
+
+// take reports, once per run, that the run has become ready.
+func (w *readyWatcher) take(booted bool) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fired {
+		return false
+	}
+	if w.pattern != nil {
+		w.fired = w.matched
+	} else {
+		w.fired = booted
+	}
+	if w.fired && w.readyCh != nil {
+		close(w.readyCh)
+	}
+	return w.fired
+}
+
+// watchBoot derives a boot deadline from the run's ctx. If the run isn't
+// ready by then it is stopped in the boot_timeout state and onError is
+// told why.
+func (e *Emulator) watchBoot(ctx context.Context, stop context.CancelFunc, timeout time.Duration) {
+	bootCtx, cancel := context.WithTimeout(ctx, timeout)
+	ready := e.ready.readied()
+
+	go func() {
+		defer cancel()
+		select {
+		case <-ready:
+			return
+		case <-bootCtx.Done():
+		}
+		select {
+		case <-ready:
+			return
+		default:
+		}
+		if !errors.Is(bootCtx.Err(), context.DeadlineExceeded) || ctx.Err() != nil {
+			return
+		}
+		if !e.transitionFrom(stateBootTimeout, stateStarting, stateRunning, statePaused) {
+			return
+		}
+
+		stop()
+		e.writer.Flush()
+		msg := fmt.Sprintf("boot did not complete within %v", timeout)
+		e.log.Warnf("%s", msg)
+		if e.options.onError.Type() == js.TypeFunction {
+			e.options.onError.Invoke(map[string]interface{}{"message": msg, "code": stateBootTimeout})
+		}
+	}()
+}
+
+// bootTimeoutOption reads bootTimeoutMs from tinyemuStart's optional
+// options object.
+func bootTimeoutOption(args []js.Value) (time.Duration, error) {
+	opts, err := optionalObjectArg(args, 0, "start options")
+	if err != nil || opts.IsUndefined() {
+		return 0, err
+	}
+	ms := opts.Get("bootTimeoutMs")
+	if ms.IsUndefined() || ms.IsNull() {
+		return 0, nil
+	}
+	if ms.Type() != js.TypeNumber || ms.Float() < 0 {
+		return 0, errors.New("bootTimeoutMs must be a number >= 0")
+	}
+	return time.Duration(ms.Float() * float64(time.Millisecond)), nil
+}
+
+// watchedConsole feeds machine output to the ready watcher, any
+// tinyemuWaitFor waiters and the watchdog on its way to the console writer.
+type watchedConsole struct {
+	e *Emulator
+}
+
+func (c watchedConsole) Write(p []byte) (int, error) {
+	c.e.ready.observe(p)
+	c.e.waiters.observe(p)
+	c.e.watchdog.kick()
+	return c.e.writer.Write(p)
+}
+
+// setReadyPattern sets the regular expression (Go RE2 syntax) whose match
+// in console output fires onReady. An empty pattern or null falls back to
+// firing when boot finishes.
+func setReadyPattern(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	pattern := ""
+	if present(args, 0) {
+		if pattern, err = stringArg(args, 0, "pattern"); err != nil {
+			return errorResult(err)
+		}
+	}
+	if pattern == "" {
+		e.ready.setPattern(nil)
+		return statusResult(statusReadyPatternCleared, nil)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return errorResult(err)
+	}
+	e.ready.setPattern(re)
+	return statusResult(statusReadyPatternSet, map[string]interface{}{"pattern": re.String()})
+}
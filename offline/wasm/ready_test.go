@@ -0,0 +1,120 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestReadyWatcherMatchesAcrossWrites(t *testing.T) {
+	var w readyWatcher
+	w.reset()
+	w.setPattern(regexp.MustCompile(`login: $`))
+
+	w.observe([]byte("Welcome\nlog"))
+	if w.take(true) {
+		t.Fatal("ready before the pattern matched, although booted")
+	}
+	w.observe([]byte("in: "))
+	if !w.take(false) {
+		t.Fatal("not ready after the pattern matched across two writes")
+	}
+	if w.take(true) {
+		t.Error("ready reported twice in one run")
+	}
+	select {
+	case <-w.readied():
+	default:
+		t.Error("readied channel still open")
+	}
+
+	// A new run has to match again
+	w.reset()
+	if w.take(true) {
+		t.Error("a reset run is ready with no new output")
+	}
+	w.observe([]byte("login: "))
+	if !w.take(false) {
+		t.Error("a reset run didn't become ready on a match")
+	}
+}
+
+func TestReadyWatcherWithoutPatternWaitsForBoot(t *testing.T) {
+	var w readyWatcher
+	w.reset()
+	w.observe([]byte("login: "))
+	if w.take(false) {
+		t.Error("ready before boot without a pattern")
+	}
+	if !w.take(true) {
+		t.Error("not ready once booted without a pattern")
+	}
+}
+
+// promptMachine prints boot messages and the prompt on step promptAt.
+func promptMachine(prompt string, promptAt int) func(machineConfig) machine {
+	return func(config machineConfig) machine {
+		return &testMachine{step: func(steps int) {
+			if steps == promptAt {
+				fmt.Fprint(config.console, prompt)
+				return
+			}
+			fmt.Fprintf(config.console, "[%d] starting\n", steps)
+		}}
+	}
+}
+
+func TestOnReadyFiresOncePerRunOnMatch(t *testing.T) {
+	useMachine(t, promptMachine("\nbuildroot login: ", 3))
+	onReady, calls := countingCallback(t)
+	e, rec := newTestEmulator(t, map[string]interface{}{"onReady": onReady})
+	if got := statusOf(e.call(setReadyPattern, `login: $`)); got != string(statusReadyPatternSet) {
+		t.Fatalf("tinyemuSetReadyPattern = %s", got)
+	}
+
+	for run := 1; run <= 2; run++ {
+		e.call(startEmulator)
+		out := waitOutput(t, rec, len(rec.text())+60)
+		if *calls != run {
+			t.Errorf("run %d: onReady called %d times in all after %q", run, *calls, out)
+		}
+		e.call(stopEmulator)
+		waitState(t, e, stateStopped)
+	}
+}
+
+func TestOnReadyWaitsForAMatch(t *testing.T) {
+	useMachine(t, promptMachine("# ", 100))
+	onReady, calls := countingCallback(t)
+	e, rec := newTestEmulator(t, map[string]interface{}{"onReady": onReady})
+	e.call(setReadyPattern, `login: `)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	waitOutput(t, rec, 40)
+	time.Sleep(2 * stepInterval)
+	if *calls != 0 {
+		t.Errorf("onReady called %d times with no output matching", *calls)
+	}
+
+	// Clearing the pattern falls back to boot, which has happened
+	if got := statusOf(e.call(setReadyPattern, nil)); got != string(statusReadyPatternCleared) {
+		t.Fatalf("clearing the pattern = %s", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for *calls == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if *calls != 1 {
+		t.Errorf("onReady called %d times after clearing the pattern, want 1", *calls)
+	}
+}
+
+func TestSetReadyPatternRejectsBadRegex(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(setReadyPattern, `login(`)); got != string(codeInvalidArgument) {
+		t.Errorf("an unbalanced pattern = %s, want invalid_argument", got)
+	}
+}
@@ -0,0 +1,198 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall/js"
+	"time"
+	"unicode/utf8"
+)
+
+// transcriptVersion is bumped whenever the transcript JSON changes shape.
+const transcriptVersion = 1
+
+// transcript is a recorded console session.
+type transcript struct {
+	Version int               `json:"version"`
+	Events  []transcriptEvent `json:"events"`
+}
+
+// transcriptEvent is one chunk of input or output. T is milliseconds since
+// recording started. Data holds text; bytes that aren't valid UTF-8 go in
+// Base64 instead so they survive JSON.
+type transcriptEvent struct {
+	T      float64 `json:"t"`
+	Type   string  `json:"type"` // "input" or "output"
+	Data   string  `json:"data,omitempty"`
+	Base64 string  `json:"base64,omitempty"`
+}
+
+func (ev transcriptEvent) bytes() ([]byte, error) {
+	if ev.Base64 != "" {
+		return base64.StdEncoding.DecodeString(ev.Base64)
+	}
+	return []byte(ev.Data), nil
+}
+
+// recorder appends console traffic to an in-memory transcript while active.
+type recorder struct {
+	mu      sync.Mutex
+	active  bool
+	started time.Time
+	events  []transcriptEvent
+
+	// replayStop cancels the replay in progress, if any
+	replayStop chan struct{}
+}
+
+func (r *recorder) record(typ string, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.active || len(p) == 0 {
+		return
+	}
+	ev := transcriptEvent{
+		T:    float64(time.Since(r.started).Microseconds()) / 1000,
+		Type: typ,
+	}
+	if utf8.Valid(p) {
+		ev.Data = string(p)
+	} else {
+		ev.Base64 = base64.StdEncoding.EncodeToString(p)
+	}
+	r.events = append(r.events, ev)
+}
+
+func (r *recorder) input(p []byte)  { r.record("input", p) }
+func (r *recorder) output(p []byte) { r.record("output", p) }
+
+func (r *recorder) start() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active {
+		return false
+	}
+	r.active = true
+	r.started = time.Now()
+	r.events = nil
+	return true
+}
+
+func (r *recorder) stop() (transcript, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.active {
+		return transcript{}, false
+	}
+	r.active = false
+	t := transcript{Version: transcriptVersion, Events: r.events}
+	r.events = nil
+	return t, true
+}
+
+func parseTranscript(s string) (transcript, error) {
+	var t transcript
+	if err := json.Unmarshal([]byte(s), &t); err != nil {
+		return t, fmt.Errorf("invalid transcript: %v", err)
+	}
+	if t.Version != transcriptVersion {
+		return t, fmt.Errorf("unsupported transcript version %d", t.Version)
+	}
+	return t, nil
+}
+
+// replay feeds the transcript's input events back with their original
+// timing until it runs out or stop is closed.
+func (e *Emulator) replay(events []transcriptEvent, stop <-chan struct{}) {
+	start := time.Now()
+	for _, ev := range events {
+		data, _ := ev.bytes()
+		at := start.Add(time.Duration(ev.T * float64(time.Millisecond)))
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := e.feedInput(data); err != nil && !errors.Is(err, ErrInputDropped) {
+			e.log.Warnf("replay input rejected: %v", err)
+		}
+	}
+}
+
+func startRecording(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !e.recorder.start() {
+		return statusResult(statusAlreadyRecording, nil)
+	}
+	return statusResult(statusRecording, nil)
+}
+
+// stopRecording ends the recording and returns the transcript as JSON.
+func stopRecording(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	t, ok := e.recorder.stop()
+	if !ok {
+		return errResult(codeInvalidState, "not recording")
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return errorResult(err)
+	}
+	return statusResult(statusStopped, map[string]interface{}{"transcript": string(data), "events": len(t.Events)})
+}
+
+// replayTranscript re-feeds a transcript's input in the background,
+// replacing any replay already running.
+func replayTranscript(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	data, err := stringArg(args, 0, "transcript")
+	if err != nil {
+		return errorResult(err)
+	}
+	t, err := parseTranscript(data)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	var inputs []transcriptEvent
+	for _, ev := range t.Events {
+		if ev.Type != "input" {
+			continue
+		}
+		if _, err := ev.bytes(); err != nil {
+			return errResult(codeInvalidArgument, fmt.Sprintf("invalid transcript: event at %vms: %v", ev.T, err))
+		}
+		inputs = append(inputs, ev)
+	}
+
+	e.recorder.mu.Lock()
+	if e.recorder.replayStop != nil {
+		close(e.recorder.replayStop)
+	}
+	stop := make(chan struct{})
+	e.recorder.replayStop = stop
+	e.recorder.mu.Unlock()
+
+	go e.replay(inputs, stop)
+	return statusResult(statusReplaying, map[string]interface{}{"events": len(inputs)})
+}
@@ -0,0 +1,104 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// stopTranscript ends e's recording and parses the transcript it returns.
+func stopTranscript(t *testing.T, e *Emulator) transcript {
+	t.Helper()
+	r := e.call(stopRecording).(map[string]interface{})
+	if statusOf(r) != string(statusStopped) {
+		t.Fatalf("tinyemuStopRecording = %v", r)
+	}
+	tr, err := parseTranscript(r["data"].(map[string]interface{})["transcript"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestRecordingKeepsEventsInOrder(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	e.call(sendInput, "before\n")
+	if got := statusOf(e.call(startRecording)); got != string(statusRecording) {
+		t.Fatalf("tinyemuStartRecording = %s", got)
+	}
+	if got := statusOf(e.call(startRecording)); got != string(statusAlreadyRecording) {
+		t.Errorf("second tinyemuStartRecording = %s, want already_recording", got)
+	}
+
+	e.call(sendInput, "ls\n")
+	guestOutput(e, "file.txt\n")
+	time.Sleep(5 * time.Millisecond)
+	e.call(sendInput, js.Global().Get("Uint8Array").Call("of", 0xff, 0x00))
+	guestOutput(e, "$ ")
+
+	tr := stopTranscript(t, e)
+	want := []transcriptEvent{
+		{Type: "input", Data: "ls\n"},
+		{Type: "output", Data: "file.txt\n"},
+		{Type: "input", Base64: "/wA="},
+		{Type: "output", Data: "$ "},
+	}
+	if len(tr.Events) != len(want) {
+		t.Fatalf("transcript has events %+v, want %+v", tr.Events, want)
+	}
+	for i, ev := range tr.Events {
+		if ev.Type != want[i].Type || ev.Data != want[i].Data || ev.Base64 != want[i].Base64 {
+			t.Errorf("event %d = %+v, want %+v", i, ev, want[i])
+		}
+		if i > 0 && ev.T < tr.Events[i-1].T {
+			t.Errorf("event %d at %vms comes before the one ahead of it at %vms", i, ev.T, tr.Events[i-1].T)
+		}
+	}
+	if tr.Events[2].T < 5 {
+		t.Errorf("input sent 5ms in is stamped %vms", tr.Events[2].T)
+	}
+
+	// Traffic after stopping isn't recorded, and there is nothing to stop
+	e.call(sendInput, "after\n")
+	if got := statusOf(e.call(stopRecording)); got != string(codeInvalidState) {
+		t.Errorf("stopping twice = %s, want invalid_state", got)
+	}
+}
+
+func TestReplayFeedsInputWithItsTiming(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	data, _ := json.Marshal(transcript{Version: transcriptVersion, Events: []transcriptEvent{
+		{T: 0, Type: "input", Data: "a"},
+		{T: 1, Type: "output", Data: "ignored"},
+		{T: 200, Type: "input", Base64: "Yg=="},
+	}})
+	r := e.call(replayTranscript, string(data)).(map[string]interface{})
+	if statusOf(r) != string(statusReplaying) || r["data"].(map[string]interface{})["events"] != 2 {
+		t.Fatalf("tinyemuReplay = %v", r)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := string(e.reader.Pending()); got != "a" {
+		t.Errorf("100ms in the guest has %q, want %q", got, "a")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got := string(e.reader.Pending()); got != "ab" {
+		t.Errorf("300ms in the guest has %q, want %q", got, "ab")
+	}
+}
+
+func TestReplayRejectsBadTranscripts(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	for _, s := range []string{
+		"not json",
+		`{"version":99,"events":[]}`,
+		`{"version":1,"events":[{"t":0,"type":"input","base64":"!!"}]}`,
+	} {
+		if got := statusOf(e.call(replayTranscript, s)); got != string(codeInvalidArgument) {
+			t.Errorf("tinyemuReplay(%s) = %s, want invalid_argument", s, got)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"syscall/js"
+)
+
+// Every exported function returns a result object JavaScript can branch on
+// uniformly:
+//
+//	{ok: true, data: {...}}
+//	{ok: false, error: {code, message}, data?: {...}}
+//
+// data holds what a call used to return flat, and error.message the old
+// error string, so {error: r.error?.message, ...r.data} recovers the
+// earlier shape. error.code and data.status, where a call reports one,
+// come from the fixed sets below, which tinyemuGetSchema lists so clients
+// can generate their types from them.
+
+// resultCode is an error code carried in error.code. Every code is one of
+// the constants below, so clients can switch on them exhaustively.
+type resultCode string
+
+// Error codes carried in error.code.
+const (
+	codeNotInitialized  resultCode = "not_initialized"
+	codeAlreadyInit     resultCode = "already_initialized"
+	codeUnknownHandle   resultCode = "unknown_handle"
+	codeInvalidArgument resultCode = "invalid_argument"
+	codeInvalidState    resultCode = "invalid_state"
+	codeBusy            resultCode = "busy" // the machine is mid-instruction
+	codeAlreadyRunning  resultCode = "already_running"
+	codeNotRunning      resultCode = "not_running"
+	codeCrashed         resultCode = "crashed"
+	codeNoKernel        resultCode = "no_kernel"
+	codeMissingImage    resultCode = "missing_image"
+	codeUnsupported     resultCode = "unsupported" // the machine lacks the device
+	codeUnavailable     resultCode = "unavailable" // the browser lacks the feature
+	codeOutOfMemory     resultCode = "out_of_memory"
+	codeTimeout         resultCode = "timeout"
+	codeBufferFull      resultCode = "buffer_full"
+	codeInputDropped    resultCode = "input_dropped"
+	codeInputClosed     resultCode = "closed"
+	codeFetchFailed     resultCode = "fetch_failed"
+	codeUnknownMessage  resultCode = "unknown_message"
+)
+
+// resultCodes lists every error code, as tinyemuGetSchema reports them.
+var resultCodes = []resultCode{
+	codeNotInitialized,
+	codeAlreadyInit,
+	codeUnknownHandle,
+	codeInvalidArgument,
+	codeInvalidState,
+	codeBusy,
+	codeAlreadyRunning,
+	codeNotRunning,
+	codeCrashed,
+	codeNoKernel,
+	codeMissingImage,
+	codeUnsupported,
+	codeUnavailable,
+	codeOutOfMemory,
+	codeTimeout,
+	codeBufferFull,
+	codeInputDropped,
+	codeInputClosed,
+	codeFetchFailed,
+	codeUnknownMessage,
+}
+
+// resultStatus is the status a successful call reports in data.status.
+// Every status is one of the constants below.
+type resultStatus string
+
+// Statuses carried in data.status, and in onNetwork events.
+const (
+	statusAlreadyAttached     resultStatus = "already_attached"
+	statusAlreadyPaused       resultStatus = "already_paused"
+	statusAlreadyRecording    resultStatus = "already_recording"
+	statusAlreadyRunning      resultStatus = "already_running"
+	statusAlreadySet          resultStatus = "already_set"
+	statusAttached            resultStatus = "attached"
+	statusAudioCallbackSet    resultStatus = "audio_callback_set"
+	statusBound               resultStatus = "bound"
+	statusBreakpointCleared   resultStatus = "breakpoint_cleared"
+	statusBreakpointSet       resultStatus = "breakpoint_set"
+	statusCanceled            resultStatus = "canceled"
+	statusCmdlineSet          resultStatus = "cmdline_set"
+	statusCompleted           resultStatus = "completed"
+	statusConnecting          resultStatus = "connecting"
+	statusDetached            resultStatus = "detached"
+	statusDiskLoaded          resultStatus = "disk_loaded"
+	statusDisplayCallbackSet  resultStatus = "display_callback_set"
+	statusDisposeTimeout      resultStatus = "dispose_timeout"
+	statusDisposed            resultStatus = "disposed"
+	statusDown                resultStatus = "down"
+	statusDTBLoaded           resultStatus = "dtb_loaded"
+	statusFallback            resultStatus = "fallback"
+	statusFeatureSet          resultStatus = "feature_set"
+	statusFirmwareLoaded      resultStatus = "firmware_loaded"
+	statusFlushed             resultStatus = "flushed"
+	statusIgnored             resultStatus = "ignored"
+	statusInitialized         resultStatus = "initialized"
+	statusInitrdLoaded        resultStatus = "initrd_loaded"
+	statusInputCleared        resultStatus = "input_cleared"
+	statusInputClosed         resultStatus = "input_closed"
+	statusKernelLoaded        resultStatus = "kernel_loaded"
+	statusLineModeSet         resultStatus = "line_mode_set"
+	statusLogLevelSet         resultStatus = "log_level_set"
+	statusMessageCallbackSet  resultStatus = "message_callback_set"
+	statusMeterCallbackSet    resultStatus = "meter_callback_set"
+	statusNotAttached         resultStatus = "not_attached"
+	statusNotLoading          resultStatus = "not_loading"
+	statusNotRunning          resultStatus = "not_running"
+	statusNotSet              resultStatus = "not_set"
+	statusPaused              resultStatus = "paused"
+	statusPersistenceEnabled  resultStatus = "persistence_enabled"
+	statusReadyPatternCleared resultStatus = "ready_pattern_cleared"
+	statusReadyPatternSet     resultStatus = "ready_pattern_set"
+	statusRecording           resultStatus = "recording"
+	statusReplaying           resultStatus = "replaying"
+	statusReset               resultStatus = "reset"
+	statusResized             resultStatus = "resized"
+	statusRestored            resultStatus = "restored"
+	statusRunning             resultStatus = "running"
+	statusSignaled            resultStatus = "signaled"
+	statusSinkAdded           resultStatus = "sink_added"
+	statusSinkRemoved         resultStatus = "sink_removed"
+	statusSpeedSet            resultStatus = "speed_set"
+	statusStarting            resultStatus = "starting"
+	statusStopTimeout         resultStatus = "stop_timeout"
+	statusStopped             resultStatus = "stopped"
+	statusSynced              resultStatus = "synced"
+	statusUnbound             resultStatus = "unbound"
+	statusUnloadReady         resultStatus = "unload_ready"
+	statusUp                  resultStatus = "up"
+	statusWatchdogSet         resultStatus = "watchdog_set"
+)
+
+// resultStatuses lists every status, as tinyemuGetSchema reports them.
+var resultStatuses = []resultStatus{
+	statusAlreadyAttached,
+	statusAlreadyPaused,
+	statusAlreadyRecording,
+	statusAlreadyRunning,
+	statusAlreadySet,
+	statusAttached,
+	statusAudioCallbackSet,
+	statusBound,
+	statusBreakpointCleared,
+	statusBreakpointSet,
+	statusCanceled,
+	statusCmdlineSet,
+	statusCompleted,
+	statusConnecting,
+	statusDetached,
+	statusDiskLoaded,
+	statusDisplayCallbackSet,
+	statusDisposeTimeout,
+	statusDisposed,
+	statusDown,
+	statusDTBLoaded,
+	statusFallback,
+	statusFeatureSet,
+	statusFirmwareLoaded,
+	statusFlushed,
+	statusIgnored,
+	statusInitialized,
+	statusInitrdLoaded,
+	statusInputCleared,
+	statusInputClosed,
+	statusKernelLoaded,
+	statusLineModeSet,
+	statusLogLevelSet,
+	statusMessageCallbackSet,
+	statusMeterCallbackSet,
+	statusNotAttached,
+	statusNotLoading,
+	statusNotRunning,
+	statusNotSet,
+	statusPaused,
+	statusPersistenceEnabled,
+	statusReadyPatternCleared,
+	statusReadyPatternSet,
+	statusRecording,
+	statusReplaying,
+	statusReset,
+	statusResized,
+	statusRestored,
+	statusRunning,
+	statusSignaled,
+	statusSinkAdded,
+	statusSinkRemoved,
+	statusSpeedSet,
+	statusStarting,
+	statusStopTimeout,
+	statusStopped,
+	statusSynced,
+	statusUnbound,
+	statusUnloadReady,
+	statusUp,
+	statusWatchdogSet,
+}
+
+// apiError is an error with a code for JavaScript. Errors without one are
+// reported as invalid_argument, the usual cause in this API.
+type apiError struct {
+	code resultCode
+	err  error
+}
+
+func (e *apiError) Error() string { return e.err.Error() }
+func (e *apiError) Unwrap() error { return e.err }
+
+func newError(code resultCode, message string) error {
+	return &apiError{code: code, err: errors.New(message)}
+}
+
+// withCode attaches code to err.
+func withCode(code resultCode, err error) error {
+	return &apiError{code: code, err: err}
+}
+
+// errorCode returns err's code.
+func errorCode(err error) resultCode {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.code
+	}
+	return codeInvalidArgument
+}
+
+// okResult wraps data, which may be nil, as a success.
+func okResult(data map[string]interface{}) map[string]interface{} {
+	r := map[string]interface{}{"ok": true}
+	if data != nil {
+		r["data"] = data
+	}
+	return r
+}
+
+// statusResult is the success of a call that reports what it did, with
+// status set among the fields of data. fields may be nil.
+func statusResult(status resultStatus, fields map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		data[k] = v
+	}
+	data["status"] = string(status)
+	return okResult(data)
+}
+
+// errResult builds a failure with an explicit code.
+func errResult(code resultCode, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"ok":    false,
+		"error": map[string]interface{}{"code": string(code), "message": message},
+	}
+}
+
+// errorResult reports err, using its code if it has one.
+func errorResult(err error) map[string]interface{} {
+	return errResult(errorCode(err), err.Error())
+}
+
+// failed reports whether r is an error result.
+func failed(r map[string]interface{}) bool {
+	ok, _ := r["ok"].(bool)
+	return !ok
+}
+
+// errorValue is resultError for a Go error.
+func errorValue(err error) js.Value {
+	return resultError(errorResult(err))
+}
+
+// resultError turns a failed result into a JS Error with a code property,
+// for rejecting promises.
+func resultError(r map[string]interface{}) js.Value {
+	e, _ := r["error"].(map[string]interface{})
+	message, _ := e["message"].(string)
+	err := jsError(message)
+	err.Set("code", e["code"])
+	return err
+}
+
+// getSchema returns {statuses, errorCodes, states}: every value data.status,
+// error.code and the lifecycle state can take. It needs no instance.
+func getSchema(this js.Value, args []js.Value) interface{} {
+	statuses := make([]interface{}, len(resultStatuses))
+	for i, s := range resultStatuses {
+		statuses[i] = string(s)
+	}
+	codes := make([]interface{}, len(resultCodes))
+	for i, c := range resultCodes {
+		codes[i] = string(c)
+	}
+	states := make([]interface{}, len(lifecycleStates))
+	for i, s := range lifecycleStates {
+		states[i] = s
+	}
+	return okResult(map[string]interface{}{
+		"statuses":   statuses,
+		"errorCodes": codes,
+		"states":     states,
+	})
+}
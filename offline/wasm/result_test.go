@@ -0,0 +1,212 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"syscall/js"
+	"testing"
+)
+
+func TestResultShapes(t *testing.T) {
+	if got := okResult(nil); !reflect.DeepEqual(got, map[string]interface{}{"ok": true}) {
+		t.Errorf("okResult(nil) = %v", got)
+	}
+	fields := map[string]interface{}{"device": "vda"}
+	want := map[string]interface{}{"ok": true, "data": map[string]interface{}{"device": "vda", "status": "synced"}}
+	if got := statusResult(statusSynced, fields); !reflect.DeepEqual(got, want) {
+		t.Errorf("statusResult = %v, want %v", got, want)
+	}
+	if _, ok := fields["status"]; ok {
+		t.Error("statusResult added status to the caller's map")
+	}
+
+	want = map[string]interface{}{"ok": false, "error": map[string]interface{}{"code": "timeout", "message": "too slow"}}
+	if got := errResult(codeTimeout, "too slow"); !reflect.DeepEqual(got, want) || !failed(got) {
+		t.Errorf("errResult = %v, want %v", got, want)
+	}
+
+	// A code survives wrapping, and an error without one is a bad argument
+	wrapped := fmt.Errorf("staging: %w", withCode(codeMissingImage, errors.New("no initrd")))
+	if got := errorResult(wrapped)["error"]; !reflect.DeepEqual(got, map[string]interface{}{"code": "missing_image", "message": "staging: no initrd"}) {
+		t.Errorf("errorResult of a wrapped error = %v", got)
+	}
+	if got := errorCode(errors.New("bad")); got != codeInvalidArgument {
+		t.Errorf("errorCode of a plain error = %s, want invalid_argument", got)
+	}
+
+	v := errorValue(newError(codeCrashed, "guest crashed"))
+	if !v.InstanceOf(js.Global().Get("Error")) || v.Get("code").String() != "crashed" || v.Get("message").String() != "guest crashed" {
+		t.Errorf("errorValue = %v with code %v", v, v.Get("code"))
+	}
+}
+
+// withoutInstances hides every instance until the test ends.
+func withoutInstances(t *testing.T) {
+	instancesMu.Lock()
+	saved, savedDefault := instances, defaultHandle
+	instances, defaultHandle = make(map[int]*Emulator), 0
+	instancesMu.Unlock()
+	t.Cleanup(func() {
+		instancesMu.Lock()
+		instances, defaultHandle = saved, savedDefault
+		instancesMu.Unlock()
+	})
+}
+
+func TestErrorPathsReturnTheirCodes(t *testing.T) {
+	t.Run("not_initialized", func(t *testing.T) {
+		withoutInstances(t)
+		if got := statusOf(sendInput(js.Undefined(), []js.Value{js.ValueOf("ls\n")})); got != string(codeNotInitialized) {
+			t.Errorf("tinyemuSendInput before tinyemuInit = %s", got)
+		}
+	})
+
+	callback := newOutputRecorder(t).fn.Value
+	tests := []struct {
+		code  resultCode
+		opts  map[string]interface{}
+		fails func(e *Emulator) interface{}
+	}{
+		{codeUnknownHandle, nil, func(e *Emulator) interface{} {
+			return sendInput(js.Undefined(), []js.Value{js.ValueOf(e.handle + 1000), js.ValueOf("x")})
+		}},
+		{codeAlreadyInit, nil, func(e *Emulator) interface{} {
+			return initEmulator(js.Undefined(), []js.Value{callback, js.ValueOf(map[string]interface{}{"reinit": false})})
+		}},
+		{codeInvalidArgument, nil, func(e *Emulator) interface{} { return e.call(sendInput, 42) }},
+		{codeInvalidState, nil, func(e *Emulator) interface{} { return e.call(syncDisk) }},
+		{codeNotRunning, nil, func(e *Emulator) interface{} { return e.call(stopEmulator) }},
+		{codeAlreadyRunning, nil, func(e *Emulator) interface{} {
+			e.call(startEmulator)
+			return e.call(startEmulator)
+		}},
+		{codeNoKernel, nil, func(e *Emulator) interface{} {
+			e.kernel = nil
+			return e.call(startEmulator)
+		}},
+		{codeMissingImage, map[string]interface{}{"bootMethod": bootFirmware}, func(e *Emulator) interface{} { return e.call(startEmulator) }},
+		{codeUnsupported, nil, func(e *Emulator) interface{} { return e.call(getAudioFormat) }},
+		{codeOutOfMemory, nil, func(e *Emulator) interface{} {
+			return initEmulator(js.Undefined(), []js.Value{callback, js.ValueOf(map[string]interface{}{"ramSizeMB": 1024, "memoryCapMB": 64})})
+		}},
+		{codeBufferFull, map[string]interface{}{"maxInputBytes": 4}, func(e *Emulator) interface{} {
+			return e.call(sendInput, "too long")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.code), func(t *testing.T) {
+			e, _ := newTestEmulator(t, tt.opts)
+			r := tt.fails(e).(map[string]interface{})
+			if got := statusOf(r); got != string(tt.code) {
+				t.Errorf("got %s (%v), want %s", got, r["error"], tt.code)
+			}
+			if msg, _ := r["error"].(map[string]interface{})["message"].(string); msg == "" {
+				t.Error("error has no message")
+			}
+		})
+	}
+
+	if got := statusOf(inputResult(ErrInputDropped)); got != string(codeInputDropped) {
+		t.Errorf("a dropped write = %s, want input_dropped", got)
+	}
+}
+
+// bareExports return a plain value rather than a result object.
+var bareExports = map[string]bool{
+	"tinyemuVersionString": true, // a string for display, as it always was
+}
+
+// checkShape reports how result strays from the result object shape, or
+// for a Promise from what it settles with, or "" if it doesn't.
+func checkShape(t *testing.T, result interface{}) string {
+	t.Helper()
+	statuses := map[string]bool{}
+	for _, s := range resultStatuses {
+		statuses[string(s)] = true
+	}
+	codes := map[string]bool{}
+	for _, c := range resultCodes {
+		codes[string(c)] = true
+	}
+
+	if promise, ok := result.(js.Value); ok {
+		if promise.Type() != js.TypeObject || promise.Get("then").Type() != js.TypeFunction {
+			return fmt.Sprintf("returned %v, neither a result object nor a Promise", promise)
+		}
+		v, fulfilled := awaitSettled(t, promise)
+		switch {
+		case !fulfilled && !v.InstanceOf(js.Global().Get("Error")):
+			return fmt.Sprintf("rejected with %v, not an Error", v)
+		case !fulfilled && !codes[v.Get("code").String()]:
+			return fmt.Sprintf("rejected with code %v, not one of resultCodes", v.Get("code"))
+		case fulfilled && v.Type() == js.TypeObject && v.Get("status").Type() != js.TypeUndefined && !statuses[v.Get("status").String()]:
+			return fmt.Sprintf("resolved with status %v, not one of resultStatuses", v.Get("status"))
+		}
+		return ""
+	}
+
+	r, ok := result.(map[string]interface{})
+	if !ok {
+		return fmt.Sprintf("returned %T, not a result object", result)
+	}
+	for key := range r {
+		if key != "ok" && key != "data" && key != "error" {
+			return fmt.Sprintf("has key %q beside ok, data and error", key)
+		}
+	}
+	success, ok := r["ok"].(bool)
+	if !ok {
+		return fmt.Sprintf("ok is %v, not a bool", r["ok"])
+	}
+	if d, present := r["data"]; present {
+		data, ok := d.(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("data is %T, not an object", d)
+		}
+		if s, present := data["status"]; present && !statuses[fmt.Sprint(s)] {
+			return fmt.Sprintf("status %v is not one of resultStatuses", s)
+		}
+	}
+	e, present := r["error"]
+	if success {
+		if present {
+			return "succeeded with an error"
+		}
+		return ""
+	}
+	err, ok := e.(map[string]interface{})
+	if !ok {
+		return fmt.Sprintf("failed with error %v, not an object", e)
+	}
+	if code, _ := err["code"].(string); !codes[code] {
+		return fmt.Sprintf("error code %v is not one of resultCodes", err["code"])
+	}
+	if msg, _ := err["message"].(string); msg == "" {
+		return "error has no message"
+	}
+	return ""
+}
+
+func TestExportsFollowTheSchema(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	for _, running := range []bool{false, true} {
+		for _, export := range exports {
+			// Each gets an instance of its own, as some dispose or reset it
+			e, _ := newTestEmulator(t, map[string]interface{}{"ramSizeMB": 1})
+			if running {
+				e.call(startEmulator)
+				waitState(t, e, stateRunning)
+			}
+			result := e.call(export.fn)
+			if bareExports[export.name] {
+				continue
+			}
+			if problem := checkShape(t, result); problem != "" {
+				t.Errorf("%s (running %v) %s: %v", export.name, running, problem, result)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"syscall/js"
+	"time"
+)
+
+// RTC modes for the rtc option.
+const (
+	rtcHost  = "host"  // the browser's Date.now()
+	rtcFixed = "fixed" // fixedEpoch at boot, advancing with the instance clock
+)
+
+// rtcSource is the time the guest's real-time clock reads.
+type rtcSource interface {
+	Now() time.Time
+}
+
+// hostRTC reads the browser clock, so the guest agrees with the page.
+type hostRTC struct{}
+
+func (hostRTC) Now() time.Time {
+	return time.UnixMilli(int64(js.Global().Get("Date").Call("now").Float()))
+}
+
+// fixedRTC starts at epoch when the machine boots and then moves with the
+// instance clock, so in a deterministic run the guest sees the same dates
+// every time.
+type fixedRTC struct {
+	epoch time.Time
+	clock clock
+	boot  time.Time
+}
+
+func (r fixedRTC) Now() time.Time {
+	return r.epoch.Add(r.clock.Now().Sub(r.boot))
+}
+
+// newRTC returns the RTC for a machine booting now.
+func (e *Emulator) newRTC() rtcSource {
+	if e.options.rtc == rtcFixed {
+		return fixedRTC{epoch: e.options.rtcEpoch, clock: e.clock, boot: e.clock.Now()}
+	}
+	return hostRTC{}
+}
+
+// rtcOption reads the rtc and fixedEpoch options into opts. fixedEpoch is
+// in seconds since 1970 and implies a fixed RTC; a deterministic run
+// defaults to one fixed at virtualEpoch.
+func rtcOption(v js.Value, opts *options) error {
+	if opts.deterministic {
+		opts.rtc = rtcFixed
+	}
+
+	epoch := v.Get("fixedEpoch")
+	hasEpoch := !epoch.IsUndefined() && !epoch.IsNull()
+	if hasEpoch {
+		if epoch.Type() != js.TypeNumber {
+			return fmt.Errorf("fixedEpoch must be a number, got %s", epoch.Type())
+		}
+		n := epoch.Float()
+		if n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return fmt.Errorf("fixedEpoch must be a whole number of seconds since 1970, got %v", n)
+		}
+		opts.rtc, opts.rtcEpoch = rtcFixed, time.Unix(int64(n), 0).UTC()
+	}
+
+	mode := v.Get("rtc")
+	if mode.IsUndefined() || mode.IsNull() {
+		return nil
+	}
+	switch {
+	case mode.Type() != js.TypeString:
+		return fmt.Errorf("rtc must be a string, got %s", mode.Type())
+	case mode.String() == rtcHost && hasEpoch:
+		return fmt.Errorf("fixedEpoch needs rtc %q, got %q", rtcFixed, rtcHost)
+	case mode.String() == rtcHost, mode.String() == rtcFixed:
+		opts.rtc = mode.String()
+		return nil
+	default:
+		return fmt.Errorf("rtc must be %q or %q", rtcHost, rtcFixed)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// rtcMachine is a mock RTC device: it reads the guest clock on every step.
+type rtcMachine struct {
+	testMachine
+	rtc   rtcSource
+	reads []time.Time
+}
+
+func (m *rtcMachine) Step(n int) int {
+	m.testMachine.Step(n)
+	m.reads = append(m.reads, m.rtc.Now())
+	return n
+}
+
+// rtcReads runs an instance created with opts for steps steps and returns
+// what its RTC read on each.
+func rtcReads(t *testing.T, opts map[string]interface{}, steps int) []time.Time {
+	t.Helper()
+	m := &rtcMachine{}
+	var e *Emulator
+	useMachine(t, func(config machineConfig) machine {
+		m.rtc = config.rtc
+		m.step = func(n int) {
+			if n == steps {
+				go e.call(pauseEmulator)
+			}
+		}
+		return m
+	})
+	e, _ = newTestEmulator(t, opts)
+	e.call(startEmulator)
+	waitState(t, e, statePaused)
+	e.call(stopEmulator)
+	if len(m.reads) < steps {
+		t.Fatalf("options %v: RTC read %d times, want %d", opts, len(m.reads), steps)
+	}
+	return m.reads[:steps]
+}
+
+func TestFixedRTCIsDeterministic(t *testing.T) {
+	opts := map[string]interface{}{"rtc": "fixed", "fixedEpoch": 1e9, "deterministic": true}
+	first := rtcReads(t, opts, 5)
+	if want := time.Unix(1e9, 0); !first[0].Equal(want) {
+		t.Errorf("RTC read %v at boot, want %v", first[0], want)
+	}
+	if !first[4].After(first[0]) {
+		t.Errorf("RTC stood still at %v over 5 steps", first[0])
+	}
+
+	// Another run reads the same times at the same steps
+	for i, got := range rtcReads(t, opts, 5) {
+		if !got.Equal(first[i]) {
+			t.Errorf("step %d: RTC read %v, then %v in a second run", i+1, first[i], got)
+		}
+	}
+
+	// Deterministic runs default to the fixed RTC, starting at virtualEpoch
+	if got := rtcReads(t, map[string]interface{}{"deterministic": true}, 1)[0]; !got.Equal(virtualEpoch) {
+		t.Errorf("deterministic RTC read %v at boot, want %v", got, virtualEpoch)
+	}
+}
+
+func TestHostRTCReadsTheJSClock(t *testing.T) {
+	date := js.Global().Get("Date")
+	saved := date.Get("now")
+	now := js.FuncOf(func(this js.Value, args []js.Value) interface{} { return 1.5e12 })
+	date.Set("now", now)
+	t.Cleanup(func() {
+		date.Set("now", saved)
+		now.Release()
+	})
+
+	for _, opts := range []map[string]interface{}{nil, {"rtc": "host"}} {
+		if got, want := rtcReads(t, opts, 1)[0], time.UnixMilli(1.5e12); !got.Equal(want) {
+			t.Errorf("options %v: RTC read %v, want Date.now()'s %v", opts, got, want)
+		}
+	}
+}
+
+func TestRTCOptionsAreChecked(t *testing.T) {
+	for _, bad := range []map[string]interface{}{
+		{"rtc": "utc"},
+		{"rtc": 1},
+		{"fixedEpoch": "2001"},
+		{"fixedEpoch": 1.5},
+		{"rtc": "host", "fixedEpoch": 0},
+	} {
+		msg := initError(t, bad)
+		if !strings.Contains(msg, "rtc") && !strings.Contains(msg, "fixedEpoch") {
+			t.Errorf("options %v: error %q isn't about the RTC", bad, msg)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// stepInstructions is how many instructions the run loop asks the
+	// machine to execute per step.
+	stepInstructions = 1000
+	// stepInterval is the pause between steps, which hands control back to
+	// the browser event loop.
+	stepInterval = 100 * time.Millisecond
+)
+
+// runLoop steps m until ctx is canceled or the guest powers off, which
+// ends the run with stop. onBooted, if non-nil, is called once the machine
+// reports that boot has finished.
+func (e *Emulator) runLoop(ctx context.Context, stop context.CancelFunc, m machine, onBooted func()) {
+	for {
+		if !e.waitWhilePaused(ctx) {
+			return
+		}
+
+		retired, booted := e.step(ctx, m)
+		if booted && e.transition(stateStarting, stateRunning) {
+			e.writer.Flush()
+			if onBooted != nil {
+				onBooted()
+			}
+		}
+
+		if e.ready.take(booted) && e.options.onReady.Type() == js.TypeFunction {
+			e.writer.Flush()
+			e.options.onReady.Invoke()
+		}
+
+		if code, ok := e.halted(m); ok {
+			e.drainOutput(m)
+			e.powerOff(stop, code)
+			return
+		}
+		if code, ok := e.options.exitPort.take(); ok {
+			e.drainOutput(m)
+			e.exitRun(stop, code)
+			return
+		}
+
+		if addr, ok := e.breakpoints.take(); ok {
+			e.pause()
+			if e.options.onBreakpoint.Type() == js.TypeFunction {
+				e.writer.Flush()
+				e.options.onBreakpoint.Invoke(map[string]interface{}{"addr": hex64(addr)})
+			}
+		}
+
+		if !e.pace(ctx, retired) {
+			return
+		}
+	}
+}
+
+// step runs one slice of m and returns how many instructions retired and
+// whether it has booted. The lock is released even if the machine panics,
+// so a crash can still be inspected.
+func (e *Emulator) step(ctx context.Context, m machine) (int, bool) {
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+	e.stepCtx = ctx
+	defer func() { e.stepCtx = nil }()
+
+	var retired, elapsed int
+	if mh, ok := m.(multiHart); ok && mh.Harts() > 1 {
+		retired, elapsed = stepHarts(mh)
+	} else if dm, ok := m.(inspectable); ok {
+		retired = e.breakpoints.run(m, dm, stepInstructions)
+		elapsed = retired
+	} else {
+		retired = m.Step(stepInstructions)
+		elapsed = retired
+	}
+	e.clock.Advance(elapsed)
+	e.stats.record(retired)
+	if retired > 0 {
+		e.watchdog.kick()
+	}
+	return retired, m.Booted()
+}
+
+// awaitStep awaits a Promise a device needs to finish the step in
+// progress, such as a lazy disk's fetch. Only the disks the machine is
+// given wait with it, so it runs inside the machine with machineMu held.
+// On the run loop's step it parks the step, letting go of machineMu until
+// the Promise settles: a synchronous call that needs the machine
+// meanwhile would otherwise wait for a Promise that can't settle until it
+// returns. Calls that would see the instruction half done refuse with
+// busy while parked. Ending the run gives up on the Promise, so a stop
+// doesn't wait for it either. Anywhere else it is await, and the caller
+// needs its own goroutine.
+func (e *Emulator) awaitStep(promise js.Value) (js.Value, error) {
+	ctx := e.stepCtx
+	if ctx == nil {
+		return await(promise)
+	}
+
+	e.stepCtx = nil
+	e.parked.Store(true)
+	e.machineMu.Unlock()
+	defer func() {
+		e.machineMu.Lock()
+		e.parked.Store(false)
+		e.stepCtx = ctx
+	}()
+	return awaitContext(ctx, promise)
+}
+
+// stepDisk is a disk as the machine sees it: reads and writes that wait
+// on a Promise do so with awaitStep. Everything else, such as a
+// persistent disk's flush, reads the disk itself and never parks the step.
+type stepDisk struct {
+	blockBackend
+	disk awaitingBackend
+	e    *Emulator
+}
+
+func (d stepDisk) ReadAt(p []byte, off int64) (int, error) {
+	return d.disk.readAtAwaiting(p, off, d.e.awaitStep)
+}
+
+func (d stepDisk) WriteAt(p []byte, off int64) (int, error) {
+	return d.disk.writeAtAwaiting(p, off, d.e.awaitStep)
+}
+
+// machineDisks returns the disks for the machine, those that may wait on
+// a Promise as stepDisks.
+func (e *Emulator) machineDisks() [maxDisks]blockBackend {
+	disks := e.disks
+	for i, d := range disks {
+		if a, ok := d.(awaitingBackend); ok {
+			disks[i] = stepDisk{d, a, e}
+		}
+	}
+	return disks
+}
+
+// multiHart is implemented by machines with more than one hart. Harts
+// share guest RAM and the machine's devices; the run loop steps them one
+// after another under machineMu, so none ever sees another mid-step.
+type multiHart interface {
+	// Harts returns how many harts the machine has, at least 1.
+	Harts() int
+	// StepHart executes up to n instructions on one hart and returns how
+	// many retired. Interrupts raised for other harts take effect when
+	// those are next stepped.
+	StepHart(hart, n int) int
+}
+
+// stepHarts runs one slice of a multi-hart machine, giving each hart an
+// equal share of stepInstructions in turn. It returns the instructions
+// retired on all harts and the most any one retired, which is how far
+// guest time moved. Breakpoints aren't checked on these machines.
+func stepHarts(m multiHart) (retired, elapsed int) {
+	harts := m.Harts()
+	quantum := max(1, stepInstructions/harts)
+	for hart := 0; hart < harts; hart++ {
+		n := m.StepHart(hart, quantum)
+		retired += n
+		elapsed = max(elapsed, n)
+	}
+	return retired, elapsed
+}
+
+// haltDetector is implemented by machines the guest can power off, through
+// SBI system reset or the test finisher device.
+type haltDetector interface {
+	// Halted reports whether the guest has powered off, and its exit code,
+	// or -1 if the device carried none.
+	Halted() (exitCode int, halted bool)
+}
+
+// halted reports whether the guest has powered m off.
+func (e *Emulator) halted(m machine) (int, bool) {
+	h, ok := m.(haltDetector)
+	if !ok {
+		return 0, false
+	}
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+	return h.Halted()
+}
+
+// powerOff ends a run the guest shut down itself, unlike a stop from JS:
+// the instance moves to halted and onHalt gets {exitCode}, null when
+// unknown. Output has been drained by then.
+func (e *Emulator) powerOff(stop context.CancelFunc, code int) {
+	if !e.transitionFrom(stateHalted, stateStarting, stateRunning, statePaused) {
+		return
+	}
+	stop()
+
+	var exitCode interface{}
+	if code >= 0 {
+		exitCode = code
+		e.log.Infof("guest powered off with exit code %d", code)
+	} else {
+		e.log.Infof("guest powered off")
+	}
+	if e.options.onHalt.Type() == js.TypeFunction {
+		e.options.onHalt.Invoke(map[string]interface{}{"exitCode": exitCode})
+	}
+}
+
+// consoleDrainer is implemented by machines that queue console output
+// internally, such as in a virtio-console TX ring, rather than writing it
+// to machineConfig.console as it is produced.
+type consoleDrainer interface {
+	// DrainConsole writes out everything queued so far.
+	DrainConsole()
+}
+
+// drainOutput pushes out whatever output m still holds and flushes the
+// console writer, so the last lines before a stop reach every sink. The
+// run loop calls it on its way out, before done is closed, so a stop that
+// returns has already delivered them.
+func (e *Emulator) drainOutput(m machine) {
+	if d, ok := m.(consoleDrainer); ok {
+		e.machineMu.Lock()
+		d.DrainConsole()
+		e.machineMu.Unlock()
+	}
+	e.writer.Flush()
+	e.flushConsoles()
+}
+
+// waitWhilePaused blocks while the loop is paused. It returns false if ctx
+// is canceled first.
+func (e *Emulator) waitWhilePaused(ctx context.Context) bool {
+	for {
+		e.pauseMu.Lock()
+		if !e.paused {
+			e.pauseMu.Unlock()
+			return ctx.Err() == nil
+		}
+		ch := e.resumed
+		e.pauseMu.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func pauseEmulator(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if result := e.checkRunning(); result != nil {
+		return result
+	}
+
+	if !e.pause() {
+		return statusResult(statusAlreadyPaused, nil)
+	}
+	return statusResult(statusPaused, nil)
+}
+
+// pause stops the run loop before its next step, reporting whether it
+// wasn't already paused.
+func (e *Emulator) pause() bool {
+	e.pauseMu.Lock()
+	if e.paused {
+		e.pauseMu.Unlock()
+		return false
+	}
+	e.paused = true
+	e.resumed = make(chan struct{})
+	e.pausedState = e.getState()
+	e.pauseMu.Unlock()
+	e.stats.halt()
+
+	e.setState(statePaused)
+	return true
+}
+
+// checkRunning returns the error result for pausing or resuming an
+// instance without a run, or nil if it has one.
+func (e *Emulator) checkRunning() map[string]interface{} {
+	if e.getState() == stateCrashed {
+		return errResult(codeCrashed, "crashed")
+	}
+	if !e.isRunning() {
+		return errResult(codeNotRunning, "not running")
+	}
+	return nil
+}
+
+func resumeEmulator(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if result := e.checkRunning(); result != nil {
+		return result
+	}
+
+	if !e.resume() {
+		return statusResult(statusAlreadyRunning, nil)
+	}
+	return statusResult(statusRunning, nil)
+}
+
+// resume lets the run loop step again, reporting whether it was paused.
+func (e *Emulator) resume() bool {
+	e.pauseMu.Lock()
+	if !e.paused {
+		e.pauseMu.Unlock()
+		return false
+	}
+	e.paused = false
+	close(e.resumed)
+	prev := e.pausedState
+	e.pauseMu.Unlock()
+	e.stats.resume()
+
+	// Only undo our own pause; a stop or crash in between wins
+	e.transition(statePaused, prev)
+	return true
+}
+
+// Reset modes accepted by tinyemuReset.
+const (
+	resetCold = "cold"
+	resetWarm = "warm"
+)
+
+// resetEmulator restarts the machine while keeping the console wiring set
+// up by tinyemuInit. A "cold" reset, the default, also clears guest RAM
+// and reverts every disk to its image as loaded, or for a persistent disk
+// as restored from IndexedDB, writing its reverted blocks back too. A "warm" reset keeps RAM and disk
+// contents and only re-enters the boot path. Before start it does nothing.
+func resetEmulator(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	mode := resetCold
+	if present(args, 0) {
+		if mode, err = stringArg(args, 0, "reset mode"); err != nil {
+			return errorResult(err)
+		}
+	}
+	if mode != resetCold && mode != resetWarm {
+		return errResult(codeInvalidArgument, fmt.Sprintf("unknown reset mode %q, want %q or %q", mode, resetCold, resetWarm))
+	}
+	if !e.isRunning() {
+		return statusResult(statusReset, map[string]interface{}{"mode": mode})
+	}
+
+	if !e.haltRunLoop() {
+		return errorResult(errStopTimeout)
+	}
+
+	if mode == resetCold {
+		clear(e.ram)
+		for _, d := range e.disks {
+			if r, ok := d.(reverter); ok {
+				r.Revert()
+			}
+		}
+	}
+	if result := e.launch(nil, nil); failed(result) {
+		return result
+	}
+	return statusResult(statusReset, map[string]interface{}{"mode": mode})
+}
@@ -0,0 +1,350 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// tickingMachine writes a numbered line to the console on every step.
+func tickingMachine(config machineConfig) machine {
+	return &testMachine{step: func(steps int) {
+		fmt.Fprintf(config.console, "tick %d\n", steps)
+	}}
+}
+
+// waitOutput waits up to a second for rec to hold more than n bytes and
+// returns what it holds.
+func waitOutput(t *testing.T, rec *outputRecorder, n int) string {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if out := rec.text(); len(out) > n {
+			return out
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no output past %d bytes", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPauseStopsOutputAndResumeRestartsIt(t *testing.T) {
+	useMachine(t, tickingMachine)
+	e, rec := newTestEmulator(t, nil)
+	if got := statusOf(e.call(startEmulator)); got != string(statusStarting) {
+		t.Fatalf("tinyemuStart = %s", got)
+	}
+	waitOutput(t, rec, 0)
+
+	if got := statusOf(e.call(pauseEmulator)); got != string(statusPaused) {
+		t.Fatalf("tinyemuPause = %s", got)
+	}
+	// A step already under way may still finish
+	time.Sleep(stepInterval)
+	e.writer.Flush()
+	paused := rec.text()
+	time.Sleep(3 * stepInterval)
+	e.writer.Flush()
+	if got := rec.text(); got != paused {
+		t.Fatalf("output while paused: %q", got[len(paused):])
+	}
+	if got := statusOf(e.call(pauseEmulator)); got != string(statusAlreadyPaused) {
+		t.Errorf("second tinyemuPause = %s, want already_paused", got)
+	}
+
+	if got := statusOf(e.call(resumeEmulator)); got != string(statusRunning) {
+		t.Fatalf("tinyemuResume = %s", got)
+	}
+	out := waitOutput(t, rec, len(paused))
+	// Ticks are numbered from 1, so the machine picks up where it was
+	if want := fmt.Sprintf("tick %d\n", strings.Count(paused, "\n")+1); !strings.HasPrefix(out[len(paused):], want) {
+		t.Errorf("after resume got %q, want it to carry on with %q", out[len(paused):], want)
+	}
+	if got := statusOf(e.call(resumeEmulator)); got != string(statusAlreadyRunning) {
+		t.Errorf("second tinyemuResume = %s, want already_running", got)
+	}
+}
+
+// panickingMachine prints a line on every step and panics on step panicAt.
+func panickingMachine(panicAt int) func(machineConfig) machine {
+	return func(config machineConfig) machine {
+		return &testMachine{step: func(steps int) {
+			fmt.Fprintf(config.console, "step %d\n", steps)
+			if steps == panicAt {
+				panic(fmt.Sprintf("illegal instruction at step %d", steps))
+			}
+		}}
+	}
+}
+
+func TestPanicInRunLoopCallsOnError(t *testing.T) {
+	useMachine(t, panickingMachine(3))
+	errs := newOutputRecorder(t)
+	e, rec := newTestEmulator(t, map[string]interface{}{"onError": errs.fn})
+	e.call(startEmulator)
+	waitState(t, e, stateCrashed)
+
+	// The state changes before the callback runs, so give it a moment,
+	// and time to run a second time if it were going to
+	time.Sleep(2 * stepInterval)
+	errs.mu.Lock()
+	reports := errs.chunks
+	errs.mu.Unlock()
+	if len(reports) != 1 {
+		t.Fatalf("onError called %d times, want once", len(reports))
+	}
+	report := reports[0]
+	if got := report.Get("message").String(); got != "illegal instruction at step 3" {
+		t.Errorf("onError message = %q", got)
+	}
+	if got := report.Get("code").String(); got != stateCrashed {
+		t.Errorf("onError code = %q, want %q", got, stateCrashed)
+	}
+	if stack := report.Get("stack").String(); !strings.Contains(stack, "panickingMachine") {
+		t.Errorf("onError stack doesn't reach the panic:\n%s", stack)
+	}
+
+	// Output up to the panic is delivered, and the instance stays down
+	if got := rec.text(); !strings.HasSuffix(got, "step 3\n") {
+		t.Errorf("console got %q, want everything through step 3", got)
+	}
+	if got := e.getState(); got != stateCrashed {
+		t.Errorf("state is %s after the crash, want crashed", got)
+	}
+	r := emulatorIsRunning(js.Undefined(), []js.Value{js.ValueOf(e.handle)}).(map[string]interface{})
+	if r["data"].(map[string]interface{})["running"] != false {
+		t.Error("tinyemuIsRunning reports a crashed instance as running")
+	}
+}
+
+// slowStepMachine prints a line at the end of every step, each of which
+// waits for release to be closed once started is.
+type slowStepMachine struct {
+	testMachine
+	console io.Writer
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (m *slowStepMachine) Step(n int) int {
+	m.once.Do(func() { close(m.started) })
+	<-m.release
+	fmt.Fprintln(m.console, "last step done")
+	return n
+}
+
+func TestStopWaitsForTheRunLoop(t *testing.T) {
+	m := &slowStepMachine{started: make(chan struct{}), release: make(chan struct{})}
+	useMachine(t, func(config machineConfig) machine {
+		m.console = config.console
+		return m
+	})
+	e, rec := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	<-m.started
+
+	stopped := make(chan interface{}, 1)
+	go func() { stopped <- e.call(stopEmulator) }()
+	select {
+	case r := <-stopped:
+		t.Fatalf("tinyemuStop returned %v with a step still running", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(m.release)
+	if got := statusOf(<-stopped); got != string(statusStopped) {
+		t.Errorf("tinyemuStop = %s, want stopped", got)
+	}
+	select {
+	case <-e.done:
+	default:
+		t.Error("tinyemuStop returned before the run loop signalled done")
+	}
+	// Output from the final step has been flushed, not left buffered
+	if got := rec.text(); !strings.Contains(got, "last step done") {
+		t.Errorf("console got %q by the time tinyemuStop returned", got)
+	}
+	if got := statusOf(e.call(stopEmulator)); got != string(codeNotRunning) {
+		t.Errorf("second tinyemuStop = %s, want not_running", got)
+	}
+}
+
+func TestStopTimesOutOnAStuckLoop(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits out stopTimeout")
+	}
+	m := &slowStepMachine{started: make(chan struct{}), release: make(chan struct{})}
+	useMachine(t, func(config machineConfig) machine {
+		m.console = config.console
+		return m
+	})
+	e, _ := newTestEmulator(t, nil)
+	defer close(m.release)
+	e.call(startEmulator)
+	<-m.started
+
+	start := time.Now()
+	if got := statusOf(e.call(stopEmulator)); got != string(statusStopTimeout) {
+		t.Errorf("tinyemuStop on a stuck loop = %s, want stop_timeout", got)
+	}
+	if waited := time.Since(start); waited < stopTimeout {
+		t.Errorf("gave up after %v, before stopTimeout", waited)
+	}
+	if got := e.getState(); got != stateStopped {
+		t.Errorf("state is %s after the timeout, want stopped", got)
+	}
+}
+
+func TestStopDeliversAHeldPartialLine(t *testing.T) {
+	useMachine(t, func(config machineConfig) machine {
+		// Booting flushes the console, so this one never finishes
+		return &testMachine{bootSteps: 1 << 30, step: func(steps int) {
+			if steps == 1 {
+				fmt.Fprint(config.console, "Kernel panic - not syncing")
+			}
+		}}
+	})
+	e, rec := newTestEmulator(t, map[string]interface{}{"flushOnNewline": true})
+	e.call(startEmulator)
+	time.Sleep(2 * stepInterval)
+	if got := rec.text(); got != "" {
+		t.Fatalf("a partial line was delivered before its newline: %q", got)
+	}
+
+	e.call(stopEmulator)
+	if got := rec.text(); got != "Kernel panic - not syncing" {
+		t.Errorf("console got %q by the time tinyemuStop returned", got)
+	}
+}
+
+// queueingMachine keeps its console output in a TX queue until drained,
+// like a virtio-console whose ring hasn't been serviced.
+type queueingMachine struct {
+	testMachine
+	console io.Writer
+	queued  []byte
+}
+
+func (m *queueingMachine) Step(n int) int {
+	m.testMachine.Step(n)
+	m.queued = fmt.Appendf(m.queued, "queued %d\n", m.steps)
+	return n
+}
+
+func (m *queueingMachine) DrainConsole() {
+	m.console.Write(m.queued)
+	m.queued = nil
+}
+
+func TestStopDrainsTheMachineConsole(t *testing.T) {
+	m := &queueingMachine{}
+	useMachine(t, func(config machineConfig) machine {
+		m.console = config.console
+		return m
+	})
+	e, rec := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	time.Sleep(2 * stepInterval)
+	if got := rec.text(); got != "" {
+		t.Fatalf("console got %q before anything drained the queue", got)
+	}
+
+	e.call(stopEmulator)
+	var want strings.Builder
+	for i := 1; i <= m.steps; i++ {
+		fmt.Fprintf(&want, "queued %d\n", i)
+	}
+	if got := rec.text(); m.steps == 0 || got != want.String() {
+		t.Errorf("after %d steps tinyemuStop delivered %q", m.steps, got)
+	}
+}
+
+// poweringOffMachine queues a shutdown message without its newline and
+// powers off with exitCode once it has taken haltAt steps.
+type poweringOffMachine struct {
+	queueingMachine
+	haltAt   int
+	exitCode int
+}
+
+func (m *poweringOffMachine) Step(n int) int {
+	m.testMachine.Step(n)
+	if m.steps == m.haltAt {
+		m.queued = append(m.queued, "reboot: Power down"...)
+	}
+	return n
+}
+
+func (m *poweringOffMachine) Halted() (int, bool) { return m.exitCode, m.steps >= m.haltAt }
+
+func TestPowerOffHaltsAndFlushes(t *testing.T) {
+	for _, tt := range []struct {
+		code int
+		want interface{} // the exitCode onHalt gets
+	}{
+		{3, 3},
+		{-1, nil}, // the device carried no code
+	} {
+		m := &poweringOffMachine{haltAt: 3, exitCode: tt.code}
+		useMachine(t, func(config machineConfig) machine {
+			m.console = config.console
+			return m
+		})
+		halts := make(chan js.Value, 2)
+		onHalt := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			halts <- args[0]
+			return nil
+		})
+		t.Cleanup(onHalt.Release)
+		states := newStateRecorder(t)
+		// Held for its newline, the last line only arrives if the halt flushes
+		e, rec := newTestEmulator(t, map[string]interface{}{"onHalt": onHalt, "onState": states.fn, "flushOnNewline": true})
+		e.call(startEmulator)
+
+		select {
+		case info := <-halts:
+			if got := info.Get("exitCode"); (tt.want == nil && !got.IsNull()) || (tt.want != nil && got.Int() != tt.want) {
+				t.Errorf("code %d: onHalt got exitCode %v, want %v", tt.code, got, tt.want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("code %d: onHalt didn't fire", tt.code)
+		}
+		waitState(t, e, stateHalted)
+		if got := rec.text(); !strings.HasSuffix(got, "reboot: Power down") {
+			t.Errorf("code %d: console got %q, want it to end with the shutdown message", tt.code, got)
+		}
+		if got := states.waitFor(4); got[len(got)-1] != stateHalted {
+			t.Errorf("code %d: onState heard %v, want it to end halted", tt.code, got)
+		}
+		if m.steps != m.haltAt {
+			t.Errorf("code %d: machine ran %d steps, want none past the halt at %d", tt.code, m.steps, m.haltAt)
+		}
+	}
+}
+
+func TestStopIsNotAHalt(t *testing.T) {
+	useMachine(t, func(config machineConfig) machine {
+		return &poweringOffMachine{queueingMachine: queueingMachine{console: config.console}, haltAt: 1 << 30}
+	})
+	halted := false
+	onHalt := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		halted = true
+		return nil
+	})
+	t.Cleanup(onHalt.Release)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onHalt": onHalt})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	e.call(stopEmulator)
+	if got := e.getState(); got != stateStopped || halted {
+		t.Errorf("after tinyemuStop state is %s and onHalt fired %v, want stopped without it", got, halted)
+	}
+}
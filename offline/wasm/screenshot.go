@@ -0,0 +1,87 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"syscall/js"
+)
+
+// Framebuffer pixel formats a screenshot can encode: bytes in memory
+// order, four per pixel.
+const (
+	formatRGBA8888 = "rgba8888"
+	formatBGRA8888 = "bgra8888"
+)
+
+// snapshotFrame copies the current frame of fb into an opaque image. The
+// alpha byte is ignored, since displays don't blend with what is behind
+// them and many leave it zero.
+func snapshotFrame(fb framebuffer) (*image.NRGBA, error) {
+	info := fb.DisplayInfo()
+	var r, b int
+	switch info.format {
+	case formatRGBA8888:
+		r, b = 0, 2
+	case formatBGRA8888:
+		r, b = 2, 0
+	default:
+		return nil, withCode(codeUnsupported, fmt.Errorf("can't take a screenshot of a %s framebuffer", info.format))
+	}
+	pixels := fb.Pixels()
+	if info.width <= 0 || info.height <= 0 || info.stride < info.width*4 || len(pixels) < (info.height-1)*info.stride+info.width*4 {
+		return nil, fmt.Errorf("framebuffer of %d bytes doesn't hold %dx%d pixels with stride %d", len(pixels), info.width, info.height, info.stride)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, info.width, info.height))
+	for y := 0; y < info.height; y++ {
+		src := pixels[y*info.stride:]
+		dst := img.Pix[y*img.Stride:]
+		for x := 0; x < info.width*4; x += 4 {
+			dst[x], dst[x+1], dst[x+2], dst[x+3] = src[x+r], src[x+1], src[x+b], 0xff
+		}
+	}
+	return img, nil
+}
+
+// screenshot encodes the frame currently in the framebuffer as PNG and
+// returns {png} holding it as a Uint8Array, or {dataURL} holding a data:
+// URL string with {dataURL: true}. It reads the pixels between steps, so
+// a paused machine gives the frame it stopped on. A machine without a
+// display, such as a text-only one, fails with unsupported;
+// tinyemuGetScrollback has its console text.
+func screenshot(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	opts, err := optionalObjectArg(args, 0, "options")
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.machineMu.Lock()
+	var img *image.NRGBA
+	err = errNoDisplay
+	if fb, ok := e.machine.(framebuffer); ok {
+		img, err = snapshotFrame(fb)
+	}
+	e.machineMu.Unlock()
+	if err != nil {
+		return errorResult(err)
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(&buf, img); err != nil {
+		return errorResult(err)
+	}
+	if opts.Type() == js.TypeObject && opts.Get("dataURL").Truthy() {
+		return okResult(map[string]interface{}{"dataURL": "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())})
+	}
+	return okResult(map[string]interface{}{"png": bytesToJS(buf.Bytes())})
+}
@@ -0,0 +1,123 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+// bgraMachine is an fbMachine whose framebuffer holds BGRA pixels.
+type bgraMachine struct{ *fbMachine }
+
+func (m bgraMachine) DisplayInfo() displayInfo {
+	info := m.fbMachine.DisplayInfo()
+	info.format = formatBGRA8888
+	return info
+}
+
+// decodeScreenshot decodes the PNG a tinyemuScreenshot result holds.
+func decodeScreenshot(t *testing.T, result interface{}) image.Image {
+	t.Helper()
+	r := result.(map[string]interface{})
+	if failed(r) {
+		t.Fatalf("tinyemuScreenshot: %v", r["error"])
+	}
+	data := r["data"].(map[string]interface{})
+	var encoded []byte
+	if url, ok := data["dataURL"].(string); ok {
+		const prefix = "data:image/png;base64,"
+		if !strings.HasPrefix(url, prefix) {
+			t.Fatalf("data URL starts %.30q, want %q", url, prefix)
+		}
+		var err error
+		if encoded, err = base64.StdEncoding.DecodeString(url[len(prefix):]); err != nil {
+			t.Fatalf("data URL isn't base64: %v", err)
+		}
+	} else {
+		var err error
+		if encoded, err = bytesFromJS(data["png"].(js.Value)); err != nil {
+			t.Fatalf("png isn't a Uint8Array: %v", err)
+		}
+	}
+	img, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("screenshot doesn't decode as PNG: %v", err)
+	}
+	return img
+}
+
+// wantFrame checks img is the frame in pixels, 8x4 with a stride of 32
+// bytes and red and blue at offsets r and b of each pixel.
+func wantFrame(t *testing.T, img image.Image, pixels []byte, r, b int) {
+	t.Helper()
+	if got := img.Bounds(); got != image.Rect(0, 0, 8, 4) {
+		t.Fatalf("screenshot is %v, want the 8x4 framebuffer", got)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			p := pixels[y*32+x*4:]
+			want := color.NRGBA{p[r], p[1], p[b], 0xff}
+			if got := color.NRGBAModel.Convert(img.At(x, y)); got != want {
+				t.Fatalf("pixel %d,%d is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestScreenshotEncodesTheFrame(t *testing.T) {
+	m := newFBMachine()
+	useMachine(t, func(machineConfig) machine { return m })
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+
+	wantFrame(t, decodeScreenshot(t, e.call(screenshot)), m.pixels, 0, 2)
+	opts := map[string]interface{}{"dataURL": true}
+	wantFrame(t, decodeScreenshot(t, e.call(screenshot, opts)), m.pixels, 0, 2)
+
+	// Paused, it takes the frame as it stands, alpha ignored
+	e.call(pauseEmulator)
+	waitState(t, e, statePaused)
+	e.machineMu.Lock()
+	for i := range m.pixels {
+		m.pixels[i] = byte(255 - i)
+	}
+	m.pixels[3] = 0
+	e.machineMu.Unlock()
+	wantFrame(t, decodeScreenshot(t, e.call(screenshot)), m.pixels, 0, 2)
+}
+
+func TestScreenshotOfABGRAFramebuffer(t *testing.T) {
+	m := newFBMachine()
+	useMachine(t, func(machineConfig) machine { return bgraMachine{m} })
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	e.call(pauseEmulator)
+	wantFrame(t, decodeScreenshot(t, e.call(screenshot)), m.pixels, 2, 0)
+}
+
+func TestScreenshotNeedsADisplay(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(screenshot)); got != string(codeUnsupported) {
+		t.Errorf("before a machine runs: tinyemuScreenshot = %s, want unsupported", got)
+	}
+
+	// A text-only machine has no frame to take
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if got := statusOf(e.call(screenshot)); got != string(codeUnsupported) {
+		t.Errorf("text-only machine: tinyemuScreenshot = %s, want unsupported", got)
+	}
+	if got := statusOf(e.call(screenshot, "png")); got != string(codeInvalidArgument) {
+		t.Errorf("string options = %s, want invalid_argument", got)
+	}
+}
@@ -0,0 +1,144 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// scriptStep is one entry of an input script: send is fed to the guest,
+// then the script waits delayMs before the next entry.
+type scriptStep struct {
+	Send    *string `json:"send"`
+	DelayMs float64 `json:"delayMs"`
+}
+
+// scriptRunner tracks the input script in progress, if any.
+type scriptRunner struct {
+	mu   sync.Mutex
+	stop chan struct{} // closed to cancel the running script
+}
+
+// begin cancels any running script and returns the stop channel for a new one.
+func (r *scriptRunner) begin() chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+	}
+	r.stop = make(chan struct{})
+	return r.stop
+}
+
+// cancel stops the running script, reporting whether there was one.
+func (r *scriptRunner) cancel() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop == nil {
+		return false
+	}
+	close(r.stop)
+	r.stop = nil
+	return true
+}
+
+// finish forgets stop if it still belongs to the running script.
+func (r *scriptRunner) finish(stop chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop == stop {
+		r.stop = nil
+	}
+}
+
+func parseScript(s string) ([]scriptStep, error) {
+	var steps []scriptStep
+	if err := json.Unmarshal([]byte(s), &steps); err != nil {
+		return nil, fmt.Errorf("invalid script: %v", err)
+	}
+	for i, st := range steps {
+		if st.Send == nil {
+			return nil, fmt.Errorf("invalid script: entry %d has no send", i)
+		}
+		if st.DelayMs < 0 {
+			return nil, fmt.Errorf("invalid script: entry %d has negative delayMs", i)
+		}
+	}
+	return steps, nil
+}
+
+// runScript feeds steps in order on the instance's clock until they run
+// out or stop is closed.
+func (e *Emulator) runScript(steps []scriptStep, stop <-chan struct{}) map[string]interface{} {
+	for i, st := range steps {
+		select {
+		case <-stop:
+			return statusResult(statusCanceled, map[string]interface{}{"sent": i})
+		default:
+		}
+		data, err := e.options.encoding.encode(*st.Send)
+		if err == nil {
+			err = e.feedInput(data)
+		}
+		if err != nil && !errors.Is(err, ErrInputDropped) {
+			r := errorResult(err)
+			r["data"] = map[string]interface{}{"sent": i}
+			return r
+		}
+
+		deadline := e.clock.Now().Add(time.Duration(st.DelayMs * float64(time.Millisecond)))
+		if !waitUntil(e.clock, deadline, stop) {
+			return statusResult(statusCanceled, map[string]interface{}{"sent": i + 1})
+		}
+	}
+	return statusResult(statusCompleted, map[string]interface{}{"sent": len(steps)})
+}
+
+// runInputScript takes a JSON array of {send, delayMs} entries and returns
+// a Promise that resolves with {status, sent} once the script completes or
+// is canceled. Starting a script cancels any already running.
+func runInputScript(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	src, err := stringArg(args, 0, "script")
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	steps, err := parseScript(src)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+
+	stop := e.script.begin()
+	return newPromise(func(resolve, reject js.Value) {
+		// Waiting needs the event loop, so it can't block this callback
+		go func() {
+			result := e.runScript(steps, stop)
+			e.script.finish(stop)
+			settle(result, resolve, reject)
+		}()
+	})
+}
+
+// cancelInputScript stops the running script; its Promise resolves with
+// status "canceled".
+func cancelInputScript(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !e.script.cancel() {
+		return statusResult(statusNotRunning, nil)
+	}
+	return statusResult(statusCanceled, nil)
+}
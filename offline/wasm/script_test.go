@@ -0,0 +1,96 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// advanceMs moves c on by ms of virtual time.
+func advanceMs(c *virtualClock, ms int) {
+	c.Advance(ms * virtualIPS / 1000)
+}
+
+// waitPending waits up to a second for e's input queue to hold want.
+func waitPending(t *testing.T, e *Emulator, want string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for string(e.reader.Pending()) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("guest has %q, want %q", e.reader.Pending(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScriptSpacesEntriesOnTheClock(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	clk := newVirtualClock()
+	e.clock = clk
+	promise := e.call(runInputScript, `[{"send":"ls\n","delayMs":500},{"send":"cat f\n","delayMs":1000},{"send":"exit\n"}]`).(js.Value)
+
+	waitPending(t, e, "ls\n")
+	advanceMs(clk, 499)
+	time.Sleep(10 * virtualYield)
+	if got := string(e.reader.Pending()); got != "ls\n" {
+		t.Fatalf("1ms before the first delay is up the guest has %q", got)
+	}
+	advanceMs(clk, 1)
+	waitPending(t, e, "ls\ncat f\n")
+	advanceMs(clk, 999)
+	time.Sleep(10 * virtualYield)
+	if got := string(e.reader.Pending()); got != "ls\ncat f\n" {
+		t.Fatalf("1ms before the second delay is up the guest has %q", got)
+	}
+	advanceMs(clk, 1)
+	waitPending(t, e, "ls\ncat f\nexit\n")
+
+	v, fulfilled := awaitSettled(t, promise)
+	if !fulfilled || v.Get("status").String() != string(statusCompleted) || v.Get("sent").Int() != 3 {
+		t.Errorf("script settled with %v, fulfilled %v", v, fulfilled)
+	}
+}
+
+func TestCancelScript(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	e.clock = newVirtualClock()
+	first := e.call(runInputScript, `[{"send":"a","delayMs":60000},{"send":"b"}]`).(js.Value)
+	waitPending(t, e, "a")
+
+	// A new script replaces the running one
+	second := e.call(runInputScript, `[{"send":"c","delayMs":60000},{"send":"d"}]`).(js.Value)
+	v, _ := awaitSettled(t, first)
+	if v.Get("status").String() != string(statusCanceled) || v.Get("sent").Int() != 1 {
+		t.Errorf("replaced script settled with %v", v)
+	}
+	waitPending(t, e, "ac")
+
+	if got := statusOf(e.call(cancelInputScript)); got != string(statusCanceled) {
+		t.Errorf("tinyemuCancelScript = %s", got)
+	}
+	if v, _ := awaitSettled(t, second); v.Get("status").String() != string(statusCanceled) || v.Get("sent").Int() != 1 {
+		t.Errorf("canceled script settled with %v", v)
+	}
+	if got := statusOf(e.call(cancelInputScript)); got != string(statusNotRunning) {
+		t.Errorf("canceling with no script = %s, want not_running", got)
+	}
+	if got := string(e.reader.Pending()); got != "ac" {
+		t.Errorf("guest has %q after both scripts were canceled", got)
+	}
+}
+
+func TestScriptRejectsBadEntries(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	for _, src := range []string{
+		`{"send":"ls"}`,
+		`[{"delayMs":10}]`,
+		`[{"send":"ls","delayMs":-1}]`,
+	} {
+		wantRejected(t, e.call(runInputScript, src).(js.Value), codeInvalidArgument)
+	}
+	if n := e.reader.Buffered(); n != 0 {
+		t.Errorf("rejected scripts queued %d bytes", n)
+	}
+}
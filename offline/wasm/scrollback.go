@@ -0,0 +1,91 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"sync"
+	"syscall/js"
+	"unicode/utf8"
+)
+
+const (
+	// defaultScrollbackBytes is how much console0 output an instance keeps
+	// unless scrollbackBytes says otherwise.
+	defaultScrollbackBytes = 256 << 10
+	// maxScrollbackBytes bounds the scrollbackBytes option.
+	maxScrollbackBytes = 64 << 20
+)
+
+// scrollback is a ring of the most recent console output, so a UI that
+// reloads or switches tabs can repopulate its terminal. The zero value
+// keeps nothing.
+type scrollback struct {
+	mu      sync.Mutex
+	buf     []byte
+	start   int // index of the oldest byte
+	n       int // bytes held
+	dropped bool
+}
+
+func newScrollback(size int) *scrollback {
+	return &scrollback{buf: make([]byte, size)}
+}
+
+// Write appends p, overwriting the oldest output once the ring is full.
+func (s *scrollback) Write(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := len(s.buf)
+	if size == 0 {
+		return
+	}
+	if len(p) >= size {
+		p = p[len(p)-size:]
+		copy(s.buf, p)
+		s.start, s.n, s.dropped = 0, size, true
+		return
+	}
+	end := (s.start + s.n) % size
+	copied := copy(s.buf[end:], p)
+	copy(s.buf, p[copied:])
+	if s.n += len(p); s.n > size {
+		s.start = (s.start + s.n - size) % size
+		s.n = size
+		s.dropped = true
+	}
+}
+
+// contents returns the retained output, oldest first, and whether older
+// output was dropped to make room.
+func (s *scrollback) contents() ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]byte, s.n)
+	copied := copy(out, s.buf[s.start:min(s.start+s.n, len(s.buf))])
+	copy(out[copied:], s.buf)
+	return out, s.dropped
+}
+
+// getScrollback returns {data, size, truncated}: the retained console0
+// output in the console encoding, and whether older output was dropped.
+func getScrollback(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	p, dropped := e.scrollback.contents()
+	if dropped && e.options.encoding == encodingUTF8 {
+		// The oldest byte may be the middle of a character
+		for i := 0; i < utf8.UTFMax-1 && len(p) > 0 && !utf8.RuneStart(p[0]); i++ {
+			p = p[1:]
+		}
+	}
+	return okResult(map[string]interface{}{
+		"data":      e.options.encoding.decode(p),
+		"size":      len(p),
+		"truncated": dropped,
+	})
+}
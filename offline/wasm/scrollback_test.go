@@ -0,0 +1,68 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScrollbackDropsTheOldestPastCapacity(t *testing.T) {
+	// Writes of every size up to past the capacity, so the ring wraps at
+	// every offset and takes writes bigger than itself
+	const size = 16
+	s := newScrollback(size)
+	var all []byte
+	for n := 1; n <= 2*size; n++ {
+		p := make([]byte, n)
+		for i := range p {
+			p[i] = byte(len(all) + i)
+		}
+		s.Write(p)
+		all = append(all, p...)
+
+		want := all[max(0, len(all)-size):]
+		got, dropped := s.contents()
+		if !bytes.Equal(got, want) {
+			t.Fatalf("after %d bytes the ring holds % x, want % x", len(all), got, want)
+		}
+		if dropped != (len(all) > size) {
+			t.Errorf("after %d bytes dropped = %v", len(all), dropped)
+		}
+	}
+}
+
+func TestScrollbackOfZeroKeepsNothing(t *testing.T) {
+	for _, s := range []*scrollback{newScrollback(0), {}} {
+		s.Write([]byte("gone"))
+		if got, dropped := s.contents(); len(got) != 0 || dropped {
+			t.Errorf("zero-size ring holds %q, dropped %v", got, dropped)
+		}
+	}
+}
+
+func TestGetScrollbackReturnsTheMostRecentOutput(t *testing.T) {
+	e, _ := newTestEmulator(t, map[string]interface{}{"scrollbackBytes": 8})
+	e.writer.Write([]byte("hello "))
+	e.writer.Flush()
+	data := e.call(getScrollback).(map[string]interface{})["data"].(map[string]interface{})
+	if data["data"] != "hello " || data["size"] != 6 || data["truncated"] != false {
+		t.Errorf("under capacity = %v, want all of %q", data, "hello ")
+	}
+
+	e.writer.Write([]byte("world"))
+	e.writer.Flush()
+	data = e.call(getScrollback).(map[string]interface{})["data"].(map[string]interface{})
+	if data["data"] != "lo world" || data["size"] != 8 || data["truncated"] != true {
+		t.Errorf("past capacity = %v, want the last 8 bytes %q, truncated", data, "lo world")
+	}
+
+	// Dropping the oldest byte may have cut a character in two, which is
+	// left out rather than shown as a replacement character
+	e.writer.Write([]byte("éèêëa"))
+	e.writer.Flush()
+	data = e.call(getScrollback).(map[string]interface{})["data"].(map[string]interface{})
+	if got := data["data"].(string); got != "èêëa" {
+		t.Errorf("ring cut through a character: got %q, want %q", got, "èêëa")
+	}
+}
@@ -0,0 +1,145 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"syscall/js"
+)
+
+// defaultConsole is the id of the console wired to the tinyemuInit
+// callback and to the keyboard, paste and line-mode input paths.
+const defaultConsole = "console0"
+
+// serialConsole is a guest console besides console0, such as a debug
+// UART, with its own output callback and input queue. Its input is passed
+// through raw, without line editing or recording.
+type serialConsole struct {
+	id     string
+	writer *ConsoleWriter
+	reader *ConsoleReader
+}
+
+// consolePort is an extra console as the machine sees it.
+type consolePort struct {
+	out io.Writer
+	in  *ConsoleReader
+}
+
+// newSerialConsoles creates the extra consoles named in the consoles
+// option, wired like console0.
+func (e *Emulator) newSerialConsoles(callbacks map[string]js.Value) {
+	if len(callbacks) == 0 {
+		return
+	}
+	e.writer.Name = defaultConsole
+	e.consoles = make(map[string]*serialConsole, len(callbacks))
+	for id, fn := range callbacks {
+		w := NewConsoleWriter(fn, DefaultFlushInterval)
+		w.Name = id
+		w.Encoding = e.options.encoding
+		w.SetStripANSI(e.options.stripANSI)
+		w.DisableFailing = e.options.disableFailing
+		w.FlushOnNewline = e.options.flushOnNewline
+		e.consoles[id] = &serialConsole{id: id, writer: w, reader: e.newInputReader()}
+	}
+}
+
+// consolePorts returns the extra consoles for a machine configuration.
+func (e *Emulator) consolePorts() map[string]consolePort {
+	if len(e.consoles) == 0 {
+		return nil
+	}
+	ports := make(map[string]consolePort, len(e.consoles))
+	for id, sc := range e.consoles {
+		ports[id] = consolePort{out: sc.writer, in: sc.reader}
+	}
+	return ports
+}
+
+// consoleIDs lists every console, console0 first.
+func (e *Emulator) consoleIDs() []string {
+	ids := make([]string, 0, len(e.consoles))
+	for id := range e.consoles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return append([]string{defaultConsole}, ids...)
+}
+
+// flushConsoles delivers buffered output of every extra console and of
+// the message port.
+func (e *Emulator) flushConsoles() {
+	for _, sc := range e.consoles {
+		sc.writer.Flush()
+	}
+	e.messages.writer.Flush()
+}
+
+// consoleArg reads an optional console id argument, defaulting to
+// console0, and checks that the console exists.
+func (e *Emulator) consoleArg(args []js.Value, i int) (string, error) {
+	if !present(args, i) {
+		return defaultConsole, nil
+	}
+	id, err := stringArg(args, i, "console id")
+	if err != nil {
+		return "", err
+	}
+	if _, ok := e.consoles[id]; !ok && id != defaultConsole {
+		return "", fmt.Errorf("unknown console %q", id)
+	}
+	return id, nil
+}
+
+// sendTo feeds input to the console id, which must exist.
+func (e *Emulator) sendTo(id string, data []byte) error {
+	if id == defaultConsole {
+		return e.feedInput(data)
+	}
+	return e.consoles[id].reader.Write(data)
+}
+
+// consolesOption reads the consoles option, an object mapping each extra
+// console id to its output callback.
+func consolesOption(v js.Value) (map[string]js.Value, error) {
+	c := v.Get("consoles")
+	if c.IsUndefined() || c.IsNull() {
+		return nil, nil
+	}
+	if c.Type() != js.TypeObject {
+		return nil, fmt.Errorf("consoles must be an object, got %s", c.Type())
+	}
+
+	keys := js.Global().Get("Object").Call("keys", c)
+	callbacks := make(map[string]js.Value, keys.Length())
+	for i := 0; i < keys.Length(); i++ {
+		id := keys.Index(i).String()
+		if id == "" || id == defaultConsole {
+			return nil, fmt.Errorf("invalid console id %q, %s is the tinyemuInit callback", id, defaultConsole)
+		}
+		fn, err := asCallback(c.Get(id), "consoles."+id)
+		if err != nil {
+			return nil, err
+		}
+		callbacks[id] = fn
+	}
+	return callbacks, nil
+}
+
+// listConsoles returns {consoles}, the ids of every console, console0
+// first.
+func listConsoles(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	ids := e.consoleIDs()
+	list := make([]interface{}, len(ids))
+	for i, id := range ids {
+		list[i] = id
+	}
+	return okResult(map[string]interface{}{"consoles": list})
+}
@@ -0,0 +1,104 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+	"testing"
+)
+
+// echoMachine writes back each console's input on that console's output,
+// tagged with the console id.
+type echoMachine struct {
+	ports map[string]consolePort // console0 included
+}
+
+func (m *echoMachine) Step(n int) int {
+	p := make([]byte, 64)
+	for id, port := range m.ports {
+		if k, _ := port.in.Read(p); k > 0 {
+			fmt.Fprintf(port.out, "%s:%s\n", id, p[:k])
+		}
+	}
+	return n
+}
+
+func (m *echoMachine) Booted() bool { return true }
+
+// echoEmulator returns a started instance with a debug console beside
+// console0, and the recorders of both.
+func echoEmulator(t *testing.T) (e *Emulator, console0, debug *outputRecorder) {
+	t.Helper()
+	useMachine(t, func(config machineConfig) machine {
+		ports := map[string]consolePort{defaultConsole: {out: config.console, in: e.reader}}
+		for id, port := range config.consoles {
+			ports[id] = port
+		}
+		return &echoMachine{ports: ports}
+	})
+	debug = newOutputRecorder(t)
+	e, console0 = newTestEmulator(t, map[string]interface{}{"consoles": map[string]interface{}{"debug": debug.fn}})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	return e, console0, debug
+}
+
+func TestConsolesDontBleedIntoEachOther(t *testing.T) {
+	e, console0, debug := echoEmulator(t)
+	if got := statusOf(e.call(sendInput, "main")); got != "" {
+		t.Fatalf("sendInput to console0 = %s", got)
+	}
+	if got := statusOf(e.call(sendInput, "dbg", "debug")); got != "" {
+		t.Fatalf("sendInput to debug = %s", got)
+	}
+
+	if got := waitOutput(t, console0, 0); got != "console0:main\n" {
+		t.Errorf("console0 callback got %q, want only its own echo", got)
+	}
+	if got := waitOutput(t, debug, 0); got != "debug:dbg\n" {
+		t.Errorf("debug callback got %q, want only its own echo", got)
+	}
+
+	// Input for one console never waits in another's queue
+	e.call(pauseEmulator)
+	e.call(sendInput, "only debug", "debug")
+	if e.reader.Buffered() != 0 {
+		t.Errorf("console0 queue holds %q after input for debug", e.reader.Pending())
+	}
+	if got := string(e.consoles["debug"].reader.Pending()); got != "only debug" {
+		t.Errorf("debug queue holds %q, want %q", got, "only debug")
+	}
+}
+
+func TestConsoleIdsAreChecked(t *testing.T) {
+	e, _, _ := echoEmulator(t)
+	if got := statusOf(e.call(sendInput, "x", "uart7")); got != string(codeInvalidArgument) {
+		t.Errorf("sendInput to an unknown console = %s, want invalid_argument", got)
+	}
+	list := e.call(listConsoles).(map[string]interface{})["data"].(map[string]interface{})["consoles"].([]interface{})
+	if len(list) != 2 || list[0] != defaultConsole || list[1] != "debug" {
+		t.Errorf("listConsoles = %v, want [console0 debug]", list)
+	}
+
+	for _, consoles := range []interface{}{"debug", map[string]interface{}{"console0": newOutputRecorder(t).fn}} {
+		result := initEmulator(js.Undefined(), []js.Value{newOutputRecorder(t).fn.Value, js.ValueOf(map[string]interface{}{"consoles": consoles})}).(map[string]interface{})
+		if !failed(result) {
+			t.Errorf("consoles %v accepted", consoles)
+			instances[result["data"].(map[string]interface{})["handle"].(int)].dispose()
+		}
+	}
+}
+
+func TestOnlyConsole0ByDefault(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	list := e.call(listConsoles).(map[string]interface{})["data"].(map[string]interface{})["consoles"].([]interface{})
+	if len(list) != 1 || list[0] != defaultConsole {
+		t.Errorf("listConsoles = %v, want [console0]", list)
+	}
+
+	// With no other consoles, output isn't tagged with a name
+	if e.writer.Name != "" {
+		t.Errorf("console0 writer is named %q", e.writer.Name)
+	}
+}
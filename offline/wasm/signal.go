@@ -0,0 +1,74 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+)
+
+// consoleSignaler is implemented by machines whose console device can
+// raise a signal in the guest directly, independent of TTY settings.
+type consoleSignaler interface {
+	Signal(name string) error
+}
+
+// supportedSignals lists the names tinyemuSendSignal accepts.
+var supportedSignals = []interface{}{"INT", "QUIT", "TERM", "TSTP"}
+
+// signalBytes maps signals to the control byte a TTY turns into them, for
+// machines without a consoleSignaler. TERM has no TTY equivalent.
+var signalBytes = map[string]byte{
+	"INT":  0x03, // ^C
+	"QUIT": 0x1c, // ^\
+	"TSTP": 0x1a, // ^Z
+}
+
+// sendSignal delivers a signal such as "INT" to the guest's foreground
+// process, through the console device if it can, else as a control byte.
+func sendSignal(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	raw, err := stringArg(args, 0, "signal")
+	if err != nil {
+		return unknownSignal(err.Error())
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(raw), "SIG")
+	known := false
+	for _, s := range supportedSignals {
+		known = known || s == name
+	}
+	if !known {
+		return unknownSignal("unknown signal " + raw)
+	}
+
+	e.machineMu.Lock()
+	s, ok := e.machine.(consoleSignaler)
+	e.machineMu.Unlock()
+	if ok {
+		if err := s.Signal(name); err != nil {
+			return errorResult(err)
+		}
+		return statusResult(statusSignaled, map[string]interface{}{"signal": name, "via": "device"})
+	}
+
+	b, ok := signalBytes[name]
+	if !ok {
+		return errResult(codeUnsupported, "machine cannot deliver "+name+" without a signal-capable console")
+	}
+	// Straight to the reader: a signal shouldn't wait on a cooked line
+	if err := e.reader.Write([]byte{b}); err != nil {
+		return inputResult(err)
+	}
+	return statusResult(statusSignaled, map[string]interface{}{"signal": name, "via": "control_byte"})
+}
+
+// unknownSignal is an invalid_argument result listing the supported names.
+func unknownSignal(message string) map[string]interface{} {
+	r := errResult(codeInvalidArgument, message)
+	r["data"] = map[string]interface{}{"supported": supportedSignals}
+	return r
+}
@@ -0,0 +1,80 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// signalingMachine is a machine whose console raises signals itself.
+type signalingMachine struct {
+	testMachine
+	mu      sync.Mutex
+	signals []string
+}
+
+func (m *signalingMachine) Signal(name string) error {
+	m.mu.Lock()
+	m.signals = append(m.signals, name)
+	m.mu.Unlock()
+	return nil
+}
+
+func TestSignalThroughConsoleDevice(t *testing.T) {
+	m := &signalingMachine{}
+	useMachine(t, func(machineConfig) machine { return m })
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+
+	r := e.call(sendSignal, "INT").(map[string]interface{})
+	if statusOf(r) != string(statusSignaled) || r["data"].(map[string]interface{})["via"] != "device" {
+		t.Fatalf("tinyemuSendSignal(INT) = %v", r)
+	}
+	e.call(sendSignal, "SIGterm")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if want := []string{"INT", "TERM"}; !reflect.DeepEqual(m.signals, want) {
+		t.Errorf("console device raised %q, want %q", m.signals, want)
+	}
+	if n := e.reader.Buffered(); n != 0 {
+		t.Errorf("%d bytes were queued as input as well", n)
+	}
+}
+
+func TestSignalAsControlByte(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	for name, want := range map[string]string{"INT": "\x03", "sigquit": "\x1c", "TSTP": "\x1a"} {
+		r := e.call(sendSignal, name).(map[string]interface{})
+		if statusOf(r) != string(statusSignaled) || r["data"].(map[string]interface{})["via"] != "control_byte" {
+			t.Errorf("tinyemuSendSignal(%s) = %v", name, r)
+		}
+		if got := string(e.reader.Pending()); got != want {
+			t.Errorf("%s queued %q, want %q", name, got, want)
+		}
+		e.reader.Clear()
+	}
+
+	if got := statusOf(e.call(sendSignal, "TERM")); got != string(codeUnsupported) {
+		t.Errorf("TERM without a signal-capable console = %s, want unsupported", got)
+	}
+}
+
+func TestUnknownSignalListsSupported(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	for _, arg := range []interface{}{"HUP", 9} {
+		r := e.call(sendSignal, arg).(map[string]interface{})
+		if statusOf(r) != string(codeInvalidArgument) {
+			t.Errorf("tinyemuSendSignal(%v) = %v, want invalid_argument", arg, r)
+			continue
+		}
+		if got := r["data"].(map[string]interface{})["supported"]; !reflect.DeepEqual(got, supportedSignals) {
+			t.Errorf("tinyemuSendSignal(%v) lists %v, want %v", arg, got, supportedSignals)
+		}
+	}
+	if n := e.reader.Buffered(); n != 0 {
+		t.Errorf("an unknown signal queued %d bytes", n)
+	}
+}
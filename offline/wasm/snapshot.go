@@ -0,0 +1,438 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"syscall/js"
+	"time"
+)
+
+// Snapshot blobs start with snapshotMagic followed by a big-endian uint32
+// format version. Bump snapshotVersion whenever the encoding changes
+// incompatibly.
+const (
+	snapshotMagic   = "TEMU"
+	snapshotVersion = 2
+)
+
+// Sections of a snapshot, in the order they appear. Each is its tag, a
+// big-endian uint64 length and that many bytes.
+const (
+	sectionMachine = "MACH" // the machine's own MarshalState
+	sectionRAM     = "RAM " // guest RAM
+	sectionDisks   = "DISK" // what the guest wrote to each disk
+	sectionConsole = "CONS" // console0's terminal and queued input
+	sectionClock   = "CLCK" // virtual time, empty on the wall clock
+)
+
+var snapshotSections = []string{sectionMachine, sectionRAM, sectionDisks, sectionConsole, sectionClock}
+
+// ramPageSize is the granularity at which RAM is saved; pages that are all
+// zero are left out.
+const ramPageSize = 4096
+
+var errNoMachine = newError(codeNotRunning, "no machine to snapshot, call tinyemuStart first")
+
+// snapshotter is implemented by machines whose full state can be saved and
+// restored.
+type snapshotter interface {
+	MarshalState() ([]byte, error)
+	UnmarshalState(data []byte) error
+}
+
+// snapshotReader decodes the fields of a section. The first error sticks,
+// and reads after it return zero values.
+type snapshotReader struct {
+	data []byte
+	err  error
+}
+
+func (r *snapshotReader) take(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.data)) < n {
+		r.err = errors.New("snapshot is truncated")
+		return nil
+	}
+	p := r.data[:n]
+	r.data = r.data[n:]
+	return p
+}
+
+func (r *snapshotReader) uint32() uint32 {
+	if p := r.take(4); p != nil {
+		return binary.BigEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (r *snapshotReader) uint64() uint64 {
+	if p := r.take(8); p != nil {
+		return binary.BigEndian.Uint64(p)
+	}
+	return 0
+}
+
+// bytes reads a uint64 length and that many bytes.
+func (r *snapshotReader) bytes() []byte {
+	return r.take(r.uint64())
+}
+
+// appendBytes appends p with its uint64 length in front.
+func appendBytes(b, p []byte) []byte {
+	return append(binary.BigEndian.AppendUint64(b, uint64(len(p))), p...)
+}
+
+// snapshotState is everything a snapshot holds, decoded.
+type snapshotState struct {
+	machine  []byte
+	ramSize  uint64
+	ramPages map[uint64][]byte // non-zero pages by offset
+	disks    map[int]snapshotDisk
+	terminal terminalState
+	input    map[string][]byte // queued input by console id
+	clock    *time.Time        // nil on the wall clock
+}
+
+// snapshotDisk is one disk as a snapshot saved it.
+type snapshotDisk struct {
+	size    int64
+	overlay map[int64][]byte
+}
+
+// diskOverlay returns the overlay of a backend a snapshot can save.
+func diskOverlay(d blockBackend) (overlayer, bool) {
+	if pd, ok := d.(*persistentDisk); ok {
+		if _, ok := pd.blockBackend.(overlayer); !ok {
+			return nil, false
+		}
+	}
+	o, ok := d.(overlayer)
+	return o, ok
+}
+
+// snapshotInputs returns the input queue of every console by id, the
+// message port's included.
+func (e *Emulator) snapshotInputs() map[string]*ConsoleReader {
+	inputs := map[string]*ConsoleReader{defaultConsole: e.reader, messagePortName: e.messages.reader}
+	for id, sc := range e.consoles {
+		inputs[id] = sc.reader
+	}
+	return inputs
+}
+
+// encodeSnapshot saves the state of the instance running m: the machine,
+// RAM, what the guest wrote to each disk, console0's terminal modes and
+// cursor, the input queued on every console and virtual time. It runs
+// with machineMu held.
+func (e *Emulator) encodeSnapshot(m machine) ([]byte, error) {
+	s, ok := m.(snapshotter)
+	if !ok {
+		return nil, newError(codeUnsupported, "machine does not support snapshots")
+	}
+	state, err := s.MarshalState()
+	if err != nil {
+		return nil, err
+	}
+
+	ram := binary.BigEndian.AppendUint64(nil, uint64(len(e.ram)))
+	zero := make([]byte, ramPageSize)
+	for off := 0; off < len(e.ram); off += ramPageSize {
+		page := e.ram[off:min(off+ramPageSize, len(e.ram))]
+		if !bytes.Equal(page, zero[:len(page)]) {
+			ram = appendBytes(binary.BigEndian.AppendUint64(ram, uint64(off)), page)
+		}
+	}
+
+	var disks []byte
+	for i, d := range e.disks {
+		if d == nil {
+			continue
+		}
+		o, ok := diskOverlay(d)
+		if !ok {
+			return nil, withCode(codeUnsupported, fmt.Errorf("disk %s can't be saved in a snapshot", diskName(i)))
+		}
+		overlay := o.Overlay()
+		offs := make([]int64, 0, len(overlay))
+		for off := range overlay {
+			offs = append(offs, off)
+		}
+		sort.Slice(offs, func(a, b int) bool { return offs[a] < offs[b] })
+
+		disks = binary.BigEndian.AppendUint32(disks, uint32(i))
+		disks = binary.BigEndian.AppendUint64(disks, uint64(d.Size()))
+		disks = binary.BigEndian.AppendUint32(disks, uint32(len(offs)))
+		for _, off := range offs {
+			disks = appendBytes(binary.BigEndian.AppendUint64(disks, uint64(off)), overlay[off])
+		}
+	}
+
+	e.writer.Flush()
+	t := e.writer.terminalState()
+	var flags uint32
+	if t.cursor.hidden {
+		flags |= 1
+	}
+	if t.cursor.wrapNext {
+		flags |= 2
+	}
+	if t.bracketedPaste {
+		flags |= 4
+	}
+	console := binary.BigEndian.AppendUint32(nil, flags)
+	console = binary.BigEndian.AppendUint32(console, uint32(t.cursor.row))
+	console = binary.BigEndian.AppendUint32(console, uint32(t.cursor.col))
+	inputs := e.snapshotInputs()
+	ids := make([]string, 0, len(inputs))
+	for id := range inputs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	console = binary.BigEndian.AppendUint32(console, uint32(len(ids)))
+	for _, id := range ids {
+		console = appendBytes(appendBytes(console, []byte(id)), inputs[id].Pending())
+	}
+
+	var clk []byte
+	if vc, ok := e.clock.(*virtualClock); ok {
+		clk = binary.BigEndian.AppendUint64(nil, uint64(vc.Now().Sub(virtualEpoch)))
+	}
+
+	blob := append([]byte(snapshotMagic), binary.BigEndian.AppendUint32(nil, snapshotVersion)...)
+	for i, section := range [][]byte{state, ram, disks, console, clk} {
+		blob = append(blob, snapshotSections[i]...)
+		blob = appendBytes(blob, section)
+	}
+	return blob, nil
+}
+
+// decodeSnapshot validates blob and returns what it holds.
+func decodeSnapshot(blob []byte) (*snapshotState, error) {
+	header := len(snapshotMagic) + 4
+	if len(blob) < header || string(blob[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.New("not a TinyEMU snapshot")
+	}
+	if v := binary.BigEndian.Uint32(blob[len(snapshotMagic):]); v != snapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d not supported (want %d)", v, snapshotVersion)
+	}
+
+	top := &snapshotReader{data: blob[header:]}
+	sections := make(map[string]*snapshotReader, len(snapshotSections))
+	for _, tag := range snapshotSections {
+		if got := string(top.take(4)); top.err == nil && got != tag {
+			return nil, fmt.Errorf("snapshot has section %q where %q belongs", got, tag)
+		}
+		sections[tag] = &snapshotReader{data: top.bytes()}
+	}
+	if top.err == nil && len(top.data) > 0 {
+		top.err = errors.New("snapshot has trailing data")
+	}
+	if top.err != nil {
+		return nil, top.err
+	}
+
+	s := &snapshotState{
+		machine:  sections[sectionMachine].data,
+		ramPages: make(map[uint64][]byte),
+		disks:    make(map[int]snapshotDisk),
+		input:    make(map[string][]byte),
+	}
+
+	r := sections[sectionRAM]
+	s.ramSize = r.uint64()
+	for r.err == nil && len(r.data) > 0 {
+		off, page := r.uint64(), r.bytes()
+		if r.err == nil && (off%ramPageSize != 0 || len(page) > ramPageSize || off+uint64(len(page)) > s.ramSize) {
+			r.err = fmt.Errorf("snapshot RAM page at %d is out of range", off)
+		}
+		s.ramPages[off] = page
+	}
+
+	d := sections[sectionDisks]
+	for d.err == nil && len(d.data) > 0 {
+		i, size, n := int(d.uint32()), int64(d.uint64()), d.uint32()
+		disk := snapshotDisk{size: size, overlay: make(map[int64][]byte, n)}
+		for j := uint32(0); j < n && d.err == nil; j++ {
+			off := int64(d.uint64())
+			disk.overlay[off] = d.bytes()
+		}
+		if d.err == nil && (i >= maxDisks || s.disks[i].overlay != nil) {
+			d.err = fmt.Errorf("snapshot has a bad disk index %d", i)
+		}
+		s.disks[i] = disk
+	}
+
+	c := sections[sectionConsole]
+	flags := c.uint32()
+	s.terminal = terminalState{
+		cursor: vtCursor{
+			row:      int(c.uint32()),
+			col:      int(c.uint32()),
+			hidden:   flags&1 != 0,
+			wrapNext: flags&2 != 0,
+		},
+		bracketedPaste: flags&4 != 0,
+	}
+	for n := c.uint32(); n > 0 && c.err == nil; n-- {
+		id := string(c.bytes())
+		s.input[id] = c.bytes()
+	}
+
+	k := sections[sectionClock]
+	if len(k.data) > 0 {
+		t := virtualEpoch.Add(time.Duration(k.uint64()))
+		s.clock = &t
+	}
+
+	for _, sr := range []*snapshotReader{r, d, c, k} {
+		if sr.err != nil {
+			return nil, sr.err
+		}
+	}
+	return s, nil
+}
+
+// checkRestore reports why the instance can't take on state, before
+// anything about it has changed.
+func (e *Emulator) checkRestore(s *snapshotState) error {
+	if s.ramSize != uint64(len(e.ram)) {
+		return withCode(codeInvalidArgument, fmt.Errorf("snapshot has %d MB of RAM, this instance %d MB", s.ramSize>>20, len(e.ram)>>20))
+	}
+	for i, d := range e.disks {
+		saved, ok := s.disks[i]
+		switch {
+		case d == nil && ok:
+			return withCode(codeInvalidArgument, fmt.Errorf("snapshot has disk %s, which isn't loaded", diskName(i)))
+		case d == nil:
+		case !ok || saved.size != d.Size():
+			return withCode(codeInvalidArgument, fmt.Errorf("disk %s isn't the one the snapshot was taken with", diskName(i)))
+		}
+	}
+	inputs := e.snapshotInputs()
+	for id := range s.input {
+		if _, ok := inputs[id]; !ok {
+			return withCode(codeInvalidArgument, fmt.Errorf("snapshot has input for console %q, which this instance doesn't have", id))
+		}
+	}
+	_, virtual := e.clock.(*virtualClock)
+	if virtual != (s.clock != nil) {
+		return withCode(codeInvalidArgument, errors.New("snapshot was taken with a different deterministic setting"))
+	}
+	return nil
+}
+
+// applySnapshot puts RAM, disks, consoles and the clock back as s saved
+// them. The run loop must not be running.
+func (e *Emulator) applySnapshot(s *snapshotState) error {
+	for i, saved := range s.disks {
+		o, ok := diskOverlay(e.disks[i])
+		if !ok {
+			return withCode(codeUnsupported, fmt.Errorf("disk %s can't be restored from a snapshot", diskName(i)))
+		}
+		if err := o.SetOverlay(saved.overlay); err != nil {
+			return fmt.Errorf("restoring disk %s: %w", diskName(i), err)
+		}
+	}
+
+	clear(e.ram)
+	for off, page := range s.ramPages {
+		copy(e.ram[off:], page)
+	}
+
+	e.writer.setTerminalState(s.terminal)
+	for id, r := range e.snapshotInputs() {
+		r.Clear()
+		if err := r.Write(s.input[id]); err != nil {
+			return fmt.Errorf("restoring input of %s: %w", id, err)
+		}
+	}
+
+	if vc, ok := e.clock.(*virtualClock); ok {
+		vc.mu.Lock()
+		vc.now = *s.clock
+		vc.mu.Unlock()
+	}
+	return nil
+}
+
+// snapshotEmulator returns {snapshot}, a Uint8Array holding the state of
+// the running or paused machine: its CPU and devices, guest RAM, what the
+// guest wrote to each disk, the console's terminal modes, input queued on
+// every console and, in deterministic mode, virtual time. Disk images
+// themselves aren't included, so tinyemuRestore needs the same ones
+// loaded. While a step waits for a lazy disk's fetch it fails with busy.
+func snapshotEmulator(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.machineMu.Lock()
+	var blob []byte
+	err = errNoMachine
+	if e.parked.Load() {
+		err = errParked
+	} else if e.machine != nil {
+		blob, err = e.encodeSnapshot(e.machine)
+	}
+	e.machineMu.Unlock()
+
+	if err != nil {
+		return errorResult(err)
+	}
+	return okResult(map[string]interface{}{"snapshot": bytesToJS(blob)})
+}
+
+// restoreEmulator stops any running machine and resumes from a snapshot
+// taken with the same RAM size, disks and consoles. Like tinyemuSnapshot
+// it fails with busy while a step waits for a lazy disk's fetch.
+func restoreEmulator(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !present(args, 0) {
+		return errResult(codeInvalidArgument, "missing snapshot argument")
+	}
+	if e.parked.Load() {
+		return errorResult(errParked)
+	}
+
+	blob, err := bytesFromJS(args[0])
+	if err != nil {
+		return errorResult(err)
+	}
+	s, err := decodeSnapshot(blob)
+	if err != nil {
+		return errorResult(err)
+	}
+	if err := e.checkRestore(s); err != nil {
+		return errorResult(err)
+	}
+
+	m, ok := newMachine(e.stagedConfig()).(snapshotter)
+	if !ok {
+		return errResult(codeUnsupported, "machine does not support snapshots")
+	}
+	if err := m.UnmarshalState(s.machine); err != nil {
+		return errorResult(err)
+	}
+
+	if !e.haltRunLoop() {
+		return errorResult(errStopTimeout)
+	}
+	if err := e.applySnapshot(s); err != nil {
+		return errorResult(err)
+	}
+	if result := e.launch(m.(machine), nil); failed(result) {
+		return result
+	}
+	return statusResult(statusRestored, nil)
+}
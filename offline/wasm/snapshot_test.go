@@ -0,0 +1,183 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// counterMachine bumps a counter of its own, a byte of RAM and a byte of
+// vda on every step and prints all three, so output after a restore only
+// matches if all of them came back.
+type counterMachine struct {
+	testMachine
+	config machineConfig
+	count  uint32
+}
+
+func newCounterMachine(config machineConfig) machine {
+	m := &counterMachine{config: config}
+	m.step = func(int) {
+		m.count++
+		m.config.ram[100]++
+		b := make([]byte, 1)
+		m.config.disks[0].ReadAt(b, 700)
+		b[0] += 3
+		m.config.disks[0].WriteAt(b, 700)
+		fmt.Fprintf(m.config.console, "count %d ram %d disk %d\n", m.count, m.config.ram[100], b[0])
+	}
+	return m
+}
+
+func (m *counterMachine) MarshalState() ([]byte, error) {
+	return binary.BigEndian.AppendUint32(nil, m.count), nil
+}
+
+func (m *counterMachine) UnmarshalState(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("bad counter state")
+	}
+	m.count = binary.BigEndian.Uint32(data)
+	return nil
+}
+
+// linesAfter waits for n complete lines of output past the first skip
+// bytes and returns them.
+func linesAfter(t *testing.T, e *Emulator, rec *outputRecorder, skip, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		e.writer.Flush()
+		if lines := strings.SplitAfter(rec.text()[skip:], "\n"); len(lines) > n {
+			return lines[:n]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("fewer than %d lines after byte %d: %q", n, skip, rec.text()[skip:])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// pauseQuiet pauses e and waits for a step under way to finish, returning
+// how much output there is.
+func pauseQuiet(t *testing.T, e *Emulator, rec *outputRecorder) int {
+	t.Helper()
+	if got := statusOf(e.call(pauseEmulator)); got != string(statusPaused) {
+		t.Fatalf("tinyemuPause = %s", got)
+	}
+	time.Sleep(stepInterval + 20*time.Millisecond)
+	e.writer.Flush()
+	return len(rec.text())
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	useMachine(t, newCounterMachine)
+	e, rec := newTestEmulator(t, nil)
+	if got := statusOf(loadDisk(js.Undefined(), []js.Value{js.ValueOf(e.handle), bytesToJS(make([]byte, 4*sectorSize))})); got != string(statusDiskLoaded) {
+		t.Fatalf("tinyemuLoadDisk = %s", got)
+	}
+	e.call(startEmulator)
+	linesAfter(t, e, rec, 0, 2)
+
+	mark := pauseQuiet(t, e, rec)
+	result := e.call(snapshotEmulator).(map[string]interface{})
+	if failed(result) {
+		t.Fatalf("tinyemuSnapshot: %v", result["error"])
+	}
+	blob := result["data"].(map[string]interface{})["snapshot"].(js.Value)
+	if !blob.InstanceOf(js.Global().Get("Uint8Array")) {
+		t.Fatalf("snapshot is a %s, want a Uint8Array", blob.Type())
+	}
+
+	e.call(resumeEmulator)
+	want := linesAfter(t, e, rec, mark, 3)
+
+	mark = pauseQuiet(t, e, rec)
+	if got := statusOf(restoreEmulator(js.Undefined(), []js.Value{js.ValueOf(e.handle), blob})); got != string(statusRestored) {
+		t.Fatalf("tinyemuRestore = %s", got)
+	}
+	got := linesAfter(t, e, rec, mark, 3)
+	if strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("after restore got\n%s\nwant\n%s", strings.Join(got, ""), strings.Join(want, ""))
+	}
+}
+
+func TestSnapshotKeepsQueuedInputAndTerminalModes(t *testing.T) {
+	useMachine(t, func(config machineConfig) machine {
+		return &counterMachine{config: config}
+	})
+	e, _ := newTestEmulator(t, nil)
+	e.disks[0] = &memDisk{data: make([]byte, sectorSize)}
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	e.writer.Write([]byte("\x1b[?2004h\x1b[3;5H"))
+	e.call(sendInput, "queued")
+
+	blob := e.call(snapshotEmulator).(map[string]interface{})["data"].(map[string]interface{})["snapshot"].(js.Value)
+	e.reader.Clear()
+	e.writer.Write([]byte("\x1b[?2004l\x1b[H"))
+	e.writer.Flush()
+
+	if got := statusOf(restoreEmulator(js.Undefined(), []js.Value{js.ValueOf(e.handle), blob})); got != string(statusRestored) {
+		t.Fatalf("tinyemuRestore = %s", got)
+	}
+	if got := string(e.reader.Pending()); got != "queued" {
+		t.Errorf("queued input after restore is %q, want %q", got, "queued")
+	}
+	if !e.writer.BracketedPaste() {
+		t.Error("bracketed paste is off after restore")
+	}
+	if c := e.writer.Cursor(); c.row != 2 || c.col != 4 {
+		t.Errorf("cursor after restore is at %d,%d, want 2,4", c.row, c.col)
+	}
+}
+
+func TestRestoreRejectsMismatchedSnapshots(t *testing.T) {
+	useMachine(t, func(config machineConfig) machine {
+		return &counterMachine{config: config}
+	})
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	blob, _ := bytesFromJS(e.call(snapshotEmulator).(map[string]interface{})["data"].(map[string]interface{})["snapshot"].(js.Value))
+
+	restore := func(b []byte) string {
+		return statusOf(restoreEmulator(js.Undefined(), []js.Value{js.ValueOf(e.handle), bytesToJS(b)}))
+	}
+	bad := append([]byte(nil), blob...)
+	binary.BigEndian.PutUint32(bad[len(snapshotMagic):], snapshotVersion+1)
+	if got := restore(bad); got != string(codeInvalidArgument) {
+		t.Errorf("restoring a newer version = %s, want invalid_argument", got)
+	}
+	if got := restore(blob[:len(blob)-1]); got != string(codeInvalidArgument) {
+		t.Errorf("restoring a truncated snapshot = %s, want invalid_argument", got)
+	}
+
+	e.disks[1] = &memDisk{data: make([]byte, sectorSize)}
+	if got := restore(blob); got != string(codeInvalidArgument) {
+		t.Errorf("restoring with a disk the snapshot lacks = %s, want invalid_argument", got)
+	}
+	e.disks[1] = nil
+	if got := restore(blob); got != string(statusRestored) {
+		t.Errorf("restoring with matching disks = %s", got)
+	}
+}
+
+func TestSnapshotUnsupportedMachine(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(snapshotEmulator)); got != string(codeNotRunning) {
+		t.Errorf("tinyemuSnapshot before start = %s, want not_running", got)
+	}
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if got := statusOf(e.call(snapshotEmulator)); got != string(codeUnsupported) {
+		t.Errorf("tinyemuSnapshot of a machine without state = %s, want unsupported", got)
+	}
+}
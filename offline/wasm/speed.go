@@ -0,0 +1,128 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// speedBurst is how much unused allowance the limiter banks, so a short
+// stall doesn't turn into a catch-up sprint.
+const speedBurst = 50 * time.Millisecond
+
+// speedLimiter caps the instruction rate with a token bucket. The run loop
+// takes tokens per step rather than per instruction and sleeps off any debt.
+type speedLimiter struct {
+	clock   clock
+	mu      sync.Mutex
+	ips     float64 // 0 means unlimited
+	tokens  float64
+	last    time.Time
+	changed chan struct{} // closed and replaced by every set
+}
+
+// set changes the target rate and forgives any debt, waking a sleeping run
+// loop so the new rate applies right away.
+func (l *speedLimiter) set(mips float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ips = mips * 1e6
+	l.tokens = 0
+	l.last = l.clock.Now()
+	if l.changed != nil {
+		close(l.changed)
+	}
+	l.changed = make(chan struct{})
+}
+
+// active reports whether a rate is set.
+func (l *speedLimiter) active() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ips > 0
+}
+
+// take spends n tokens and returns how long to wait before the next step,
+// along with a channel that is closed if the speed changes meanwhile.
+func (l *speedLimiter) take(n int) (time.Duration, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.changed == nil {
+		l.changed = make(chan struct{})
+	}
+	if l.ips == 0 {
+		return 0, l.changed
+	}
+
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.ips
+	l.last = now
+	if burst := l.ips * speedBurst.Seconds(); l.tokens > burst {
+		l.tokens = burst
+	}
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0, l.changed
+	}
+	return time.Duration(-l.tokens / l.ips * float64(time.Second)), l.changed
+}
+
+// pace sleeps between steps for at least stepInterval, and longer if the
+// speed limit needs it. With a yield budget it instead carries straight on
+// until the budget is spent and then yields, still sleeping off the speed
+// limit. It returns false if ctx is canceled first.
+func (e *Emulator) pace(ctx context.Context, retired int) bool {
+	start := e.clock.Now()
+	wait, changed := e.limiter.take(retired)
+	interval := stepInterval
+	if e.yielder.budget.enabled() {
+		// A step that retired nothing is waiting on something, so yield
+		// rather than spin
+		if !e.yielder.due(retired, start) && retired > 0 && wait <= 0 {
+			return ctx.Err() == nil
+		}
+		if wait <= 0 {
+			return e.yield(ctx)
+		}
+		e.yielder.reset(start)
+		interval = 0
+	}
+	deadline := start.Add(max(wait, interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-e.clock.After(deadline.Sub(e.clock.Now())):
+			return true
+		case <-changed:
+			// The debt was forgiven, so only the yield is left
+			_, changed = e.limiter.take(0)
+			deadline = start.Add(interval)
+		}
+	}
+}
+
+// setSpeed caps the emulated CPU at the given MIPS. 0 removes the cap.
+func setSpeed(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 1)
+	if err != nil {
+		return errorResult(err)
+	}
+	mips, err := numberArg(args, 0, "mips")
+	if err != nil {
+		return errorResult(err)
+	}
+	if mips < 0 {
+		return errResult(codeInvalidArgument, "mips must be >= 0")
+	}
+
+	e.limiter.set(mips)
+	return statusResult(statusSpeedSet, map[string]interface{}{"mips": mips})
+}
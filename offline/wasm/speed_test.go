@@ -0,0 +1,125 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// simulateLimiter runs steps of n instructions for window of clock time,
+// taking overhead per step and sleeping whatever take asks, and returns
+// the rate achieved.
+func simulateLimiter(l *speedLimiter, c *manualClock, n int, overhead, window time.Duration) float64 {
+	start := c.Now()
+	retired := 0
+	for c.Now().Sub(start) < window {
+		c.tick(overhead)
+		retired += n
+		wait, _ := l.take(n)
+		c.tick(wait)
+	}
+	return float64(retired) / c.Now().Sub(start).Seconds()
+}
+
+func TestSpeedLimiterHoldsTargetRate(t *testing.T) {
+	for _, tt := range []struct {
+		mips     float64
+		n        int
+		overhead time.Duration
+	}{
+		{1, 1000, 10 * time.Microsecond},
+		{50, stepInstructions, time.Microsecond},
+		{0.5, 40000, 2 * time.Millisecond},
+		{10, 1000, 0},
+	} {
+		c := &manualClock{now: virtualEpoch}
+		l := &speedLimiter{clock: c}
+		l.set(tt.mips)
+		got := simulateLimiter(l, c, tt.n, tt.overhead, 2*time.Second)
+		if want := tt.mips * 1e6; math.Abs(got-want)/want > 0.02 {
+			t.Errorf("%v MIPS in steps of %d: achieved %.0f IPS, want within 2%% of %.0f", tt.mips, tt.n, got, want)
+		}
+	}
+}
+
+func TestSpeedLimiterBanksOnlyABurst(t *testing.T) {
+	c := &manualClock{now: virtualEpoch}
+	l := &speedLimiter{clock: c}
+	l.set(1)
+
+	// A long stall earns at most speedBurst of instructions
+	c.tick(10 * time.Second)
+	free := int(1e6 * speedBurst.Seconds())
+	if wait, _ := l.take(free); wait != 0 {
+		t.Errorf("spending the banked burst waited %v", wait)
+	}
+	if wait, _ := l.take(1000); wait != time.Millisecond {
+		t.Errorf("the step after the burst waited %v, want 1ms", wait)
+	}
+}
+
+func TestSpeedChangeWakesThePacer(t *testing.T) {
+	c := &manualClock{now: virtualEpoch}
+	l := &speedLimiter{clock: c}
+	l.set(0.001)
+	wait, changed := l.take(1000)
+	if wait != time.Second {
+		t.Fatalf("1000 instructions at 0.001 MIPS waited %v, want 1s", wait)
+	}
+	l.set(0)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("setting the speed didn't signal the waiting step")
+	}
+	if wait, _ := l.take(1e9); wait != 0 {
+		t.Errorf("unlimited speed still waited %v", wait)
+	}
+}
+
+// measureRate returns the instructions per second e retires over window.
+func measureRate(t *testing.T, e *Emulator, window time.Duration) float64 {
+	t.Helper()
+	before := statsData(t, e)["instructions"].(float64)
+	start := time.Now()
+	time.Sleep(window)
+	after := statsData(t, e)["instructions"].(float64)
+	return (after - before) / time.Since(start).Seconds()
+}
+
+func TestSetSpeedCapsTheRunLoop(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	// A yield budget lets the loop step back to back between yields, so
+	// only the limiter holds it back
+	e, _ := newTestEmulator(t, map[string]interface{}{"yieldIntervalMs": 4})
+	if got := statusOf(e.call(setSpeed, 0.5)); got != string(statusSpeedSet) {
+		t.Fatalf("tinyemuSetSpeed = %s", got)
+	}
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	time.Sleep(50 * time.Millisecond)
+
+	const tolerance = 0.15
+	if got := measureRate(t, e, 500*time.Millisecond); math.Abs(got-0.5e6)/0.5e6 > tolerance {
+		t.Errorf("at 0.5 MIPS the loop ran at %.0f IPS", got)
+	}
+
+	// The new cap applies straight away rather than after the old debt
+	e.call(setSpeed, 0.1)
+	time.Sleep(10 * time.Millisecond)
+	if got := measureRate(t, e, 500*time.Millisecond); math.Abs(got-0.1e6)/0.1e6 > tolerance {
+		t.Errorf("after slowing to 0.1 MIPS the loop ran at %.0f IPS", got)
+	}
+
+	e.call(setSpeed, 0)
+	time.Sleep(10 * time.Millisecond)
+	if got := measureRate(t, e, 200*time.Millisecond); got < 1e6 {
+		t.Errorf("unlimited, the loop ran at only %.0f IPS", got)
+	}
+
+	if got := statusOf(e.call(setSpeed, -1)); got != string(codeInvalidArgument) {
+		t.Errorf("tinyemuSetSpeed(-1) = %s, want invalid_argument", got)
+	}
+}
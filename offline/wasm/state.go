@@ -0,0 +1,130 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+)
+
+// Lifecycle states reported to the onState callback.
+const (
+	stateInitialized = "initialized"
+	stateStarting    = "starting"
+	stateRunning     = "running"
+	statePaused      = "paused"
+	stateStopped     = "stopped"
+	stateCrashed     = "crashed"
+	stateBootTimeout = "boot_timeout"
+	stateHalted      = "halted" // the guest powered off
+	stateDisposed    = "disposed"
+)
+
+// lifecycleStates lists every state, as tinyemuGetSchema reports them.
+var lifecycleStates = []string{
+	stateInitialized,
+	stateStarting,
+	stateRunning,
+	statePaused,
+	stateStopped,
+	stateCrashed,
+	stateBootTimeout,
+	stateHalted,
+	stateDisposed,
+}
+
+// getState returns the current lifecycle state.
+func (e *Emulator) getState() string {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	return e.state
+}
+
+// setState moves the instance to state s and notifies onState. Every
+// lifecycle change goes through here.
+func (e *Emulator) setState(s string) {
+	e.stateMu.Lock()
+	e.changeStateLocked(s)
+}
+
+// transition moves from one state to another only if the instance is
+// currently in from, reporting whether it did.
+func (e *Emulator) transition(from, to string) bool {
+	e.stateMu.Lock()
+	if e.state != from {
+		e.stateMu.Unlock()
+		return false
+	}
+	e.changeStateLocked(to)
+	return true
+}
+
+// transitionFrom moves to to only if the instance is currently in one of
+// from, reporting whether it did.
+func (e *Emulator) transitionFrom(to string, from ...string) bool {
+	e.stateMu.Lock()
+	for _, s := range from {
+		if e.state == s {
+			e.changeStateLocked(to)
+			return true
+		}
+	}
+	e.stateMu.Unlock()
+	return false
+}
+
+// changeStateLocked is called with stateMu held and releases it. Changes
+// are queued and delivered in order by whichever caller is already
+// dispatching, so onState is never invoked concurrently, and a callback
+// that itself changes state (say, pausing on "running") doesn't deadlock.
+func (e *Emulator) changeStateLocked(s string) {
+	if e.state == s {
+		e.stateMu.Unlock()
+		return
+	}
+	e.state = s
+	e.stateQueue = append(e.stateQueue, s)
+	if e.dispatching {
+		e.stateMu.Unlock()
+		return
+	}
+
+	e.dispatching = true
+	for len(e.stateQueue) > 0 {
+		next := e.stateQueue[0]
+		e.stateQueue = e.stateQueue[1:]
+		e.stateMu.Unlock()
+
+		e.log.Debugf("state %s", next)
+		if e.options.onState.Type() == js.TypeFunction {
+			e.options.onState.Invoke(next)
+		}
+
+		e.stateMu.Lock()
+	}
+	e.dispatching = false
+	e.stateMu.Unlock()
+}
+
+// getEmulatorState returns {state}, the current lifecycle state, for UIs
+// that poll instead of listening to onState.
+func getEmulatorState(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	return okResult(map[string]interface{}{"state": e.getState()})
+}
+
+// emulatorIsRunning returns {running}, true while a run is starting or
+// running and false when paused, stopped, crashed or not yet started.
+func emulatorIsRunning(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err == errNotInitialized {
+		return okResult(map[string]interface{}{"running": false})
+	}
+	if err != nil {
+		return errorResult(err)
+	}
+	state := e.getState()
+	return okResult(map[string]interface{}{"running": state == stateStarting || state == stateRunning})
+}
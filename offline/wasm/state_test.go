@@ -0,0 +1,168 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"sync"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// stateRecorder is an onState callback that keeps the states it hears
+// and notes whether two calls ever overlapped.
+type stateRecorder struct {
+	fn      js.Func
+	mu      sync.Mutex
+	states  []string
+	inCall  bool
+	overlap bool
+	during  func(state string) // run inside the callback, if set
+}
+
+func newStateRecorder(t *testing.T) *stateRecorder {
+	rec := &stateRecorder{}
+	rec.fn = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		rec.mu.Lock()
+		rec.overlap = rec.overlap || rec.inCall
+		rec.inCall = true
+		rec.states = append(rec.states, args[0].String())
+		during := rec.during
+		rec.mu.Unlock()
+
+		if during != nil {
+			during(args[0].String())
+		}
+
+		rec.mu.Lock()
+		rec.inCall = false
+		rec.mu.Unlock()
+		return nil
+	})
+	t.Cleanup(rec.fn.Release)
+	return rec
+}
+
+func (rec *stateRecorder) seen() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]string(nil), rec.states...)
+}
+
+// waitFor waits up to a second for n states and returns those seen. A
+// state is set before the callback hears it, and may be delivered by
+// another goroutine that is already dispatching.
+func (rec *stateRecorder) waitFor(n int) []string {
+	deadline := time.Now().Add(time.Second)
+	for len(rec.seen()) < n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return rec.seen()
+}
+
+func TestStateSequenceForStartStop(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{bootSteps: 3} })
+	rec := newStateRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onState": rec.fn})
+
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	e.call(stopEmulator)
+	e.dispose()
+
+	want := []string{stateInitialized, stateStarting, stateRunning, stateStopped, stateDisposed}
+	if got := rec.waitFor(len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("onState heard %v, want %v", got, want)
+	}
+}
+
+func TestStateCallbackIsNeverConcurrent(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	rec := newStateRecorder(t)
+	// A slow callback makes overlapping deliveries likely if they can happen
+	rec.during = func(string) { time.Sleep(time.Millisecond) }
+	e, _ := newTestEmulator(t, map[string]interface{}{"onState": rec.fn})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				e.call(pauseEmulator)
+				e.call(resumeEmulator)
+			}
+		}()
+	}
+	wg.Wait()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.overlap {
+		t.Error("onState was invoked while another call was still running")
+	}
+	for i := 1; i < len(rec.states); i++ {
+		if rec.states[i] == rec.states[i-1] {
+			t.Errorf("onState heard %s twice in a row", rec.states[i])
+		}
+	}
+}
+
+func TestStateCallbackCanChangeState(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	rec := newStateRecorder(t)
+	var e *Emulator
+	rec.during = func(state string) {
+		if state == stateRunning {
+			e.call(pauseEmulator)
+		}
+	}
+	e, _ = newTestEmulator(t, map[string]interface{}{"onState": rec.fn})
+	e.call(startEmulator)
+	waitState(t, e, statePaused)
+
+	want := []string{stateInitialized, stateStarting, stateRunning, statePaused}
+	if got := rec.waitFor(len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("onState heard %v, want %v", got, want)
+	}
+}
+
+func TestStateQueriesFollowTheLifecycle(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	e, _ := newTestEmulator(t, nil)
+	check := func(action, state string, running bool) {
+		t.Helper()
+		got := e.call(getEmulatorState).(map[string]interface{})["data"].(map[string]interface{})["state"]
+		gotRunning := e.call(emulatorIsRunning).(map[string]interface{})["data"].(map[string]interface{})["running"]
+		if got != state || gotRunning != running {
+			t.Errorf("after %s: state %v, running %v; want %s, %v", action, got, gotRunning, state, running)
+		}
+	}
+
+	check("init", stateInitialized, false)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	check("start", stateRunning, true)
+	e.call(pauseEmulator)
+	check("pause", statePaused, false)
+	e.call(resumeEmulator)
+	check("resume", stateRunning, true)
+	e.call(stopEmulator)
+	check("stop", stateStopped, false)
+}
+
+func TestStateQueriesWithoutAnInstance(t *testing.T) {
+	withoutInstances(t)
+	if got := statusOf(getEmulatorState(js.Undefined(), nil)); got != string(codeNotInitialized) {
+		t.Errorf("getState = %s, want not_initialized", got)
+	}
+
+	// Not initialized is simply not running
+	result := emulatorIsRunning(js.Undefined(), nil).(map[string]interface{})
+	if failed(result) || result["data"].(map[string]interface{})["running"] != false {
+		t.Errorf("isRunning = %v, want {running: false}", result)
+	}
+}
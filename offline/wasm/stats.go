@@ -0,0 +1,227 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// ipsWindow is how far back the rolling instructions-per-second figure
+	// looks.
+	ipsWindow = time.Second
+	// maxStatsInterval bounds statsIntervalMs.
+	maxStatsInterval = time.Hour
+)
+
+// statSample is the retired instruction count at a point in time.
+type statSample struct {
+	at      time.Time
+	instret uint64
+}
+
+// runStats counts retired instructions and running time for one run. The
+// run loop records into it and JavaScript reads snapshots, so everything is
+// under mu.
+type runStats struct {
+	clock   clock
+	mu      sync.Mutex
+	instret uint64
+	samples []statSample // oldest first, spanning about ipsWindow
+
+	// Uptime excludes paused and stopped intervals: ran holds the time
+	// accumulated before since, which is zero while not running.
+	ran   time.Duration
+	since time.Time
+}
+
+// reset starts counting a new run from zero.
+func (s *runStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	s.instret = 0
+	s.samples = append(s.samples[:0], statSample{at: now})
+	s.ran = 0
+	s.since = now
+}
+
+// halt stops the uptime clock, on pause or when the run ends.
+func (s *runStats) halt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.since.IsZero() {
+		s.ran += s.clock.Now().Sub(s.since)
+		s.since = time.Time{}
+	}
+}
+
+// resume restarts the uptime clock after a pause.
+func (s *runStats) resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.since.IsZero() {
+		s.since = s.clock.Now()
+	}
+}
+
+// uptimeLocked is called with mu held.
+func (s *runStats) uptimeLocked() time.Duration {
+	if s.since.IsZero() {
+		return s.ran
+	}
+	return s.ran + s.clock.Now().Sub(s.since)
+}
+
+// record adds n retired instructions.
+func (s *runStats) record(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	s.instret += uint64(n)
+	s.samples = append(s.samples, statSample{at: now, instret: s.instret})
+
+	// Keep one sample at or beyond the window edge as the baseline
+	cut := 0
+	for cut < len(s.samples)-1 && now.Sub(s.samples[cut+1].at) >= ipsWindow {
+		cut++
+	}
+	s.samples = s.samples[cut:]
+}
+
+// counters returns instructions retired, uptime and the rolling IPS.
+func (s *runStats) counters() (instret uint64, uptime time.Duration, ips float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := len(s.samples); n > 1 {
+		first, last := s.samples[0], s.samples[n-1]
+		if elapsed := last.at.Sub(first.at).Seconds(); elapsed > 0 {
+			ips = float64(last.instret-first.instret) / elapsed
+		}
+	}
+	return s.instret, s.uptimeLocked(), ips
+}
+
+// snapshot returns the counters as a JavaScript object.
+func (s *runStats) snapshot() map[string]interface{} {
+	instret, uptime, ips := s.counters()
+	return map[string]interface{}{
+		"instructions": float64(instret),
+		"uptimeMs":     float64(uptime.Milliseconds()),
+		"ips":          ips,
+	}
+}
+
+// statsReport is the object handed to onStats. It is allocated once per
+// run and its fields are set in place before each call, so a short
+// statsIntervalMs doesn't allocate a fresh object and register array
+// on every call. Callbacks that keep a report must copy it.
+type statsReport struct {
+	obj js.Value
+	x   js.Value // x0 to x31, only with statsRegisters on an inspectable machine
+}
+
+func newStatsReport(registers bool) *statsReport {
+	r := &statsReport{obj: js.Global().Get("Object").New()}
+	if registers {
+		r.x = js.Global().Get("Array").New(len(abiNames))
+	}
+	return r
+}
+
+// fill sets the report's fields from s and, if the report carries them,
+// from regs.
+func (r *statsReport) fill(s *runStats, regs *cpuRegisters) {
+	instret, uptime, ips := s.counters()
+	r.obj.Set("instructions", float64(instret))
+	r.obj.Set("uptimeMs", float64(uptime.Milliseconds()))
+	r.obj.Set("ips", ips)
+	if r.x.IsUndefined() || regs == nil {
+		return
+	}
+	r.obj.Set("pc", hex64(regs.PC))
+	for i, v := range regs.X {
+		r.x.SetIndex(i, hex64(v))
+	}
+	r.obj.Set("x", r.x)
+}
+
+// statsRegisters reads the register file for a stats report, or returns
+// nil if the machine can't be inspected or is parked mid-instruction.
+func (e *Emulator) statsRegisters() *cpuRegisters {
+	e.machineMu.Lock()
+	defer e.machineMu.Unlock()
+
+	m, ok := e.machine.(inspectable)
+	if !ok || e.parked.Load() {
+		return nil
+	}
+	regs := m.Registers()
+	return &regs
+}
+
+// reportStats calls onStats every statsInterval until ctx is canceled.
+// launch only starts it when both options are set. A tick that arrives
+// less than half an interval after the last report, as the ticker's
+// buffered tick does after a slow callback, is dropped, so reports never
+// bunch up.
+func (e *Emulator) reportStats(ctx context.Context) {
+	interval := e.options.statsInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	report := newStatsReport(e.options.statsRegisters)
+	var last time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			if now.Sub(last) < interval/2 {
+				continue
+			}
+			last = now
+
+			var regs *cpuRegisters
+			if e.options.statsRegisters {
+				regs = e.statsRegisters()
+			}
+			report.fill(&e.stats, regs)
+			e.options.onStats.Invoke(report.obj)
+		}
+	}
+}
+
+// getStats returns instructions retired, uptime and the rolling IPS for the
+// current run. Before start everything is zero.
+func getStats(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	return okResult(e.stats.snapshot())
+}
+
+// getUptime returns how long the current run has spent running, in
+// milliseconds. Paused time doesn't count, the figure freezes once the run
+// ends, and reset starts it again from zero.
+func getUptime(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	e.stats.mu.Lock()
+	uptime := e.stats.uptimeLocked()
+	e.stats.mu.Unlock()
+	return okResult(map[string]interface{}{"uptimeMs": float64(uptime.Milliseconds())})
+}
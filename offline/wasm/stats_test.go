@@ -0,0 +1,278 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock only moves when the test moves it.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (c *manualClock) Advance(int) {}
+
+func (c *manualClock) tick(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestRunStatsRollingIPS(t *testing.T) {
+	c := &manualClock{now: virtualEpoch}
+	s := &runStats{clock: c}
+	s.reset()
+
+	// 1000 instructions every 10ms is 100,000 IPS
+	for i := 0; i < 300; i++ {
+		c.tick(10 * time.Millisecond)
+		s.record(1000)
+	}
+	instret, uptime, ips := s.counters()
+	if instret != 300000 || uptime != 3*time.Second {
+		t.Errorf("counters = %d instructions in %v, want 300000 in 3s", instret, uptime)
+	}
+	if math.Abs(ips-100000) > 1 {
+		t.Errorf("ips = %v, want 100000", ips)
+	}
+
+	// The rolling figure forgets the faster second once a slower one passes
+	for i := 0; i < 100; i++ {
+		c.tick(10 * time.Millisecond)
+		s.record(100)
+	}
+	if _, _, ips := s.counters(); math.Abs(ips-10000) > 1 {
+		t.Errorf("ips after slowing down = %v, want 10000", ips)
+	}
+	if n := len(s.samples); n > 102 {
+		t.Errorf("kept %d samples for a one-second window of 100", n)
+	}
+}
+
+func TestRunStatsUptimeSkipsPauses(t *testing.T) {
+	c := &manualClock{now: virtualEpoch}
+	s := &runStats{clock: c}
+	s.reset()
+
+	c.tick(2 * time.Second)
+	s.halt()
+	c.tick(time.Hour)
+	s.resume()
+	c.tick(500 * time.Millisecond)
+	if _, uptime, _ := s.counters(); uptime != 2500*time.Millisecond {
+		t.Errorf("uptime = %v, want 2.5s with the paused hour left out", uptime)
+	}
+	s.halt()
+	c.tick(time.Minute)
+	if _, uptime, _ := s.counters(); uptime != 2500*time.Millisecond {
+		t.Errorf("uptime after the run ended = %v, want it frozen at 2.5s", uptime)
+	}
+}
+
+// fixedRateMachine retires the same number of instructions every step.
+type fixedRateMachine struct {
+	testMachine
+	perStep int
+}
+
+func (m *fixedRateMachine) Step(n int) int {
+	m.testMachine.Step(n)
+	return m.perStep
+}
+
+func TestStatsCountMockStepLoop(t *testing.T) {
+	var m *fixedRateMachine
+	useMachine(t, func(machineConfig) machine {
+		m = &fixedRateMachine{perStep: 250}
+		return m
+	})
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	time.Sleep(3 * stepInterval)
+	e.call(stopEmulator)
+
+	stats := statsData(t, e)
+	if want := float64(m.steps * m.perStep); stats["instructions"] != want {
+		t.Errorf("instructions = %v after %d steps of %d, want %v", stats["instructions"], m.steps, m.perStep, want)
+	}
+	if stats["uptimeMs"].(float64) < float64(2*stepInterval.Milliseconds()) {
+		t.Errorf("uptimeMs = %v after running for 3 step intervals", stats["uptimeMs"])
+	}
+}
+
+// statsData returns the data of tinyemuGetStats for e.
+func statsData(t *testing.T, e *Emulator) map[string]interface{} {
+	t.Helper()
+	r := e.call(getStats).(map[string]interface{})
+	if failed(r) {
+		t.Fatalf("tinyemuGetStats: %v", r["error"])
+	}
+	return r["data"].(map[string]interface{})
+}
+
+func TestOnStatsIsOffByDefault(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	for _, tt := range []struct {
+		intervalMs interface{}
+		wantCalls  bool
+	}{
+		{nil, false},
+		{0, false},
+		{20, true},
+	} {
+		reports := newOutputRecorder(t)
+		opts := map[string]interface{}{"onStats": reports.fn}
+		if tt.intervalMs != nil {
+			opts["statsIntervalMs"] = tt.intervalMs
+		}
+		e, _ := newTestEmulator(t, opts)
+		e.call(startEmulator)
+		time.Sleep(200 * time.Millisecond)
+		e.call(stopEmulator)
+
+		reports.mu.Lock()
+		n := len(reports.chunks)
+		var last map[string]bool
+		if n > 0 {
+			r := reports.chunks[n-1]
+			last = map[string]bool{}
+			for _, key := range []string{"instructions", "uptimeMs", "ips"} {
+				last[key] = !r.Get(key).IsUndefined()
+			}
+		}
+		reports.mu.Unlock()
+
+		switch {
+		case !tt.wantCalls && n > 0:
+			t.Errorf("statsIntervalMs %v: onStats called %d times, want none", tt.intervalMs, n)
+		case tt.wantCalls && n < 3:
+			t.Errorf("statsIntervalMs %v: onStats called %d times in 200ms", tt.intervalMs, n)
+		case tt.wantCalls && !(last["instructions"] && last["uptimeMs"] && last["ips"]):
+			t.Errorf("statsIntervalMs %v: report is missing fields: %v", tt.intervalMs, last)
+		}
+	}
+}
+
+func TestStatsIntervalIsChecked(t *testing.T) {
+	for _, bad := range []interface{}{-1, math.NaN(), math.Inf(1), maxStatsInterval.Milliseconds() + 1, "20"} {
+		if msg := initError(t, map[string]interface{}{"statsIntervalMs": bad}); !strings.Contains(msg, "statsIntervalMs") {
+			t.Errorf("statsIntervalMs %v: error %q doesn't name the option", bad, msg)
+		}
+	}
+}
+
+// uptimeMs reads tinyemuGetUptime.
+func uptimeMs(t *testing.T, e *Emulator) float64 {
+	t.Helper()
+	r := e.call(getUptime).(map[string]interface{})
+	if failed(r) {
+		t.Fatal(r["error"])
+	}
+	return r["data"].(map[string]interface{})["uptimeMs"].(float64)
+}
+
+func TestGetUptimeLeavesOutPauses(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	e, _ := newTestEmulator(t, nil)
+	clk := &manualClock{now: time.Unix(1e9, 0)}
+	e.stats.clock = clk
+	if got := uptimeMs(t, e); got != 0 {
+		t.Errorf("uptime before the first start = %vms", got)
+	}
+
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	clk.tick(time.Second)
+	for cycle := 1; cycle <= 3; cycle++ {
+		e.call(pauseEmulator)
+		clk.tick(time.Hour)
+		if got, want := uptimeMs(t, e), float64(cycle*1000); got != want {
+			t.Errorf("paused after %d seconds of running: uptime = %vms, want %v", cycle, got, want)
+		}
+		e.call(resumeEmulator)
+		clk.tick(time.Second)
+	}
+	if got := uptimeMs(t, e); got != 4000 {
+		t.Errorf("after three pause cycles uptime = %vms, want 4000", got)
+	}
+
+	// A reset starts over from zero
+	e.call(resetEmulator)
+	waitState(t, e, stateRunning)
+	clk.tick(250 * time.Millisecond)
+	if got := uptimeMs(t, e); got != 250 {
+		t.Errorf("250ms after a reset uptime = %vms", got)
+	}
+}
+
+func TestOnStatsReusesItsReport(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return newCPUMachine() })
+	reports := newOutputRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onStats": reports.fn, "statsIntervalMs": 20, "statsRegisters": true})
+	e.call(startEmulator)
+	waitFrames(t, reports, 2)
+	e.call(stopEmulator)
+
+	reports.mu.Lock()
+	defer reports.mu.Unlock()
+	first, last := reports.chunks[0], reports.chunks[len(reports.chunks)-1]
+	if !first.Equal(last) || !first.Get("x").Equal(last.Get("x")) {
+		t.Error("onStats got a new report object each call")
+	}
+	if last.Get("x").Length() != 32 || last.Get("pc").String() == "" {
+		t.Errorf("report with statsRegisters has x %v and pc %v", last.Get("x"), last.Get("pc"))
+	}
+}
+
+// benchmarkStatsReport hands onStats a report per op, either refilling one
+// statsReport or building a fresh object as each call once did.
+func benchmarkStatsReport(b *testing.B, reuse, registers bool) {
+	onStats, _ := countingCallback(b)
+	s := &runStats{clock: &manualClock{now: virtualEpoch}}
+	s.reset()
+	s.record(1000)
+	regs := newCPUMachine().Registers()
+
+	report := newStatsReport(registers)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if reuse {
+			report.fill(s, &regs)
+			onStats.Invoke(report.obj)
+			continue
+		}
+		fields := s.snapshot()
+		if registers {
+			x := make([]interface{}, len(regs.X))
+			for i, v := range regs.X {
+				x[i] = hex64(v)
+			}
+			fields["pc"], fields["x"] = hex64(regs.PC), x
+		}
+		onStats.Invoke(fields)
+	}
+}
+
+func BenchmarkStatsReportFresh(b *testing.B) { benchmarkStatsReport(b, false, false) }
+
+func BenchmarkStatsReportReused(b *testing.B) { benchmarkStatsReport(b, true, false) }
+
+func BenchmarkStatsReportFreshWithRegisters(b *testing.B) { benchmarkStatsReport(b, false, true) }
+
+func BenchmarkStatsReportReusedWithRegisters(b *testing.B) { benchmarkStatsReport(b, true, true) }
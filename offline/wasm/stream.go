@@ -0,0 +1,404 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"syscall/js"
+)
+
+const (
+	// streamHighWaterMark is how many chunks a stream's JS queue holds
+	// before it reports backpressure.
+	streamHighWaterMark = 16
+	// streamMaxBuffered caps the output held on the Go side for a stream
+	// whose reader has fallen behind.
+	streamMaxBuffered = 1 << 20
+)
+
+var errStreamFull = newError(codeBufferFull, "output stream buffer full, reader fell behind")
+
+// outputStream feeds console output to a WHATWG ReadableStream. Chunks go
+// straight to the controller while it has room (desiredSize > 0) and wait
+// in queue otherwise, up to max bytes, past which policy decides what is
+// lost.
+type outputStream struct {
+	e      *Emulator
+	sinkID int
+	funcs  []int
+
+	mu         sync.Mutex
+	controller js.Value
+	queue      []streamChunk
+	queued     int // bytes
+	max        int
+	policy     OverflowPolicy
+	dropped    int // chunks lost to the policy
+	closed     bool
+}
+
+// streamChunk is a chunk of output waiting for the stream to have room.
+type streamChunk struct {
+	value js.Value
+	size  int // bytes
+}
+
+// jsStream is a JS stream backed by an instance.
+type jsStream interface {
+	// shutdown ends the stream because its instance is going away.
+	shutdown()
+}
+
+// streamSet tracks an instance's open streams so dispose can end them.
+type streamSet struct {
+	mu   sync.Mutex
+	open map[jsStream]struct{}
+}
+
+func (ss *streamSet) add(s jsStream) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.open == nil {
+		ss.open = make(map[jsStream]struct{})
+	}
+	ss.open[s] = struct{}{}
+}
+
+func (ss *streamSet) remove(s jsStream) {
+	ss.mu.Lock()
+	delete(ss.open, s)
+	ss.mu.Unlock()
+}
+
+// shutdownAll ends every open stream.
+func (ss *streamSet) shutdownAll() {
+	ss.mu.Lock()
+	open := ss.open
+	ss.open = nil
+	ss.mu.Unlock()
+
+	for s := range open {
+		s.shutdown()
+	}
+}
+
+// push is the writer sink: it buffers chunk of size bytes under the
+// overflow policy and hands whatever the stream has room for to the
+// controller.
+func (s *outputStream) push(chunk js.Value, size int) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	for s.queued+size > s.max {
+		if s.policy == OverflowDropOldest && len(s.queue) > 0 {
+			s.queued -= s.queue[0].size
+			s.queue = s.queue[1:]
+			s.dropped++
+			s.warnDropped()
+			continue
+		}
+		if s.policy == OverflowError {
+			s.mu.Unlock()
+			s.fail(errStreamFull)
+			return
+		}
+		// Drop newest, or a single chunk bigger than the whole buffer
+		s.dropped++
+		s.warnDropped()
+		s.mu.Unlock()
+		s.pump()
+		return
+	}
+	s.queue = append(s.queue, streamChunk{chunk, size})
+	s.queued += size
+	s.mu.Unlock()
+	s.pump()
+}
+
+// warnDropped logs the first chunk a stream loses. It is called with mu
+// held.
+func (s *outputStream) warnDropped() {
+	if s.dropped == 1 {
+		s.e.log.Warnf("output stream reader fell behind, dropping output")
+	}
+}
+
+// pump enqueues buffered chunks while the controller wants more. Enqueue
+// can call pull, and so pump, reentrantly; the lock is not held across it
+// and each chunk is taken off the queue before it is enqueued, so order is
+// kept.
+func (s *outputStream) pump() {
+	for {
+		s.mu.Lock()
+		if s.closed || len(s.queue) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		desired := s.controller.Get("desiredSize")
+		if desired.Type() != js.TypeNumber || desired.Float() <= 0 {
+			s.mu.Unlock()
+			return
+		}
+		chunk := s.queue[0]
+		s.queue = s.queue[1:]
+		s.queued -= chunk.size
+		controller := s.controller
+		s.mu.Unlock()
+
+		controller.Call("enqueue", chunk.value)
+	}
+}
+
+// finish detaches the stream from the writer and frees its funcs. With
+// closeStream set the stream ends normally once the reader drains it.
+func (s *outputStream) finish(closeStream bool) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	queue := s.queue
+	s.queue = nil
+	controller := s.controller
+	s.mu.Unlock()
+
+	s.e.writer.RemoveSink(s.sinkID)
+	s.e.streams.remove(s)
+	if closeStream {
+		// Whatever is still buffered is delivered past the high water
+		// mark rather than lost
+		for _, chunk := range queue {
+			controller.Call("enqueue", chunk.value)
+		}
+		controller.Call("close")
+	}
+	for _, id := range s.funcs {
+		s.e.funcs.release(id)
+	}
+}
+
+// shutdown closes the stream as if the guest's output had ended.
+func (s *outputStream) shutdown() {
+	s.finish(true)
+}
+
+// fail errors the stream with err, so a pending read rejects.
+func (s *outputStream) fail(err error) {
+	s.mu.Lock()
+	controller := s.controller
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return
+	}
+	s.finish(false)
+	controller.Call("error", errorValue(err))
+}
+
+// streamOptions reads {highWaterMark, maxBufferedBytes, overflow} from an
+// optional options object.
+func streamOptions(opts js.Value) (highWaterMark, maxBuffered int, policy OverflowPolicy, err error) {
+	highWaterMark, maxBuffered, policy = streamHighWaterMark, streamMaxBuffered, OverflowDropOldest
+	if opts.Type() != js.TypeObject {
+		return highWaterMark, maxBuffered, policy, nil
+	}
+
+	if highWaterMark, err = intField(opts, "highWaterMark", highWaterMark, 1, 1<<16); err != nil {
+		return
+	}
+	if maxBuffered, err = intField(opts, "maxBufferedBytes", maxBuffered, 1, 1<<30); err != nil {
+		return
+	}
+	switch v := opts.Get("overflow"); {
+	case v.IsUndefined() || v.IsNull():
+	case v.Type() == js.TypeString && v.String() == "drop_oldest":
+	case v.Type() == js.TypeString && v.String() == "drop_newest":
+		policy = OverflowDropNewest
+	case v.Type() == js.TypeString && v.String() == "error":
+		policy = OverflowError
+	default:
+		err = fmt.Errorf("overflow must be \"drop_oldest\", \"drop_newest\" or \"error\"")
+	}
+	return
+}
+
+// intField reads an integer field of opts in [min, max], or def if unset.
+func intField(opts js.Value, name string, def, min, max int) (int, error) {
+	v := opts.Get(name)
+	if v.IsUndefined() || v.IsNull() {
+		return def, nil
+	}
+	if v.Type() != js.TypeNumber || v.Float() != float64(v.Int()) {
+		return 0, fmt.Errorf("%s must be an integer, got %s", name, v.Type())
+	}
+	if n := v.Int(); n < min || n > max {
+		return 0, fmt.Errorf("%s must be between %d and %d, got %d", name, min, max, n)
+	}
+	return v.Int(), nil
+}
+
+// getOutputStream returns {stream}, a ReadableStream of console output
+// delivered alongside the tinyemuInit callback, in the same chunks and
+// type. An optional {highWaterMark, maxBufferedBytes, overflow} sizes the
+// stream's queue in chunks, caps what is held in Go while the reader is
+// behind, and picks what is dropped past that cap: the oldest output (the
+// default), the newest, or nothing, erroring the stream instead.
+// Canceling the stream detaches it; dispose closes it.
+func getOutputStream(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	opts, err := optionalObjectArg(args, 0, "options")
+	if err != nil {
+		return errorResult(err)
+	}
+	highWaterMark, maxBuffered, policy, err := streamOptions(opts)
+	if err != nil {
+		return errorResult(err)
+	}
+	ctor := js.Global().Get("ReadableStream")
+	if ctor.Type() != js.TypeFunction {
+		return errResult(codeUnavailable, "ReadableStream is not available")
+	}
+
+	s := &outputStream{e: e, max: maxBuffered, policy: policy}
+	start, startID := e.funcs.funcOf(func(this js.Value, args []js.Value) interface{} {
+		s.mu.Lock()
+		s.controller = args[0]
+		s.mu.Unlock()
+		return nil
+	})
+	pull, pullID := e.funcs.funcOf(func(this js.Value, args []js.Value) interface{} {
+		s.pump()
+		return nil
+	})
+	cancel, cancelID := e.funcs.funcOf(func(this js.Value, args []js.Value) interface{} {
+		s.finish(false)
+		return nil
+	})
+	s.funcs = []int{startID, pullID, cancelID}
+
+	stream := ctor.New(
+		map[string]interface{}{"start": start, "pull": pull, "cancel": cancel},
+		map[string]interface{}{"highWaterMark": highWaterMark},
+	)
+	s.sinkID = e.writer.AddSinkFunc(s.push)
+	e.streams.add(s)
+	return okResult(map[string]interface{}{"stream": stream})
+}
+
+// inputStream feeds a WHATWG WritableStream's chunks to the console.
+type inputStream struct {
+	e     *Emulator
+	funcs []int
+
+	mu         sync.Mutex
+	controller js.Value
+	done       bool
+}
+
+// write feeds one chunk, a string or bytes, as console input. A full
+// queue refuses it rather than waiting, so it settles right away.
+func (s *inputStream) write(chunk js.Value) js.Value {
+	var data []byte
+	if chunk.Type() == js.TypeString {
+		b, err := s.e.options.encoding.encode(chunk.String())
+		if err != nil {
+			s.finish()
+			return rejectedPromise(err)
+		}
+		data = b
+	} else {
+		b, err := bytesFromJS(chunk)
+		if err != nil {
+			s.finish()
+			return rejectedPromise(fmt.Errorf("input chunk must be a string or bytes: %v", err))
+		}
+		data = b
+	}
+
+	return newPromise(func(resolve, reject js.Value) {
+		result := inputResult(s.e.feedInput(data))
+		if failed(result) {
+			// A rejected write errors the stream for good
+			s.finish()
+		}
+		settle(result, resolve, reject)
+	})
+}
+
+// finish detaches the stream and frees its funcs, reporting whether it
+// was still open.
+func (s *inputStream) finish() bool {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return false
+	}
+	s.done = true
+	s.mu.Unlock()
+
+	s.e.streams.remove(s)
+	for _, id := range s.funcs {
+		s.e.funcs.release(id)
+	}
+	return true
+}
+
+// shutdown errors the stream so further writes reject.
+func (s *inputStream) shutdown() {
+	s.mu.Lock()
+	controller := s.controller
+	s.mu.Unlock()
+	if s.finish() {
+		controller.Call("error", errorValue(errDisposed))
+	}
+}
+
+// getInputStream returns {stream}, a WritableStream whose chunks, strings
+// or bytes, are fed to the guest like tinyemuSendInput. A write rejects
+// with the same codes when input is refused, which errors the stream.
+// Closing the stream closes console input, so the guest sees EOF;
+// aborting it only detaches it.
+func getInputStream(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	ctor := js.Global().Get("WritableStream")
+	if ctor.Type() != js.TypeFunction {
+		return errResult(codeUnavailable, "WritableStream is not available")
+	}
+
+	s := &inputStream{e: e}
+	start, startID := e.funcs.funcOf(func(this js.Value, args []js.Value) interface{} {
+		s.mu.Lock()
+		s.controller = args[0]
+		s.mu.Unlock()
+		return nil
+	})
+	write, writeID := e.funcs.funcOf(func(this js.Value, args []js.Value) interface{} {
+		return s.write(arg(args, 0))
+	})
+	closeFn, closeID := e.funcs.funcOf(func(this js.Value, args []js.Value) interface{} {
+		if s.finish() {
+			e.reader.Close()
+		}
+		return nil
+	})
+	abort, abortID := e.funcs.funcOf(func(this js.Value, args []js.Value) interface{} {
+		s.finish()
+		return nil
+	})
+	s.funcs = []int{startID, writeID, closeID, abortID}
+
+	stream := ctor.New(map[string]interface{}{"start": start, "write": write, "close": closeFn, "abort": abort})
+	e.streams.add(s)
+	return okResult(map[string]interface{}{"stream": stream})
+}
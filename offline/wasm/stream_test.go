@@ -0,0 +1,245 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"io"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+// mockController stands in for a ReadableStreamDefaultController. Like a
+// real one, each enqueue lowers desiredSize by one chunk.
+type mockController struct {
+	obj      js.Value
+	enqueued []string
+	closed   bool
+	err      js.Value
+}
+
+func newMockController(t *testing.T, desiredSize int) *mockController {
+	c := &mockController{obj: js.Global().Get("Object").New(), err: js.Undefined()}
+	c.obj.Set("desiredSize", desiredSize)
+	for name, fn := range map[string]func(args []js.Value){
+		"enqueue": func(args []js.Value) {
+			c.enqueued = append(c.enqueued, args[0].String())
+			c.obj.Set("desiredSize", c.obj.Get("desiredSize").Int()-1)
+		},
+		"close": func([]js.Value) { c.closed = true },
+		"error": func(args []js.Value) { c.err = args[0] },
+	} {
+		fn := fn
+		f := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			fn(args)
+			return nil
+		})
+		t.Cleanup(f.Release)
+		c.obj.Set(name, f)
+	}
+	return c
+}
+
+// mockStream returns an output stream of an instance feeding c.
+func mockStream(t *testing.T, c *mockController, max int, policy OverflowPolicy) *outputStream {
+	e, _ := newTestEmulator(t, nil)
+	s := &outputStream{e: e, controller: c.obj, max: max, policy: policy}
+	s.sinkID = e.writer.AddSinkFunc(s.push)
+	e.streams.add(s)
+	return s
+}
+
+// pushAll pushes each chunk to s as a string.
+func pushAll(s *outputStream, chunks ...string) {
+	for _, chunk := range chunks {
+		s.push(js.ValueOf(chunk), len(chunk))
+	}
+}
+
+func TestOutputStreamEnqueuesWhileThereIsRoom(t *testing.T) {
+	c := newMockController(t, 2)
+	s := mockStream(t, c, 1<<10, OverflowDropOldest)
+	pushAll(s, "a", "b", "c", "d")
+	if got := strings.Join(c.enqueued, ","); got != "a,b" {
+		t.Fatalf("enqueued %q with room for 2 chunks, want a,b", got)
+	}
+	if s.queued != 2 || len(s.queue) != 2 {
+		t.Errorf("Go side holds %d chunks of %d bytes, want 2 of 2", len(s.queue), s.queued)
+	}
+
+	// The reader catching up pulls, which hands over the rest in order
+	c.obj.Set("desiredSize", 8)
+	s.pump()
+	pushAll(s, "e")
+	if got := strings.Join(c.enqueued, ","); got != "a,b,c,d,e" {
+		t.Errorf("enqueued %q after the reader caught up, want a,b,c,d,e", got)
+	}
+	if s.queued != 0 {
+		t.Errorf("%d bytes still held in Go", s.queued)
+	}
+}
+
+func TestOutputStreamBackpressureBound(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		want    string // what the reader gets once it has room
+		dropped int
+	}{
+		{OverflowDropOldest, "cccc,dddd", 2},
+		{OverflowDropNewest, "aaaa,bbbb", 2},
+	}
+	for _, tt := range tests {
+		c := newMockController(t, 0)
+		s := mockStream(t, c, 8, tt.policy)
+		pushAll(s, "aaaa", "bbbb", "cccc", "dddd")
+		if len(c.enqueued) != 0 {
+			t.Errorf("policy %d: enqueued %q with desiredSize 0", tt.policy, c.enqueued)
+		}
+		if s.queued > 8 || s.dropped != tt.dropped {
+			t.Errorf("policy %d: holding %d bytes with %d dropped, want at most 8 with %d", tt.policy, s.queued, s.dropped, tt.dropped)
+		}
+		c.obj.Set("desiredSize", 8)
+		s.pump()
+		if got := strings.Join(c.enqueued, ","); got != tt.want {
+			t.Errorf("policy %d: reader got %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestOutputStreamOverflowErrorFailsTheStream(t *testing.T) {
+	c := newMockController(t, 0)
+	s := mockStream(t, c, 8, OverflowError)
+	pushAll(s, "aaaa", "bbbb")
+	if c.err.Truthy() {
+		t.Fatalf("stream errored at the bound: %v", c.err)
+	}
+	pushAll(s, "c")
+	if !c.err.Truthy() || c.err.Get("code").String() != string(codeBufferFull) {
+		t.Fatalf("stream error = %v, want code buffer_full", c.err)
+	}
+
+	// Errored, the stream is detached and takes no more output
+	pushAll(s, "d")
+	s.e.writer.Write([]byte("more"))
+	s.e.writer.Flush()
+	if len(c.enqueued) != 0 || c.closed {
+		t.Errorf("errored stream got %q, closed %v", c.enqueued, c.closed)
+	}
+}
+
+func TestOutputStreamCloseDeliversTheBacklog(t *testing.T) {
+	c := newMockController(t, 0)
+	s := mockStream(t, c, 1<<10, OverflowDropOldest)
+	pushAll(s, "x", "y")
+	s.e.dispose()
+	if got := strings.Join(c.enqueued, ","); got != "x,y" || !c.closed {
+		t.Errorf("on dispose enqueued %q, closed %v; want x,y then closed", got, c.closed)
+	}
+}
+
+func TestOutputStreamReadsConsoleOutput(t *testing.T) {
+	if js.Global().Get("ReadableStream").Type() != js.TypeFunction {
+		t.Skip("no ReadableStream in this runtime")
+	}
+	e, rec := newTestEmulator(t, nil)
+	result := e.call(getOutputStream).(map[string]interface{})
+	if failed(result) {
+		t.Fatal(result["error"])
+	}
+	reader := result["data"].(map[string]interface{})["stream"].(js.Value).Call("getReader")
+
+	e.writer.Write([]byte("hello\n"))
+	e.writer.Flush()
+	v, fulfilled := awaitSettled(t, reader.Call("read"))
+	if !fulfilled || v.Get("done").Bool() || v.Get("value").String() != "hello\n" {
+		t.Errorf("read() = %v, fulfilled %v; want {value: \"hello\\n\", done: false}", v, fulfilled)
+	}
+	if got := rec.text(); got != "hello\n" {
+		t.Errorf("callback got %q alongside the stream, want %q", got, "hello\n")
+	}
+	reader.Call("cancel")
+}
+
+// inputStreamWriter returns a writer on e's tinyemuGetInputStream.
+func inputStreamWriter(t *testing.T, e *Emulator) js.Value {
+	t.Helper()
+	if js.Global().Get("WritableStream").Type() != js.TypeFunction {
+		t.Skip("no WritableStream in this runtime")
+	}
+	result := e.call(getInputStream).(map[string]interface{})
+	if failed(result) {
+		t.Fatal(result["error"])
+	}
+	return result["data"].(map[string]interface{})["stream"].(js.Value).Call("getWriter")
+}
+
+func TestInputStreamChunksReachTheReaderInOrder(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	w := inputStreamWriter(t, e)
+	var writes []js.Value
+	for _, chunk := range []interface{}{"ab", bytesToJS([]byte("cd")), "é", bytesToJS([]byte{0xff})} {
+		writes = append(writes, w.Call("write", chunk))
+	}
+	for i, promise := range writes {
+		if v, fulfilled := awaitSettled(t, promise); !fulfilled {
+			t.Fatalf("write %d rejected: %v", i, v)
+		}
+	}
+	if got := string(e.reader.Pending()); got != "abcdé\xff" {
+		t.Errorf("reader holds %q, want %q", got, "abcdé\xff")
+	}
+}
+
+func TestInputStreamRejectsRefusedInput(t *testing.T) {
+	e, _ := newTestEmulator(t, map[string]interface{}{"maxInputBytes": 4})
+	w := inputStreamWriter(t, e)
+	if v, fulfilled := awaitSettled(t, w.Call("write", "abc")); !fulfilled {
+		t.Fatalf("write under the cap rejected: %v", v)
+	}
+	wantRejected(t, w.Call("write", "defg"), codeBufferFull)
+
+	// The rejection errors the stream, so later writes fail too
+	if _, fulfilled := awaitSettled(t, w.Call("write", "x")); fulfilled {
+		t.Error("write after a rejected one was accepted")
+	}
+	if got := string(e.reader.Pending()); got != "abc" {
+		t.Errorf("reader holds %q, want %q", got, "abc")
+	}
+}
+
+func TestInputStreamCloseEndsInput(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	w := inputStreamWriter(t, e)
+	w.Call("write", "last")
+	if v, fulfilled := awaitSettled(t, w.Call("close")); !fulfilled {
+		t.Fatalf("close rejected: %v", v)
+	}
+
+	// Input written before the close is still read, then the guest sees EOF
+	p := make([]byte, 16)
+	if n, err := e.reader.Read(p); string(p[:n]) != "last" || err != nil {
+		t.Errorf("Read = %q, %v; want %q, nil", p[:n], err, "last")
+	}
+	if n, err := e.reader.Read(p); n != 0 || err != io.EOF {
+		t.Errorf("Read after close = %d, %v; want 0, io.EOF", n, err)
+	}
+}
+
+func TestInputStreamRefusesClosedInput(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	w := inputStreamWriter(t, e)
+	e.call(closeInput)
+	wantRejected(t, w.Call("write", "late"), codeInputClosed)
+	if got := e.reader.Pending(); len(got) != 0 {
+		t.Errorf("closed reader holds %q", got)
+	}
+}
+
+func TestInputStreamAbortLeavesInputOpen(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	w := inputStreamWriter(t, e)
+	awaitSettled(t, w.Call("abort"))
+	if n, err := e.reader.Read(make([]byte, 4)); n != 0 || err != nil {
+		t.Errorf("Read after abort = %d, %v; want 0, nil", n, err)
+	}
+}
@@ -0,0 +1,130 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// defaultTypingDelay is the pause between characters typed by
+	// tinyemuTypeString unless perCharDelayMs says otherwise.
+	defaultTypingDelay = 80
+	// maxTypingDelay bounds perCharDelayMs and jitterMs.
+	maxTypingDelay = 60000
+)
+
+// typingOptions paces tinyemuTypeString.
+type typingOptions struct {
+	delay  time.Duration
+	jitter time.Duration
+	seed   int64
+}
+
+// pause returns the wait after a character, the delay moved at random by
+// up to jitter either way.
+func (o typingOptions) pause(r *rand.Rand) time.Duration {
+	d := o.delay
+	if o.jitter > 0 {
+		d += time.Duration(r.Int63n(int64(2*o.jitter)+1)) - o.jitter
+	}
+	return max(d, 0)
+}
+
+// typeString feeds text to console0 one character at a time on the
+// instance's clock until it runs out or stop is closed. Characters still
+// reach the guest no faster than inputRateLimit allows.
+func (e *Emulator) typeString(text string, opts typingOptions, stop <-chan struct{}) map[string]interface{} {
+	rng := rand.New(rand.NewSource(opts.seed))
+	sent := 0
+	for _, c := range text {
+		select {
+		case <-stop:
+			return statusResult(statusCanceled, map[string]interface{}{"sent": sent})
+		default:
+		}
+		data, err := e.options.encoding.encode(string(c))
+		if err == nil {
+			err = e.feedInput(data)
+		}
+		if err != nil && !errors.Is(err, ErrInputDropped) {
+			r := errorResult(err)
+			r["data"] = map[string]interface{}{"sent": sent}
+			return r
+		}
+		sent++
+
+		if !waitUntil(e.clock, e.clock.Now().Add(opts.pause(rng)), stop) {
+			return statusResult(statusCanceled, map[string]interface{}{"sent": sent})
+		}
+	}
+	return statusResult(statusCompleted, map[string]interface{}{"sent": sent})
+}
+
+// typeStringInput takes (text, {perCharDelayMs, jitterMs}) and returns a
+// Promise that resolves with {status, sent} once every character has been
+// typed or tinyemuCancelTyping stops it. Newlines and control characters
+// are sent as they are, like tinyemuSendInput. Starting to type cancels
+// any typing already in progress.
+func typeStringInput(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	text, err := stringArg(args, 0, "text")
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	opts, err := typingOptionsArg(args, 1)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	// Draw the seed before going async, as e.rand isn't safe for concurrent use
+	opts.seed = e.rand.Int63()
+
+	stop := e.typing.begin()
+	return newPromise(func(resolve, reject js.Value) {
+		// Waiting needs the event loop, so it can't block this callback
+		go func() {
+			result := e.typeString(text, opts, stop)
+			e.typing.finish(stop)
+			settle(result, resolve, reject)
+		}()
+	})
+}
+
+// typingOptionsArg reads the optional pacing options of tinyemuTypeString.
+func typingOptionsArg(args []js.Value, i int) (typingOptions, error) {
+	opts := typingOptions{delay: defaultTypingDelay * time.Millisecond}
+	v, err := optionalObjectArg(args, i, "options")
+	if err != nil || v.Type() != js.TypeObject {
+		return opts, err
+	}
+	delay, err := intField(v, "perCharDelayMs", defaultTypingDelay, 0, maxTypingDelay)
+	if err != nil {
+		return opts, err
+	}
+	jitter, err := intField(v, "jitterMs", 0, 0, maxTypingDelay)
+	if err != nil {
+		return opts, err
+	}
+	opts.delay = time.Duration(delay) * time.Millisecond
+	opts.jitter = time.Duration(jitter) * time.Millisecond
+	return opts, nil
+}
+
+// cancelTyping stops tinyemuTypeString; its Promise resolves with status
+// "canceled".
+func cancelTyping(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+	if !e.typing.cancel() {
+		return statusResult(statusNotRunning, nil)
+	}
+	return statusResult(statusCanceled, nil)
+}
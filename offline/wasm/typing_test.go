@@ -0,0 +1,98 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math/rand"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+func TestTypeStringSpacesCharactersByTheDelay(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	clk := newVirtualClock()
+	e.clock = clk
+	// Control characters go through as they are, one keystroke each
+	const text = "a\nb\x03"
+	promise := e.call(typeStringInput, text, map[string]interface{}{"perCharDelayMs": 100}).(js.Value)
+
+	waitPending(t, e, text[:1])
+	for i := 2; i <= len(text); i++ {
+		advanceMs(clk, 99)
+		time.Sleep(10 * virtualYield)
+		if got := string(e.reader.Pending()); got != text[:i-1] {
+			t.Fatalf("1ms before character %d is due the guest has %q", i, got)
+		}
+		advanceMs(clk, 1)
+		waitPending(t, e, text[:i])
+	}
+
+	// The pause after the last character is waited out too
+	advanceMs(clk, 100)
+	v, fulfilled := awaitSettled(t, promise)
+	if !fulfilled || v.Get("status").String() != string(statusCompleted) || v.Get("sent").Int() != len(text) {
+		t.Errorf("typing settled with %v, fulfilled %v", v, fulfilled)
+	}
+}
+
+func TestTypingJitterStaysWithinBounds(t *testing.T) {
+	opts := typingOptions{delay: 100 * time.Millisecond, jitter: 30 * time.Millisecond}
+	r := rand.New(rand.NewSource(1))
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 1000; i++ {
+		d := opts.pause(r)
+		if d < 70*time.Millisecond || d > 130*time.Millisecond {
+			t.Fatalf("pause %v is outside 100ms ± 30ms", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 10 {
+		t.Errorf("only %d distinct pauses in 1000", len(seen))
+	}
+
+	// Jitter past the delay never asks for a negative wait
+	opts = typingOptions{delay: 10 * time.Millisecond, jitter: 50 * time.Millisecond}
+	for i := 0; i < 1000; i++ {
+		if d := opts.pause(r); d < 0 {
+			t.Fatalf("pause %v is negative", d)
+		}
+	}
+}
+
+func TestCancelTyping(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	e.clock = newVirtualClock()
+	first := e.call(typeStringInput, "ab", map[string]interface{}{"perCharDelayMs": 60000}).(js.Value)
+	waitPending(t, e, "a")
+
+	// Typing again replaces what is being typed
+	second := e.call(typeStringInput, "cd", map[string]interface{}{"perCharDelayMs": 60000}).(js.Value)
+	if v, _ := awaitSettled(t, first); v.Get("status").String() != string(statusCanceled) || v.Get("sent").Int() != 1 {
+		t.Errorf("replaced typing settled with %v", v)
+	}
+	waitPending(t, e, "ac")
+
+	if got := statusOf(e.call(cancelTyping)); got != string(statusCanceled) {
+		t.Errorf("tinyemuCancelTyping = %s", got)
+	}
+	if v, _ := awaitSettled(t, second); v.Get("status").String() != string(statusCanceled) || v.Get("sent").Int() != 1 {
+		t.Errorf("canceled typing settled with %v", v)
+	}
+	if got := statusOf(e.call(cancelTyping)); got != string(statusNotRunning) {
+		t.Errorf("canceling with nothing typing = %s, want not_running", got)
+	}
+}
+
+func TestTypeStringOptionsAreChecked(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	for _, opts := range []interface{}{
+		map[string]interface{}{"perCharDelayMs": -1},
+		map[string]interface{}{"perCharDelayMs": maxTypingDelay + 1},
+		map[string]interface{}{"jitterMs": "lots"},
+		"fast",
+	} {
+		wantRejected(t, e.call(typeStringInput, "x", opts).(js.Value), codeInvalidArgument)
+	}
+	wantRejected(t, e.call(typeStringInput, 42).(js.Value), codeInvalidArgument)
+}
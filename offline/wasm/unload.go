@@ -0,0 +1,46 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+)
+
+// prepareUnload gets an instance ready for the page to go away: it pauses
+// a running machine, waits out the step in progress, hands every dirty
+// block of each persistent disk to its writeBlock callback and delivers
+// all buffered console output, then returns {paused, blocks}. It is
+// synchronous so a beforeunload or pagehide handler can call it.
+//
+// Everything has reached JavaScript by the time it returns, but not
+// necessarily storage: an IndexedDB put that writeBlock starts is
+// asynchronous, and the browser may not let it commit once the page is
+// unloading. Calling it from visibilitychange when the page is hidden as
+// well, or syncing periodically with tinyemuSync, narrows the window. The
+// machine stays paused; tinyemuResume continues it if the page stays.
+func prepareUnload(this js.Value, args []js.Value) interface{} {
+	e, _, err := lookup(args, 0)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	paused := e.isRunning() && e.pause()
+
+	// The run loop holds machineMu while stepping, so once it is ours no
+	// guest write is half done.
+	e.machineMu.Lock()
+	blocks := 0
+	for _, d := range e.disks {
+		if pd, ok := d.(*persistentDisk); ok {
+			blocks += pd.Sync()
+		}
+	}
+	e.machineMu.Unlock()
+	e.writer.Flush()
+	e.flushConsoles()
+
+	return statusResult(statusUnloadReady, map[string]interface{}{
+		"paused": paused,
+		"blocks": blocks,
+	})
+}
@@ -0,0 +1,107 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// diskWritingMachine prints a prompt on its first step and then writes its
+// step count to the start of one of vda's first four blocks on each step,
+// keeping the last count each block got.
+type diskWritingMachine struct {
+	testMachine
+	console io.Writer
+	vda     blockBackend
+	last    map[int]byte
+}
+
+func (m *diskWritingMachine) Step(n int) int {
+	m.testMachine.Step(n)
+	if m.steps == 1 {
+		fmt.Fprint(m.console, "# ")
+	}
+	block := m.steps % 4
+	m.vda.WriteAt([]byte{byte(m.steps)}, int64(block*persistBlockSize))
+	m.last[block] = byte(m.steps)
+	return n
+}
+
+func TestPrepareUnloadFlushesAndPauses(t *testing.T) {
+	m := &diskWritingMachine{last: make(map[int]byte)}
+	useMachine(t, func(config machineConfig) machine {
+		m.console, m.vda = config.console, config.disks[0]
+		return m
+	})
+	store := newBlockStore(t)
+	e, rec := newTestEmulator(t, map[string]interface{}{"flushOnNewline": true})
+	e.call(loadDisk, bytesToJS(make([]byte, 16*persistBlockSize)))
+	e.call(enablePersistence, "test-db", store.fn)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	time.Sleep(5 * stepInterval)
+
+	result := e.call(prepareUnload).(map[string]interface{})
+	if statusOf(result) != string(statusUnloadReady) {
+		t.Fatalf("tinyemuPrepareUnload = %v", result)
+	}
+	data := result["data"].(map[string]interface{})
+	if data["paused"] != true || e.getState() != statePaused {
+		t.Errorf("paused %v, state %s; want the running machine paused", data["paused"], e.getState())
+	}
+
+	// Everything the guest wrote has reached writeBlock, and no step since
+	e.machineMu.Lock()
+	steps, last := m.steps, m.last
+	e.machineMu.Unlock()
+	store.mu.Lock()
+	if data["blocks"] != len(last) || store.calls != len(last) {
+		t.Errorf("reported %v blocks and wrote %d, want the %d dirty ones", data["blocks"], store.calls, len(last))
+	}
+	for block, want := range last {
+		if got := store.blocks[block]; len(got) != persistBlockSize || got[0] != want {
+			t.Errorf("block %d stored with %v first, want the guest's last write %d", block, got[:1], want)
+		}
+	}
+	store.mu.Unlock()
+	if got := rec.text(); got != "# " {
+		t.Errorf("console got %q, want the held prompt delivered", got)
+	}
+
+	time.Sleep(3 * stepInterval)
+	e.machineMu.Lock()
+	if m.steps != steps {
+		t.Errorf("machine ran %d more steps after tinyemuPrepareUnload", m.steps-steps)
+	}
+	e.machineMu.Unlock()
+
+	// Nothing is left to do the second time
+	data = e.call(prepareUnload).(map[string]interface{})["data"].(map[string]interface{})
+	if data["paused"] != false || data["blocks"] != 0 {
+		t.Errorf("second tinyemuPrepareUnload = %v, want nothing paused or written", data)
+	}
+	if got := statusOf(e.call(resumeEmulator)); got != string(statusRunning) {
+		t.Errorf("tinyemuResume after unloading was called off = %s", got)
+	}
+}
+
+func TestPrepareUnloadWithoutARun(t *testing.T) {
+	store := newBlockStore(t)
+	e := persistentTestEmulator(t, store, js.Undefined())
+	e.disks[0].WriteAt([]byte("saved"), 3*persistBlockSize)
+
+	data := e.call(prepareUnload).(map[string]interface{})["data"].(map[string]interface{})
+	if data["paused"] != false || data["blocks"] != 1 {
+		t.Errorf("tinyemuPrepareUnload before start = %v, want block 3 written and nothing paused", data)
+	}
+	if string(store.blocks[3][:5]) != "saved" {
+		t.Errorf("block 3 stored as %q", store.blocks[3][:5])
+	}
+	if e.getState() != stateInitialized {
+		t.Errorf("state is %s, want it left initialized", e.getState())
+	}
+}
@@ -0,0 +1,72 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"syscall/js"
+)
+
+// nextLine matches the first line of output a waiter sees.
+var nextLine = regexp.MustCompile(`\A[^\n]*\n`)
+
+// runUntilOutput resumes the machine, lets it run until it writes a
+// newline to console0 and pauses it again, for tutorials that walk
+// through a boot one line at a time. The Promise resolves with {line,
+// timedOut}: the line without its line ending, or after timeoutMs on the
+// instance clock whatever part of a line arrived, and the machine is
+// paused either way. The pause lands before the next step, so the rest of
+// the step that wrote the newline still reaches the console. Only one
+// call can be in progress per instance.
+func runUntilOutput(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 1)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	timeout, err := timeoutArg(args, 0)
+	if err != nil {
+		return rejectedPromise(err)
+	}
+	if result := e.checkRunning(); result != nil {
+		return newPromise(func(resolve, reject js.Value) {
+			settle(result, resolve, reject)
+		})
+	}
+	if !e.untilOutput.CompareAndSwap(false, true) {
+		return newPromise(func(resolve, reject js.Value) {
+			settle(errResult(codeInvalidState, "tinyemuRunUntilOutput already in progress"), resolve, reject)
+		})
+	}
+
+	// Registered before resuming, so the first line can't slip past
+	id, w := e.waiters.add(nextLine, func() { e.pause() })
+	e.resume()
+	return newPromise(func(resolve, reject js.Value) {
+		// Waiting needs the event loop, so it can't block this callback
+		go func() {
+			defer e.untilOutput.Store(false)
+
+			groups, timedOut := e.awaitMatch(id, w, timeout)
+			if timedOut {
+				if e.isRunning() {
+					e.pause()
+				}
+				// Removed, so the window is no longer written
+				settle(okResult(map[string]interface{}{
+					"line":     string(w.window),
+					"timedOut": true,
+				}), resolve, reject)
+				return
+			}
+			if groups == nil {
+				settle(errorResult(errDisposed), resolve, reject)
+				return
+			}
+			settle(okResult(map[string]interface{}{
+				"line":     strings.TrimRight(groups[0], "\r\n"),
+				"timedOut": false,
+			}), resolve, reject)
+		}()
+	})
+}
@@ -0,0 +1,119 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// linesMachine pauses itself on its first step, then writes a line in two
+// pieces over steps 2 and 3, with a second line behind it in the same
+// write, and a line on each step from there on. A quiet one writes nothing
+// after step 3.
+type linesMachine struct {
+	testMachine
+	e       *Emulator
+	console io.Writer
+	quiet   bool
+}
+
+func (m *linesMachine) Step(n int) int {
+	m.testMachine.Step(n)
+	switch {
+	case m.steps == 1:
+		m.e.pause()
+	case m.steps == 2:
+		io.WriteString(m.console, "boot")
+	case m.steps == 3:
+		io.WriteString(m.console, "ing\r\nsecond\n")
+	case !m.quiet:
+		fmt.Fprintf(m.console, "line %d\n", m.steps)
+	}
+	return n
+}
+
+// pausedLines returns an instance paused before its linesMachine writes
+// anything.
+func pausedLines(t *testing.T, quiet bool) (*Emulator, *linesMachine) {
+	t.Helper()
+	m := &linesMachine{quiet: quiet}
+	useMachine(t, func(config machineConfig) machine {
+		m.console = config.console
+		return m
+	})
+	e, _ := newTestEmulator(t, nil)
+	m.e = e
+	e.call(startEmulator)
+	waitState(t, e, statePaused)
+	return e, m
+}
+
+// untilOutput runs tinyemuRunUntilOutput and returns what it resolved with.
+func untilOutput(t *testing.T, e *Emulator, timeoutMs int) (line string, timedOut bool) {
+	t.Helper()
+	v, fulfilled := awaitSettled(t, e.call(runUntilOutput, timeoutMs).(js.Value))
+	if !fulfilled {
+		t.Fatalf("tinyemuRunUntilOutput rejected with %s: %s", v.Get("code"), v.Get("message"))
+	}
+	return v.Get("line").String(), v.Get("timedOut").Bool()
+}
+
+func TestRunUntilOutputReturnsOneLineAndPauses(t *testing.T) {
+	e, m := pausedLines(t, false)
+	if line, timedOut := untilOutput(t, e, 1000); line != "booting" || timedOut {
+		t.Errorf("first call resolved with %q, timedOut %v; want \"booting\" alone", line, timedOut)
+	}
+	if e.getState() != statePaused {
+		t.Fatalf("state is %s after the line, want paused", e.getState())
+	}
+	// Paused before the step after the newline
+	e.machineMu.Lock()
+	steps := m.steps
+	e.machineMu.Unlock()
+	if steps != 3 {
+		t.Errorf("machine ran %d steps, want to stop after the 3rd wrote the newline", steps)
+	}
+
+	time.Sleep(3 * stepInterval)
+	if line, _ := untilOutput(t, e, 1000); line != "line 4" {
+		t.Errorf("second call resolved with %q, want the next line written, \"line 4\"", line)
+	}
+	if e.getState() != statePaused {
+		t.Errorf("state is %s after the second line, want paused", e.getState())
+	}
+}
+
+func TestRunUntilOutputTimesOutPaused(t *testing.T) {
+	e, _ := pausedLines(t, true)
+	untilOutput(t, e, 1000)
+
+	// "second" came with the first line, and nothing follows it
+	if line, timedOut := untilOutput(t, e, 50); line != "" || !timedOut {
+		t.Errorf("quiet machine resolved with %q, timedOut %v; want a timeout", line, timedOut)
+	}
+	if e.getState() != statePaused {
+		t.Errorf("state is %s after the timeout, want paused", e.getState())
+	}
+}
+
+func TestRunUntilOutputOneAtATime(t *testing.T) {
+	e, _ := pausedLines(t, true)
+	untilOutput(t, e, 1000)
+
+	first := e.call(runUntilOutput, 200).(js.Value)
+	wantRejected(t, e.call(runUntilOutput, 200).(js.Value), codeInvalidState)
+	if _, fulfilled := awaitSettled(t, first); !fulfilled {
+		t.Errorf("the call in progress failed once another was refused")
+	}
+	// Free again once the first settles
+	if _, timedOut := untilOutput(t, e, 20); !timedOut {
+		t.Errorf("a later call didn't run to its timeout")
+	}
+
+	e.call(stopEmulator)
+	wantRejected(t, e.call(runUntilOutput, 20).(js.Value), codeNotRunning)
+}
@@ -0,0 +1,88 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// configProblems lists every reason the instance couldn't boot with opts
+// as staged, most fundamental first.
+func (e *Emulator) configProblems(opts options) []error {
+	var problems []error
+	if e.kernel == nil {
+		problems = append(problems, errNoKernel)
+	}
+	problems = append(problems, e.missingImages(opts.requiredImages)...)
+	if err := e.checkBoot(opts.bootMethod); err != nil {
+		problems = append(problems, err)
+	}
+
+	loaded := len(e.initrd) + len(e.dtb)
+	if e.kernel != nil {
+		loaded += len(e.kernel.data)
+	}
+	if opts.bootMethod == bootFirmware {
+		loaded += len(e.firmware)
+	}
+	if ram := opts.ramSizeMB << 20; loaded > ram {
+		problems = append(problems, withCode(codeOutOfMemory, fmt.Errorf("staged images take %d bytes, more than the %d MB of guest RAM", loaded, opts.ramSizeMB)))
+	}
+
+	if e.loopAlive() || e.isStarted() {
+		problems = append(problems, newError(codeAlreadyRunning, "already running"))
+	}
+	return problems
+}
+
+// validateConfig checks, without booting, whether tinyemuStart would
+// succeed, and returns {valid, problems} with problems a list of {code,
+// message}, empty when valid. It looks at what is staged: the kernel, the
+// images requiredImages names, firmware for bootMethod firmware, that the
+// images fit in guest RAM, and that no run is in progress.
+//
+// An optional options object is checked as tinyemuInit would check it and
+// used in place of the instance's for the checks above. Without an
+// instance only such options are checked, including whether their RAM
+// fits the memory cap, and not_initialized is listed too.
+func validateConfig(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 0)
+	if err != nil && errorCode(err) != codeNotInitialized {
+		return errorResult(err)
+	}
+
+	var problems []error
+	if err != nil {
+		problems = append(problems, err)
+	}
+	opts := defaultOptions()
+	if e != nil {
+		opts = e.options
+	}
+	if present(args, 0) {
+		parsed, err := parseOptions(args[0])
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			opts = parsed
+			if e == nil {
+				if err := checkRAMBudget(opts.ramSizeMB, opts.memoryCapMB); err != nil {
+					problems = append(problems, err)
+				}
+			}
+		}
+	}
+	if e != nil {
+		problems = append(problems, e.configProblems(opts)...)
+	}
+
+	list := make([]interface{}, len(problems))
+	for i, p := range problems {
+		list[i] = map[string]interface{}{"code": string(errorCode(p)), "message": p.Error()}
+	}
+	return okResult(map[string]interface{}{
+		"valid":    len(problems) == 0,
+		"problems": list,
+	})
+}
@@ -0,0 +1,109 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+// problemCodes runs tinyemuValidate with args and returns the codes of the
+// problems it lists, checking that valid agrees with them.
+func problemCodes(t *testing.T, args ...js.Value) []string {
+	t.Helper()
+	result := validateConfig(js.Undefined(), args).(map[string]interface{})
+	if failed(result) {
+		t.Fatalf("tinyemuValidate failed: %v", result["error"])
+	}
+	data := result["data"].(map[string]interface{})
+	codes := []string{}
+	for _, p := range data["problems"].([]interface{}) {
+		p := p.(map[string]interface{})
+		if p["message"] == "" {
+			t.Errorf("problem %s has no message", p["code"])
+		}
+		codes = append(codes, p["code"].(string))
+	}
+	if data["valid"] != (len(codes) == 0) {
+		t.Errorf("valid = %v with problems %v", data["valid"], codes)
+	}
+	return codes
+}
+
+func TestValidateAllClear(t *testing.T) {
+	built := 0
+	useMachine(t, func(machineConfig) machine {
+		built++
+		return &testMachine{}
+	})
+	e, _ := newTestEmulator(t, nil)
+	if got := problemCodes(t, js.ValueOf(e.handle)); len(got) != 0 {
+		t.Errorf("a staged kernel with default options listed %v", got)
+	}
+	if built != 0 || e.getState() != stateInitialized {
+		t.Errorf("validating built %d machines and left state %s", built, e.getState())
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	for _, tt := range []struct {
+		name  string
+		opts  map[string]interface{}
+		stage func(t *testing.T, e *Emulator)
+		check map[string]interface{} // options passed to tinyemuValidate
+		want  []string
+	}{
+		{"no kernel", nil, func(t *testing.T, e *Emulator) { e.kernel = nil }, nil,
+			[]string{string(codeNoKernel)}},
+		{"required initrd missing", map[string]interface{}{"requiredImages": []interface{}{"initrd"}}, nil, nil,
+			[]string{string(codeMissingImage)}},
+		{"firmware boot without firmware", map[string]interface{}{"bootMethod": bootFirmware}, nil, nil,
+			[]string{string(codeMissingImage)}},
+		{"images bigger than RAM", nil, func(t *testing.T, e *Emulator) { e.call(loadInitrd, bytesToJS(make([]byte, 2<<20))) },
+			map[string]interface{}{"ramSizeMB": 1}, []string{string(codeOutOfMemory)}},
+		{"cores over the max", nil, nil, map[string]interface{}{"cores": maxCores + 1},
+			[]string{string(codeInvalidArgument)}},
+		{"unknown console device", nil, nil, map[string]interface{}{"consoleDevice": "ttyUSB0"},
+			[]string{string(codeInvalidArgument)}},
+		{"several at once", map[string]interface{}{"bootMethod": bootFirmware, "requiredImages": []interface{}{"initrd"}}, func(t *testing.T, e *Emulator) { e.kernel = nil }, nil,
+			[]string{string(codeNoKernel), string(codeMissingImage), string(codeMissingImage)}},
+		{"already running", nil, func(t *testing.T, e *Emulator) {
+			e.call(startEmulator)
+			waitState(t, e, stateRunning)
+		}, nil, []string{string(codeAlreadyRunning)}},
+	} {
+		// A subtest each, so each instance's RAM is freed before the next
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := newTestEmulator(t, tt.opts)
+			if tt.stage != nil {
+				tt.stage(t, e)
+			}
+			args := []js.Value{js.ValueOf(e.handle)}
+			if tt.check != nil {
+				args = append(args, js.ValueOf(tt.check))
+			}
+			if got := problemCodes(t, args...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWithoutAnInstance(t *testing.T) {
+	withoutInstances(t)
+	if got := problemCodes(t); !reflect.DeepEqual(got, []string{string(codeNotInitialized)}) {
+		t.Errorf("before tinyemuInit problems %v, want only not_initialized", got)
+	}
+	got := problemCodes(t, js.ValueOf(map[string]interface{}{"cores": 0}))
+	if want := []string{string(codeNotInitialized), string(codeInvalidArgument)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bad options before tinyemuInit listed %v, want %v", got, want)
+	}
+	result := validateConfig(js.Undefined(), []js.Value{js.ValueOf(map[string]interface{}{"cores": 0})}).(map[string]interface{})
+	problems := result["data"].(map[string]interface{})["problems"].([]interface{})
+	if msg := problems[1].(map[string]interface{})["message"].(string); !strings.Contains(msg, "cores") {
+		t.Errorf("bad cores listed as %q", msg)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"runtime"
+	"syscall/js"
+)
+
+// version is the TinyEMU WASM module version.
+const version = "0.1.0"
+
+// Build metadata, stamped at link time:
+//
+//	go build -ldflags "-X main.gitCommit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	gitCommit = "unknown"
+	buildTime = "unknown"
+)
+
+// getVersion returns build metadata for bug reports.
+func getVersion(this js.Value, args []js.Value) interface{} {
+	return okResult(map[string]interface{}{
+		"version":   version,
+		"commit":    gitCommit,
+		"goVersion": runtime.Version(),
+		"buildTime": buildTime,
+		"target":    runtime.GOOS + "/" + runtime.GOARCH,
+	})
+}
+
+// getVersionString returns just the short version string.
+func getVersionString(this js.Value, args []js.Value) interface{} {
+	return version
+}
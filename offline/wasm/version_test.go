@@ -0,0 +1,41 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"runtime"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+func TestVersionHasBuildMetadata(t *testing.T) {
+	r := getVersion(js.Undefined(), nil).(map[string]interface{})
+	if failed(r) {
+		t.Fatalf("tinyemuVersion: %v", r["error"])
+	}
+	data := r["data"].(map[string]interface{})
+	for _, key := range []string{"version", "commit", "goVersion", "buildTime", "target"} {
+		v, ok := data[key].(string)
+		if !ok || v == "" {
+			t.Errorf("%s = %#v, want a non-empty string", key, data[key])
+		}
+	}
+	if len(data) != 5 {
+		t.Errorf("tinyemuVersion returned %d keys, want 5: %v", len(data), data)
+	}
+	if data["version"] != version || data["goVersion"] != runtime.Version() || data["target"] != "js/wasm" {
+		t.Errorf("tinyemuVersion = %v", data)
+	}
+	// Test binaries aren't stamped
+	if data["commit"] != "unknown" || data["buildTime"] != "unknown" {
+		t.Errorf("unstamped build reports commit %v, built %v", data["commit"], data["buildTime"])
+	}
+}
+
+func TestVersionStringIsShort(t *testing.T) {
+	got, ok := getVersionString(js.Undefined(), nil).(string)
+	if !ok || got != version || strings.ContainsAny(got, " \n") {
+		t.Errorf("tinyemuVersionString = %#v, want %q", got, version)
+	}
+}
@@ -0,0 +1,133 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// watchdog notices a wedged guest: one that has neither retired an
+// instruction nor written output for a whole interval while not waiting
+// for input. It uses wall time, since a stall is about the page sitting
+// there, not guest time.
+type watchdog struct {
+	mu       sync.Mutex
+	interval time.Duration // 0 disables it
+	progress time.Time     // last retired instruction or output
+	stalled  bool          // onStall fired for the current stall
+	changed  chan struct{} // closed and replaced when interval changes
+}
+
+// set changes the interval and rearms the watchdog.
+func (w *watchdog) set(interval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.interval = interval
+	w.progress = time.Now()
+	w.stalled = false
+	if w.changed != nil {
+		close(w.changed)
+	}
+	w.changed = make(chan struct{})
+}
+
+// kick records progress, ending any stall.
+func (w *watchdog) kick() {
+	w.mu.Lock()
+	w.progress = time.Now()
+	w.stalled = false
+	w.mu.Unlock()
+}
+
+// check reports how long the guest has been stalled if it crossed the
+// interval since the last check. Each stall is reported once.
+func (w *watchdog) check(awaitingInput func(since time.Time) bool) (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.interval == 0 || w.stalled {
+		return 0, false
+	}
+	idle := time.Since(w.progress)
+	if idle < w.interval {
+		return 0, false
+	}
+	if awaitingInput(w.progress) {
+		// Idle at a prompt is not a stall
+		w.progress = time.Now()
+		return 0, false
+	}
+	w.stalled = true
+	return idle, true
+}
+
+// state returns the interval and a channel closed when it next changes.
+func (w *watchdog) state() (time.Duration, <-chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.changed == nil {
+		w.changed = make(chan struct{})
+	}
+	return w.interval, w.changed
+}
+
+// watch runs the watchdog for one run until ctx is canceled, calling
+// onStall with {idleMs} when the guest stalls.
+func (e *Emulator) watch(ctx context.Context) {
+	e.watchdog.kick()
+	for {
+		interval, changed := e.watchdog.state()
+		var tick <-chan time.Time
+		if interval > 0 {
+			// Checking at a quarter of the interval reports a stall at
+			// most 25% late
+			tick = time.After(interval / 4)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			continue
+		case <-tick:
+		}
+
+		if e.getState() == statePaused {
+			e.watchdog.kick()
+			continue
+		}
+		idle, stalled := e.watchdog.check(e.reader.AwaitingInput)
+		if !stalled {
+			continue
+		}
+		e.log.with(e.runFields()).Warnf("guest stalled: no progress for %v", idle.Round(time.Millisecond))
+		if e.options.onStall.Type() == js.TypeFunction {
+			e.options.onStall.Invoke(map[string]interface{}{"idleMs": float64(idle.Milliseconds())})
+		}
+	}
+}
+
+// setWatchdog sets how long the guest may go without progress before
+// onStall fires. 0 disables the watchdog.
+func setWatchdog(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 1)
+	if err != nil {
+		return errorResult(err)
+	}
+	ms, err := numberArg(args, 0, "intervalMs")
+	if err != nil {
+		return errorResult(err)
+	}
+	if ms < 0 {
+		return errResult(codeInvalidArgument, fmt.Sprintf("intervalMs must be >= 0, got %v", ms))
+	}
+
+	e.watchdog.set(time.Duration(ms * float64(time.Millisecond)))
+	return statusResult(statusWatchdogSet, map[string]interface{}{"intervalMs": ms})
+}
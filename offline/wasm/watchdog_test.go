@@ -0,0 +1,94 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// wedgedMachine boots and then never retires an instruction, like a guest
+// spinning with interrupts off. With poll set it reads the console on
+// every step, as a guest at a prompt does.
+type wedgedMachine struct {
+	poll func()
+}
+
+func (m *wedgedMachine) Step(n int) int {
+	if m.poll != nil {
+		m.poll()
+	}
+	return 0
+}
+
+func (m *wedgedMachine) Booted() bool { return true }
+
+// stallRecorder is an onStall callback that passes on the idleMs it gets.
+func stallRecorder(t *testing.T) (js.Value, <-chan float64) {
+	stalls := make(chan float64, 8)
+	fn := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		stalls <- args[0].Get("idleMs").Float()
+		return nil
+	})
+	t.Cleanup(fn.Release)
+	return fn.Value, stalls
+}
+
+func TestWatchdogFiresOnAStalledGuest(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &wedgedMachine{} })
+	onStall, stalls := stallRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onStall": onStall})
+	if result := e.call(setWatchdog, 200).(map[string]interface{}); failed(result) {
+		t.Fatal(result["error"])
+	}
+	e.call(startEmulator)
+
+	select {
+	case idle := <-stalls:
+		if idle < 200 {
+			t.Errorf("onStall got idleMs %v, want at least the 200ms interval", idle)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("onStall didn't fire for a guest retiring nothing")
+	}
+
+	// One stall is reported once, however long it lasts
+	select {
+	case idle := <-stalls:
+		t.Errorf("onStall fired again with idleMs %v for the same stall", idle)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestWatchdogIgnoresAGuestWaitingForInput(t *testing.T) {
+	var e *Emulator
+	useMachine(t, func(machineConfig) machine {
+		return &wedgedMachine{poll: func() { e.reader.Read(make([]byte, 16)) }}
+	})
+	onStall, stalls := stallRecorder(t)
+	e, _ = newTestEmulator(t, map[string]interface{}{"onStall": onStall})
+	e.call(setWatchdog, 200)
+	e.call(startEmulator)
+
+	select {
+	case idle := <-stalls:
+		t.Fatalf("onStall fired with idleMs %v while the guest was polling for input", idle)
+	case <-time.After(time.Second):
+	}
+}
+
+func TestWatchdogZeroDisables(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &wedgedMachine{} })
+	onStall, stalls := stallRecorder(t)
+	e, _ := newTestEmulator(t, map[string]interface{}{"onStall": onStall})
+	e.call(setWatchdog, 200)
+	e.call(setWatchdog, 0)
+	e.call(startEmulator)
+
+	select {
+	case idle := <-stalls:
+		t.Fatalf("onStall fired with idleMs %v with the watchdog disabled", idle)
+	case <-time.After(600 * time.Millisecond):
+	}
+}
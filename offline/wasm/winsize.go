@@ -0,0 +1,64 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// maxWinsizeDim bounds cols and rows to what fits in struct winsize.
+const maxWinsizeDim = 0xffff
+
+// winsize is the guest terminal size reported by TIOCGWINSZ.
+type winsize struct {
+	cols, rows int
+}
+
+// consoleResizer is implemented by machines whose console device can report
+// a window size to the guest and raise SIGWINCH when it changes.
+type consoleResizer interface {
+	Resize(ws winsize)
+}
+
+// defaultWinsize is the terminal size until tinyemuResize is called.
+var defaultWinsize = winsize{cols: 80, rows: 24}
+
+func validateWinsize(cols, rows int) error {
+	if cols < 1 || rows < 1 || cols > maxWinsizeDim || rows > maxWinsizeDim {
+		return fmt.Errorf("cols and rows must be between 1 and %d, got %dx%d", maxWinsizeDim, cols, rows)
+	}
+	return nil
+}
+
+// resizeTerminal accepts (cols, rows). The size is kept on the instance and
+// handed to the machine at boot, so a resize before start is honored.
+func resizeTerminal(this js.Value, args []js.Value) interface{} {
+	e, args, err := lookup(args, 2)
+	if err != nil {
+		return errorResult(err)
+	}
+	cols, err := intArg(args, 0, "cols")
+	if err != nil {
+		return errorResult(err)
+	}
+	rows, err := intArg(args, 1, "rows")
+	if err != nil {
+		return errorResult(err)
+	}
+	ws := winsize{cols: cols, rows: rows}
+	if err := validateWinsize(ws.cols, ws.rows); err != nil {
+		return errorResult(err)
+	}
+
+	e.machineMu.Lock()
+	changed := ws != e.winsize
+	e.winsize = ws
+	if r, ok := e.machine.(consoleResizer); ok && changed {
+		r.Resize(ws)
+	}
+	e.machineMu.Unlock()
+	e.writer.SetSize(ws)
+
+	return statusResult(statusResized, map[string]interface{}{"cols": ws.cols, "rows": ws.rows})
+}
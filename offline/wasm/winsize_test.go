@@ -0,0 +1,78 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// resizingMachine records the window size it boots with and every resize
+// the console device would raise SIGWINCH for.
+type resizingMachine struct {
+	testMachine
+	booted  winsize
+	resizes []winsize
+}
+
+func (m *resizingMachine) Resize(ws winsize) { m.resizes = append(m.resizes, ws) }
+
+func TestResizeBeforeStartIsUsedAtBoot(t *testing.T) {
+	var m *resizingMachine
+	useMachine(t, func(config machineConfig) machine {
+		m = &resizingMachine{booted: config.winsize}
+		return m
+	})
+	e, _ := newTestEmulator(t, nil)
+	if got := statusOf(e.call(resizeTerminal, 132, 43)); got != string(statusResized) {
+		t.Fatalf("tinyemuResize = %s", got)
+	}
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if want := (winsize{cols: 132, rows: 43}); m.booted != want {
+		t.Errorf("machine booted with %+v, want %+v", m.booted, want)
+	}
+	if len(m.resizes) != 0 {
+		t.Errorf("resize before start raised %v on the running machine", m.resizes)
+	}
+}
+
+func TestResizeWhileRunningUpdatesWinsize(t *testing.T) {
+	var m *resizingMachine
+	useMachine(t, func(config machineConfig) machine {
+		m = &resizingMachine{booted: config.winsize}
+		return m
+	})
+	e, _ := newTestEmulator(t, nil)
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	if m.booted != defaultWinsize {
+		t.Errorf("machine booted with %+v, want the default %+v", m.booted, defaultWinsize)
+	}
+
+	e.call(resizeTerminal, 100, 30)
+	e.call(resizeTerminal, 100, 30) // unchanged, so no SIGWINCH
+	e.call(resizeTerminal, 100, 31)
+
+	e.machineMu.Lock()
+	got := m.resizes
+	e.machineMu.Unlock()
+	if want := []winsize{{100, 30}, {100, 31}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("machine was resized to %v, want %v", got, want)
+	}
+	if e.winsize != (winsize{100, 31}) {
+		t.Errorf("instance keeps %+v, want the last size", e.winsize)
+	}
+}
+
+func TestResizeRejectsBadSizes(t *testing.T) {
+	e, _ := newTestEmulator(t, nil)
+	for _, size := range [][2]interface{}{{0, 24}, {80, 0}, {-80, 24}, {maxWinsizeDim + 1, 24}, {80.5, 24}, {"80", 24}} {
+		if got := statusOf(e.call(resizeTerminal, size[0], size[1])); got != string(codeInvalidArgument) {
+			t.Errorf("tinyemuResize(%v, %v) = %s, want invalid_argument", size[0], size[1], got)
+		}
+	}
+	if e.winsize != defaultWinsize {
+		t.Errorf("rejected sizes left the instance at %+v", e.winsize)
+	}
+}
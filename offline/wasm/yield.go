@@ -0,0 +1,147 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// yieldBudget is how long the run loop may step back to back before it
+// hands control to the browser, set by the yieldInstructions and
+// yieldIntervalMs options. With neither set the loop pauses stepInterval
+// after every step instead.
+type yieldBudget struct {
+	instructions int           // 0 for no instruction budget
+	interval     time.Duration // 0 for no time budget
+	// scheduler is called with a callback to run once the browser has had
+	// its turn; undefined means setTimeout(callback, 0).
+	scheduler js.Value
+}
+
+// enabled reports whether the run loop yields by budget.
+func (b yieldBudget) enabled() bool {
+	return b.instructions > 0 || b.interval > 0
+}
+
+// yieldOption reads the yieldInstructions, yieldIntervalMs and
+// yieldScheduler options into opts.
+func yieldOption(v js.Value, opts *options) error {
+	if n := v.Get("yieldInstructions"); !n.IsUndefined() && !n.IsNull() {
+		if n.Type() != js.TypeNumber {
+			return fmt.Errorf("yieldInstructions must be a number, got %s", n.Type())
+		}
+		if f := n.Float(); f != math.Trunc(f) || f < 1 || f > 1<<31 {
+			return fmt.Errorf("yieldInstructions must be a whole number between 1 and %d, got %v", 1<<31, f)
+		}
+		opts.yield.instructions = n.Int()
+	}
+	if ms := v.Get("yieldIntervalMs"); !ms.IsUndefined() && !ms.IsNull() {
+		if ms.Type() != js.TypeNumber {
+			return fmt.Errorf("yieldIntervalMs must be a number, got %s", ms.Type())
+		}
+		if f := ms.Float(); !(f > 0) || math.IsInf(f, 0) {
+			return fmt.Errorf("yieldIntervalMs must be positive, got %v", f)
+		}
+		opts.yield.interval = time.Duration(ms.Float() * float64(time.Millisecond))
+	}
+
+	var err error
+	if opts.yield.scheduler, err = callbackOption(v, "yieldScheduler"); err != nil {
+		return err
+	}
+	if opts.yield.scheduler.Type() == js.TypeFunction && !opts.yield.enabled() {
+		return fmt.Errorf("yieldScheduler needs yieldInstructions or yieldIntervalMs")
+	}
+	return nil
+}
+
+// yielder spends a yieldBudget across steps.
+type yielder struct {
+	budget  yieldBudget
+	retired int
+	since   time.Time
+}
+
+// reset starts a new budget at now.
+func (y *yielder) reset(now time.Time) {
+	y.retired, y.since = 0, now
+}
+
+// due adds retired instructions and reports whether the budget is spent.
+func (y *yielder) due(retired int, now time.Time) bool {
+	y.retired += retired
+	return (y.budget.instructions > 0 && y.retired >= y.budget.instructions) ||
+		(y.budget.interval > 0 && now.Sub(y.since) >= y.budget.interval)
+}
+
+// oneShot wraps the function f so that it is called at most once. The
+// wrapper drops f before calling it, and its cancel method drops f
+// without calling it, so once either has run a scheduler can call the
+// wrapper again, or late, without reaching a released js.Func.
+var oneShot = js.Global().Get("Function").New("f", `
+	const once = function () { const g = f; f = null; if (g) g(); };
+	once.cancel = function () { f = null; };
+	return once;`)
+
+// waker returns a callback for a scheduler that sends on woken the first
+// time it is called, unless woken is already full, and a func that
+// disarms it. Either releases the Go func behind it, once nothing can call
+// it any more.
+func waker(woken chan<- struct{}) (js.Value, func()) {
+	var once sync.Once
+	var fn js.Func
+	fn = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		once.Do(func() {
+			fn.Release()
+			select {
+			case woken <- struct{}{}:
+			default:
+			}
+		})
+		return nil
+	})
+	wake := oneShot.Invoke(fn)
+	return wake, func() {
+		wake.Call("cancel")
+		once.Do(fn.Release)
+	}
+}
+
+// yield waits for the scheduler to call back, which takes a trip through
+// the browser event loop, and reports false if ctx is canceled first. A
+// scheduler that throws is logged and replaced by setTimeout.
+func (e *Emulator) yield(ctx context.Context) bool {
+	defer func() { e.yielder.reset(e.clock.Now()) }()
+
+	woken := make(chan struct{}, 1)
+	wake, cancel := waker(woken)
+
+	scheduler := e.yielder.budget.scheduler
+	if scheduler.Type() == js.TypeFunction {
+		if err := safeInvoke(scheduler, wake); err != nil {
+			e.log.Warnf("yieldScheduler threw, using setTimeout: %v", err)
+			e.yielder.budget.scheduler = js.Undefined()
+			scheduler = js.Undefined()
+			// It may have queued wake before throwing, so setTimeout gets a
+			// callback of its own
+			cancel()
+			wake, cancel = waker(woken)
+		}
+	}
+	if scheduler.Type() != js.TypeFunction {
+		js.Global().Call("setTimeout", wake, 0)
+	}
+
+	select {
+	case <-woken:
+		return true
+	case <-ctx.Done():
+		cancel()
+		return false
+	}
+}
@@ -0,0 +1,195 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// yieldSteps runs an instance created with opts and a yieldScheduler
+// until the loop has yielded n times, and returns how many steps the
+// machine had taken at each yield.
+func yieldSteps(t *testing.T, opts map[string]interface{}, n int) []int {
+	t.Helper()
+	m := &testMachine{}
+	useMachine(t, func(machineConfig) machine { return m })
+	yields := make(chan int, n)
+	scheduler := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		// Called on the run loop between steps, so m.steps is settled
+		if len(yields) < n {
+			yields <- m.steps
+		}
+		js.Global().Call("setTimeout", args[0], 0)
+		return nil
+	})
+	t.Cleanup(scheduler.Release)
+	opts["yieldScheduler"] = scheduler
+
+	e, _ := newTestEmulator(t, opts)
+	start := time.Now()
+	e.call(startEmulator)
+	var got []int
+	for len(got) < n {
+		select {
+		case s := <-yields:
+			got = append(got, s)
+		case <-time.After(time.Second):
+			t.Fatalf("options %v: the loop yielded %d times, want %d", opts, len(got), n)
+		}
+	}
+	e.call(stopEmulator)
+	// Between yields the loop steps back to back instead of resting
+	if elapsed := time.Since(start); elapsed > 3*stepInterval {
+		t.Errorf("options %v: %d steps took %v", opts, got[n-1], elapsed)
+	}
+	return got
+}
+
+func TestLoopYieldsEveryInstructionBudget(t *testing.T) {
+	for _, tt := range []struct {
+		budget int
+		want   []int
+	}{
+		{stepInstructions, []int{1, 2, 3, 4}},
+		{3 * stepInstructions, []int{3, 6, 9, 12}},
+		// A budget ends with the step that spends it
+		{2*stepInstructions + 1, []int{3, 6, 9, 12}},
+	} {
+		if got := yieldSteps(t, map[string]interface{}{"yieldInstructions": tt.budget}, 4); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("yieldInstructions %d: yielded after steps %v, want %v", tt.budget, got, tt.want)
+		}
+	}
+}
+
+func TestLoopYieldsEveryInterval(t *testing.T) {
+	// In virtual time a step of stepInstructions takes 10µs
+	opts := map[string]interface{}{"yieldIntervalMs": 0.05, "deterministic": true}
+	if got, want := yieldSteps(t, opts, 3), []int{5, 10, 15}; !reflect.DeepEqual(got, want) {
+		t.Errorf("yieldIntervalMs 0.05: yielded after steps %v, want %v", got, want)
+	}
+}
+
+func TestThrowingYieldSchedulerFallsBack(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	log := newLogRecorder(t)
+	throws := js.Global().Get("Function").New("throw new Error('no scheduler here')")
+	e, _ := newTestEmulator(t, map[string]interface{}{
+		"yieldInstructions": stepInstructions,
+		"yieldScheduler":    throws,
+		"onLog":             log.fn,
+	})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	time.Sleep(3 * stepInterval)
+	e.call(pauseEmulator)
+
+	if got := statsData(t, e)["instructions"].(float64); got < 10*stepInstructions {
+		t.Errorf("the loop ran %.0f instructions with setTimeout in place of the scheduler", got)
+	}
+	warned := 0
+	for _, line := range log.lines {
+		if strings.Contains(line, "yieldScheduler threw") {
+			warned++
+		}
+	}
+	if warned != 1 {
+		t.Errorf("the throwing scheduler was logged %d times, want once: %q", warned, log.lines)
+	}
+}
+
+// consoleErrors collects what is passed to console.error until the test
+// ends, which is where syscall/js reports a call to a released function.
+func consoleErrors(t *testing.T) js.Value {
+	errs := js.Global().Get("Array").New()
+	console := js.Global().Get("console")
+	prev := console.Get("error")
+	console.Set("error", js.Global().Get("Function").New("errs", "return (...a) => { errs.push(a.join(' ')); };").Invoke(errs))
+	t.Cleanup(func() { console.Set("error", prev) })
+	return errs
+}
+
+func TestMisbehavingYieldSchedulers(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	for _, tt := range []struct {
+		name, body string
+	}{
+		{"queues the callback and throws", "setTimeout(cb, 0); throw new Error('half done');"},
+		{"calls back at once and later", "cb(); setTimeout(cb, 0);"},
+		{"calls back twice later", "setTimeout(cb, 0); setTimeout(cb, 1);"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := consoleErrors(t)
+			e, _ := newTestEmulator(t, map[string]interface{}{
+				"yieldInstructions": stepInstructions,
+				"yieldScheduler":    js.Global().Get("Function").New("cb", tt.body),
+				"onLog":             newLogRecorder(t).fn,
+			})
+			e.call(startEmulator)
+			waitState(t, e, stateRunning)
+			time.Sleep(3 * stepInterval)
+			e.call(stopEmulator)
+			// Leave time for the late calls to arrive
+			time.Sleep(10 * time.Millisecond)
+
+			if got := statsData(t, e)["instructions"].(float64); got < 10*stepInstructions {
+				t.Errorf("the loop ran %.0f instructions", got)
+			}
+			if n := errs.Length(); n > 0 {
+				t.Errorf("console.error got %d calls, the first %q", n, errs.Index(0).String())
+			}
+		})
+	}
+}
+
+func TestStopDisarmsAPendingYield(t *testing.T) {
+	useMachine(t, func(machineConfig) machine { return &testMachine{} })
+	errs := consoleErrors(t)
+	// Keeps the callback and never calls it, so the loop waits at the first
+	// yield until stopped
+	held := js.Global().Get("Array").New()
+	e, _ := newTestEmulator(t, map[string]interface{}{
+		"yieldInstructions": stepInstructions,
+		"yieldScheduler":    js.Global().Get("Function").New("held", "return (cb) => { held.push(cb); };").Invoke(held),
+	})
+	e.call(startEmulator)
+	waitState(t, e, stateRunning)
+	deadline := time.Now().Add(time.Second)
+	for held.Length() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the loop never yielded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	e.call(stopEmulator)
+
+	// Called after the loop gave up on it, it does nothing
+	held.Index(0).Invoke()
+	if held.Length() != 1 {
+		t.Errorf("the loop yielded %d times without being called back", held.Length())
+	}
+	if n := errs.Length(); n > 0 {
+		t.Errorf("calling the stale callback logged %q", errs.Index(0).String())
+	}
+}
+
+func TestYieldOptionsAreChecked(t *testing.T) {
+	scheduler := js.FuncOf(func(this js.Value, args []js.Value) interface{} { return nil })
+	t.Cleanup(scheduler.Release)
+	for _, bad := range []map[string]interface{}{
+		{"yieldInstructions": 0},
+		{"yieldInstructions": 1.5},
+		{"yieldInstructions": "1000"},
+		{"yieldIntervalMs": 0},
+		{"yieldIntervalMs": -4},
+		{"yieldScheduler": scheduler}, // without a budget to schedule
+		{"yieldInstructions": 1000, "yieldScheduler": 7},
+	} {
+		if msg := initError(t, bad); !strings.Contains(msg, "yield") {
+			t.Errorf("options %v: error %q isn't about yielding", bad, msg)
+		}
+	}
+}
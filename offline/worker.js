@@ -11,6 +11,27 @@ importScripts('assets/wasm_exec.js');
 // State
 let emulatorInitialized = false;
 let emulatorRunning = false;
+let emulatorHandle = null;
+
+/**
+ * Unwrap a {ok, data, error} result from a tinyemu* call, throwing its
+ * error so the handler's catch posts it back
+ */
+function check(result) {
+    if (!result || !result.ok) {
+        const error = new Error(result && result.error ? result.error.message : 'no result');
+        error.code = result && result.error ? result.error.code : 'unknown';
+        throw error;
+    }
+    return result.data;
+}
+
+/**
+ * Post a failed request back to the main thread
+ */
+function postError(request, error) {
+    postMessage({ type: 'error', request, error: error.message, code: error.code });
+}
 
 // Message handlers
 const handlers = {
@@ -35,21 +56,52 @@ const handlers = {
             await new Promise(resolve => setTimeout(resolve, 100));
             
             // Initialize the emulator with console callback
-            if (typeof tinyemuInit === 'function') {
-                tinyemuInit((output) => {
-                    postMessage({ type: 'output', data: output });
-                });
+            if (typeof tinyemuInit !== 'function') {
+                throw new Error('tinyemu.wasm did not register tinyemuInit');
             }
+            const init = check(tinyemuInit((output) => {
+                postMessage({ type: 'output', data: output });
+            }, data.options));
             
+            emulatorHandle = init.handle;
             emulatorInitialized = true;
             postMessage({ type: 'status', status: 'ready' });
             postMessage({ 
                 type: 'init_complete',
-                version: typeof tinyemuVersion === 'function' ? tinyemuVersion() : 'unknown'
+                version: typeof tinyemuVersionString === 'function' ? tinyemuVersionString() : 'unknown'
             });
             
         } catch (error) {
-            postMessage({ type: 'error', error: error.message });
+            postError('init', error);
+        }
+    },
+    
+    /**
+     * Load the kernel for the next start, either as bytes the main thread
+     * fetched ({kernel}) or from a URL fetched here ({url})
+     */
+    async loadKernel(data) {
+        if (!emulatorInitialized) {
+            postMessage({ type: 'error', request: 'loadKernel', error: 'Emulator not initialized' });
+            return;
+        }
+        
+        try {
+            postMessage({ type: 'status', status: 'loading_kernel' });
+            
+            let kernel;
+            if (data.url) {
+                // Resolves with the result's data, or rejects with an
+                // Error carrying its code
+                kernel = await tinyemuLoadKernelFromURL(emulatorHandle, data.url, data.options);
+            } else {
+                kernel = check(tinyemuLoadKernel(emulatorHandle, data.kernel, data.options));
+            }
+            
+            postMessage({ type: 'kernel_loaded', ...kernel });
+            
+        } catch (error) {
+            postError('loadKernel', error);
         }
     },
     
@@ -63,23 +115,21 @@ const handlers = {
         }
         
         if (emulatorRunning) {
-            postMessage({ type: 'error', error: 'Emulator already running' });
+            postMessage({ type: 'error', request: 'start', error: 'Emulator already running' });
             return;
         }
         
         try {
             postMessage({ type: 'status', status: 'booting' });
             
-            if (typeof tinyemuStart === 'function') {
-                tinyemuStart();
-            }
+            check(tinyemuStart(emulatorHandle));
             
             emulatorRunning = true;
             postMessage({ type: 'status', status: 'running' });
             postMessage({ type: 'start_complete' });
             
         } catch (error) {
-            postMessage({ type: 'error', error: error.message });
+            postError('start', error);
         }
     },
     
@@ -92,16 +142,14 @@ const handlers = {
         }
         
         try {
-            if (typeof tinyemuStop === 'function') {
-                tinyemuStop();
-            }
+            check(tinyemuStop(emulatorHandle));
             
             emulatorRunning = false;
             postMessage({ type: 'status', status: 'stopped' });
             postMessage({ type: 'stop_complete' });
             
         } catch (error) {
-            postMessage({ type: 'error', error: error.message });
+            postError('stop', error);
         }
     },
     
@@ -113,8 +161,10 @@ const handlers = {
             return;
         }
         
-        if (typeof tinyemuSendInput === 'function') {
-            tinyemuSendInput(data.text);
+        try {
+            check(tinyemuSendInput(emulatorHandle, data.text));
+        } catch (error) {
+            postError('input', error);
         }
     },
     
@@ -129,9 +179,13 @@ const handlers = {
         // The LLM response is formatted as an OSC escape sequence
         // and written to the emulator's console input
         const { LLMProtocol } = self;
-        if (LLMProtocol && typeof tinyemuSendInput === 'function') {
+        if (LLMProtocol) {
             const message = LLMProtocol.encodeMessage(data.messageType, data.payload);
-            tinyemuSendInput(message);
+            try {
+                check(tinyemuSendInput(emulatorHandle, message));
+            } catch (error) {
+                postError('llmResponse', error);
+            }
         }
     },
     
@@ -143,7 +197,7 @@ const handlers = {
             type: 'status_response',
             initialized: emulatorInitialized,
             running: emulatorRunning,
-            version: typeof tinyemuVersion === 'function' ? tinyemuVersion() : 'unknown'
+            version: typeof tinyemuVersionString === 'function' ? tinyemuVersionString() : 'unknown'
         });
     }
 };